@@ -0,0 +1,424 @@
+package mustache
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// Node is a node of the parse tree of a template, as returned by Nodes and
+// visited by Walk. It is one of *TextNode, *VarNode, *CoalesceNode,
+// *TranslateNode, *SectionNode, *FunctionNode, *PartialNode, *CommentNode or
+// *ConstNode.
+//
+// Nodes are a copy of the parse tree, so modifying them does not affect the
+// template.
+type Node interface {
+	// Range returns the range of the node in the source of the template.
+	Range() Span
+	isNode()
+}
+
+// Span is a range of bytes in the source of a template, End being exclusive,
+// so that the source of a node n is src[n.Range().Start:n.Range().End]. The
+// span of a tag includes its delimiters, and the span of a section extends
+// from its opening tag to its closing tag.
+//
+// Spans are only recorded for parsed templates. The nodes of templates built
+// with a Builder have empty spans.
+type Span struct {
+	Start, End int
+}
+
+// Range returns s. Embedded in the nodes, it implements Node.Range.
+func (s Span) Range() Span {
+	return s
+}
+
+// TextNode is literal text.
+type TextNode struct {
+	Text string
+	Span
+}
+
+// VarNode is a variable tag such as {{name}} or {{{name}}}. Line and Col are
+// the position of the start of the tag.
+type VarNode struct {
+	Name      string
+	Unescaped bool
+	Filters   []Filter // the stages of {{name | trim | upper}}, with FilterPipes
+	Format    string   // the format option of {{name format="Jan 2"}}, with TimeFormat or DurationFormat
+	Line, Col int
+	Span
+}
+
+// Filter is a stage of a variable tag with filters, calling the customizer
+// function Name with the positional arguments Args.
+type Filter struct {
+	Name string
+	Args []string
+}
+
+// TranslateNode is a {{_ "key" count=n}} tag. Args holds the bindings of the
+// arguments as written, e.g. `count=n`.
+type TranslateNode struct {
+	Key       string
+	Args      []string
+	Unescaped bool
+	Span
+}
+
+// CoalesceNode is a {{coalesce a b "c"}} tag. Args holds the identifiers and
+// literals as written, literals with their quotes.
+type CoalesceNode struct {
+	Args      []string
+	Unescaped bool
+	Span
+}
+
+// SectionNode is a section such as {{#items}}...{{/items}}. For the sections
+// enabled by options, Kind is the keyword of the section, e.g. "switch",
+// "is_list" or "let", and Args holds the arguments following the name. For
+// plain sections Kind is empty, and Args holds the offset and limit arguments
+// of paginated sections.
+type SectionNode struct {
+	Kind     string
+	Name     string
+	Args     []string
+	Inverted bool
+	Children []Node
+	Span
+	Body Span // the range of the children
+}
+
+// FunctionNode is a function section such as {{~date tz="UTC"}}...{{/date}}.
+// Options whose value is looked up are given as written, e.g. "{{user.tz}}".
+type FunctionNode struct {
+	Name     string
+	Args     []string // the positional arguments, e.g. ", " for {{~join ", "}}
+	Options  map[string]string
+	Children []Node
+	Span
+	Body Span // the range of the children
+}
+
+// PartialNode is a partial tag such as {{>header}}.
+type PartialNode struct {
+	Name string
+	Span
+}
+
+// CommentNode is a comment tag such as {{! note }}.
+type CommentNode struct {
+	Text string
+	Span
+}
+
+// ConstNode is a constant definition such as {{=const name "value"}}.
+type ConstNode struct {
+	Name  string
+	Value string
+	Span
+}
+
+func (*TextNode) isNode()      {}
+func (*VarNode) isNode()       {}
+func (*CoalesceNode) isNode()  {}
+func (*TranslateNode) isNode() {}
+func (*SectionNode) isNode()   {}
+func (*FunctionNode) isNode()  {}
+func (*PartialNode) isNode()   {}
+func (*CommentNode) isNode()   {}
+func (*ConstNode) isNode()     {}
+
+// Nodes returns the parse tree of the template.
+func (t *Template) Nodes() []Node {
+	return exportNodes(t, t.elems, 0)
+}
+
+// Walk visits the parse tree of the template depth first, calling fn for each
+// node. If fn returns false, the children of the node are not visited.
+func (t *Template) Walk(fn func(Node) bool) {
+	Walk(t.Nodes(), fn)
+}
+
+// Walk visits nodes and their children depth first, calling fn for each node.
+// If fn returns false, the children of the node are not visited.
+func Walk(nodes []Node, fn func(Node) bool) {
+	for _, n := range nodes {
+		if !fn(n) {
+			continue
+		}
+		switch n := n.(type) {
+		case *SectionNode:
+			Walk(n.Children, fn)
+		case *FunctionNode:
+			Walk(n.Children, fn)
+		}
+	}
+}
+
+// exportNodes returns the public nodes of nodes, the first of which starts at
+// the byte offset pos. Text nodes do not record their range, which is instead
+// derived from the nodes preceding them.
+func exportNodes(t *Template, nodes []node, pos int) []Node {
+	var out []Node
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case textNode:
+			out = append(out, &TextNode{Text: string(n), Span: Span{pos, pos + len(n)}})
+			pos += len(n)
+		case delimNode:
+			pos += len(n)
+		case trimNode:
+			pos += len(n)
+		default:
+			if e := exportNode(t, n); e != nil {
+				out = append(out, e)
+			}
+			if s, ok := n.(spanned); ok {
+				pos = s.nodeSpans().outer.end
+			}
+		}
+	}
+	return out
+}
+
+// exportSpans returns the public ranges of s.
+func exportSpans(s spans) (outer, inner Span) {
+	return Span{s.outer.start, s.outer.end}, Span{s.inner.start, s.inner.end}
+}
+
+func exportNode(t *Template, n node) Node {
+	s, ok := n.(spanned)
+	if !ok {
+		return nil
+	}
+	outer, inner := exportSpans(s.nodeSpans())
+	section := func(kind, name string, args []string, inverted bool, elems []node) *SectionNode {
+		return &SectionNode{
+			Kind:     kind,
+			Name:     name,
+			Args:     args,
+			Inverted: inverted,
+			Children: exportNodes(t, elems, inner.Start),
+			Span:     outer,
+			Body:     inner,
+		}
+	}
+	switch n := n.(type) {
+	case *varNode:
+		var filters []Filter
+		for _, f := range n.filters {
+			filters = append(filters, Filter{Name: f.name, Args: f.args})
+		}
+		return &VarNode{Name: n.name, Unescaped: n.escape == noEscape, Filters: filters, Format: n.format, Line: n.line, Col: n.col, Span: outer}
+	case *coalesceNode:
+		args := make([]string, len(n.args))
+		for i, arg := range n.args {
+			args[i] = arg.ident
+			if arg.path == nil {
+				args[i] = strconv.Quote(arg.literal)
+			}
+		}
+		return &CoalesceNode{Args: args, Unescaped: n.escape == noEscape, Span: outer}
+	case *translateNode:
+		return &TranslateNode{Key: n.key, Args: bindingStrings(n.args), Unescaped: n.escape == noEscape, Span: outer}
+	case *sectionNode:
+		var args []string
+		if n.offset > 0 {
+			args = append(args, "offset="+strconv.Quote(strconv.Itoa(n.offset)))
+		}
+		if n.limit > 0 {
+			args = append(args, "limit="+strconv.Quote(strconv.Itoa(n.limit)))
+		}
+		return section("", n.name, args, n.inverted, n.elems)
+	case *functionSectionNode:
+		var opts map[string]string
+		if len(n.opts)+len(n.optPaths)+len(n.optParts) > 0 {
+			opts = make(map[string]string, len(n.opts)+len(n.optPaths)+len(n.optParts))
+			for k, v := range n.opts {
+				opts[k] = v
+			}
+			for k, path := range n.optPaths {
+				opts[k] = t.startDelim + pathString(path) + t.endDelim
+			}
+			for k, parts := range n.optParts {
+				opts[k] = optionSource(parts, t.startDelim, t.endDelim)
+			}
+		}
+		return &FunctionNode{Name: n.name, Args: n.args, Options: opts, Children: exportNodes(t, n.elems, inner.Start), Span: outer, Body: inner}
+	case *testNode:
+		return section("test_value", pathString(n.testIdentPath), []string{strconv.Quote(n.testVal)}, false, n.elems)
+	case *typeTestNode:
+		return section(n.kind, n.name, nil, n.inverted, n.elems)
+	case *countNode:
+		return section(n.kind, n.name, []string{strconv.Itoa(n.count)}, n.inverted, n.elems)
+	case *chunkNode:
+		return section("chunk", n.name, []string{strconv.Itoa(n.size)}, false, n.elems)
+	case *zipNode:
+		args := []string{n.idents[1], "as=" + strconv.Quote(n.names[0][1:]+" "+n.names[1][1:])}
+		return section("zip", n.idents[0], args, false, n.elems)
+	case *switchNode:
+		var cases []Node
+		for i, value := range n.values {
+			var s spans
+			if i < len(n.caseSpans) {
+				s = n.caseSpans[i]
+			}
+			cases = append(cases, exportCase("case", strconv.Quote(value), t, n.cases[value], s))
+		}
+		if n.hasDefault {
+			cases = append(cases, exportCase("default", "", t, n.defaultElems, n.defaultSpans))
+		}
+		return &SectionNode{Kind: "switch", Name: n.name, Children: cases, Span: outer, Body: inner}
+	case *letNode:
+		return section("let", "", bindingStrings(n.bindings), false, n.elems)
+	case *captureNode:
+		return section("capture", n.name, nil, false, n.elems)
+	case *partialNode:
+		return &PartialNode{Name: n.name, Span: outer}
+	case *verbatimNode:
+		// The content of a raw block is text, and its range excludes the
+		// tags of the block.
+		return &TextNode{Text: n.text, Span: inner}
+	case *commentNode:
+		return &CommentNode{Text: n.text, Span: outer}
+	case *constNode:
+		return &ConstNode{Name: n.name, Value: t.consts[n.name], Span: outer}
+	}
+	return nil
+}
+
+// plainArgRe matches the arguments of filters written without quotes.
+var plainArgRe = regexp.MustCompile(`^[\w-]+$`)
+
+// bindingStrings returns the bindings as written, e.g. `label="Total"` or
+// `total=order.total | money "EUR"`.
+func bindingStrings(bindings []letBinding) []string {
+	args := make([]string, len(bindings))
+	for i, b := range bindings {
+		value := b.ident
+		if b.path == nil {
+			value = strconv.Quote(b.literal)
+		}
+		for _, f := range b.filters {
+			value += " | " + f.name
+			for _, arg := range f.args {
+				if !plainArgRe.MatchString(arg) {
+					arg = `"` + optionEscaper.Replace(arg) + `"`
+				}
+				value += " " + arg
+			}
+		}
+		args[i] = b.name + "=" + value
+	}
+	return args
+}
+
+// exportCase returns the public node of a case of a switch.
+func exportCase(kind, name string, t *Template, elems []node, s spans) Node {
+	outer, inner := exportSpans(s)
+	return &SectionNode{Kind: kind, Name: name, Children: exportNodes(t, elems, inner.Start), Span: outer, Body: inner}
+}
+
+// NodeType identifies the type of a Node in a NodeQuery.
+type NodeType int
+
+// The types of nodes.
+const (
+	AnyNode NodeType = iota
+	TextNodeType
+	VarNodeType
+	CoalesceNodeType
+	SectionNodeType
+	FunctionNodeType
+	PartialNodeType
+	CommentNodeType
+	ConstNodeType
+	TranslateNodeType
+)
+
+// NodeQuery selects nodes of a parse tree. A node matches if it matches all of
+// the non-zero fields of the query.
+type NodeQuery struct {
+	Type     NodeType        // the type of the node
+	Name     string          // the name of a variable, section, function, partial or constant, or the key of a translation
+	MinDepth int             // the minimum number of enclosing sections and functions
+	Match    func(Node) bool // an additional predicate
+}
+
+// NodeRef is a node found by Find along with its position in the tree.
+type NodeRef struct {
+	Node Node
+	// Parents holds the enclosing sections and functions, outermost first.
+	Parents []Node
+}
+
+// Depth returns the number of sections and functions enclosing the node.
+func (r NodeRef) Depth() int {
+	return len(r.Parents)
+}
+
+// Find returns the nodes of the parse tree of t matching query, in depth first
+// order. For example, all references to the partial header are found with
+//
+//	mustache.Find(t, mustache.NodeQuery{Type: mustache.PartialNodeType, Name: "header"})
+func Find(t *Template, query NodeQuery) []NodeRef {
+	var refs []NodeRef
+	var find func(nodes []Node, parents []Node)
+	find = func(nodes []Node, parents []Node) {
+		for _, n := range nodes {
+			if query.matches(n, len(parents)) {
+				refs = append(refs, NodeRef{Node: n, Parents: append([]Node(nil), parents...)})
+			}
+			switch c := n.(type) {
+			case *SectionNode:
+				find(c.Children, append(parents, n))
+			case *FunctionNode:
+				find(c.Children, append(parents, n))
+			}
+		}
+	}
+	find(t.Nodes(), nil)
+	return refs
+}
+
+func (q NodeQuery) matches(n Node, depth int) bool {
+	typ, name := describeNode(n)
+	switch {
+	case q.Type != AnyNode && q.Type != typ:
+		return false
+	case q.Name != "" && q.Name != name:
+		return false
+	case depth < q.MinDepth:
+		return false
+	case q.Match != nil && !q.Match(n):
+		return false
+	}
+	return true
+}
+
+// describeNode returns the type and name of n.
+func describeNode(n Node) (NodeType, string) {
+	switch n := n.(type) {
+	case *TextNode:
+		return TextNodeType, ""
+	case *VarNode:
+		return VarNodeType, n.Name
+	case *CoalesceNode:
+		return CoalesceNodeType, ""
+	case *TranslateNode:
+		return TranslateNodeType, n.Key
+	case *SectionNode:
+		return SectionNodeType, n.Name
+	case *FunctionNode:
+		return FunctionNodeType, n.Name
+	case *PartialNode:
+		return PartialNodeType, n.Name
+	case *CommentNode:
+		return CommentNodeType, ""
+	case *ConstNode:
+		return ConstNodeType, n.Name
+	}
+	return AnyNode, ""
+}
@@ -0,0 +1,189 @@
+package mustache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNodes(t *testing.T) {
+	same := func(s string) (string, error) { return s, nil }
+	template := New(SwitchSections(), LetSections(), CoalesceTags(), PaginateSections(), FilterPipes(), Translate(messages{}), TimeFormat(time.Kitchen),
+		CustomizeFunction("upper", same), CustomizeFunction("truncate", same))
+	err := template.ParseString(`{{=const c "v"}}Hi {{{name}}}{{! note }}{{#items offset="1"}}{{.}}{{/items}}` +
+		`{{#switch kind}}{{#case "a"}}A{{/case}}{{#default}}D{{/default}}{{/switch}}` +
+		`{{#let x=a.b y="z"}}{{coalesce x "none"}}{{/let}}{{~f ", " opt="1" tz={{user.tz}}}}{{>p}}{{/f}}` +
+		`{{title | upper | truncate 5 "..."}}{{_ "cart" n=cart.size}}{{at format="Jan 2"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := template.Nodes()
+	// Positions are tested by TestSpans.
+	Walk(nodes, func(n Node) bool {
+		switch n := n.(type) {
+		case *TextNode:
+			n.Span = Span{}
+		case *VarNode:
+			n.Line, n.Col, n.Span = 0, 0, Span{}
+		case *CoalesceNode:
+			n.Span = Span{}
+		case *TranslateNode:
+			n.Span = Span{}
+		case *SectionNode:
+			n.Span, n.Body = Span{}, Span{}
+		case *FunctionNode:
+			n.Span, n.Body = Span{}, Span{}
+		case *PartialNode:
+			n.Span = Span{}
+		case *CommentNode:
+			n.Span = Span{}
+		case *ConstNode:
+			n.Span = Span{}
+		}
+		return true
+	})
+	expected := []Node{
+		&ConstNode{Name: "c", Value: "v"},
+		&TextNode{Text: "Hi "},
+		&VarNode{Name: "name", Unescaped: true},
+		&CommentNode{Text: " note "},
+		&SectionNode{Name: "items", Args: []string{`offset="1"`}, Children: []Node{&VarNode{Name: "."}}},
+		&SectionNode{Kind: "switch", Name: "kind", Children: []Node{
+			&SectionNode{Kind: "case", Name: `"a"`, Children: []Node{&TextNode{Text: "A"}}},
+			&SectionNode{Kind: "default", Children: []Node{&TextNode{Text: "D"}}},
+		}},
+		&SectionNode{Kind: "let", Args: []string{"x=a.b", `y="z"`}, Children: []Node{
+			&CoalesceNode{Args: []string{"x", `"none"`}},
+		}},
+		&FunctionNode{Name: "f", Args: []string{", "}, Options: map[string]string{"opt": "1", "tz": "{{user.tz}}"}, Children: []Node{
+			&PartialNode{Name: "p"},
+		}},
+		&VarNode{Name: "title", Filters: []Filter{{Name: "upper"}, {Name: "truncate", Args: []string{"5", "..."}}}},
+		&TranslateNode{Key: "cart", Args: []string{"n=cart.size"}},
+		&VarNode{Name: "at", Format: "Jan 2"},
+	}
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("unexpected nodes")
+		for i := range nodes {
+			if i < len(expected) && !reflect.DeepEqual(nodes[i], expected[i]) {
+				t.Errorf("node %d: expected %#v got %#v", i, expected[i], nodes[i])
+			}
+		}
+	}
+}
+
+func TestWalk(t *testing.T) {
+	template := New()
+	if err := template.ParseString("{{a}}{{#b}}{{c}}{{#d}}{{e}}{{/d}}{{/b}}{{^f}}{{g}}{{/f}}"); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	template.Walk(func(n Node) bool {
+		switch n := n.(type) {
+		case *VarNode:
+			names = append(names, n.Name)
+		case *SectionNode:
+			names = append(names, "#"+n.Name)
+			return !n.Inverted
+		}
+		return true
+	})
+	expected := []string{"a", "#b", "c", "#d", "e", "#f"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %q got %q", expected, names)
+	}
+}
+
+func TestFind(t *testing.T) {
+	template := New()
+	err := template.ParseString("{{name}}{{>header}}{{#a}}{{name}}{{#b}}{{#c}}{{name}}{{>footer}}{{/c}}{{/b}}{{/a}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refs := Find(template, NodeQuery{Type: VarNodeType, Name: "name"})
+	if len(refs) != 3 || refs[0].Depth() != 0 || refs[1].Depth() != 1 || refs[2].Depth() != 3 {
+		t.Errorf("unexpected var refs %+v", refs)
+	}
+	if parent := refs[2].Parents[2].(*SectionNode); parent.Name != "c" {
+		t.Errorf("expected the innermost parent to be c, got %q", parent.Name)
+	}
+
+	var partials []string
+	for _, ref := range Find(template, NodeQuery{Type: PartialNodeType}) {
+		partials = append(partials, ref.Node.(*PartialNode).Name)
+	}
+	if !reflect.DeepEqual(partials, []string{"header", "footer"}) {
+		t.Errorf("unexpected partials %q", partials)
+	}
+
+	// Sections nested deeper than one level.
+	var sections []string
+	for _, ref := range Find(template, NodeQuery{Type: SectionNodeType, MinDepth: 2}) {
+		sections = append(sections, ref.Node.(*SectionNode).Name)
+	}
+	if !reflect.DeepEqual(sections, []string{"c"}) {
+		t.Errorf("unexpected sections %q", sections)
+	}
+
+	refs = Find(template, NodeQuery{Match: func(n Node) bool {
+		v, ok := n.(*VarNode)
+		return ok && v.Line == 1 && v.Col == 0
+	}})
+	if len(refs) != 1 {
+		t.Errorf("expected a single match got %+v", refs)
+	}
+}
+
+func TestSpans(t *testing.T) {
+	source := "{{=const c \"v\"}}Hi {{{name}}}, {{! note }}\n{{#items}}\n- {{.}}\n{{/items}}" +
+		"{{=<% %>=}}<%#switch kind%> <%#case \"a\"%>A<%/case%><%/switch%><%~f opt=\"1\"%><%>p%><%/f%><%&raw%>" +
+		" <%- x -%> y <%#s -%>\n z\n<%- /s%><%<%raw%>%><%q%><%<%/raw%>%>"
+	template := New(SwitchSections())
+	if err := template.ParseString(source); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	template.Walk(func(n Node) bool {
+		s := n.Range()
+		got = append(got, source[s.Start:s.End])
+		switch n := n.(type) {
+		case *SectionNode:
+			got = append(got, "body:"+source[n.Body.Start:n.Body.End])
+		case *FunctionNode:
+			got = append(got, "body:"+source[n.Body.Start:n.Body.End])
+		}
+		return true
+	})
+	expected := []string{
+		`{{=const c "v"}}`,
+		"Hi ",
+		"{{{name}}}",
+		", ",
+		"{{! note }}",
+		"\n",
+		"{{#items}}\n- {{.}}\n{{/items}}",
+		"body:\n- {{.}}\n",
+		"\n- ",
+		"{{.}}",
+		"\n",
+		`<%#switch kind%> <%#case "a"%>A<%/case%><%/switch%>`,
+		`body: <%#case "a"%>A<%/case%>`,
+		`<%#case "a"%>A<%/case%>`,
+		"body:A",
+		"A",
+		`<%~f opt="1"%><%>p%><%/f%>`,
+		"body:<%>p%>",
+		"<%>p%>",
+		"<%&raw%>",
+		"<%- x -%>",
+		"y ",
+		"<%#s -%>\n z\n<%- /s%>",
+		"body:\n z\n",
+		"z",
+		"<%q%>",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q got %q", expected, got)
+	}
+}
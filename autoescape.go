@@ -0,0 +1,815 @@
+package mustache
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+)
+
+// ContextualAutoEscape makes the escaping of the variables of the template
+// depend on where they appear in its HTML, like html/template does, rather
+// than always escaping them as HTML text:
+//
+//   - in the value of an attribute holding a URL, such as href or src, values
+//     are percent-encoded as needed, and a value starting the URL with a
+//     scheme other than http, https or mailto is replaced by "#ZmustacheZ"
+//   - in scripts and event handler attributes such as onclick, values are
+//     written as JavaScript values, e.g. strings are quoted, or escaped as
+//     the contents of the string, template or regular expression literal or
+//     the comment they appear in
+//   - in style elements and attributes, values are escaped as CSS
+//   - in unquoted attribute values, whitespace is escaped too
+//
+// The context of a tag is found from the text preceding it in the source of
+// the template. As a section may render its contents any number of times, or
+// not at all, the contents of a section, and of each case of a switch, must
+// end in the context the section starts in; otherwise parsing the template
+// fails, as does executing an html/template whose branches end in different
+// contexts. Only the contents ending either at the start of a URL or further
+// in it, or either before a division or before a regular expression in
+// JavaScript, are accepted, as long as no variable, respectively no /,
+// follows where this is ambiguous. Partials are escaped on their own, from
+// the HTML text context, so templates must end in it, and partials may only be
+// included in it.
+//
+// The option applies to variables escaped as HTML, so it has no effect with
+// JsonEscape or NoEscape, nor on {{{name}}} and {{&name}}. It must be set
+// before the template is parsed, or given to NewBuilder for built templates.
+func ContextualAutoEscape() Option {
+	return func(t *Template) {
+		t.contextualEscape = true
+	}
+}
+
+// The states of the HTML scanner of an htmlContext.
+const (
+	htmlText      = iota
+	htmlLt        // after <
+	htmlBang      // after <!
+	htmlBangDash  // after <!-
+	htmlComment   // in <!-- -->
+	htmlDecl      // in <!DOCTYPE> and the like
+	htmlTagName   // in the name of a tag
+	htmlTag       // in a tag, between attributes
+	htmlAttrName  // in the name of an attribute
+	htmlAfterName // after the name of an attribute
+	htmlBeforeVal // after the = of an attribute
+	htmlAttrValue // in the value of an attribute
+	htmlRawText   // in the contents of a script or style element
+)
+
+// The parts of URLs which may be unknown after a section.
+const (
+	urlKnown = iota
+	urlStarted
+	urlInQuery
+)
+
+// The kinds of attribute values.
+const (
+	attrPlain = iota
+	attrURL
+	attrJS
+	attrCSS
+)
+
+// urlAttrs are the attributes whose value is a URL.
+var urlAttrs = map[string]bool{
+	"action": true, "background": true, "cite": true, "codebase": true,
+	"data": true, "formaction": true, "href": true, "icon": true,
+	"longdesc": true, "manifest": true, "poster": true, "src": true,
+	"srcset": true, "usemap": true, "xlink:href": true,
+}
+
+// htmlContext scans the HTML of a template to find the context of its tags.
+type htmlContext struct {
+	state   int
+	name    []byte    // the name of the current tag or attribute
+	tag     string    // the name of the current tag
+	closing bool      // whether the current tag is a closing tag
+	raw     string    // the element whose raw text is scanned
+	recent  string    // the end of the raw text or comment scanned
+	kind    int       // the kind of the current attribute value
+	quote   byte      // the quote of the attribute value, 0 if unquoted
+	value   int       // the number of bytes of the attribute value
+	query   bool      // whether the URL of the attribute value has a query
+	script  jsScanner // the JavaScript of a script or event handler
+	entity  []byte    // the character reference being scanned in an event handler
+	// After a section whose contents end in different contexts, urlUnknown
+	// is urlStarted if it is unknown whether the URL of the attribute value
+	// has started, or urlInQuery whether it is in its query, and ambiguous
+	// whether a / followed where it is unknown if it is a division,
+	// unknownAt being the offset of the section.
+	urlUnknown int
+	ambiguous  bool
+	unknownAt  int
+}
+
+// jsScanner scans JavaScript code to find whether values are written in code,
+// or in a string, template, regular expression literal or comment.
+type jsScanner struct {
+	quote    byte   // the quote of the literal, ` for templates and / for regular expressions
+	escaped  bool   // whether the last byte of the literal is a backslash
+	class    bool   // whether in a class of a regular expression literal
+	comment  byte   // / in line comments, * in block comments
+	star     bool   // whether the last byte of the block comment is a *
+	dollar   bool   // whether the last byte of the template is a $
+	slash    bool   // whether the last byte of the code is a /, starting a comment or not
+	slashDiv bool   // whether that / is a division rather than a regular expression
+	div      bool   // whether a / in the code is a division
+	word     []byte // the identifier or keyword being scanned
+	depth    int    // the nesting of braces in the code
+	exprs    []int  // the depth of the code of the ${} of enclosing templates
+	// divUnknown is whether it is unknown if a / in the code is a division,
+	// and ambiguous whether such a / was scanned.
+	divUnknown bool
+	ambiguous  bool
+}
+
+// escape returns the escaping of values written in the current context.
+func (h *htmlContext) escape() escapeType {
+	switch h.state {
+	case htmlRawText:
+		if h.raw == "style" {
+			return cssEscape
+		}
+		return h.script.escape(jsEscape)
+	case htmlTagName, htmlTag, htmlAttrName, htmlAfterName:
+		return attrEscape
+	case htmlBeforeVal, htmlAttrValue:
+		switch h.kind {
+		case attrURL:
+			if h.value == 0 {
+				return urlEscape
+			}
+			if h.query {
+				return urlQueryEscape
+			}
+			return urlPartEscape
+		case attrJS:
+			return h.script.escape(jsAttrEscape)
+		case attrCSS:
+			return cssEscape
+		}
+		if h.state == htmlBeforeVal || h.quote == 0 {
+			return attrEscape
+		}
+	}
+	return htmlEscape
+}
+
+// text scans s, which is written in the current context.
+func (h *htmlContext) text(s string) {
+	for i := 0; i < len(s); i++ {
+		h.next(s[i])
+		if h.script.ambiguous {
+			h.ambiguous = true
+		}
+	}
+}
+
+// next scans the byte c.
+func (h *htmlContext) next(c byte) {
+	space := c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+	switch h.state {
+	case htmlText:
+		if c == '<' {
+			h.state = htmlLt
+		}
+	case htmlLt:
+		h.name = h.name[:0]
+		h.closing = c == '/'
+		switch {
+		case c == '!':
+			h.state = htmlBang
+		case c == '/' || isLetter(c):
+			h.state = htmlTagName
+			if isLetter(c) {
+				h.name = append(h.name, lower(c))
+			}
+		default:
+			h.state = htmlText
+			h.next(c)
+		}
+	case htmlBang:
+		h.state = htmlDecl
+		if c == '-' {
+			h.state = htmlBangDash
+		}
+	case htmlBangDash:
+		h.state = htmlDecl
+		if c == '-' {
+			h.state, h.recent = htmlComment, ""
+		}
+	case htmlComment:
+		h.recent = keepEnd(h.recent+string(c), 3)
+		if h.recent == "-->" {
+			h.state = htmlText
+		}
+	case htmlDecl:
+		if c == '>' {
+			h.state = htmlText
+		}
+	case htmlTagName:
+		if space || c == '>' || c == '/' {
+			h.tag, h.state = string(h.name), htmlTag
+			h.next(c)
+			return
+		}
+		h.name = append(h.name, lower(c))
+	case htmlTag:
+		switch {
+		case c == '>':
+			h.endTag()
+		case space || c == '/':
+		default:
+			h.name = append(h.name[:0], lower(c))
+			h.state = htmlAttrName
+		}
+	case htmlAttrName:
+		if space || c == '=' || c == '>' || c == '/' {
+			h.state = htmlAfterName
+			h.next(c)
+			return
+		}
+		h.name = append(h.name, lower(c))
+	case htmlAfterName:
+		switch {
+		case c == '=':
+			name := string(h.name)
+			h.state, h.kind, h.value, h.query, h.script, h.entity = htmlBeforeVal, attrPlain, 0, false, jsScanner{}, nil
+			h.urlUnknown = urlKnown
+			switch {
+			case urlAttrs[name]:
+				h.kind = attrURL
+			case strings.HasPrefix(name, "on"):
+				h.kind = attrJS
+			case name == "style":
+				h.kind = attrCSS
+			}
+		case !space:
+			h.state = htmlTag
+			h.next(c)
+		}
+	case htmlBeforeVal:
+		switch {
+		case c == '"' || c == '\'':
+			h.state, h.quote = htmlAttrValue, c
+		case c == '>':
+			h.endTag()
+		case !space:
+			h.state, h.quote = htmlAttrValue, 0
+			h.next(c)
+		}
+	case htmlAttrValue:
+		if c == h.quote || h.quote == 0 && (space || c == '>') {
+			h.state = htmlTag
+			if c == '>' {
+				h.endTag()
+			}
+			return
+		}
+		h.value++
+		if c == '?' || c == '#' {
+			h.query, h.urlUnknown = true, urlKnown
+		} else if h.urlUnknown == urlStarted {
+			h.urlUnknown = urlKnown
+		}
+		if h.kind == attrJS {
+			h.handler(c)
+		}
+	case htmlRawText:
+		h.recent = keepEnd(h.recent+string(lower(c)), len(h.raw)+2)
+		if h.recent == "</"+h.raw {
+			h.name = append(h.name[:0], h.raw...)
+			h.closing, h.state = true, htmlTagName
+			return
+		}
+		if h.raw == "script" {
+			h.script.next(c)
+		}
+	}
+}
+
+// escape returns the escaping of values written in the current context of
+// the code, code in the code itself.
+func (s *jsScanner) escape(code escapeType) escapeType {
+	if s.quote != 0 || s.comment != 0 || s.slash && !s.slashDiv {
+		// Values after a / starting a regular expression are in it.
+		return jsStringEscape
+	}
+	return code
+}
+
+// jsKeywords are the keywords after which a / starts a regular expression.
+var jsKeywords = map[string]bool{
+	"await": true, "case": true, "delete": true, "do": true, "else": true,
+	"in": true, "instanceof": true, "new": true, "return": true,
+	"throw": true, "typeof": true, "void": true, "yield": true,
+}
+
+// next scans the byte c.
+func (s *jsScanner) next(c byte) {
+	switch {
+	case s.comment == '/':
+		if c == '\n' || c == '\r' {
+			s.comment = 0
+		}
+	case s.comment == '*':
+		if s.star && c == '/' {
+			s.comment = 0
+		}
+		s.star = c == '*'
+	case s.quote == '/':
+		switch {
+		case s.escaped:
+			s.escaped = false
+		case c == '\\':
+			s.escaped = true
+		case c == '[':
+			s.class = true
+		case c == ']':
+			s.class = false
+		case c == '/' && !s.class:
+			s.quote, s.div = 0, true
+		}
+	case s.quote == '`':
+		switch {
+		case s.escaped:
+			s.escaped = false
+		case c == '\\':
+			s.escaped = true
+		case c == '`':
+			s.quote, s.div = 0, true
+		case s.dollar && c == '{':
+			// The expression of the template is code, up to its }.
+			s.exprs = append(s.exprs, s.depth)
+			s.quote, s.div = 0, false
+		}
+		s.dollar = c == '$' && !s.escaped
+	case s.quote != 0:
+		switch {
+		case s.escaped:
+			s.escaped = false
+		case c == '\\':
+			s.escaped = true
+		case c == s.quote:
+			s.quote, s.div = 0, true
+		}
+	default:
+		s.code(c)
+	}
+}
+
+// code scans the byte c of code.
+func (s *jsScanner) code(c byte) {
+	if s.divUnknown && strings.IndexByte(" \t\n\r\f", c) < 0 {
+		s.divUnknown = false
+		if c == '/' {
+			s.ambiguous = true
+		}
+	}
+	if s.slash {
+		s.slash = false
+		switch {
+		case c == '/' || c == '*':
+			s.comment, s.star = c, false
+			return
+		case !s.slashDiv:
+			s.quote, s.class = '/', false
+			s.next(c)
+			return
+		}
+		s.div = false
+	}
+	word := isLetter(c) || '0' <= c && c <= '9' || c == '_' || c == '$' || c >= 0x80
+	if word {
+		s.word = append(s.word, c)
+		s.div = true
+		return
+	}
+	if len(s.word) > 0 {
+		s.div = !jsKeywords[string(s.word)]
+		s.word = s.word[:0]
+	}
+	switch c {
+	case ' ', '\t', '\n', '\r', '\f':
+	case '/':
+		s.slash, s.slashDiv = true, s.div
+	case '"', '\'', '`':
+		s.quote, s.escaped, s.dollar = c, false, false
+	case ')', ']':
+		s.div = true
+	case '{':
+		s.depth++
+		s.div = false
+	case '}':
+		if n := len(s.exprs); n > 0 && s.exprs[n-1] == s.depth {
+			s.exprs = s.exprs[:n-1]
+			s.quote, s.escaped, s.dollar = '`', false, false
+			return
+		}
+		s.depth--
+		s.div = false
+	default:
+		s.div = false
+	}
+}
+
+// handler scans the byte c of the value of an event handler attribute, whose
+// JavaScript is the value with its character references decoded.
+func (h *htmlContext) handler(c byte) {
+	if len(h.entity) == 0 && c != '&' {
+		h.script.next(c)
+		return
+	}
+	h.entity = append(h.entity, c)
+	if c == ';' || len(h.entity) > 32 || len(h.entity) > 1 && c != '#' && !isLetter(c) && !('0' <= c && c <= '9') {
+		decoded := html.UnescapeString(string(h.entity))
+		h.entity = h.entity[:0]
+		for i := 0; i < len(decoded); i++ {
+			h.script.next(decoded[i])
+		}
+	}
+}
+
+// endTag scans the end of the current tag.
+func (h *htmlContext) endTag() {
+	h.state = htmlText
+	if !h.closing && (h.tag == "script" || h.tag == "style") {
+		h.state, h.raw, h.recent, h.script = htmlRawText, h.tag, "", jsScanner{}
+	}
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func lower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// keepEnd returns the last n bytes of s.
+func keepEnd(s string, n int) string {
+	if len(s) > n {
+		return s[len(s)-n:]
+	}
+	return s
+}
+
+// escapeError is an error setting the escaping of a template, about the tag at
+// offset, or about the end of the template if offset is negative.
+type escapeError struct {
+	offset int
+	msg    string
+}
+
+func (e *escapeError) Error() string {
+	return e.msg
+}
+
+// escapeTree sets the escaping of the variables of elems, the parse tree of a
+// template, which must end in the HTML text context.
+func escapeTree(elems []node) *escapeError {
+	h := &htmlContext{}
+	if err := autoEscape(elems, h); err != nil {
+		return err
+	}
+	if h.state != htmlText {
+		return &escapeError{-1, fmt.Sprintf("the template ends in %s rather than in HTML text", h)}
+	}
+	return nil
+}
+
+// autoEscape sets the escaping of the variables of nodes escaped as HTML after
+// the context they appear in, scanning the HTML of the nodes with h.
+func autoEscape(nodes []node, h *htmlContext) *escapeError {
+	for _, n := range nodes {
+		var err *escapeError
+		switch n := n.(type) {
+		case textNode:
+			h.text(string(n))
+		case *verbatimNode:
+			h.text(n.text)
+		case *varNode:
+			err = h.variable(&n.escape, n.name, n.outer.start)
+		case *coalesceNode:
+			err = h.variable(&n.escape, "coalesce", n.outer.start)
+		case *translateNode:
+			err = h.variable(&n.escape, n.key, n.outer.start)
+		case *partialNode:
+			if h.state != htmlText {
+				err = &escapeError{n.outer.start, fmt.Sprintf("partial %q is included in %s rather than in HTML text", n.name, h)}
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if h.ambiguous {
+			return &escapeError{h.unknownAt, "a / after the section could start either a division or a regular expression"}
+		}
+		if lists := children(n); lists != nil {
+			if err := h.section(n.(spanned).nodeSpans().outer.start, lists); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// variable sets escape, that of a variable tag named name at offset, after the
+// current context if it is escaped as HTML, and scans the value written.
+func (h *htmlContext) variable(escape *escapeType, name string, offset int) *escapeError {
+	if *escape == htmlEscape {
+		*escape = h.escape()
+	}
+	switch *escape {
+	case urlEscape, urlPartEscape, urlQueryEscape:
+		if h.urlUnknown != urlKnown {
+			return &escapeError{offset, fmt.Sprintf("%q is written where it is unknown which part of the URL it is in, after a section whose contents end in different parts of the URL", name)}
+		}
+	}
+	h.text("x")
+	return nil
+}
+
+// section scans lists, the contents of the section at offset, each from the
+// context the section starts in, and leaves h in the context they end in.
+// When they end in the contexts which may be joined, the contents are scanned
+// again from the joined context, that the next iteration starts in.
+func (h *htmlContext) section(offset int, lists [][]node) *escapeError {
+	joined := h.clone()
+	for {
+		start := joined.clone()
+		for _, elems := range lists {
+			end := start.clone()
+			if err := autoEscape(elems, end); err != nil {
+				return err
+			}
+			if !joined.join(end, offset) {
+				return &escapeError{offset, fmt.Sprintf("the section starts in %s but its contents end in %s", h, end)}
+			}
+		}
+		if joined.urlUnknown == start.urlUnknown && joined.script.divUnknown == start.script.divUnknown {
+			break
+		}
+	}
+	*h = *joined
+	return nil
+}
+
+// clone returns a copy of h which scans independently of it.
+func (h *htmlContext) clone() *htmlContext {
+	c := *h
+	c.name = append([]byte(nil), h.name...)
+	c.entity = append([]byte(nil), h.entity...)
+	c.script.word = append([]byte(nil), h.script.word...)
+	c.script.exprs = append([]int(nil), h.script.exprs...)
+	return &c
+}
+
+// scanState is the part of the state of an htmlContext which decides how what
+// follows is escaped.
+type scanState struct {
+	state   int
+	name    string
+	tag     string
+	closing bool
+	raw     string
+	kind    int
+	quote   byte
+	url     int // 0 at the start of the URL, 1 after it and 2 in its query
+	js      jsState
+}
+
+// jsState is the part of the state of a jsScanner which decides how what
+// follows is escaped.
+type jsState struct {
+	quote, comment                                     byte
+	escaped, class, star, dollar, slash, slashDiv, div bool
+	depth                                              int
+	exprs                                              string
+}
+
+// key returns the scanState of h. Only the parts of the state in use in the
+// current context are set.
+func (h *htmlContext) key() scanState {
+	k := scanState{state: h.state}
+	switch h.state {
+	case htmlTagName, htmlAttrName, htmlAfterName:
+		k.name = string(h.name)
+	case htmlRawText:
+		k.raw = h.raw
+		if h.raw == "script" {
+			k.js = h.script.key()
+		}
+	}
+	switch h.state {
+	case htmlTagName, htmlTag, htmlAttrName, htmlAfterName, htmlBeforeVal, htmlAttrValue:
+		k.tag, k.closing = h.tag, h.closing
+	}
+	switch h.state {
+	case htmlBeforeVal, htmlAttrValue:
+		k.kind, k.quote = h.kind, h.quote
+		switch {
+		case h.kind == attrURL && h.query:
+			k.url = 2
+		case h.kind == attrURL && h.value > 0:
+			k.url = 1
+		case h.kind == attrJS:
+			k.js = h.script.key()
+		}
+	}
+	return k
+}
+
+// key returns the jsState of s.
+func (s *jsScanner) key() jsState {
+	div := s.div
+	if len(s.word) > 0 {
+		div = !jsKeywords[string(s.word)]
+	}
+	return jsState{
+		quote: s.quote, comment: s.comment,
+		escaped: s.escaped, class: s.class, star: s.star, dollar: s.dollar, slash: s.slash, slashDiv: s.slashDiv, div: div,
+		depth: s.depth, exprs: fmt.Sprint(s.exprs),
+	}
+}
+
+// join makes h, the context the contents of the section at offset are scanned
+// from, the join of h and o, the context they end in. It reports whether the
+// contexts may be joined: they must be the same, except for whether a URL has
+// started or a / is a division, which then becomes unknown.
+func (h *htmlContext) join(o *htmlContext, offset int) bool {
+	a, b := h.key(), o.key()
+	urls, div := [2]int{a.url, b.url}, a.js.div != b.js.div
+	a.url, b.url, a.js.div, b.js.div = 0, 0, false, false
+	if a != b {
+		return false
+	}
+	unknown := o.urlUnknown
+	switch {
+	case urls[0] == urls[1]:
+	case urls[0] == 2 || urls[1] == 2:
+		unknown = urlInQuery
+	case unknown == urlKnown:
+		unknown = urlStarted
+	}
+	if unknown > h.urlUnknown {
+		h.urlUnknown = unknown
+	}
+	if (div || o.script.divUnknown) && !h.script.divUnknown {
+		h.script.divUnknown, h.unknownAt = true, offset
+	}
+	return true
+}
+
+// String describes the context of h, for errors.
+func (h *htmlContext) String() string {
+	switch h.state {
+	case htmlText:
+		return "HTML text"
+	case htmlComment:
+		return "an HTML comment"
+	case htmlRawText:
+		if h.raw == "script" {
+			return h.script.String() + " of a script element"
+		}
+		return "a " + h.raw + " element"
+	case htmlBeforeVal, htmlAttrValue:
+		if h.kind == attrJS {
+			return h.script.String() + " of an event handler"
+		}
+		return "an attribute value"
+	}
+	return "an HTML tag"
+}
+
+// String describes the context of s, for errors.
+func (s *jsScanner) String() string {
+	switch {
+	case s.comment != 0:
+		return "a comment"
+	case s.quote == '/':
+		return "a regular expression"
+	case s.quote == '`':
+		return "a template literal"
+	case s.quote != 0:
+		return "a string"
+	}
+	return "the code"
+}
+
+// escapeContextual escapes s, the formatted value of a variable, for the
+// context of escape, one of the escapes set by ContextualAutoEscape other than
+// jsEscape and jsAttrEscape.
+func escapeContextual(s string, escape escapeType) string {
+	switch escape {
+	case attrEscape:
+		return escapeAttr(s)
+	case urlEscape:
+		if i := strings.IndexAny(s, ":/?#"); i >= 0 && s[i] == ':' {
+			switch strings.ToLower(s[:i]) {
+			case "http", "https", "mailto":
+			default:
+				return "#ZmustacheZ"
+			}
+		}
+		return escapeHtml(normalizeURL(s))
+	case urlPartEscape:
+		return escapeHtml(normalizeURL(s))
+	case urlQueryEscape:
+		return url.QueryEscape(s)
+	case jsStringEscape:
+		return escapeJSString(s)
+	case cssEscape:
+		return escapeCSS(s)
+	}
+	return s
+}
+
+// escapeAttr escapes s as HTML which may appear in an unquoted attribute
+// value.
+func escapeAttr(s string) string {
+	return attrReplacer.Replace(escapeHtml(s))
+}
+
+var attrReplacer = strings.NewReplacer(
+	" ", "&#32;", "\t", "&#9;", "\n", "&#10;", "\f", "&#12;", "\r", "&#13;",
+	"=", "&#61;", "`", "&#96;",
+)
+
+// normalizeURL percent-encodes the bytes of s which may not appear in a URL,
+// leaving existing escapes alone.
+func normalizeURL(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isLetter(c) || '0' <= c && c <= '9' || strings.IndexByte("-._~:/?#[]@!$&*+,;=%", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// jsValue formats v as a JavaScript value which may appear in a script
+// element, with the characters special to HTML escaped.
+func jsValue(v interface{}) string {
+	if s, ok := v.(fmt.Stringer); ok {
+		v = s.String()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	return string(b)
+}
+
+// escapeJSString escapes s as the contents of a JavaScript string literal
+// quoted with any quote, escaping the characters special to HTML too. $ and {
+// are escaped so that the contents of a template can not start a ${}
+// expression. As / is escaped, s may appear in a regular expression literal
+// or a comment too.
+func escapeJSString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '/':
+			b.WriteString(`\/`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < ' ' || r == '\u2028' || r == '\u2029' || strings.ContainsRune("\"'`<>&=${", r):
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// escapeCSS escapes the characters of s other than letters and digits as CSS
+// escapes, so that s may appear in a CSS string, identifier or value.
+func escapeCSS(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < 0x80 && (isLetter(byte(r)) || '0' <= r && r <= '9') {
+			b.WriteRune(r)
+			continue
+		}
+		fmt.Fprintf(&b, `\%x `, r)
+	}
+	return b.String()
+}
@@ -0,0 +1,135 @@
+package mustache
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestContextualAutoEscape(t *testing.T) {
+	data := map[string]interface{}{
+		"name":  `Ann "A" <b>`,
+		"path":  "a b/c",
+		"bad":   "javascript:alert(1)",
+		"good":  "https://example.com/?q=1",
+		"query": "a&b=c d",
+		"n":     3,
+		"user":  map[string]interface{}{"id": 1},
+		"code":  "${alert(1)}",
+		"js":    "alert(1)",
+	}
+	for _, test := range []struct {
+		template string
+		expected string
+	}{
+		{`<p>{{name}}</p>`, `<p>Ann &quot;A&quot; &lt;b&gt;</p>`},
+		{`<p title="{{name}}">`, `<p title="Ann &quot;A&quot; &lt;b&gt;">`},
+		{`<p title={{path}}>`, `<p title=a&#32;b/c>`},
+		{`<a href="{{bad}}">`, `<a href="#ZmustacheZ">`},
+		{`<a href="{{good}}">`, `<a href="https://example.com/?q=1">`},
+		{`<a href="/files/{{path}}">`, `<a href="/files/a%20b/c">`},
+		{`<a href="/search?q={{query}}">`, `<a href="/search?q=a%26b%3Dc+d">`},
+		{`<button onclick="show({{name}})">`, `<button onclick="show(&quot;Ann&#32;\&quot;A\&quot;&#32;\u003cb\u003e&quot;)">`},
+		{`<script>var user = {{user}}, n = {{n}};</script>`, `<script>var user = {"id":1}, n = 3;</script>`},
+		{`<script>var s = "hi {{name}}";</script>`, `<script>var s = "hi Ann \u0022A\u0022 \u003cb\u003e";</script>`},
+		{`<script>var s = "\"{{n}}";</script>{{n}}`, `<script>var s = "\"3";</script>3`},
+		{`<style>p { color: {{path}} }</style>`, `<style>p { color: a\20 b\2f c }</style>`},
+		{`<!-- <script> -->{{name}}`, `<!-- <script> -->Ann &quot;A&quot; &lt;b&gt;`},
+		{`<script>{{{name}}}</script>`, `<script>Ann "A" <b></script>`},
+		{`{{#user}}<a href="{{bad}}">{{/user}}`, `<a href="#ZmustacheZ">`},
+		{"<script>var s = `{{code}}`;</script>", "<script>var s = `\\u0024\\u007balert(1)}`;</script>"},
+		{"<script>var s = `${ {{js}} }`, t = `{{n}}`;</script>", "<script>var s = `${ \"alert(1)\" }`, t = `3`;</script>"},
+		{"<script>var s = `${ {a: `${1}`}.a }{{n}}`;</script>", "<script>var s = `${ {a: `${1}`}.a }3`;</script>"},
+		{"<script>// don't\nvar v = {{js}};</script>", "<script>// don't\nvar v = \"alert(1)\";</script>"},
+		{"<script>/* it's */ var v = {{js}}; // {{js}}\n</script>", "<script>/* it's */ var v = \"alert(1)\"; // alert(1)\n</script>"},
+		{"<script>/* {{path}} */</script>", "<script>/* a b\\/c */</script>"},
+		{"<script>var r = /'/; var v = {{js}};</script>", "<script>var r = /'/; var v = \"alert(1)\";</script>"},
+		{"<script>var r = /[/']/g, v = {{js}};</script>", "<script>var r = /[/']/g, v = \"alert(1)\";</script>"},
+		{"<script>var r = /a{{path}}/;</script>", "<script>var r = /aa b\\/c/;</script>"},
+		{"<script>var v = a / {{n}} / 2, w = {{js}};</script>", "<script>var v = a / 3 / 2, w = \"alert(1)\";</script>"},
+		{"<script>return /'/.test(s) ? {{js}} : 0;</script>", "<script>return /'/.test(s) ? \"alert(1)\" : 0;</script>"},
+		{`<button onclick="// don't&#10;f({{js}})">`, `<button onclick="// don't&#10;f(&quot;alert(1)&quot;)">`},
+		{`<button onclick="f(&quot;a&quot;, {{js}})">`, `<button onclick="f(&quot;a&quot;, &quot;alert(1)&quot;)">`},
+		{`<script>{{#user}}var v = {{js}};{{/user}}</script>`, `<script>var v = "alert(1)";</script>`},
+		{`<script>var a = [{{#user}}{{n}}{{/user}}];</script>`, `<script>var a = [3];</script>`},
+		{`<script>var v = {{#n}}{{n}}{{/n}}{{^n}}0{{/n}};</script>`, `<script>var v = 3;</script>`},
+		{`<a href="{{#user}}/u{{/user}}/{{path}}">`, `<a href="/u/a%20b/c">`},
+		{`<a href="/?{{#user}}a=1&{{/user}}b={{query}}">`, `<a href="/?a=1&b=a%26b%3Dc+d">`},
+		{`{{#user}}{{>p}}{{/user}}<p>{{name}}</p>`, `<p>Ann &quot;A&quot; &lt;b&gt;</p>`},
+	} {
+		template := New(ContextualAutoEscape())
+		if err := template.ParseString(test.template); err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(data)
+		if err != nil {
+			t.Errorf("%q: %s", test.template, err)
+			continue
+		}
+		if output != test.expected {
+			t.Errorf("%q: expected %q got %q", test.template, test.expected, output)
+		}
+	}
+}
+
+func TestContextualAutoEscapeContexts(t *testing.T) {
+	for _, test := range []struct {
+		template string
+		err      string
+	}{
+		{`<script>{{#x}}</script>{{/x}}{{s}}`, "1:8 syntax error: the section starts in the code of a script element but its contents end in HTML text"},
+		{`<p>{{^x}}<script>{{/x}}</script>`, "1:3 syntax error: the section starts in HTML text but its contents end in the code of a script element"},
+		{`<script>{{#items}}"{{/items}}"</script>`, "1:8 syntax error: the section starts in the code of a script element but its contents end in a string of a script element"},
+		{`<a {{#x}}href="{{/x}}">`, "1:3 syntax error: the section starts in an HTML tag but its contents end in an attribute value"},
+		{`{{#switch k}}{{#case "a"}}<b>{{/case}}{{#default}}<i {{/default}}{{/switch}}`, "1:0 syntax error: the section starts in HTML text but its contents end in an HTML tag"},
+		{`<script>var v = {{#x}}{{n}}{{/x}}/2/g;</script>`, "1:16 syntax error: a / after the section could start either a division or a regular expression"},
+		{`<script>{{#items}}a{{/items}}/b/;</script>`, "1:8 syntax error: a / after the section could start either a division or a regular expression"},
+		{`<a href="{{#x}}/x/{{/x}}{{u}}">`, `1:24 syntax error: "u" is written where it is unknown which part of the URL it is in, after a section whose contents end in different parts of the URL`},
+		{`<a href="/{{#x}}?a{{/x}}b={{u}}">`, `1:26 syntax error: "u" is written where it is unknown which part of the URL it is in, after a section whose contents end in different parts of the URL`},
+		{`<a href="{{>p}}">`, `1:9 syntax error: partial "p" is included in an attribute value rather than in HTML text`},
+		{`<script>{{>p}}</script>`, `1:8 syntax error: partial "p" is included in the code of a script element rather than in HTML text`},
+		{"<p>\n<script>", "2:8 syntax error: the template ends in the code of a script element rather than in HTML text"},
+	} {
+		template := New(ContextualAutoEscape(), SwitchSections())
+		err := template.ParseString(test.template)
+		if err == nil {
+			t.Errorf("%q: expected an error", test.template)
+			continue
+		}
+		if msg, _, _ := strings.Cut(err.Error(), "\n"); msg != test.err {
+			t.Errorf("%q: expected %q got %q", test.template, test.err, msg)
+		}
+		if len(template.Nodes()) != 0 {
+			t.Errorf("%q: expected the template to be left unchanged", test.template)
+		}
+	}
+
+	// The template of the review, which rendered its value in the script.
+	if _, err := NewBuilder(ContextualAutoEscape()).Text("<script>").Section("x", func(b *Builder) {
+		b.Text("</script>")
+	}).Var("s").Template(); err == nil {
+		t.Error("expected an error building the template")
+	}
+}
+
+func TestContextualAutoEscapeEncode(t *testing.T) {
+	template := New(ContextualAutoEscape())
+	if err := template.ParseString(`<a href="/u/{{id}}" onclick="f({{id}})">{{id}}</a>`); err != nil {
+		t.Fatal(err)
+	}
+	b, err := template.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := New()
+	if err := decoded.UnmarshalJSON(b); err != nil {
+		t.Fatal(err)
+	}
+	output, err := decoded.RenderString(map[string]string{"id": "a b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<a href="/u/a%20b" onclick="f(&quot;a&#32;b&quot;)">a b</a>`
+	if output != expected {
+		t.Errorf("expected %q got %q", expected, output)
+	}
+}
@@ -0,0 +1,121 @@
+package mustache
+
+// Builder constructs a template programmatically, without parsing a source
+// string. Names are validated as they would be when parsing; the first error
+// is returned by Template.
+//
+//	t, err := mustache.NewBuilder().
+//		Text("Hello ").Var("name").Text("!\n").
+//		Section("items", func(b *mustache.Builder) {
+//			b.Text("- ").Var(".").Text("\n")
+//		}).
+//		Template()
+type Builder struct {
+	t     *Template
+	elems []node
+	err   *error // shared with the builders of sections
+}
+
+// NewBuilder returns a builder for a template with the given options.
+func NewBuilder(options ...Option) *Builder {
+	return &Builder{t: New(options...), err: new(error)}
+}
+
+// Template returns the built template, or the first error encountered while
+// building it. With ContextualAutoEscape, the escaping of its variables is set
+// from the context they appear in, as when parsing, and fails likewise.
+func (b *Builder) Template() (*Template, error) {
+	if *b.err != nil {
+		return nil, *b.err
+	}
+	if b.t.contextualEscape {
+		if err := escapeTree(b.elems); err != nil {
+			return nil, err
+		}
+	}
+	b.t.elems = b.elems
+	return b.t, nil
+}
+
+// Text appends literal text.
+func (b *Builder) Text(s string) *Builder {
+	b.elems = append(b.elems, textNode(s))
+	return b
+}
+
+// Var appends a variable, escaped according to the options of the template.
+func (b *Builder) Var(name string) *Builder {
+	return b.variable(name, b.t.escape, b.t.startDelim+name+b.t.endDelim)
+}
+
+// RawVar appends a variable which is not escaped, like {{&name}}.
+func (b *Builder) RawVar(name string) *Builder {
+	return b.variable(name, noEscape, b.t.startDelim+"&"+name+b.t.endDelim)
+}
+
+func (b *Builder) variable(name string, escape escapeType, tag string) *Builder {
+	path, ok := b.path(name)
+	if ok {
+		b.elems = append(b.elems, &varNode{name: name, path: path, escape: escape, tag: tag})
+	}
+	return b
+}
+
+// Section appends a section, whose elements are appended by body.
+func (b *Builder) Section(name string, body func(*Builder)) *Builder {
+	return b.section(name, false, body)
+}
+
+// InvertedSection appends an inverted section, like {{^name}}, whose elements
+// are appended by body.
+func (b *Builder) InvertedSection(name string, body func(*Builder)) *Builder {
+	return b.section(name, true, body)
+}
+
+func (b *Builder) section(name string, inverted bool, body func(*Builder)) *Builder {
+	path, ok := b.path(name)
+	if ok {
+		b.elems = append(b.elems, &sectionNode{name: name, path: path, inverted: inverted, elems: b.build(body)})
+	}
+	return b
+}
+
+// Function appends a function section, like {{~name}}, whose elements are
+// appended by body. The options are passed to the customizer function.
+func (b *Builder) Function(name string, opts map[string]string, body func(*Builder)) *Builder {
+	b.elems = append(b.elems, &functionSectionNode{name: name, opts: opts, elems: b.build(body)})
+	return b
+}
+
+// Partial appends a partial, like {{>name}}.
+func (b *Builder) Partial(name string) *Builder {
+	b.elems = append(b.elems, &partialNode{name: name})
+	return b
+}
+
+// Comment appends a comment, which renders nothing.
+func (b *Builder) Comment(s string) *Builder {
+	b.elems = append(b.elems, &commentNode{text: s})
+	return b
+}
+
+// build returns the elements appended by body to a new builder.
+func (b *Builder) build(body func(*Builder)) []node {
+	child := &Builder{t: b.t, err: b.err}
+	if body != nil {
+		body(child)
+	}
+	return child.elems
+}
+
+// path parses name, recording an error if it is invalid.
+func (b *Builder) path(name string) ([]pathSegment, bool) {
+	path, err := parsePath(name)
+	if err != nil {
+		if *b.err == nil {
+			*b.err = err
+		}
+		return nil, false
+	}
+	return path, true
+}
@@ -0,0 +1,69 @@
+package mustache
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	header := New(Name("header"))
+	if err := header.ParseString("# {{title}}\n"); err != nil {
+		t.Fatal(err)
+	}
+	template, err := NewBuilder(Partial(header), CustomizeFunction("upper", func(s string) (string, error) {
+		return strings.ToUpper(s), nil
+	})).
+		Partial("header").
+		Text("Hello ").Var("name").Text(" ").RawVar("name").Text("!\n").
+		Comment("items follow").
+		Section("items", func(b *Builder) {
+			b.Text("- ").Var(".").Text("\n")
+		}).
+		InvertedSection("items", func(b *Builder) {
+			b.Text("none\n")
+		}).
+		Function("upper", nil, func(b *Builder) {
+			b.Var(`meta."a.b"`)
+		}).
+		Template()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := template.RenderString(map[string]interface{}{
+		"title": "T",
+		"name":  "<Jane>",
+		"items": []string{"a", "b"},
+		"meta":  map[string]string{"a.b": "x"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "# T\nHello &lt;Jane&gt; <Jane>!\n- a\n- b\nX"; output != expected {
+		t.Errorf("expected %q got %q", expected, output)
+	}
+
+	_, err = NewBuilder().Section("s", func(b *Builder) {
+		b.Var(`a."b`)
+	}).Template()
+	if err == nil {
+		t.Error("expected an error for an invalid name")
+	}
+}
+
+func TestBuilderContextualAutoEscape(t *testing.T) {
+	template, err := NewBuilder(ContextualAutoEscape()).
+		Text(`<a href="`).Var("url").Text(`" title=`).Var("title").Text(`>`).Var("title").Text("</a>").
+		Text("<script>var x = ").Var("title").Text(";</script>").
+		Template()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := template.RenderString(map[string]string{"url": "javascript:alert(1)", "title": "a b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<a href="#ZmustacheZ" title=a&#32;b>a b</a><script>var x = "a b";</script>`
+	if output != expected {
+		t.Errorf("expected %q got %q", expected, output)
+	}
+}
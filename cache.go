@@ -0,0 +1,114 @@
+package mustache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"errors"
+	"sync"
+)
+
+// Cache holds parsed templates keyed by a hash of their source, evicting the
+// least recently used template once it holds more than its maximum number of
+// entries. It is safe for concurrent use, and concurrent requests for the same
+// source parse it only once. Every template of a cache is parsed with the
+// options of the cache, so that a template is never served with options other
+// than those it was requested with.
+type Cache struct {
+	max     int
+	options []Option
+
+	mu       sync.Mutex
+	lru      *list.List // of *cacheEntry, most recently used first
+	entries  map[[sha256.Size]byte]*list.Element
+	inflight map[[sha256.Size]byte]*cacheCall
+}
+
+type cacheEntry struct {
+	key      [sha256.Size]byte
+	template *Template
+}
+
+// cacheCall is a parse in progress, which callers asking for the same source
+// wait on.
+type cacheCall struct {
+	done     chan struct{}
+	template *Template
+	err      error
+}
+
+// NewCache returns a cache holding at most max templates, parsed with
+// options. A max of zero or less means the cache is unbounded. The options
+// are given to the cache rather than to GetOrParse, see GetOrParse.
+func NewCache(max int, options ...Option) *Cache {
+	return &Cache{
+		max:      max,
+		options:  options,
+		lru:      list.New(),
+		entries:  make(map[[sha256.Size]byte]*list.Element),
+		inflight: make(map[[sha256.Size]byte]*cacheCall),
+	}
+}
+
+// GetOrParse returns the cached template for src, parsing it with the options
+// of the cache if it is not cached yet. Templates which fail to parse are not
+// cached. It takes no options of its own: options are functions, which can not
+// be compared, so templates parsed with different options could not be told
+// apart by the cache. Templates needing other options use another Cache.
+//
+// If an option or the parse panics, the panic is passed on to the caller, and
+// the callers waiting for the same source get an error.
+func (c *Cache) GetOrParse(src string) (*Template, error) {
+	key := sha256.Sum256([]byte(src))
+
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(e)
+		c.mu.Unlock()
+		return e.Value.(*cacheEntry).template, nil
+	}
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		<-call.done
+		return call.template, call.err
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	// The call is finished even if the parse panics, so that the callers
+	// waiting on it, and those asking for src later, do not block forever.
+	parsed := false
+	defer func() {
+		if !parsed {
+			call.template, call.err = nil, errors.New("parsing the template panicked")
+		}
+		c.mu.Lock()
+		delete(c.inflight, key)
+		if call.err == nil {
+			c.entries[key] = c.lru.PushFront(&cacheEntry{key, call.template})
+			if c.max > 0 && c.lru.Len() > c.max {
+				oldest := c.lru.Back()
+				c.lru.Remove(oldest)
+				delete(c.entries, oldest.Value.(*cacheEntry).key)
+			}
+		}
+		c.mu.Unlock()
+		close(call.done)
+	}()
+
+	t := New(c.options...)
+	if err := t.ParseString(src); err != nil {
+		call.err = err
+	} else {
+		call.template = t
+	}
+	parsed = true
+	return call.template, call.err
+}
+
+// Len returns the number of templates in the cache.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
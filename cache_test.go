@@ -0,0 +1,120 @@
+package mustache
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	cache := NewCache(2)
+	a, err := cache.GetOrParse("a {{x}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := cache.GetOrParse("a {{x}}"); again != a {
+		t.Error("expected the cached template to be returned")
+	}
+	if _, err := cache.GetOrParse("b {{x}}"); err != nil {
+		t.Fatal(err)
+	}
+	// a was used more recently than b, so b is evicted.
+	cache.GetOrParse("a {{x}}")
+	if _, err := cache.GetOrParse("c {{x}}"); err != nil {
+		t.Fatal(err)
+	}
+	if cache.Len() != 2 {
+		t.Errorf("expected 2 entries got %d", cache.Len())
+	}
+	if again, _ := cache.GetOrParse("a {{x}}"); again != a {
+		t.Error("expected a to survive eviction")
+	}
+
+	if _, err := cache.GetOrParse("{{#open}}"); err == nil {
+		t.Error("expected a parse error")
+	}
+	if cache.Len() != 2 {
+		t.Errorf("expected failed parses not to be cached, got %d entries", cache.Len())
+	}
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	var parses int32
+	cache := NewCache(0, func(t *Template) {
+		atomic.AddInt32(&parses, 1)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 4; j++ {
+				template, err := cache.GetOrParse("{{n}}-" + strconv.Itoa(j))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				output, _ := template.RenderString(map[string]int{"n": i})
+				if expected := strconv.Itoa(i) + "-" + strconv.Itoa(j); output != expected {
+					t.Errorf("expected %q got %q", expected, output)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if parses != 4 {
+		t.Errorf("expected 4 parses got %d", parses)
+	}
+}
+
+func TestCacheOptions(t *testing.T) {
+	escaped, raw := NewCache(0), NewCache(0, NoEscape())
+	for _, test := range []struct {
+		cache    *Cache
+		expected string
+	}{
+		{raw, "<b>"},
+		{escaped, "&lt;b&gt;"},
+	} {
+		template, err := test.cache.GetOrParse("{{x}}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output, _ := template.RenderString(map[string]string{"x": "<b>"}); output != test.expected {
+			t.Errorf("expected %q got %q", test.expected, output)
+		}
+	}
+}
+
+func TestCachePanic(t *testing.T) {
+	var calls int32
+	cache := NewCache(0, func(t *Template) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			panic("option failed")
+		}
+	})
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected the panic of the option to reach the caller")
+			}
+		}()
+		cache.GetOrParse("{{x}}")
+	}()
+	done := make(chan error)
+	go func() {
+		_, err := cache.GetOrParse("{{x}}")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected the source to be parsed again, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the cache is blocked after a panic")
+	}
+}
@@ -0,0 +1,10 @@
+module github.com/observeinc/mustache/cmd/mustache
+
+go 1.20
+
+require (
+	github.com/observeinc/mustache v1.5.0
+	github.com/observeinc/mustache/mustachetest v1.5.0
+)
+
+require gopkg.in/yaml.v3 v3.0.1 // indirect
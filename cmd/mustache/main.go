@@ -0,0 +1,239 @@
+// Command mustache checks mustache templates. Its test subcommand runs the
+// test cases kept next to templates, in files such as welcome.tests.yaml for
+// welcome.mustache, and its lint subcommand reports parse errors and the
+// findings of lint rules:
+//
+//	mustache test ./templates/...
+//	mustache lint -format sarif -no-raw ./templates/... > lint.sarif
+//
+// Its repl subcommand evaluates the fragments of template read from the
+// standard input, one per line, against the context of a JSON file, so that
+// tags and sections can be tried against sample data:
+//
+//	mustache repl -data ctx.json -partials ./templates
+//
+// A line ending with a backslash continues on the next line. The line
+// ":data" followed by JSON replaces the context, and ":quit" ends the session.
+//
+// A directory ending with /... is searched recursively. The -format flag
+// selects the output: text, the default, json or sarif. The command exits
+// with status 1 if a case fails or an issue is found. The test subcommand
+// prints every case with -v in the text format.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/observeinc/mustache"
+	"github.com/observeinc/mustache/mustachetest"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+const usage = `usage: mustache test [-format f] [-v] [dir[/...]]...
+       mustache lint [-format f] [-no-raw] [-max-nesting n] [dir[/...]]...
+       mustache repl [-data file] [-partials dir]`
+
+// run runs the command with args and returns its exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || (args[0] != "test" && args[0] != "lint" && args[0] != "repl") {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "text", "the output format: text, json or sarif")
+	verbose := flags.Bool("v", false, "print every case, not only failures")
+	noRaw := flags.Bool("no-raw", false, "report unescaped variables")
+	maxNesting := flags.Int("max-nesting", 0, "report sections nested deeper than `n`")
+	data := flags.String("data", "", "the JSON `file` holding the context of the repl")
+	partials := flags.String("partials", "", "the `dir` holding the partials of the repl")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if args[0] == "repl" {
+		return repl(stdin, stdout, stderr, *data, *partials)
+	}
+	if *format != "text" && *format != "json" && *format != "sarif" {
+		fmt.Fprintf(stderr, "unknown format %q\n", *format)
+		return 2
+	}
+	dirs := flags.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	var report mustache.Report
+	failed, total := 0, 0
+	for _, dir := range dirs {
+		recursive := dir == "..." || strings.HasSuffix(dir, "/...")
+		if recursive {
+			dir = strings.TrimSuffix(strings.TrimSuffix(dir, "..."), "/")
+			if dir == "" {
+				dir = "."
+			}
+		}
+		if args[0] == "lint" {
+			var rules []mustache.Rule
+			if *noRaw {
+				rules = append(rules, mustache.NoRawVariables())
+			}
+			if *maxNesting > 0 {
+				rules = append(rules, mustache.MaxNesting(*maxNesting))
+			}
+			if err := lint(&report, dir, recursive, rules); err != nil {
+				fmt.Fprintf(stderr, "%s: %s\n", dir, err)
+				return 1
+			}
+			continue
+		}
+		results, err := mustachetest.RunCases(os.DirFS(dir), ".", recursive)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", dir, err)
+			return 1
+		}
+		for i, r := range results {
+			r.File = strings.TrimPrefix(dir+"/"+r.File, "./")
+			results[i] = r
+			total++
+			if r.Failed() {
+				failed++
+			}
+			if *format != "text" {
+				continue
+			}
+			if r.Failed() {
+				fmt.Fprintln(stdout, "FAIL", r)
+			} else if *verbose {
+				fmt.Fprintln(stdout, "ok  ", r)
+			}
+		}
+		mustachetest.AddResults(&report, results)
+	}
+
+	var err error
+	switch {
+	case *format == "json":
+		err = report.WriteJSON(stdout)
+	case *format == "sarif":
+		err = report.WriteSARIF(stdout, "mustache")
+	case args[0] == "lint":
+		err = report.WriteText(stdout)
+	case failed > 0:
+		fmt.Fprintf(stdout, "FAIL: %d of %d cases\n", failed, total)
+	default:
+		fmt.Fprintf(stdout, "ok: %d cases\n", total)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if len(report.Issues) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// lint adds the parse errors and the findings of rules for the templates of
+// dir, and of its subdirectories if recursive, to report.
+func lint(report *mustache.Report, dir string, recursive bool, rules []mustache.Rule) error {
+	fsys := os.DirFS(dir)
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name != "." && !recursive {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if path.Ext(name) != ".mustache" {
+			return nil
+		}
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		file := strings.TrimPrefix(dir+"/"+name, "./")
+		t := mustache.New(mustache.Name(strings.TrimSuffix(path.Base(name), ".mustache")))
+		if err := t.ParseBytes(b); err != nil {
+			report.AddErrors(file, err)
+			return nil
+		}
+		report.AddFindings(t, file, mustache.Lint(t, rules...))
+		return nil
+	})
+}
+
+// repl evaluates the fragments read from in against the context held by the
+// JSON file data, if any, including the partials of the directory partials.
+func repl(in io.Reader, stdout, stderr io.Writer, data, partials string) int {
+	var context interface{}
+	if data != "" {
+		b, err := os.ReadFile(data)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		if err := json.Unmarshal(b, &context); err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", data, err)
+			return 1
+		}
+	}
+	var options []mustache.Option
+	if partials != "" {
+		options = append(options, mustache.PartialDir(os.DirFS(partials), ".", ".mustache"))
+	}
+	t := mustache.New(options...)
+
+	scanner := bufio.NewScanner(in)
+	var fragment strings.Builder
+	fmt.Fprint(stdout, "> ")
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasSuffix(line, `\`) {
+			fragment.WriteString(strings.TrimSuffix(line, `\`) + "\n")
+			fmt.Fprint(stdout, "... ")
+			continue
+		}
+		fragment.WriteString(line)
+		source := fragment.String()
+		fragment.Reset()
+		switch {
+		case source == ":quit":
+			return 0
+		case strings.HasPrefix(source, ":data "):
+			var c interface{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(source, ":data ")), &c); err != nil {
+				fmt.Fprintln(stderr, err)
+				break
+			}
+			context = c
+		case source != "":
+			output, err := t.Eval(source, context)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				break
+			}
+			fmt.Fprintln(stdout, output)
+		}
+		fmt.Fprint(stdout, "> ")
+	}
+	fmt.Fprintln(stdout)
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
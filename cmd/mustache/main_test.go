@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"templates/welcome.mustache":         "Hello {{name}}!",
+		"templates/welcome.tests.yaml":       "- {name: ann, context: {name: Ann}, expected: Hello Ann!}\n",
+		"templates/mail/receipt.mustache":    "Total: {{total}}",
+		"templates/mail/receipt.tests.yaml":  "- {name: total, context: {total: 3}, expected: 'Total: 4'}\n",
+		"templates/other/unrelated.mustache": "{{x}}",
+		"lint/page.mustache":                 "{{#a}}\n{{{raw}}}{{/a}}",
+		"lint/broken.mustache":               "{{#a}}",
+	} {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	templates := filepath.ToSlash(filepath.Join(dir, "templates"))
+	lint := filepath.ToSlash(filepath.Join(dir, "lint"))
+	for _, test := range []struct {
+		args     []string
+		status   int
+		expected string
+	}{
+		{[]string{"test", "-v", templates}, 0, "ok   " + templates + "/welcome.mustache: ann\nok: 1 cases\n"},
+		{[]string{"test", templates + "/..."}, 1, "FAIL " + templates + `/mail/receipt.mustache: total: expected "Total: 4" got "Total: 3"` + "\nFAIL: 1 of 2 cases\n"},
+		{[]string{"test", "-format", "json", templates + "/..."}, 1, `{
+  "issues": [
+    {
+      "rule": "test",
+      "level": "error",
+      "message": "total: expected \"Total: 4\" got \"Total: 3\"",
+      "file": "` + templates + `/mail/receipt.mustache"
+    }
+  ]
+}
+`},
+		{[]string{"test", "-format", "json", templates}, 0, "{\n  \"issues\": []\n}\n"},
+		{[]string{"lint", "-no-raw", lint}, 1, lint + "/broken.mustache:1:0: parse: failed to find closing tag for section \"a\" opened at 1:0\n" +
+			lint + "/page.mustache:2:0: no-raw-variables: variable \"raw\" is not escaped\n"},
+		{[]string{"lint", templates + "/..."}, 0, ""},
+		{[]string{"lint", "-format", "xml"}, 2, ""},
+		{[]string{"vet"}, 2, ""},
+	} {
+		var stdout, stderr strings.Builder
+		if status := run(test.args, nil, &stdout, &stderr); status != test.status {
+			t.Errorf("%q: expected status %d got %d: %s", test.args, test.status, status, stderr.String())
+		}
+		if stdout.String() != test.expected {
+			t.Errorf("%q: expected output %q got %q", test.args, test.expected, stdout.String())
+		}
+	}
+}
+
+func TestRepl(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"ctx.json":             `{"name": "Ann", "items": [1, 2]}`,
+		"partials/hi.mustache": "Hi {{name}}",
+	} {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	input := strings.Join([]string{
+		"{{name}}",
+		"Hello\\",
+		"{{#items}}{{.}},{{/items}}\\",
+		"{{name}}",
+		"{{>hi}}!",
+		"{{#items}}",
+		`:data {"name": "Bob"}`,
+		"{{name}}",
+		":quit",
+		"{{name}}",
+	}, "\n")
+	var stdout, stderr strings.Builder
+	args := []string{"repl", "-data", filepath.Join(dir, "ctx.json"), "-partials", filepath.Join(dir, "partials")}
+	if status := run(args, strings.NewReader(input), &stdout, &stderr); status != 0 {
+		t.Errorf("expected status 0 got %d: %s", status, stderr.String())
+	}
+	expected := "> Ann\n> ... ... Hello\n1,2,\nAnn\n> Hi Ann!\n> > > Bob\n> "
+	if stdout.String() != expected {
+		t.Errorf("expected output %q got %q", expected, stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "failed to find closing tag") {
+		t.Errorf("expected a syntax error, got %q", stderr.String())
+	}
+}
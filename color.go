@@ -0,0 +1,72 @@
+package mustache
+
+import (
+	"fmt"
+	"os"
+)
+
+// ansiColors maps color names to their ANSI foreground color codes.
+var ansiColors = map[string]int{
+	"black":   30,
+	"red":     31,
+	"green":   32,
+	"yellow":  33,
+	"blue":    34,
+	"magenta": 35,
+	"cyan":    36,
+	"white":   37,
+}
+
+const ansiReset = "\x1b[0m"
+
+// ColorHelpers makes customizers for terminal output available to the
+// template: {{~color name="red"}}, {{~bold}}, {{~dim}} and {{~underline}}
+// wrap their content in the corresponding ANSI escape codes, and
+// {{~reset}}{{/reset}} emits a reset code. If enabled is false the helpers
+// leave their content unchanged, so the same template can be used for output
+// which is not a terminal.
+func ColorHelpers(enabled bool) Option {
+	style := func(code int) CustomizerFunc {
+		return func(s string) (string, error) {
+			if !enabled || s == "" {
+				return s, nil
+			}
+			return fmt.Sprintf("\x1b[%dm%s%s", code, s, ansiReset), nil
+		}
+	}
+	return func(t *Template) {
+		t.Option(
+			CustomizeFunctionWithOptions("color", func(s string, opts map[string]string) (string, error) {
+				code, ok := ansiColors[opts["name"]]
+				if !ok {
+					return "", fmt.Errorf("unknown color %q", opts["name"])
+				}
+				return style(code)(s)
+			}),
+			CustomizeFunction("bold", style(1)),
+			CustomizeFunction("dim", style(2)),
+			CustomizeFunction("underline", style(4)),
+			CustomizeFunction("reset", func(s string) (string, error) {
+				if !enabled {
+					return s, nil
+				}
+				return s + ansiReset, nil
+			}),
+		)
+	}
+}
+
+// ColorHelpersFor is like ColorHelpers, but enables the helpers only if f is
+// a terminal.
+func ColorHelpersFor(f *os.File) Option {
+	return ColorHelpers(isTerminal(f))
+}
+
+// isTerminal reports whether f is a character device, such as a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,43 @@
+package mustache
+
+import (
+	"os"
+	"testing"
+)
+
+func TestColorHelpers(t *testing.T) {
+	input := `{{~color name="red"}}{{status}}{{/color}} {{~bold}}{{name}}{{/bold}}{{~reset}}{{/reset}}`
+	data := map[string]string{"status": "FAIL", "name": "build"}
+	for _, test := range []struct {
+		enabled  bool
+		expected string
+	}{
+		{true, "\x1b[31mFAIL\x1b[0m \x1b[1mbuild\x1b[0m\x1b[0m"},
+		{false, "FAIL build"},
+	} {
+		template := New(ColorHelpers(test.enabled))
+		if err := template.ParseString(input); err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(data)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expected {
+			t.Errorf("expected %q got %q", test.expected, output)
+		}
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	template := New(ColorHelpersFor(f))
+	if err := template.ParseString(input); err != nil {
+		t.Fatal(err)
+	}
+	if output, _ := template.RenderString(data); output != "FAIL build" {
+		t.Errorf("expected colors to be disabled for a file, got %q", output)
+	}
+}
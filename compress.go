@@ -0,0 +1,51 @@
+package mustache
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+)
+
+// FlushSections makes renders flush their destination at the end of every
+// section nested at most depth levels deep, if the destination has a Flush
+// method, such as a *gzip.Writer, a *bufio.Writer or an http.Flusher. The
+// output of large renders is then streamed section by section, e.g. as
+// compressed blocks, rather than when the destination decides to. The line
+// being written when a section ends is flushed at its end, as usual.
+func FlushSections(depth int) Option {
+	return func(t *Template) {
+		t.flushDepth = depth
+	}
+}
+
+// RenderGzip renders the template to w compressed with gzip, without holding
+// the uncompressed output in memory. The compressed stream is flushed at the
+// end of the sections given by FlushSections, or of top level sections if the
+// option is not set, so a reader may decompress the output as it arrives.
+func (t *Template) RenderGzip(w io.Writer, data ...interface{}) error {
+	zw := gzip.NewWriter(w)
+	err := t.run(context.Background(), zw, data, func(tw *writer) {
+		if tw.state.flushDepth <= 0 {
+			tw.state.flushDepth = 1
+			tw.state.flusher = zw.Flush
+		}
+	})
+	if cerr := zw.Close(); cerr != nil && err == nil {
+		err = t.tag(&WriteError{Err: cerr})
+	}
+	return err
+}
+
+// flusherOf returns the Flush method of w, or nil if it has none.
+func flusherOf(w io.Writer) func() error {
+	switch f := w.(type) {
+	case interface{ Flush() error }:
+		return f.Flush
+	case interface{ Flush() }:
+		return func() error {
+			f.Flush()
+			return nil
+		}
+	}
+	return nil
+}
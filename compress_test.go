@@ -0,0 +1,135 @@
+package mustache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// flushBuffer counts the flushes of a buffer.
+type flushBuffer struct {
+	bytes.Buffer
+	flushes []string // the output at each flush
+	err     error
+}
+
+func (b *flushBuffer) Flush() error {
+	b.flushes = append(b.flushes, b.String())
+	return b.err
+}
+
+func TestFlushSections(t *testing.T) {
+	source := "{{#a}}a{{#b}}b{{/b}}\n{{/a}}{{#c}}c\n{{/c}}"
+	data := map[string]interface{}{"a": []int{1, 2}, "b": true, "c": true}
+	for _, test := range []struct {
+		depth   int
+		flushes []string
+	}{
+		{0, nil},
+		{1, []string{"ab\nab\n", "ab\nab\nc\n"}},
+		{2, []string{"", "ab\n", "ab\nab\n", "ab\nab\nc\n"}},
+	} {
+		template := New(FlushSections(test.depth))
+		if err := template.ParseString(source); err != nil {
+			t.Fatal(err)
+		}
+		var b flushBuffer
+		if err := template.Render(&b, data); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != "ab\nab\nc\n" {
+			t.Errorf("depth %d: unexpected output %q", test.depth, b.String())
+		}
+		if strings.Join(b.flushes, "|") != strings.Join(test.flushes, "|") {
+			t.Errorf("depth %d: expected flushes %q got %q", test.depth, test.flushes, b.flushes)
+		}
+	}
+
+	template := New(FlushSections(1))
+	if err := template.ParseString(source); err != nil {
+		t.Fatal(err)
+	}
+	failure := errors.New("failed")
+	var e *WriteError
+	if err := template.Render(&flushBuffer{err: failure}, data); !errors.As(err, &e) || e.Err != failure {
+		t.Errorf("expected a *WriteError, got %v", err)
+	}
+}
+
+// writeCounter counts the writes to a buffer.
+type writeCounter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *writeCounter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestRenderGzip(t *testing.T) {
+	template := New()
+	if err := template.ParseString("{{#items}}{{.}} {{/items}}{{#more}}more{{/more}}"); err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]interface{}{"items": []int{1, 2, 3}, "more": true}
+	var b writeCounter
+	if err := template.RenderGzip(&b, data); err != nil {
+		t.Fatal(err)
+	}
+	// The header, a block for each of the two sections, and the end of the
+	// stream are written separately.
+	if b.writes < 4 {
+		t.Errorf("expected the sections to be flushed, got %d writes", b.writes)
+	}
+	r, err := gzip.NewReader(&b.Buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(output) != "1 2 3 more" {
+		t.Errorf("unexpected output %q", output)
+	}
+}
+
+func TestRenderGzipStream(t *testing.T) {
+	// The sections streamed to a customizer do not flush the destination
+	// the customizer writes to.
+	template := New(CustomizeFunctionStream("copy", func(w io.Writer, r io.Reader, _ map[string]string) error {
+		_, err := io.Copy(w, r)
+		return err
+	}))
+	section := "{{#items}}{{.}} {{/items}}"
+	if err := template.ParseString("{{~copy}}" + strings.Repeat(section, 20) + "{{/copy}}{{#more}}more{{/more}}"); err != nil {
+		t.Fatal(err)
+	}
+	items := make([]int, 1000)
+	var expected strings.Builder
+	for i := range items {
+		items[i] = i
+		expected.WriteString(strconv.Itoa(i) + " ")
+	}
+	expected.WriteString(strings.Repeat(expected.String(), 19) + "more")
+	var b bytes.Buffer
+	if err := template.RenderGzip(&b, map[string]interface{}{"items": items, "more": true}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(output) != expected.String() {
+		t.Errorf("unexpected output %q", output)
+	}
+}
@@ -0,0 +1,235 @@
+package mustache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DateHelper makes the {{~date}} customizer available to the template. It
+// parses its content as a point in time and formats it in the time zone given
+// by the tz option, an IANA name such as "Europe/Berlin", using the layout
+// option, a Go reference time layout. The time zone defaults to UTC and the
+// layout to RFC 3339. Options may be looked up in the context, so that times
+// can be rendered in each user's time zone.
+//
+//	{{~date tz={{user.tz}} layout="Jan 2 15:04"}}{{created_at}}{{/date}}
+//
+// The content may be an RFC 3339 timestamp or a rendered time.Time value.
+func DateHelper() Option {
+	return CustomizeFunctionWithOptions("date", func(s string, opts map[string]string) (string, error) {
+		tm, err := parseTime(strings.TrimSpace(s))
+		if err != nil {
+			return "", err
+		}
+		loc := time.UTC
+		if tz, ok := opts["tz"]; ok && tz != "" {
+			loc, err = time.LoadLocation(tz)
+			if err != nil {
+				return "", fmt.Errorf("invalid date tz %q", tz)
+			}
+		}
+		layout := time.RFC3339
+		if v, ok := opts["layout"]; ok {
+			layout = v
+		}
+		return tm.In(loc).Format(layout), nil
+	})
+}
+
+// TimeFormat makes time.Time and *time.Time values render in layout, a Go
+// reference time layout such as "Jan 2, 2006", rather than as formatted by
+// their String method. With TimeFormat or DurationFormat, variable tags take a
+// format option overriding the layout, or the unit of durations, for their
+// value:
+//
+//	{{created_at format="2006-01-02"}} took {{elapsed format="1m"}}
+func TimeFormat(layout string) Option {
+	return func(t *Template) {
+		t.timeLayout = layout
+	}
+}
+
+// DurationFormat makes time.Duration values render rounded to a multiple of
+// unit, e.g. 1h2m3s rather than 1h2m3.456789s for time.Second.
+func DurationFormat(unit time.Duration) Option {
+	return func(t *Template) {
+		t.durationUnit = unit
+	}
+}
+
+// formatTime returns v formatted after the options of t, or format if not
+// empty, if it is a time or a duration, and v otherwise.
+func (t *Template) formatTime(v interface{}, format string) (interface{}, error) {
+	switch tm := v.(type) {
+	case *time.Time:
+		if tm == nil {
+			return v, nil
+		}
+		return t.formatTime(*tm, format)
+	case time.Time:
+		layout := t.timeLayout
+		if format != "" {
+			layout = format
+		}
+		if layout == "" {
+			return v, nil
+		}
+		return tm.Format(layout), nil
+	case time.Duration:
+		unit := t.durationUnit
+		if format != "" {
+			var err error
+			if unit, err = time.ParseDuration(format); err != nil || unit <= 0 {
+				return nil, fmt.Errorf("invalid duration format %q", format)
+			}
+		}
+		if unit <= 0 {
+			return v, nil
+		}
+		return tm.Round(unit).String(), nil
+	}
+	return v, nil
+}
+
+// timeStringLayout is the layout used by time.Time's String method.
+const timeStringLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// parseTime parses s as an RFC 3339 timestamp, or as the output of
+// time.Time's String method.
+func parseTime(s string) (time.Time, error) {
+	if tm, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return tm, nil
+	}
+	// Drop the monotonic clock reading, which time.Parse does not accept.
+	if i := strings.Index(s, " m="); i >= 0 {
+		s = s[:i]
+	}
+	if tm, err := time.Parse(timeStringLayout, s); err == nil {
+		return tm, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+type nowKey struct{}
+
+// WithNow returns a copy of ctx which pins the current time seen by helpers
+// such as {{~ago}} to now. Passing it to RenderContext makes the output of a
+// render independent of when it happens, which is useful in tests.
+func WithNow(ctx context.Context, now time.Time) context.Context {
+	return context.WithValue(ctx, nowKey{}, now)
+}
+
+// nowFrom returns the time pinned to ctx with WithNow, or the current time.
+func nowFrom(ctx context.Context) time.Time {
+	if now, ok := ctx.Value(nowKey{}).(time.Time); ok {
+		return now
+	}
+	return time.Now()
+}
+
+// RelativeTimeHelper makes the {{~ago}} customizer available to the template.
+// It parses its content like {{~date}} and describes it relative to the
+// current time, e.g. "3 hours ago" or "in 2 days". The locale option selects
+// the language, one of en (the default), de, es or fr. The current time can be
+// pinned per render with WithNow.
+//
+//	{{~ago locale={{user.locale}}}}{{created_at}}{{/ago}}
+func RelativeTimeHelper() Option {
+	return CustomizeFunctionCtx("ago", func(ctx context.Context, s string, opts map[string]string) (string, error) {
+		tm, err := parseTime(strings.TrimSpace(s))
+		if err != nil {
+			return "", err
+		}
+		loc, ok := relativeLocales[language(opts["locale"])]
+		if !ok {
+			return "", fmt.Errorf("unsupported ago locale %q", opts["locale"])
+		}
+		return loc.format(nowFrom(ctx).Sub(tm)), nil
+	})
+}
+
+// relativeLocale holds the words used to describe a relative time in one
+// language.
+type relativeLocale struct {
+	now    string
+	past   string       // format for durations in the past
+	future string       // format for durations in the future
+	units  [5][2]string // singular and plural of minute, hour, day, month and year
+}
+
+// format describes d, the duration elapsed since a point in time, rounding
+// down to the largest whole unit.
+func (l relativeLocale) format(d time.Duration) string {
+	past := d >= 0
+	if !past {
+		d = -d
+	}
+	if d < time.Minute {
+		return l.now
+	}
+	const day = 24 * time.Hour
+	var n int64
+	var unit int
+	switch {
+	case d < time.Hour:
+		n, unit = int64(d/time.Minute), 0
+	case d < day:
+		n, unit = int64(d/time.Hour), 1
+	case d < 30*day:
+		n, unit = int64(d/day), 2
+	case d < 365*day:
+		n, unit = int64(d/(30*day)), 3
+	default:
+		n, unit = int64(d/(365*day)), 4
+	}
+	word := l.units[unit][1]
+	if n == 1 {
+		word = l.units[unit][0]
+	}
+	if past {
+		return fmt.Sprintf(l.past, n, word)
+	}
+	return fmt.Sprintf(l.future, n, word)
+}
+
+// relativeLocales are the locales known to {{~ago}}, keyed by language code.
+var relativeLocales = map[string]relativeLocale{
+	"en": {
+		now:    "just now",
+		past:   "%d %s ago",
+		future: "in %d %s",
+		units: [5][2]string{
+			{"minute", "minutes"}, {"hour", "hours"},
+			{"day", "days"}, {"month", "months"}, {"year", "years"},
+		},
+	},
+	"de": {
+		now:    "gerade eben",
+		past:   "vor %d %s",
+		future: "in %d %s",
+		units: [5][2]string{
+			{"Minute", "Minuten"}, {"Stunde", "Stunden"},
+			{"Tag", "Tagen"}, {"Monat", "Monaten"}, {"Jahr", "Jahren"},
+		},
+	},
+	"es": {
+		now:    "ahora mismo",
+		past:   "hace %d %s",
+		future: "dentro de %d %s",
+		units: [5][2]string{
+			{"minuto", "minutos"}, {"hora", "horas"},
+			{"día", "días"}, {"mes", "meses"}, {"año", "años"},
+		},
+	},
+	"fr": {
+		now:    "à l'instant",
+		past:   "il y a %d %s",
+		future: "dans %d %s",
+		units: [5][2]string{
+			{"minute", "minutes"}, {"heure", "heures"},
+			{"jour", "jours"}, {"mois", "mois"}, {"an", "ans"},
+		},
+	},
+}
@@ -0,0 +1,145 @@
+package mustache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeFormat(t *testing.T) {
+	created := time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC)
+	data := map[string]interface{}{
+		"created": created,
+		"updated": &created,
+		"elapsed": 90*time.Minute + 3456*time.Millisecond,
+		"items":   []time.Time{created, created.AddDate(0, 0, 1)},
+	}
+	for _, test := range []struct {
+		options  []Option
+		template string
+		expected string
+	}{
+		{nil, `{{elapsed}}`, "1h30m3.456s"},
+		{[]Option{TimeFormat("Jan 2, 2006")}, `{{created}} {{updated}} {{elapsed}}`, "Mar 5, 2024 Mar 5, 2024 1h30m3.456s"},
+		{[]Option{TimeFormat("Jan 2")}, `{{#items}}{{.}};{{/items}}`, "Mar 5;Mar 6;"},
+		{[]Option{TimeFormat("Jan 2")}, `{{created format="2006-01-02 15:04"}} {{{updated format="Mon"}}}`, "2024-03-05 14:30 Tue"},
+		{[]Option{DurationFormat(time.Second)}, `{{elapsed}} {{elapsed format="1m"}}`, "1h30m3s 1h30m0s"},
+		{[]Option{TimeFormat("Jan 2"), CoalesceTags()}, `{{coalesce missing created}}`, "Mar 5"},
+		{[]Option{TimeFormat("Jan 2"), FilterPipes(), CustomizeFunction("upper", func(s string) (string, error) {
+			return strings.ToUpper(s), nil
+		})}, `{{created format="Jan" | upper}}`, "MAR"},
+	} {
+		template := New(test.options...)
+		if err := template.ParseString(test.template); err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(data)
+		if err != nil {
+			t.Errorf("%q: %s", test.template, err)
+		} else if output != test.expected {
+			t.Errorf("%q: expected %q got %q", test.template, test.expected, output)
+		}
+	}
+
+	template := New(DurationFormat(time.Second), SilentMiss(false))
+	if err := template.ParseString(`{{elapsed format="soon"}}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := template.RenderString(data); err == nil || err.Error() != `invalid duration format "soon"` {
+		t.Errorf("expected an invalid duration format error, got %v", err)
+	}
+}
+
+func TestDateHelper(t *testing.T) {
+	created := time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC)
+	now := time.Now() // carries a monotonic clock reading
+	for _, test := range []templateTest{
+		{
+			`{{~date}}{{at}}{{/date}}`,
+			map[string]interface{}{"at": "2024-03-05T14:30:00Z"},
+			"2024-03-05T14:30:00Z",
+		},
+		{
+			`{{~date tz="America/New_York" layout="Jan 2 15:04 MST"}}{{at}}{{/date}}`,
+			map[string]interface{}{"at": "2024-03-05T14:30:00Z"},
+			"Mar 5 09:30 EST",
+		},
+		{
+			`{{~date tz={{user.tz}} layout="Jan 2 15:04"}}{{at}}{{/date}}`,
+			map[string]interface{}{"at": created, "user": map[string]string{"tz": "Asia/Tokyo"}},
+			"Mar 5 23:30",
+		},
+		{
+			`{{~date layout="2006-01-02"}}{{at}}{{/date}}`,
+			map[string]interface{}{"at": now},
+			now.UTC().Format("2006-01-02"),
+		},
+		{
+			`{{~date tz={{tz}} layout="15:04"}}{{at}}{{/date}}`,
+			map[string]interface{}{"at": "2024-03-05T14:30:00+01:00"},
+			"13:30",
+		},
+	} {
+		template := New(DateHelper())
+		if err := template.ParseString(test.template); err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(test.payload)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expect {
+			t.Errorf("expected %q got %q", test.expect, output)
+		}
+	}
+
+	for _, payload := range []map[string]interface{}{
+		{"at": "yesterday"},
+		{"at": "2024-03-05T14:30:00Z", "tz": "Nowhere/Special"},
+	} {
+		template := New(DateHelper(), SilentMiss(false))
+		if err := template.ParseString(`{{~date tz={{tz}}}}{{at}}{{/date}}`); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := template.RenderString(payload); err == nil {
+			t.Errorf("expected an error for %v", payload)
+		}
+	}
+}
+
+func TestRelativeTimeHelper(t *testing.T) {
+	now := time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC)
+	ctx := WithNow(context.Background(), now)
+	for _, test := range []templateTest{
+		{`{{~ago}}{{at}}{{/ago}}`, map[string]interface{}{"at": now.Add(-20 * time.Second)}, "just now"},
+		{`{{~ago}}{{at}}{{/ago}}`, map[string]interface{}{"at": now.Add(-time.Minute)}, "1 minute ago"},
+		{`{{~ago}}{{at}}{{/ago}}`, map[string]interface{}{"at": "2024-03-05T11:10:00Z"}, "3 hours ago"},
+		{`{{~ago}}{{at}}{{/ago}}`, map[string]interface{}{"at": now.Add(49 * time.Hour)}, "in 2 days"},
+		{`{{~ago}}{{at}}{{/ago}}`, map[string]interface{}{"at": "2023-12-01T00:00:00Z"}, "3 months ago"},
+		{`{{~ago}}{{at}}{{/ago}}`, map[string]interface{}{"at": "2021-01-01T00:00:00Z"}, "3 years ago"},
+		{`{{~ago locale="de-DE"}}{{at}}{{/ago}}`, map[string]interface{}{"at": now.Add(-3 * time.Hour)}, "vor 3 Stunden"},
+		{`{{~ago locale={{lang}}}}{{at}}{{/ago}}`, map[string]interface{}{"at": now.Add(-24 * time.Hour), "lang": "fr"}, "il y a 1 jour"},
+		{`{{~ago locale={{lang}}}}{{at}}{{/ago}}`, map[string]interface{}{"at": now.Add(5 * time.Minute), "lang": "es"}, "dentro de 5 minutos"},
+	} {
+		template := New(RelativeTimeHelper())
+		if err := template.ParseString(test.template); err != nil {
+			t.Fatal(err)
+		}
+		var b strings.Builder
+		if err := template.RenderContext(ctx, &b, test.payload); err != nil {
+			t.Error(err)
+		}
+		if output := b.String(); output != test.expect {
+			t.Errorf("expected %q got %q", test.expect, output)
+		}
+	}
+
+	template := New(RelativeTimeHelper(), SilentMiss(false))
+	if err := template.ParseString(`{{~ago locale="xx"}}{{at}}{{/ago}}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := template.RenderString(map[string]interface{}{"at": now}); err == nil {
+		t.Error("expected an error for an unsupported locale")
+	}
+}
@@ -0,0 +1,84 @@
+package mustache
+
+import "strings"
+
+// DeprecatedKey is the metadata key marking a template as deprecated when it
+// is set with WithMetadata. Its value names the partial to use instead, and
+// may be empty. Renders including the template as a partial report a
+// DeprecatedWarning.
+const DeprecatedKey = "deprecated"
+
+// Deprecate marks the variables named by the keys of variables as deprecated.
+// The values name the variables to use instead, and may be empty. A tag
+// looking up a deprecated name, or a name under it such as user.email for
+// user, is reported by RenderResult as a DeprecatedWarning: variables and
+// sections, and the names given to the sections and tags enabled by options,
+// such as let bindings, zip and chunk lists, switch values and the options of
+// function sections. Use the DeprecatedVariables rule to find such tags with
+// Lint instead.
+func Deprecate(variables map[string]string) Option {
+	return func(t *Template) {
+		// The names are copied, as the map may be shared with clones of t.
+		deprecated := make(map[string]string, len(t.deprecated)+len(variables))
+		for name, replacement := range t.deprecated {
+			deprecated[name] = replacement
+		}
+		for name, replacement := range variables {
+			deprecated[name] = replacement
+		}
+		t.deprecated = deprecated
+	}
+}
+
+// deprecatedName reports whether name or one of the names it is under is a
+// key of deprecated, returning the replacement of the longest such key.
+func deprecatedName(deprecated map[string]string, name string) (string, bool) {
+	for {
+		if replacement, ok := deprecated[name]; ok {
+			return replacement, true
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			return "", false
+		}
+		name = name[:i]
+	}
+}
+
+// deprecation records a warning if name, referred to by the tag at offset,
+// is a deprecated variable of t.
+func (t *Template) deprecation(w *writer, name string, offset int) {
+	if len(t.deprecated) == 0 || w.state.warnings == nil {
+		return
+	}
+	if replacement, ok := deprecatedName(t.deprecated, name); ok {
+		pos := t.position(offset)
+		w.warn(Warning{
+			Kind:        DeprecatedWarning,
+			Name:        name,
+			Replacement: replacement,
+			Line:        pos.Line,
+			Col:         pos.Col,
+			Template:    t.name,
+		})
+	}
+}
+
+// partialDeprecation records a warning if the partial p of t, rendered by
+// the template partial, is deprecated.
+func (t *Template) partialDeprecation(w *writer, p *partialNode, partial *Template) {
+	if w.state.warnings == nil {
+		return
+	}
+	if replacement, ok := partial.metadata[DeprecatedKey]; ok {
+		pos := t.position(p.outer.start)
+		w.warn(Warning{
+			Kind:        DeprecatedWarning,
+			Name:        p.name,
+			Replacement: replacement,
+			Line:        pos.Line,
+			Col:         pos.Col,
+			Template:    t.name,
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package mustache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeprecate(t *testing.T) {
+	header := New(Name("old_header"), WithMetadata(map[string]string{DeprecatedKey: "header"}))
+	if err := header.ParseString("[{{user.name}}]"); err != nil {
+		t.Fatal(err)
+	}
+	template := New(
+		Name("page"),
+		Partial(header),
+		Deprecate(map[string]string{"user": "account", "title": ""}),
+	)
+	if err := template.ParseString("{{>old_header}}\n{{title}} {{#user}}{{name}}{{/user}} {{account.name}}"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := template.RenderResult(map[string]interface{}{
+		"user":    map[string]string{"name": "Ann"},
+		"account": map[string]string{"name": "Ann"},
+		"title":   "Home",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Output) != "[Ann]\nHome Ann Ann" {
+		t.Errorf("unexpected output %q", res.Output)
+	}
+	var warnings []string
+	for _, w := range res.Warnings {
+		warnings = append(warnings, w.String())
+	}
+	// The variables of old_header are not deprecated by the options of page.
+	expected := []string{
+		"page:1:0 deprecated old_header, use header",
+		"page:2:0 deprecated title",
+		"page:2:10 deprecated user, use account",
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("expected %q got %q", expected, warnings)
+	}
+
+	// Deprecated names do not change renders without warnings.
+	if s, err := template.RenderString(map[string]string{"title": "Home"}); err != nil || s != "[]\nHome  " {
+		t.Errorf("unexpected render %q, %v", s, err)
+	}
+
+	// Every tag looking up a name reports it.
+	template = New(
+		LetSections(), ZipSections(), ChunkSections(), SwitchSections(), TypeTestSections(), CountSections(),
+		CustomizeFunction("f", func(s string) (string, error) { return s, nil }),
+		Deprecate(map[string]string{"old": "new"}),
+	)
+	err = template.ParseString(`{{#let v=old w=v}}{{/let}}{{#zip old b}}{{/zip}}{{#chunk old 1}}{{/chunk}}` +
+		`{{#switch old}}{{/switch}}{{#is_list old}}{{/is_list}}{{#min_count old 1}}{{/min_count}}{{~f tz={{old.tz}}}}{{/f}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = template.RenderResult(map[string]interface{}{"old": []int{1}, "b": []int{2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	warnings = nil
+	for _, w := range res.Warnings {
+		warnings = append(warnings, w.String())
+	}
+	expected = []string{
+		"1:0 deprecated old, use new",
+		"1:26 deprecated old, use new",
+		"1:48 deprecated old, use new",
+		"1:74 deprecated old, use new",
+		"1:100 deprecated old, use new",
+		"1:128 deprecated old, use new",
+		"1:162 deprecated old.tz, use new",
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("expected %q got %q", expected, warnings)
+	}
+}
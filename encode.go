@@ -0,0 +1,614 @@
+package mustache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// encodingVersion is the version of the binary and JSON encodings of
+// templates. It is incremented whenever the encodings change incompatibly.
+const encodingVersion = 2
+
+// MarshalBinary encodes the parse tree of the template, so that it can be
+// parsed once, for example at build time, and loaded with UnmarshalBinary
+// without lexing and parsing the source again.
+//
+// Only the parse tree, the name, the delimiters and the constants of the
+// template are encoded. Options, customizers and partials are not.
+func (t *Template) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(t.encode()); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// UnmarshalBinary replaces the parse tree of the template with one encoded by
+// MarshalBinary. The options, customizers and partials of t are kept, so t
+// should be created with the options the encoded template was parsed with.
+//
+//	t := mustache.New(mustache.SwitchSections())
+//	if err := t.UnmarshalBinary(data); err != nil {
+//		// handle error
+//	}
+func (t *Template) UnmarshalBinary(data []byte) error {
+	var enc encodedTemplate
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&enc); err != nil {
+		return fmt.Errorf("decoding template: %w", err)
+	}
+	return t.decode(enc)
+}
+
+// MarshalJSON encodes the parse tree of the template as JSON, for tools
+// written in other languages. The encoding is an object with the fields
+//
+//	version     the version of the encoding, currently 2
+//	name        the name of the template
+//	startDelim  the delimiters of the template
+//	endDelim
+//	consts      the constants defined by the template, by name
+//	elems       the nodes of the template
+//
+// Each node is an object whose "type" field is one of "text", "var",
+// "coalesce", "translate", "section", "function", "test_value", "type_test",
+// "count", "chunk", "zip", "switch", "let", "capture", "partial", "comment",
+// "const", "delim", "trim" or "raw". Its other fields are omitted when empty:
+//
+//	name        the text of text, comment and raw nodes, the source of delim nodes,
+//	            the text left out of the output for trim nodes, i.e. whitespace
+//	            removed by trim markers and escaping backslashes, the message
+//	            key of translate nodes and the name of the other nodes
+//	kind        the keyword of type_test and count sections, e.g. "is_list"
+//	value       the value of test_value sections and of the cases of a switch
+//	tag         the source of var tags
+//	path        the segments of the looked up name, as {"key", "quoted"}
+//	escape      "html", "json" or "none" for var, coalesce and translate tags,
+//	            or with ContextualAutoEscape "attr", "url", "url_part",
+//	            "url_query", "js", "js_attr", "js_string" or "css"
+//	filters     the filters of var tags and let bindings, as {"name", "args"}
+//	format      the format option of var tags
+//	line, col   the position of the start of var tags
+//	inverted    true for inverted sections
+//	offset      the offset and limit of paginated sections
+//	limit
+//	count       the count of count sections and the size of chunk sections
+//	opts        the literal options of function sections
+//	optPaths    the looked up options of function sections, as paths
+//	optParts    the options of function sections interpolating variables, as
+//	            {"path"} and {"literal"} parts
+//	args        the arguments of coalesce tags, the bindings of let sections
+//	            and translate tags and the lists of zip sections, as {"name",
+//	            "ident", "path", "literal", "filters"}, and the positional
+//	            arguments of function sections, as {"literal"}
+//	elems       the children of sections
+//	cases       the cases of a switch, as nodes of type "case", with a value,
+//	            and "default"
+//	start, end  the range of bytes of the node in the source, see Span
+//	bodyStart   the range of bytes of the children of sections
+//	bodyEnd
+//
+// Ranges are not encoded for text nodes, as they follow from the preceding
+// nodes.
+//
+// As with MarshalBinary, options, customizers and partials are not encoded.
+func (t *Template) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.encode())
+}
+
+// UnmarshalJSON replaces the parse tree of the template with one encoded by
+// MarshalJSON. Like UnmarshalBinary, the options of t are kept.
+func (t *Template) UnmarshalJSON(data []byte) error {
+	var enc encodedTemplate
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return fmt.Errorf("decoding template: %w", err)
+	}
+	return t.decode(enc)
+}
+
+func (t *Template) encode() encodedTemplate {
+	return encodedTemplate{
+		Version:    encodingVersion,
+		Name:       t.name,
+		StartDelim: t.startDelim,
+		EndDelim:   t.endDelim,
+		Consts:     t.consts,
+		Elems:      encodeNodes(t.elems),
+	}
+}
+
+func (t *Template) decode(enc encodedTemplate) error {
+	if enc.Version != encodingVersion {
+		return fmt.Errorf("unsupported template encoding version %d", enc.Version)
+	}
+	elems, err := decodeNodes(enc.Elems)
+	if err != nil {
+		return err
+	}
+	if enc.Name != "" {
+		t.name = enc.Name
+	}
+	if enc.StartDelim != "" && enc.EndDelim != "" {
+		t.startDelim, t.endDelim = enc.StartDelim, enc.EndDelim
+	}
+	t.consts = enc.Consts
+	if t.consts == nil {
+		t.consts = make(map[string]string)
+	}
+	t.elems = elems
+	t.starts = nil
+	return nil
+}
+
+// encodedTemplate is the encoded form of a template, shared by the binary and
+// JSON encodings.
+type encodedTemplate struct {
+	Version    int               `json:"version"`
+	Name       string            `json:"name,omitempty"`
+	StartDelim string            `json:"startDelim"`
+	EndDelim   string            `json:"endDelim"`
+	Consts     map[string]string `json:"consts,omitempty"`
+	Elems      []encodedNode     `json:"elems"`
+}
+
+// The types of encoded nodes.
+const (
+	encodedText      = "text"
+	encodedVar       = "var"
+	encodedCoalesce  = "coalesce"
+	encodedTranslate = "translate"
+	encodedSection   = "section"
+	encodedFunction  = "function"
+	encodedTest      = "test_value"
+	encodedTypeTest  = "type_test"
+	encodedCount     = "count"
+	encodedChunk     = "chunk"
+	encodedZip       = "zip"
+	encodedSwitch    = "switch"
+	encodedCase      = "case"
+	encodedDefault   = "default"
+	encodedLet       = "let"
+	encodedCapture   = "capture"
+	encodedPartial   = "partial"
+	encodedComment   = "comment"
+	encodedConst     = "const"
+	encodedDelim     = "delim"
+	encodedTrim      = "trim"
+	encodedVerbatim  = "raw"
+)
+
+// encodedNode is the encoded form of a node. The meaning of the fields
+// depends on Type; unused fields are left empty.
+type encodedNode struct {
+	Type      string                      `json:"type"`
+	Name      string                      `json:"name,omitempty"` // the name, text or source of the node
+	Kind      string                      `json:"kind,omitempty"` // the keyword of type test and count sections
+	Value     string                      `json:"value,omitempty"`
+	Tag       string                      `json:"tag,omitempty"`
+	Path      []encodedSegment            `json:"path,omitempty"`
+	Escape    string                      `json:"escape,omitempty"`
+	Line      int                         `json:"line,omitempty"`
+	Col       int                         `json:"col,omitempty"`
+	Inverted  bool                        `json:"inverted,omitempty"`
+	Offset    int                         `json:"offset,omitempty"`
+	Limit     int                         `json:"limit,omitempty"`
+	Count     int                         `json:"count,omitempty"` // the count of count sections or the size of chunks
+	Opts      map[string]string           `json:"opts,omitempty"`
+	OptPaths  map[string][]encodedSegment `json:"optPaths,omitempty"`
+	OptParts  map[string][]encodedArg     `json:"optParts,omitempty"`
+	Args      []encodedArg                `json:"args,omitempty"`
+	Filters   []encodedFilter             `json:"filters,omitempty"`
+	Format    string                      `json:"format,omitempty"`
+	Elems     []encodedNode               `json:"elems,omitempty"`
+	Cases     []encodedNode               `json:"cases,omitempty"` // the case and default nodes of a switch
+	Start     int                         `json:"start,omitempty"`
+	End       int                         `json:"end,omitempty"`
+	BodyStart int                         `json:"bodyStart,omitempty"`
+	BodyEnd   int                         `json:"bodyEnd,omitempty"`
+}
+
+// setSpans records s in e.
+func (e *encodedNode) setSpans(s spans) {
+	e.Start, e.End, e.BodyStart, e.BodyEnd = s.outer.start, s.outer.end, s.inner.start, s.inner.end
+}
+
+// spans returns the ranges recorded in e.
+func (e *encodedNode) spans() spans {
+	return spans{outer: span{e.Start, e.End}, inner: span{e.BodyStart, e.BodyEnd}}
+}
+
+// encodedFilter is a stage of a variable tag or let binding with filters.
+type encodedFilter struct {
+	Name string   `json:"name"`
+	Args []string `json:"args,omitempty"`
+}
+
+// encodedArg is an argument of a coalesce tag, a binding of a let section or
+// an identifier of a zip section.
+type encodedArg struct {
+	Name    string           `json:"name,omitempty"`
+	Ident   string           `json:"ident,omitempty"`
+	Path    []encodedSegment `json:"path,omitempty"`
+	Literal string           `json:"literal,omitempty"`
+	Filters []encodedFilter  `json:"filters,omitempty"`
+}
+
+type encodedSegment struct {
+	Key    string `json:"key"`
+	Quoted bool   `json:"quoted,omitempty"`
+}
+
+// encodeEscape and decodeEscape convert escape types to and from their names
+// in the encoding.
+func encodeEscape(e escapeType) string {
+	for name, escape := range escapeNames {
+		if escape == e {
+			return name
+		}
+	}
+	return "html"
+}
+
+func decodeEscape(s string) (escapeType, error) {
+	if s == "" {
+		return htmlEscape, nil
+	}
+	if escape, ok := escapeNames[s]; ok {
+		return escape, nil
+	}
+	return 0, fmt.Errorf("invalid escape %q", s)
+}
+
+// escapeNames are the names of the escape types in the encoding.
+var escapeNames = map[string]escapeType{
+	"none":      noEscape,
+	"html":      htmlEscape,
+	"json":      jsonEscape,
+	"attr":      attrEscape,
+	"url":       urlEscape,
+	"url_part":  urlPartEscape,
+	"url_query": urlQueryEscape,
+	"js":        jsEscape,
+	"js_attr":   jsAttrEscape,
+	"js_string": jsStringEscape,
+	"css":       cssEscape,
+}
+
+func encodePath(path []pathSegment) []encodedSegment {
+	if path == nil {
+		return nil
+	}
+	segs := make([]encodedSegment, len(path))
+	for i, seg := range path {
+		segs[i] = encodedSegment{Key: seg.key, Quoted: seg.quoted}
+	}
+	return segs
+}
+
+func decodePath(segs []encodedSegment) []pathSegment {
+	if segs == nil {
+		return nil
+	}
+	path := make([]pathSegment, len(segs))
+	for i, seg := range segs {
+		path[i] = pathSegment{key: seg.Key, quoted: seg.Quoted}
+	}
+	return path
+}
+
+func encodeFilters(filters []filter) []encodedFilter {
+	var encoded []encodedFilter
+	for _, f := range filters {
+		encoded = append(encoded, encodedFilter{Name: f.name, Args: f.args})
+	}
+	return encoded
+}
+
+func decodeFilters(encoded []encodedFilter) []filter {
+	var filters []filter
+	for _, f := range encoded {
+		filters = append(filters, filter{name: f.Name, args: f.Args})
+	}
+	return filters
+}
+
+func encodeBindings(bindings []letBinding) []encodedArg {
+	args := make([]encodedArg, len(bindings))
+	for i, b := range bindings {
+		args[i] = encodedArg{Name: b.name, Ident: b.ident, Path: encodePath(b.path), Literal: b.literal, Filters: encodeFilters(b.filters)}
+	}
+	return args
+}
+
+func decodeBindings(args []encodedArg) []letBinding {
+	bindings := make([]letBinding, len(args))
+	for i, arg := range args {
+		bindings[i] = letBinding{name: arg.Name, ident: arg.Ident, path: decodePath(arg.Path), literal: arg.Literal, filters: decodeFilters(arg.Filters)}
+	}
+	return bindings
+}
+
+func encodeNodes(nodes []node) []encodedNode {
+	enc := make([]encodedNode, 0, len(nodes))
+	for _, n := range nodes {
+		e := encodeNode(n)
+		if s, ok := n.(spanned); ok {
+			e.setSpans(s.nodeSpans())
+		}
+		enc = append(enc, e)
+	}
+	return enc
+}
+
+func encodeNode(n node) encodedNode {
+	switch n := n.(type) {
+	case textNode:
+		return encodedNode{Type: encodedText, Name: string(n)}
+	case *varNode:
+		return encodedNode{
+			Type:    encodedVar,
+			Name:    n.name,
+			Path:    encodePath(n.path),
+			Escape:  encodeEscape(n.escape),
+			Filters: encodeFilters(n.filters),
+			Format:  n.format,
+			Tag:     n.tag,
+			Line:    n.line,
+			Col:     n.col,
+		}
+	case *coalesceNode:
+		args := make([]encodedArg, len(n.args))
+		for i, arg := range n.args {
+			args[i] = encodedArg{Ident: arg.ident, Path: encodePath(arg.path), Literal: arg.literal}
+		}
+		return encodedNode{Type: encodedCoalesce, Args: args, Escape: encodeEscape(n.escape)}
+	case *translateNode:
+		return encodedNode{Type: encodedTranslate, Name: n.key, Args: encodeBindings(n.args), Escape: encodeEscape(n.escape)}
+	case *sectionNode:
+		return encodedNode{
+			Type:     encodedSection,
+			Name:     n.name,
+			Path:     encodePath(n.path),
+			Inverted: n.inverted,
+			Offset:   n.offset,
+			Limit:    n.limit,
+			Elems:    encodeNodes(n.elems),
+		}
+	case *functionSectionNode:
+		var optPaths map[string][]encodedSegment
+		if n.optPaths != nil {
+			optPaths = make(map[string][]encodedSegment, len(n.optPaths))
+			for k, path := range n.optPaths {
+				optPaths[k] = encodePath(path)
+			}
+		}
+		var optParts map[string][]encodedArg
+		if n.optParts != nil {
+			optParts = make(map[string][]encodedArg, len(n.optParts))
+			for k, parts := range n.optParts {
+				args := make([]encodedArg, len(parts))
+				for i, part := range parts {
+					args[i] = encodedArg{Path: encodePath(part.path), Literal: part.literal}
+				}
+				optParts[k] = args
+			}
+		}
+		var args []encodedArg
+		for _, arg := range n.args {
+			args = append(args, encodedArg{Literal: arg})
+		}
+		return encodedNode{Type: encodedFunction, Name: n.name, Opts: n.opts, OptPaths: optPaths, OptParts: optParts, Args: args, Elems: encodeNodes(n.elems)}
+	case *testNode:
+		return encodedNode{Type: encodedTest, Path: encodePath(n.testIdentPath), Value: n.testVal, Elems: encodeNodes(n.elems)}
+	case *typeTestNode:
+		return encodedNode{
+			Type:     encodedTypeTest,
+			Kind:     n.kind,
+			Name:     n.name,
+			Path:     encodePath(n.path),
+			Inverted: n.inverted,
+			Elems:    encodeNodes(n.elems),
+		}
+	case *countNode:
+		return encodedNode{
+			Type:     encodedCount,
+			Kind:     n.kind,
+			Name:     n.name,
+			Path:     encodePath(n.path),
+			Count:    n.count,
+			Inverted: n.inverted,
+			Elems:    encodeNodes(n.elems),
+		}
+	case *chunkNode:
+		return encodedNode{Type: encodedChunk, Name: n.name, Path: encodePath(n.path), Count: n.size, Elems: encodeNodes(n.elems)}
+	case *zipNode:
+		args := make([]encodedArg, 2)
+		for i := range args {
+			args[i] = encodedArg{Name: n.names[i], Ident: n.idents[i], Path: encodePath(n.paths[i])}
+		}
+		return encodedNode{Type: encodedZip, Args: args, Elems: encodeNodes(n.elems)}
+	case *switchNode:
+		cases := make([]encodedNode, len(n.values), len(n.values)+1)
+		for i, value := range n.values {
+			cases[i] = encodedNode{Type: encodedCase, Value: value, Elems: encodeNodes(n.cases[value])}
+			if i < len(n.caseSpans) {
+				cases[i].setSpans(n.caseSpans[i])
+			}
+		}
+		if n.hasDefault {
+			def := encodedNode{Type: encodedDefault, Elems: encodeNodes(n.defaultElems)}
+			def.setSpans(n.defaultSpans)
+			cases = append(cases, def)
+		}
+		return encodedNode{Type: encodedSwitch, Name: n.name, Path: encodePath(n.path), Cases: cases}
+	case *letNode:
+		return encodedNode{Type: encodedLet, Args: encodeBindings(n.bindings), Elems: encodeNodes(n.elems)}
+	case *captureNode:
+		return encodedNode{Type: encodedCapture, Name: n.name, Elems: encodeNodes(n.elems)}
+	case *partialNode:
+		return encodedNode{Type: encodedPartial, Name: n.name}
+	case *commentNode:
+		return encodedNode{Type: encodedComment, Name: n.text}
+	case *constNode:
+		return encodedNode{Type: encodedConst, Name: n.name}
+	case delimNode:
+		return encodedNode{Type: encodedDelim, Name: string(n)}
+	case trimNode:
+		return encodedNode{Type: encodedTrim, Name: string(n)}
+	case *verbatimNode:
+		return encodedNode{Type: encodedVerbatim, Name: n.text}
+	}
+	panic(fmt.Sprintf("mustache: cannot encode node %T", n))
+}
+
+func decodeNodes(enc []encodedNode) ([]node, error) {
+	nodes := make([]node, 0, len(enc))
+	for _, e := range enc {
+		n, err := decodeNode(e)
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := n.(spanned); ok {
+			spans := e.spans()
+			s.setSpans(spans.outer, spans.inner)
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+func decodeNode(e encodedNode) (node, error) {
+	elems, err := decodeNodes(e.Elems)
+	if err != nil {
+		return nil, err
+	}
+	switch e.Type {
+	case encodedText:
+		return textNode(e.Name), nil
+	case encodedVar:
+		escape, err := decodeEscape(e.Escape)
+		if err != nil {
+			return nil, err
+		}
+		return &varNode{
+			name:    e.Name,
+			path:    decodePath(e.Path),
+			escape:  escape,
+			filters: decodeFilters(e.Filters),
+			format:  e.Format,
+			tag:     e.Tag,
+			line:    e.Line,
+			col:     e.Col,
+		}, nil
+	case encodedCoalesce:
+		args := make([]coalesceArg, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = coalesceArg{ident: arg.Ident, path: decodePath(arg.Path), literal: arg.Literal}
+		}
+		escape, err := decodeEscape(e.Escape)
+		if err != nil {
+			return nil, err
+		}
+		return &coalesceNode{args: args, escape: escape}, nil
+	case encodedTranslate:
+		escape, err := decodeEscape(e.Escape)
+		if err != nil {
+			return nil, err
+		}
+		return &translateNode{key: e.Name, args: decodeBindings(e.Args), escape: escape}, nil
+	case encodedSection:
+		return &sectionNode{
+			name:     e.Name,
+			path:     decodePath(e.Path),
+			inverted: e.Inverted,
+			offset:   e.Offset,
+			limit:    e.Limit,
+			elems:    elems,
+		}, nil
+	case encodedFunction:
+		var optPaths map[string][]pathSegment
+		if e.OptPaths != nil {
+			optPaths = make(map[string][]pathSegment, len(e.OptPaths))
+			for k, path := range e.OptPaths {
+				optPaths[k] = decodePath(path)
+			}
+		}
+		var optParts map[string][]optionPart
+		if e.OptParts != nil {
+			optParts = make(map[string][]optionPart, len(e.OptParts))
+			for k, args := range e.OptParts {
+				parts := make([]optionPart, len(args))
+				for i, arg := range args {
+					parts[i] = optionPart{path: decodePath(arg.Path), literal: arg.Literal}
+				}
+				optParts[k] = parts
+			}
+		}
+		var args []string
+		for _, arg := range e.Args {
+			args = append(args, arg.Literal)
+		}
+		return &functionSectionNode{name: e.Name, opts: e.Opts, optPaths: optPaths, optParts: optParts, args: args, elems: elems}, nil
+	case encodedTest:
+		return &testNode{testIdentPath: decodePath(e.Path), testVal: e.Value, elems: elems}, nil
+	case encodedTypeTest:
+		return &typeTestNode{kind: e.Kind, name: e.Name, path: decodePath(e.Path), inverted: e.Inverted, elems: elems}, nil
+	case encodedCount:
+		return &countNode{
+			kind:     e.Kind,
+			name:     e.Name,
+			path:     decodePath(e.Path),
+			count:    e.Count,
+			inverted: e.Inverted,
+			elems:    elems,
+		}, nil
+	case encodedChunk:
+		return &chunkNode{name: e.Name, path: decodePath(e.Path), size: e.Count, elems: elems}, nil
+	case encodedZip:
+		if len(e.Args) != 2 {
+			return nil, fmt.Errorf("invalid encoded zip section")
+		}
+		n := &zipNode{elems: elems}
+		for i, arg := range e.Args {
+			n.idents[i], n.paths[i], n.names[i] = arg.Ident, decodePath(arg.Path), arg.Name
+		}
+		return n, nil
+	case encodedSwitch:
+		n := &switchNode{name: e.Name, path: decodePath(e.Path), cases: make(map[string][]node, len(e.Cases))}
+		for _, c := range e.Cases {
+			caseElems, err := decodeNodes(c.Elems)
+			if err != nil {
+				return nil, err
+			}
+			switch c.Type {
+			case encodedCase:
+				n.cases[c.Value] = caseElems
+				n.values = append(n.values, c.Value)
+				n.caseSpans = append(n.caseSpans, c.spans())
+			case encodedDefault:
+				n.hasDefault, n.defaultElems, n.defaultSpans = true, caseElems, c.spans()
+			default:
+				return nil, fmt.Errorf("invalid encoded case type %q", c.Type)
+			}
+		}
+		return n, nil
+	case encodedLet:
+		return &letNode{bindings: decodeBindings(e.Args), elems: elems}, nil
+	case encodedCapture:
+		return &captureNode{name: e.Name, elems: elems}, nil
+	case encodedPartial:
+		return &partialNode{name: e.Name}, nil
+	case encodedComment:
+		return &commentNode{text: e.Name}, nil
+	case encodedConst:
+		return &constNode{name: e.Name}, nil
+	case encodedDelim:
+		return delimNode(e.Name), nil
+	case encodedTrim:
+		return trimNode(e.Name), nil
+	case encodedVerbatim:
+		return &verbatimNode{text: e.Name}, nil
+	}
+	return nil, fmt.Errorf("invalid encoded node type %q", e.Type)
+}
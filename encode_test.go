@@ -0,0 +1,111 @@
+package mustache
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	options := []Option{SwitchSections(), LetSections(), CoalesceTags(), CountSections(), ZipSections(), ChunkSections(), FilterPipes(), Translate(messages{"hi": "<Hi>"}), TimeFormat(time.Kitchen)}
+	source := `{{=const greeting "Hello"}}{{greeting}} {{user.name | upper}} {{{raw}}}
+{{#switch status}}{{#case "on"}}on{{/case}}{{#default}}off{{/default}}{{/switch}}
+{{#let who=user.name | upper}}{{who}}{{/let}} {{coalesce nick "anonymous"}}
+{{#items}}[{{.}}]{{/items}}{{^items}}none{{/items}}{{at format="Jan 2"}}{{! comment }} {{_ "hi" to=user.name}}
+{{#zip xs ys}}{{@a}}{{@b}}{{/zip}} {{#chunk items 2}}{{#.}}{{.}}{{/.}};{{/chunk}}
+{{=<% %>=}}<%user.name%> <%~upper%>up<%/upper%> <%~wrap prefix="<%user.name%>: "%>x<%/wrap%> <%~join "-" a%>x<%/join%>`
+	options = append(options, CustomizeFunction("upper", func(s string) (string, error) {
+		return strings.ToUpper(s), nil
+	}), CustomizeFunctionWithOptions("wrap", func(s string, opts map[string]string) (string, error) {
+		return opts["prefix"] + s, nil
+	}), CustomizeFunctionWithArgs("join", func(s string, args []string, opts map[string]string) (string, error) {
+		return s + strings.Join(args, ""), nil
+	}))
+	template := New(options...)
+	if err := template.ParseString(source); err != nil {
+		t.Fatal(err)
+	}
+	data, err := template.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := New(options...)
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Source() != template.Source() {
+		t.Errorf("expected source %q got %q", template.Source(), loaded.Source())
+	}
+	context := map[string]interface{}{
+		"user":   map[string]string{"name": "<Jane>"},
+		"raw":    "<b>",
+		"status": "on",
+		"items":  []int{1, 2, 3},
+		"xs":     []string{"a", "b"},
+		"ys":     []string{"c", "d"},
+		"at":     time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC),
+	}
+	expected, err := template.RenderString(context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := loaded.RenderString(context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != expected {
+		t.Errorf("expected %q got %q", expected, output)
+	}
+
+	if err := New().UnmarshalBinary([]byte("garbage")); err == nil {
+		t.Error("expected an error for invalid data")
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	template := New(Name("greeting"))
+	if err := template.ParseString(`Hello {{{user.name}}}!{{#items}}{{.}}{{/items}}`); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"version":2,"name":"greeting","startDelim":"{{","endDelim":"}}","elems":[` +
+		`{"type":"text","name":"Hello "},` +
+		`{"type":"var","name":"user.name","tag":"{{{user.name}}}","path":[{"key":"user"},{"key":"name"}],"escape":"none","line":1,"col":6,"start":6,"end":21},` +
+		`{"type":"text","name":"!"},` +
+		`{"type":"section","name":"items","path":[{"key":"items"}],"elems":[` +
+		`{"type":"var","name":".","tag":"{{.}}","path":[{"key":"."}],"escape":"html","line":1,"col":32,"start":32,"end":37}],` +
+		`"start":22,"end":47,"bodyStart":32,"bodyEnd":37}]}`
+	if string(data) != expected {
+		t.Errorf("expected %s got %s", expected, data)
+	}
+
+	loaded := New()
+	if err := json.Unmarshal(data, loaded); err != nil {
+		t.Fatal(err)
+	}
+	output, err := loaded.RenderString(map[string]interface{}{
+		"user":  map[string]string{"name": "<Jane>"},
+		"items": []int{1, 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Hello <Jane>!12"; output != expected {
+		t.Errorf("expected %q got %q", expected, output)
+	}
+
+	for _, data := range []string{
+		`{"version":1,"elems":[]}`,
+		`{"version":2,"elems":[{"type":"bogus"}]}`,
+		`{"version":2,"elems":[{"type":"var","name":"a","path":[{"key":"a"}],"escape":"xml"}]}`,
+	} {
+		if err := New().UnmarshalJSON([]byte(data)); err == nil {
+			t.Errorf("expected an error for %s", data)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package mustache
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrMissingVariable is matched by errors.Is for errors caused by a variable
+// which could not be found in the context.
+var ErrMissingVariable = errors.New("missing variable")
+
+// ErrorSlice holds the errors collected while rendering the elements of a
+// section or template. It supports errors.Is and errors.As by unwrapping to
+// each of the errors it holds.
+type ErrorSlice []error
+
+func (es ErrorSlice) Error() string {
+	b := strings.Builder{}
+	b.WriteRune('[')
+	first := true
+	for _, e := range es {
+		if first {
+			first = false
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(e.Error())
+	}
+	b.WriteRune(']')
+
+	return b.String()
+}
+
+// Unwrap returns the errors held by es.
+func (es ErrorSlice) Unwrap() []error {
+	return es
+}
+
+// MissError is returned when a variable can not be found in the context while
+// rendering with SilentMiss(false). It records the position of the offending
+// tag and the name of the template it appears in, if any.
+type MissError struct {
+	Name     string
+	Line     int
+	Col      int
+	Template string
+}
+
+func (e *MissError) Error() string {
+	if e.Template != "" {
+		return fmt.Sprintf("%s:%d:%d failed to lookup %s", e.Template, e.Line, e.Col, e.Name)
+	}
+	return fmt.Sprintf("%d:%d failed to lookup %s", e.Line, e.Col, e.Name)
+}
+
+// Is reports whether target is ErrMissingVariable.
+func (e *MissError) Is(target error) bool {
+	return target == ErrMissingVariable
+}
+
+// Position is a position in the source of a template. Offset is the byte
+// offset, Line counts from 1 and Col is the number of characters preceding the
+// position on its line, counted in runes.
+type Position struct {
+	Offset int
+	Line   int
+	Col    int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
+// ParseError is returned when a template contains a syntax error. It records
+// the position of the start of the offending tag, or where the error was found
+// for errors found while scanning the source such as unclosed tags, and, for
+// templates parsed from a string or bytes, an excerpt of the source showing
+// it.
+type ParseError struct {
+	Position
+	Msg string
+	// Excerpt is the line of the source holding the error, followed by a
+	// line with a caret under the error, as in:
+	//
+	//	Hello {{#name}
+	//	             ^
+	//
+	// Lines longer than 80 characters, such as those of minified templates,
+	// are cut around the error, the cuts being marked with "...".
+	Excerpt string
+}
+
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("%s syntax error: %s", e.Position, e.Msg)
+	if e.Excerpt != "" {
+		msg += "\n" + e.Excerpt
+	}
+	return msg
+}
+
+// excerptWidth is the number of characters of the line of a syntax error
+// shown in the excerpt of a ParseError.
+const excerptWidth = 80
+
+// excerpt returns the excerpt of source showing the error at offset, as
+// described for ParseError.
+func excerpt(source string, offset int) string {
+	if offset > len(source) {
+		offset = len(source)
+	}
+	start := strings.LastIndexByte(source[:offset], '\n') + 1
+	end := len(source)
+	if i := strings.IndexByte(source[offset:], '\n'); i >= 0 {
+		end = offset + i
+	}
+	line := strings.TrimSuffix(source[start:end], "\r")
+	split := offset - start
+	if split > len(line) {
+		split = len(line)
+	}
+	before, after := []rune(line[:split]), []rune(line[split:])
+	var prefix, suffix string
+	if len(before)+len(after) > excerptWidth {
+		if half := excerptWidth / 2; len(before) > half {
+			before, prefix = before[len(before)-half:], "..."
+		}
+		if room := excerptWidth - len(before); len(after) > room {
+			after, suffix = after[:room], "..."
+		}
+	}
+	var b strings.Builder
+	b.WriteString(prefix)
+	b.WriteString(string(before))
+	b.WriteString(string(after))
+	b.WriteString(suffix)
+	b.WriteByte('\n')
+	// Tabs are kept so that the caret lines up with the error however they
+	// are displayed.
+	for _, r := range prefix + string(before) {
+		if r == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteByte('^')
+	return b.String()
+}
+
+// OutputLimitError is returned when a render exceeds the number of bytes
+// allowed by MaxOutputBytes.
+type OutputLimitError struct {
+	Limit int64
+}
+
+func (e *OutputLimitError) Error() string {
+	return fmt.Sprintf("output exceeds limit of %d bytes", e.Limit)
+}
+
+// IterationLimitError is returned when a render exceeds the number of section
+// iterations allowed by MaxIterations.
+type IterationLimitError struct {
+	Limit int
+}
+
+func (e *IterationLimitError) Error() string {
+	return fmt.Sprintf("section iterations exceed limit of %d", e.Limit)
+}
+
+// DepthLimitError is returned when a render exceeds the nesting of sections
+// and partials allowed by MaxDepth.
+type DepthLimitError struct {
+	Limit int
+}
+
+func (e *DepthLimitError) Error() string {
+	return fmt.Sprintf("nesting exceeds limit of %d", e.Limit)
+}
+
+// WriteError is returned when the writer a template is rendered to fails. It
+// wraps the error of the writer, or io.ErrShortWrite if the writer accepted
+// fewer bytes than given. The render stops at the first failed write.
+type WriteError struct {
+	Err error
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("write failed: %s", e.Err)
+}
+
+// Unwrap returns the error of the writer.
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// CycleError is returned when a variable is printed whose value references
+// itself, such as a map containing itself or a cycle of struct pointers.
+type CycleError struct {
+	Name string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("value of %s references itself", e.Name)
+}
+
+// MetadataError wraps the errors of a template given metadata with
+// WithMetadata. Its message starts with the metadata, sorted by key.
+type MetadataError struct {
+	Metadata map[string]string
+	Err      error
+}
+
+func (e *MetadataError) Error() string {
+	keys := make([]string, 0, len(e.Metadata))
+	for k := range e.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b := strings.Builder{}
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%s ", k, e.Metadata[k])
+	}
+	return strings.TrimSuffix(b.String(), " ") + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error of the template.
+func (e *MetadataError) Unwrap() error {
+	return e.Err
+}
+
+// CustomizerError is returned when a customizer function fails while rendering
+// a function section. It wraps the error returned by the function.
+type CustomizerError struct {
+	Name string
+	Err  error
+}
+
+func (e *CustomizerError) Error() string {
+	return fmt.Sprintf("customizer %s: %s", e.Name, e.Err)
+}
+
+// Unwrap returns the error returned by the customizer function.
+func (e *CustomizerError) Unwrap() error {
+	return e.Err
+}
+
+// PartialFuncError is returned when a PartialFunc fails to process the output
+// of a partial. It wraps the error returned by the function.
+type PartialFuncError struct {
+	Name string // the name of the partial
+	Err  error
+}
+
+func (e *PartialFuncError) Error() string {
+	return fmt.Sprintf("partial %s: %s", e.Name, e.Err)
+}
+
+// Unwrap returns the error returned by the PartialFunc.
+func (e *PartialFuncError) Unwrap() error {
+	return e.Err
+}
+
+// MergeConflictError is returned by MergeContexts with the ConflictError
+// policy when two contexts hold different values at the same path.
+type MergeConflictError struct {
+	Path string // the dotted path of the value, e.g. "user.name"
+}
+
+func (e *MergeConflictError) Error() string {
+	return fmt.Sprintf("conflicting values for %s", e.Path)
+}
@@ -0,0 +1,402 @@
+package mustache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestErrorsIsAs(t *testing.T) {
+	template := New(SilentMiss(false), CustomizeFunction("fail", func(s string) (string, error) {
+		return "", errors.New("boom")
+	}))
+	if err := template.ParseString("{{#list}}{{missing}}{{/list}}"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := template.RenderString(map[string]interface{}{"list": []int{1}})
+	if !errors.Is(err, ErrMissingVariable) {
+		t.Errorf("expected %v to match ErrMissingVariable", err)
+	}
+	var missErr *MissError
+	if !errors.As(err, &missErr) || missErr.Name != "missing" {
+		t.Errorf("expected %v to contain a *MissError for missing", err)
+	}
+
+	if err := template.ParseString("{{~fail}}text{{/fail}}"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = template.RenderString(nil)
+	var customizerErr *CustomizerError
+	if !errors.As(err, &customizerErr) || customizerErr.Name != "fail" {
+		t.Errorf("expected %v to be a *CustomizerError for fail", err)
+	}
+	if errors.Is(err, ErrMissingVariable) {
+		t.Errorf("expected %v not to match ErrMissingVariable", err)
+	}
+
+	err = template.ParseString("text {{#section}}")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Line != 1 {
+		t.Errorf("expected %v to be a *ParseError", err)
+	}
+}
+
+func TestCollectErrors(t *testing.T) {
+	template := New(CollectErrors(), CustomizeFunction("fail", func(s string) (string, error) {
+		return "", errors.New("boom")
+	}))
+	err := template.ParseString("{{a}} {{#list}}{{b}}{{/list}} {{~fail}}x{{/fail}} {{c}} end")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := template.RenderString(map[string]interface{}{"list": []int{1, 2}, "c": "C"})
+	if expected := "   C end"; output != expected {
+		t.Errorf("expected %q got %q", expected, output)
+	}
+	errs, ok := err.(ErrorSlice)
+	if !ok || len(errs) != 4 {
+		t.Fatalf("expected 4 errors, got %v", err)
+	}
+	for i, name := range []string{"a", "b", "b"} {
+		var missErr *MissError
+		if !errors.As(errs[i], &missErr) || missErr.Name != name {
+			t.Errorf("expected error %d to be a miss of %s, got %v", i, name, errs[i])
+		}
+	}
+	var customizerErr *CustomizerError
+	if !errors.As(errs[3], &customizerErr) {
+		t.Errorf("expected a customizer error, got %v", errs[3])
+	}
+}
+
+func TestMaxOutputBytes(t *testing.T) {
+	items := make([]int, 10000)
+	for _, input := range []string{
+		"{{#items}}0123456789{{/items}}",
+		"{{#items}}0123456789\n{{/items}}",
+		"0123456789012345678901234567890123456789",
+	} {
+		template := New(MaxOutputBytes(25))
+		if err := template.ParseString(input); err != nil {
+			t.Fatal(err)
+		}
+		var output bytes.Buffer
+		err := template.Render(&output, map[string]interface{}{"items": items})
+		var limitErr *OutputLimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != 25 {
+			t.Errorf("expected an *OutputLimitError, got %v", err)
+		}
+		if output.Len() != 25 {
+			t.Errorf("expected 25 bytes of output, got %d", output.Len())
+		}
+	}
+
+	template := New(MaxOutputBytes(25))
+	if err := template.ParseString("{{#items}}{{.}}{{/items}}"); err != nil {
+		t.Fatal(err)
+	}
+	output, err := template.RenderString(map[string]interface{}{"items": []int{1, 2, 3}})
+	if err != nil || output != "123" {
+		t.Errorf("expected %q got %q, %v", "123", output, err)
+	}
+}
+
+// failingWriter accepts n bytes of each write, and fails once it has been
+// written to limit times.
+type failingWriter struct {
+	n, limit, writes int
+}
+
+var errClosed = errors.New("closed")
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	f.writes++
+	if f.writes > f.limit {
+		return 0, errClosed
+	}
+	if len(p) > f.n {
+		return f.n, nil
+	}
+	return len(p), nil
+}
+
+func TestWriteError(t *testing.T) {
+	items := make([]int, 1000)
+	template := New()
+	if err := template.ParseString("{{#items}}line {{.}}\n{{/items}}end\n"); err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]interface{}{"items": items}
+
+	w := &failingWriter{n: 100, limit: 1}
+	err := template.Render(w, data)
+	var writeErr *WriteError
+	if !errors.As(err, &writeErr) || !errors.Is(err, errClosed) {
+		t.Errorf("expected a *WriteError wrapping errClosed, got %v", err)
+	}
+	if w.writes != 2 {
+		t.Errorf("expected the render to stop after the failed write, got %d writes", w.writes)
+	}
+
+	w = &failingWriter{n: 3, limit: 10}
+	err = template.Render(w, data)
+	if !errors.As(err, &writeErr) || !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("expected a *WriteError wrapping io.ErrShortWrite, got %v", err)
+	}
+	if w.writes != 1 {
+		t.Errorf("expected the render to stop after the short write, got %d writes", w.writes)
+	}
+
+	w = &failingWriter{n: 100, limit: 0}
+	if err = template.RenderAtomic(w, data); !errors.Is(err, errClosed) {
+		t.Errorf("expected errClosed, got %v", err)
+	}
+}
+
+func TestCycleError(t *testing.T) {
+	type node struct {
+		Name string
+		Next *node
+	}
+	m := map[string]interface{}{"a": 1}
+	m["self"] = m
+	n := &node{Name: "n"}
+	n.Next = &node{Name: "m", Next: n}
+	var p interface{}
+	p = &p
+	shared := []int{1}
+	data := map[string]interface{}{"m": m, "n": *n, "p": p, "shared": map[string]interface{}{"a": shared, "b": shared}}
+
+	for _, test := range []struct {
+		template string
+		name     string
+	}{
+		{"{{m}}", "m"},
+		{"{{{m.self}}}", "m.self"},
+		{"{{n.Next}}", "n.Next"},
+	} {
+		template := New()
+		if err := template.ParseString(test.template); err != nil {
+			t.Fatal(err)
+		}
+		_, err := template.RenderString(data)
+		var cycleErr *CycleError
+		if !errors.As(err, &cycleErr) || cycleErr.Name != test.name {
+			t.Errorf("%q: expected a *CycleError for %s, got %v", test.template, test.name, err)
+		}
+	}
+
+	template := New()
+	if err := template.ParseString("{{#p}}p{{/p}}{{{shared}}}"); err != nil {
+		t.Fatal(err)
+	}
+	output, err := template.RenderString(data)
+	if expected := `{"a":[1],"b":[1]}`; err != nil || output != expected {
+		t.Errorf("expected %q got %q, %v", expected, output, err)
+	}
+}
+
+func TestMaxIterationsAndDepth(t *testing.T) {
+	data := map[string]interface{}{
+		"rows": []interface{}{
+			map[string]interface{}{"cols": []int{1, 2, 3}},
+			map[string]interface{}{"cols": []int{4, 5, 6}},
+		},
+	}
+	template := New(MaxIterations(6))
+	if err := template.ParseString("{{#rows}}{{#cols}}{{.}}{{/cols}}{{/rows}}"); err != nil {
+		t.Fatal(err)
+	}
+	output, err := template.RenderString(data)
+	var iterErr *IterationLimitError
+	if !errors.As(err, &iterErr) || iterErr.Limit != 6 {
+		t.Errorf("expected an *IterationLimitError, got %v", err)
+	}
+	if output != "" {
+		t.Errorf("expected no output, got %q", output)
+	}
+	template.Option(MaxIterations(8))
+	if output, err = template.RenderString(data); err != nil || output != "123456" {
+		t.Errorf("expected %q got %q, %v", "123456", output, err)
+	}
+
+	partial := New(Name("cols"))
+	if err := partial.ParseString("{{#cols}}{{.}}{{/cols}}"); err != nil {
+		t.Fatal(err)
+	}
+	template = New(MaxDepth(2), Partial(partial))
+	if err := template.ParseString("{{#rows}}{{>cols}}{{/rows}}"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = template.RenderString(data)
+	var depthErr *DepthLimitError
+	if !errors.As(err, &depthErr) || depthErr.Limit != 2 {
+		t.Errorf("expected a *DepthLimitError, got %v", err)
+	}
+	template.Option(MaxDepth(3))
+	if output, err = template.RenderString(data); err != nil || output != "123456" {
+		t.Errorf("expected %q got %q, %v", "123456", output, err)
+	}
+	// Chunk and zip sections iterate and nest like other sections.
+	items := make([]int, 100)
+	for _, source := range []string{"{{#chunk a 1}}x{{/chunk}}", "{{#zip a b}}x{{/zip}}"} {
+		template := New(ChunkSections(), ZipSections(), MaxIterations(10))
+		if err := template.ParseString(source); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := template.RenderString(map[string]interface{}{"a": items, "b": items}); !errors.As(err, &iterErr) {
+			t.Errorf("%q: expected an *IterationLimitError, got %v", source, err)
+		}
+		template = New(ChunkSections(), ZipSections(), MaxDepth(1))
+		if err := template.ParseString("{{#a}}" + source + "{{/a}}"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := template.RenderString(map[string]interface{}{"a": items[:1], "b": items}); !errors.As(err, &depthErr) {
+			t.Errorf("%q: expected a *DepthLimitError, got %v", source, err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	template = New(ChunkSections())
+	if err := template.ParseString("{{#chunk a 1}}x{{/chunk}}"); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := template.RenderContext(ctx, &b, map[string]interface{}{"a": items}); !errors.Is(err, context.Canceled) || b.Len() != 0 {
+		t.Errorf("expected a canceled render without output, got %q, %v", b.String(), err)
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	template := New(TabWidth(4))
+	err := template.ParseString("ünïcode\n\t{{#section}}")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected %v to be a *ParseError", err)
+	}
+	if expected := (Position{Offset: 11, Line: 2, Col: 4}); parseErr.Position != expected {
+		t.Errorf("expected %v got %v", expected, parseErr.Position)
+	}
+	if expected := "2:4 syntax error: failed to find closing tag for section \"section\" opened at 2:4\n\t{{#section}}\n\t^"; err.Error() != expected {
+		t.Errorf("expected %q got %q", expected, err.Error())
+	}
+}
+
+func TestParseErrorExcerpt(t *testing.T) {
+	long := strings.Repeat("<p>", 100)
+	for _, test := range []struct {
+		template string
+		expected string
+	}{
+		{"Hi\n{{#a}}\n", "{{#a}}\n^"},
+		{"{{name", "{{name\n      ^"},
+		{long + "{{#a}}" + long, "..." + long[len(long)-40:] + "{{#a}}" + long[:34] + "...\n" + strings.Repeat(" ", 43) + "^"},
+		{"{{#a}}" + long, "{{#a}}" + long[:74] + "...\n^"},
+		{long + "{{#a}}", "..." + long[len(long)-40:] + "{{#a}}\n" + strings.Repeat(" ", 43) + "^"},
+	} {
+		var parseErr *ParseError
+		if err := New().ParseString(test.template); !errors.As(err, &parseErr) {
+			t.Fatalf("expected %v to be a *ParseError", err)
+		}
+		if parseErr.Excerpt != test.expected {
+			t.Errorf("%.20q: expected excerpt\n%s\ngot\n%s", test.template, test.expected, parseErr.Excerpt)
+		}
+	}
+
+	err := New().ParseAll("{{#a}}\n{{/b}}")
+	var excerpts []string
+	for _, err := range err.(ErrorSlice) {
+		excerpts = append(excerpts, err.(*ParseError).Excerpt)
+	}
+	if expected := []string{"{{#a}}\n^", "{{/b}}\n^"}; !reflect.DeepEqual(excerpts, expected) {
+		t.Errorf("expected %q got %q", expected, excerpts)
+	}
+}
+
+func TestParseAll(t *testing.T) {
+	template := New()
+	err := template.ParseAll("{{#a}}{{b}}\n{{/a}}{{/c}}\n{{#d}}\n{{{{raw}}}}")
+	var positions []string
+	for _, err := range err.(ErrorSlice) {
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Fatalf("expected %v to be a *ParseError", err)
+		}
+		positions = append(positions, parseErr.Position.String())
+	}
+	if expected := []string{"2:6", "3:0", "4:0"}; strings.Join(positions, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected errors at %q got %v", expected, err)
+	}
+	if len(template.Nodes()) != 0 {
+		t.Errorf("expected the template to be left unchanged")
+	}
+
+	if err := template.ParseAll("{{#a}}{{b}}{{/a}}"); err != nil {
+		t.Fatal(err)
+	}
+	if output, _ := template.RenderString(map[string]interface{}{"a": true, "b": 1}); output != "1" {
+		t.Errorf("expected %q got %q", "1", output)
+	}
+}
+
+func TestWithMetadata(t *testing.T) {
+	metadata := map[string]string{"tenant": "acme", "file": "welcome.mustache"}
+	template := New(WithMetadata(metadata), SilentMiss(false))
+	metadata["tenant"] = "changed"
+
+	err := template.ParseString("{{#a}}")
+	var metaErr *MetadataError
+	var parseErr *ParseError
+	if !errors.As(err, &metaErr) || metaErr.Metadata["tenant"] != "acme" || !errors.As(err, &parseErr) {
+		t.Errorf("expected a *MetadataError wrapping a *ParseError, got %v", err)
+	}
+	expected := "file=welcome.mustache tenant=acme: 1:0 syntax error: failed to find closing tag for section \"a\" opened at 1:0\n{{#a}}\n^"
+	if err.Error() != expected {
+		t.Errorf("expected %q got %q", expected, err.Error())
+	}
+
+	if err := template.ParseString("Hi {{name}}"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := template.RenderString(nil); !errors.As(err, &metaErr) || !errors.Is(err, ErrMissingVariable) {
+		t.Errorf("expected a *MetadataError wrapping a *MissError, got %v", err)
+	}
+	for _, err := range template.Validate(nil) {
+		if !errors.As(err, &metaErr) {
+			t.Errorf("expected a *MetadataError, got %v", err)
+		}
+	}
+
+	// Templates without metadata return their errors unwrapped.
+	if err := New().ParseString("{{#a}}"); !errors.As(err, &parseErr) || errors.As(err, &metaErr) {
+		t.Errorf("expected a bare *ParseError, got %v", err)
+	}
+}
+
+func TestParseErrorPositionCRLF(t *testing.T) {
+	for _, input := range []string{
+		"text\n{{name \n}}",
+		"text\n{{#section}}\n{{/other}}",
+		"text\n{{> }}\n",
+	} {
+		template := New()
+		lfErr := template.ParseString(input)
+		crlfErr := template.ParseString(strings.ReplaceAll(input, "\n", "\r\n"))
+		var lf, crlf *ParseError
+		if !errors.As(lfErr, &lf) || !errors.As(crlfErr, &crlf) {
+			t.Fatalf("expected parse errors, got %v and %v", lfErr, crlfErr)
+		}
+		if lf.Line != crlf.Line || lf.Col != crlf.Col || lf.Msg != crlf.Msg {
+			t.Errorf("%q: expected %v got %v", input, lfErr, crlfErr)
+		}
+	}
+
+	err := New().ParseString("text\r\n{{name \r\n}}")
+	if expected := "2:7 syntax error: unexpected token t_error:\"unclosed action\"\n{{name \n       ^"; err == nil || err.Error() != expected {
+		t.Errorf("expected %q got %v", expected, err)
+	}
+}
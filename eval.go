@@ -0,0 +1,14 @@
+package mustache
+
+// Eval parses fragment, a piece of template source such as a tag or a section,
+// and renders it with context in the environment of t: its options, partials
+// and functions. The template itself is left unchanged, so fragments may be
+// evaluated one after another against the same environment, as the repl
+// command of cmd/mustache does to try tags against sample data.
+func (t *Template) Eval(fragment string, context ...interface{}) (string, error) {
+	f := *t
+	if err := f.ParseString(fragment); err != nil {
+		return "", err
+	}
+	return f.RenderString(context...)
+}
@@ -0,0 +1,42 @@
+package mustache
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	greeting := New(Name("greeting"))
+	if err := greeting.ParseString("Hi {{name}}"); err != nil {
+		t.Fatal(err)
+	}
+	template := New(Partial(greeting), CustomizeFunction("upper", func(s string) (string, error) {
+		return strings.ToUpper(s), nil
+	}))
+	if err := template.ParseString("{{body}}"); err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]interface{}{"name": "Ann", "items": []int{1, 2, 3}}
+	for _, test := range []struct {
+		fragment string
+		expected string
+	}{
+		{"{{name}}", "Ann"},
+		{"{{#items}}{{.}},{{/items}}", "1,2,3,"},
+		{"{{>greeting}}!", "Hi Ann!"},
+		{"{{~upper}}{{name}}{{/upper}}", "ANN"},
+	} {
+		output, err := template.Eval(test.fragment, data)
+		if err != nil {
+			t.Errorf("%q: %s", test.fragment, err)
+		} else if output != test.expected {
+			t.Errorf("%q: expected %q got %q", test.fragment, test.expected, output)
+		}
+	}
+	if _, err := template.Eval("{{#items}}", data); err == nil {
+		t.Error("expected a syntax error")
+	}
+	if output, _ := template.RenderString(map[string]string{"body": "unchanged"}); output != "unchanged" {
+		t.Errorf("expected the template to be left unchanged, got %q", output)
+	}
+}
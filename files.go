@@ -0,0 +1,169 @@
+package mustache
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ParseFiles creates a new template from the named files. The first file is
+// parsed as the template itself and every file is registered as a partial
+// named after its base name without extension, so that templates/header.mustache
+// may be included with {{>header}}.
+func ParseFiles(filenames ...string) (*Template, error) {
+	t := New()
+	err := t.ParseFiles(filenames...)
+	return t, err
+}
+
+// ParseGlob is like ParseFiles, parsing the files matching pattern as defined
+// by filepath.Match.
+func ParseGlob(pattern string) (*Template, error) {
+	t := New()
+	err := t.ParseGlob(pattern)
+	return t, err
+}
+
+// ParseFS is like ParseFiles, parsing the files of fsys matching patterns as
+// defined by fs.Glob.
+func ParseFS(fsys fs.FS, patterns ...string) (*Template, error) {
+	t := New()
+	err := t.ParseFS(fsys, patterns...)
+	return t, err
+}
+
+// ParseFiles parses the named files into t. The first file is parsed as the
+// template itself and every file is registered as a partial named after its
+// base name without extension. Partials are parsed with the options of t. If t
+// has no name it is named after the first file.
+func (t *Template) ParseFiles(filenames ...string) error {
+	return t.parseFiles(os.ReadFile, filepath.Base, filenames)
+}
+
+// ParseGlob is like ParseFiles, parsing the files matching pattern as defined
+// by filepath.Match.
+func (t *Template) ParseGlob(pattern string) error {
+	filenames, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	if len(filenames) == 0 {
+		return fmt.Errorf("pattern matches no files: %q", pattern)
+	}
+	return t.ParseFiles(filenames...)
+}
+
+// ParseFS is like ParseFiles, parsing the files of fsys matching patterns as
+// defined by fs.Glob.
+func (t *Template) ParseFS(fsys fs.FS, patterns ...string) error {
+	var filenames []string
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("pattern matches no files: %q", pattern)
+		}
+		filenames = append(filenames, matches...)
+	}
+	readFile := func(name string) ([]byte, error) {
+		return fs.ReadFile(fsys, name)
+	}
+	return t.parseFiles(readFile, path.Base, filenames)
+}
+
+func (t *Template) parseFiles(readFile func(string) ([]byte, error), base func(string) string, filenames []string) error {
+	if len(filenames) == 0 {
+		return fmt.Errorf("no files named")
+	}
+	for i, filename := range filenames {
+		b, err := readFile(filename)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(base(filename), path.Ext(filename))
+		p := t.Clone()
+		p.name = name
+		if err := p.ParseBytes(b); err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		if i == 0 {
+			t.elems = p.elems
+			if t.name == "" {
+				t.name = name
+			}
+		}
+		t.partials[name] = p
+	}
+	return nil
+}
+
+// PartialDir makes partials not otherwise known to the template resolve to
+// files of fsys, so that {{>header}} includes dir/header.mustache when ext is
+// ".mustache". Files are parsed with the options of the including template on
+// first use and cached by it, each template given the option or cloned from
+// one keeping its own cache. Partials without a matching file render as
+// nothing.
+func PartialDir(fsys fs.FS, dir, ext string) Option {
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	d := partialDir{fsys: fsys, dir: dir, ext: ext}
+	return func(t *Template) {
+		t.partialDir = d.clone()
+	}
+}
+
+// partialDir loads partials from the files of a directory.
+type partialDir struct {
+	fsys fs.FS
+	dir  string
+	ext  string
+
+	mu    sync.Mutex
+	cache map[string]*Template // nil for partials without a file
+}
+
+// clone returns a partialDir reading the same files as d, with an empty cache.
+func (d *partialDir) clone() *partialDir {
+	return &partialDir{
+		fsys:  d.fsys,
+		dir:   d.dir,
+		ext:   d.ext,
+		cache: make(map[string]*Template),
+	}
+}
+
+// load returns the partial name, parsing it as a clone of t if it was not
+// loaded before. It returns nil if there is no file for the partial. The
+// partial shares the cache of t, as it has the same options.
+func (d *partialDir) load(t *Template, name string) (*Template, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if p, ok := d.cache[name]; ok {
+		return p, nil
+	}
+	filename := path.Join(d.dir, name+d.ext)
+	b, err := fs.ReadFile(d.fsys, filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		d.cache[name] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p := t.Clone()
+	p.name = name
+	p.partialDir = d
+	if err := p.ParseBytes(b); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	d.cache[name] = p
+	return p, nil
+}
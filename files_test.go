@@ -0,0 +1,110 @@
+package mustache
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/greeting.mustache": {Data: []byte("Hello {{>name}}!")},
+		"templates/name.mustache":     {Data: []byte("{{first}} {{last}}")},
+	}
+	data := map[string]string{"first": "Jane", "last": "Doe"}
+
+	for _, parse := range []func() (*Template, error){
+		func() (*Template, error) {
+			return ParseFiles("testdata/files/greeting.mustache", "testdata/files/name.mustache")
+		},
+		func() (*Template, error) { return ParseGlob("testdata/files/*.mustache") },
+		func() (*Template, error) { return ParseFS(fsys, "templates/*.mustache") },
+	} {
+		template, err := parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if template.name != "greeting" {
+			t.Errorf("expected the template to be named greeting, got %q", template.name)
+		}
+		output, err := template.RenderString(data)
+		if err != nil {
+			t.Error(err)
+		}
+		if expected := "Hello Jane Doe!"; output != expected {
+			t.Errorf("expected %q got %q", expected, output)
+		}
+	}
+
+	if _, err := ParseFS(fsys, "missing/*.mustache"); err == nil {
+		t.Error("expected an error for a pattern matching no files")
+	}
+	if _, err := ParseFiles(); err == nil {
+		t.Error("expected an error for no files")
+	}
+}
+
+func TestPartialDir(t *testing.T) {
+	fsys := fstest.MapFS{
+		"partials/header.mustache": {Data: []byte("<h1>{{title}}</h1>{{>nav}}")},
+		"partials/nav.mustache":    {Data: []byte("<nav>{{#links}}{{.}} {{/links}}</nav>")},
+		"partials/broken.mustache": {Data: []byte("{{#open}}")},
+	}
+	template := New(PartialDir(fsys, "partials", "mustache"))
+	if err := template.ParseString("{{>header}}{{>missing}}<p>{{body}}</p>"); err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]interface{}{"title": "Hi", "links": []string{"a", "b"}, "body": "text"}
+	for i := 0; i < 2; i++ {
+		output, err := template.RenderString(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "<h1>Hi</h1><nav>a b </nav><p>text</p>"; output != expected {
+			t.Errorf("expected %q got %q", expected, output)
+		}
+	}
+
+	template = New(PartialDir(fsys, "partials", ".mustache"), SilentMiss(false))
+	if err := template.ParseString("{{>broken}}"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := template.RenderString(nil); err == nil {
+		t.Error("expected an error for a partial which fails to parse")
+	}
+
+	// Templates given the same option parse the partials with their own
+	// options.
+	dir := PartialDir(fsys, "partials", ".mustache")
+	data = map[string]interface{}{"title": "<b>"}
+	for _, test := range []struct {
+		options  []Option
+		expected string
+	}{
+		{[]Option{dir}, "<h1>&lt;b&gt;</h1><nav></nav>"},
+		{[]Option{dir, NoEscape()}, "<h1><b></h1><nav></nav>"},
+	} {
+		template := New(test.options...)
+		if err := template.ParseString("{{>header}}"); err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != test.expected {
+			t.Errorf("expected %q got %q", test.expected, output)
+		}
+	}
+	template = New(dir)
+	if err := template.ParseString("{{>header}}"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := template.RenderString(data); err != nil {
+		t.Fatal(err)
+	}
+	clone := template.Clone()
+	clone.Option(NoEscape())
+	if output, _ := clone.RenderString(data); output != "<h1><b></h1><nav></nav>" {
+		t.Errorf("expected the clone to parse the partials again, got %q", output)
+	}
+}
@@ -0,0 +1,140 @@
+package mustache
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Funcs makes the functions of funcs, such as the helpers of a library written
+// for text/template, available to the template as customizers, so that they
+// may be used as filters with FilterPipes or as function sections. As in a
+// text/template pipeline, the value passed to a function comes after its
+// arguments, so that with sprig's helpers:
+//
+//	{{name | trunc 5 | upper}}
+//	{{~replace " " "-"}}{{title}}{{/replace}}
+//
+// The value and the arguments, which are strings, are converted to the types
+// of the parameters of the function: strings, booleans, numbers and empty
+// interfaces. Like text/template's Funcs, it panics if a value of funcs is not
+// a function returning one value, or a value and an error. A function which
+// panics when called fails the call with a *CustomizerError, as its error
+// would.
+func Funcs(funcs template.FuncMap) Option {
+	fns := make(map[string]customizerFunc, len(funcs))
+	for name, fn := range funcs {
+		fns[name] = adaptFunc(name, fn)
+	}
+	return func(t *Template) {
+		for name, fn := range fns {
+			t.customizers[name] = fn
+		}
+	}
+}
+
+// adaptFunc returns fn, a function of a text/template FuncMap, as a
+// customizer called with its positional arguments followed by its content.
+func adaptFunc(name string, fn interface{}) customizerFunc {
+	v := reflect.ValueOf(fn)
+	typ := v.Type()
+	if typ.Kind() != reflect.Func {
+		panic(fmt.Sprintf("mustache: value for %q is not a function", name))
+	}
+	if n := typ.NumOut(); n == 0 || n > 2 || n == 2 && typ.Out(1) != errorType {
+		panic(fmt.Sprintf("mustache: function %q must return one value, or a value and an error", name))
+	}
+	return func(_ context.Context, s string, args []string, _ map[string]string) (result string, err error) {
+		args = append(args[:len(args):len(args)], s)
+		in, err := convertArgs(typ, args)
+		if err != nil {
+			return "", err
+		}
+		// As with text/template, a function which panics fails the call
+		// rather than the program.
+		defer func() {
+			if r := recover(); r != nil {
+				result, err = "", fmt.Errorf("error calling %s: %v", name, r)
+			}
+		}()
+		out := v.Call(in)
+		if len(out) == 2 && !out[1].IsNil() {
+			return "", out[1].Interface().(error)
+		}
+		var sb strings.Builder
+		if err := print(&sb, out[0].Interface(), noEscape); err != nil {
+			return "", err
+		}
+		return sb.String(), nil
+	}
+}
+
+// convertArgs converts args to the types of the parameters of the function
+// type typ.
+func convertArgs(typ reflect.Type, args []string) ([]reflect.Value, error) {
+	n := typ.NumIn()
+	if typ.IsVariadic() {
+		if len(args) < n-1 {
+			return nil, fmt.Errorf("wrong number of args: want at least %d got %d", n-1, len(args))
+		}
+	} else if len(args) != n {
+		return nil, fmt.Errorf("wrong number of args: want %d got %d", n, len(args))
+	}
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var param reflect.Type
+		if typ.IsVariadic() && i >= n-1 {
+			param = typ.In(n - 1).Elem()
+		} else {
+			param = typ.In(i)
+		}
+		v, err := convertArg(arg, param)
+		if err != nil {
+			return nil, err
+		}
+		in[i] = v
+	}
+	return in, nil
+}
+
+// convertArg converts s to a value of type typ.
+func convertArg(s string, typ reflect.Type) (reflect.Value, error) {
+	v := reflect.New(typ).Elem()
+	var err error
+	switch typ.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(s)
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		i, err = strconv.ParseInt(strings.TrimSpace(s), 10, typ.Bits())
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		u, err = strconv.ParseUint(strings.TrimSpace(s), 10, typ.Bits())
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(strings.TrimSpace(s), typ.Bits())
+		v.SetFloat(f)
+	case reflect.Interface:
+		if typ.NumMethod() != 0 {
+			return v, fmt.Errorf("cannot convert %q to %s", s, typ)
+		}
+		v.Set(reflect.ValueOf(s))
+	default:
+		return v, fmt.Errorf("cannot convert %q to %s", s, typ)
+	}
+	if err != nil {
+		return v, fmt.Errorf("cannot convert %q to %s", s, typ)
+	}
+	return v, nil
+}
@@ -0,0 +1,80 @@
+package mustache
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestFuncs(t *testing.T) {
+	funcs := template.FuncMap{
+		"upper":   strings.ToUpper,
+		"replace": func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"trunc": func(n int, s string) string {
+			if len(s) > n {
+				return s[:n]
+			}
+			return s
+		},
+		"add": func(a, b float64) float64 { return a + b },
+		"default": func(d interface{}, v interface{}) interface{} {
+			if v == "" {
+				return d
+			}
+			return v
+		},
+		"join":  func(sep string, parts ...string) string { return strings.Join(parts, sep) },
+		"fail":  func(s string) (string, error) { return "", errors.New("failed") },
+		"panic": func(s string) string { panic("no " + s) },
+	}
+	data := map[string]interface{}{"name": "Ann Smith", "n": 2, "empty": ""}
+	for _, test := range []struct {
+		template string
+		expected string
+	}{
+		{`{{name | upper}}`, "ANN SMITH"},
+		{`{{name | trunc 3 | upper}}`, "ANN"},
+		{`{{~replace " " "-"}}{{name}}{{/replace}}`, "Ann-Smith"},
+		{`{{n | add 1.5}}`, "3.5"},
+		{`{{empty | default "none"}}`, "none"},
+		{`{{name | join "," "a" "b"}}`, "a,b,Ann Smith"},
+	} {
+		template := New(FilterPipes(), Funcs(funcs))
+		if err := template.ParseString(test.template); err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(data)
+		if err != nil {
+			t.Errorf("%q: %s", test.template, err)
+		} else if output != test.expected {
+			t.Errorf("%q: expected %q got %q", test.template, test.expected, output)
+		}
+	}
+
+	for _, test := range []struct {
+		template string
+		expected string
+	}{
+		{`{{name | fail}}`, "failed"},
+		{`{{name | trunc "x"}}`, `cannot convert "x" to int`},
+		{`{{name | upper 1}}`, "wrong number of args: want 1 got 2"},
+		{`{{name | panic}}`, "error calling panic: no Ann Smith"},
+	} {
+		template := New(FilterPipes(), Funcs(funcs), SilentMiss(false))
+		if err := template.ParseString(test.template); err != nil {
+			t.Fatal(err)
+		}
+		var customizerErr *CustomizerError
+		if _, err := template.RenderString(data); !errors.As(err, &customizerErr) || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%q: expected a *CustomizerError with %q, got %v", test.template, test.expected, err)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected Funcs to panic for a function without results")
+		}
+	}()
+	Funcs(template.FuncMap{"nothing": func() {}})
+}
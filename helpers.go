@@ -0,0 +1,113 @@
+package mustache
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DedentHelper makes the {{~dedent}} customizer available to the template. It
+// removes the indentation common to all non-blank lines of its content, which
+// allows nested sections to be indented for readability without the
+// indentation leaking into the output.
+//
+//	{{~dedent}}
+//	    {{#items}}
+//	      - {{name}}
+//	    {{/items}}
+//	{{/dedent}}
+func DedentHelper() Option {
+	return CustomizeFunction("dedent", func(s string) (string, error) {
+		return dedent(s), nil
+	})
+}
+
+// dedent removes the longest run of leading spaces and tabs shared by all
+// non-blank lines of s. Blank lines are emptied.
+func dedent(s string) string {
+	lines := strings.Split(s, "\n")
+	prefix := ""
+	first := true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			prefix, first = indent, false
+			continue
+		}
+		for !strings.HasPrefix(indent, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			lines[i] = strings.TrimLeft(line, " \t")
+			continue
+		}
+		lines[i] = line[len(prefix):]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CollapseHelper makes the {{~collapse}} customizer available to the template.
+// It replaces every run of whitespace in its content, newlines included, with
+// a single space and trims the ends. This keeps values injected into HTML
+// attributes, email subjects or SMS bodies on a single line.
+//
+//	<a title="{{~collapse}}{{description}}{{/collapse}}">
+func CollapseHelper() Option {
+	return CustomizeFunction("collapse", func(s string) (string, error) {
+		return strings.Join(strings.Fields(s), " "), nil
+	})
+}
+
+// WrapHelper makes the {{~wrap}} customizer available to the template. It word
+// wraps each line of its content to a width, 72 by default, given in runes.
+// Continuation lines are prefixed with the value of the indent option. Words
+// longer than the width are not broken.
+//
+//	{{~wrap width="60" indent="  "}}{{description}}{{/wrap}}
+func WrapHelper() Option {
+	return CustomizeFunctionWithOptions("wrap", func(s string, opts map[string]string) (string, error) {
+		width := 72
+		if v, ok := opts["width"]; ok {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return "", fmt.Errorf("invalid wrap width %q", v)
+			}
+			width = n
+		}
+		return wrap(s, width, opts["indent"]), nil
+	})
+}
+
+// wrap word wraps each line of s to width runes, prefixing continuation lines
+// with indent.
+func wrap(s string, width int, indent string) string {
+	var b strings.Builder
+	for i, line := range strings.Split(s, "\n") {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		n := 0
+		for j, word := range strings.Fields(line) {
+			l := utf8.RuneCountInString(word)
+			switch {
+			case j == 0:
+			case n+1+l > width:
+				b.WriteByte('\n')
+				b.WriteString(indent)
+				n = utf8.RuneCountInString(indent)
+			default:
+				b.WriteByte(' ')
+				n++
+			}
+			b.WriteString(word)
+			n += l
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,103 @@
+package mustache
+
+import (
+	"testing"
+)
+
+func TestDedentHelper(t *testing.T) {
+	template := New(DedentHelper())
+	err := template.ParseString("Items:\n{{~dedent}}\n    {{#items}}\n      - {{.}}{{/items}}\n\n    Total: {{total}}\n{{/dedent}}\nend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := template.RenderString(map[string]interface{}{"items": []string{"a", "b"}, "total": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Items:\n  - a\n  - b\n\nTotal: 2\nend"
+	if output != expected {
+		t.Errorf("expected %q got %q", expected, output)
+	}
+}
+
+func TestDedent(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected string
+	}{
+		{"  a\n    b\n  c", "a\n  b\nc"},
+		{"\ta\n\t\tb", "a\n\tb"},
+		{"  a\n   \n  b", "a\n\nb"},
+		{"a\n  b", "a\n  b"},
+		{"", ""},
+	} {
+		if output := dedent(test.input); output != test.expected {
+			t.Errorf("dedent(%q): expected %q got %q", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestWrapHelper(t *testing.T) {
+	for _, test := range []templateTest{
+		{
+			`{{~wrap width="20"}}{{text}}{{/wrap}}`,
+			map[string]string{"text": "The quick brown fox jumps over the lazy dog"},
+			"The quick brown fox\njumps over the lazy\ndog",
+		},
+		{
+			`{{~wrap width="16" indent="  "}}{{text}}{{/wrap}}`,
+			map[string]string{"text": "The quick brown fox jumps over the lazy dog"},
+			"The quick brown\n  fox jumps over\n  the lazy dog",
+		},
+		{
+			`{{~wrap width="10"}}{{text}}{{/wrap}}`,
+			map[string]string{"text": "short\nsupercalifragilistic word"},
+			"short\nsupercalifragilistic\nword",
+		},
+		{
+			`{{~wrap}}{{text}}{{/wrap}}`,
+			map[string]string{"text": "déjà vu"},
+			"déjà vu",
+		},
+	} {
+		template := New(WrapHelper())
+		if err := template.ParseString(test.template); err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(test.payload)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expect {
+			t.Errorf("expected %q got %q", test.expect, output)
+		}
+	}
+
+	template := New(WrapHelper(), SilentMiss(false))
+	if err := template.ParseString(`{{~wrap width="x"}}text{{/wrap}}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := template.RenderString(nil); err == nil {
+		t.Error("expected an error for an invalid width")
+	}
+}
+
+func TestCollapseHelper(t *testing.T) {
+	for _, test := range []templateTest{
+		{`<a title="{{~collapse}}{{text}}{{/collapse}}">`, map[string]string{"text": "  Line one\r\n\tline  two\n"}, `<a title="Line one line two">`},
+		{"{{~collapse}}\n  {{#items}}\n  {{.}}\n  {{/items}}\n{{/collapse}}", map[string][]string{"items": {"a", "b"}}, "a b"},
+		{`[{{~collapse}}{{text}}{{/collapse}}]`, map[string]string{"text": "  x  "}, "[x]"},
+	} {
+		template := New(CollapseHelper())
+		if err := template.ParseString(test.template); err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(test.payload)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expect {
+			t.Errorf("expected %q got %q", test.expect, output)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package mustache
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HumanizeHelpers makes customizers for formatting raw quantities available
+// to the template:
+//
+//	{{~bytes}}{{size}}{{/bytes}}           1.2 GiB
+//	{{~duration}}{{elapsed}}{{/duration}}  2 minutes
+//
+// The bytes helper uses binary units by default; {{~bytes units="si"}} uses
+// decimal units (1.3 GB) instead. The duration helper rounds down to the
+// largest whole unit. Its content is a number of nanoseconds, or of the unit
+// given by the unit option, one of ns, us, ms, s, m or h. Go duration strings
+// such as 2m31s are accepted too.
+func HumanizeHelpers() Option {
+	return func(t *Template) {
+		t.Option(
+			CustomizeFunctionWithOptions("bytes", func(s string, opts map[string]string) (string, error) {
+				n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+				if err != nil {
+					return "", fmt.Errorf("invalid byte count %q", s)
+				}
+				switch units := opts["units"]; units {
+				case "", "iec":
+					return humanizeBytes(n, 1024, []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}), nil
+				case "si":
+					return humanizeBytes(n, 1000, []string{"B", "kB", "MB", "GB", "TB", "PB", "EB"}), nil
+				default:
+					return "", fmt.Errorf("invalid bytes units %q", units)
+				}
+			}),
+			CustomizeFunctionWithOptions("duration", func(s string, opts map[string]string) (string, error) {
+				d, err := parseDuration(strings.TrimSpace(s), opts["unit"])
+				if err != nil {
+					return "", err
+				}
+				return humanizeDuration(d), nil
+			}),
+		)
+	}
+}
+
+// humanizeBytes formats n with the largest unit it is at least one of, where
+// each unit is base times the previous one.
+func humanizeBytes(n, base float64, units []string) string {
+	sign := ""
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	i := 0
+	for n >= base && i < len(units)-1 {
+		n /= base
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%s%d %s", sign, int64(n), units[i])
+	}
+	s := strconv.FormatFloat(n, 'f', 1, 64)
+	return sign + strings.TrimSuffix(s, ".0") + " " + units[i]
+}
+
+// durationUnits maps the unit option of the duration helper to durations.
+var durationUnits = map[string]time.Duration{
+	"":   time.Nanosecond,
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+// parseDuration parses s as a number of unit, or as a Go duration string.
+func parseDuration(s, unit string) (time.Duration, error) {
+	u, ok := durationUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid duration unit %q", unit)
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(n * float64(u)), nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid duration %q", s)
+}
+
+// humanizeDuration describes d in the largest whole unit it spans.
+func humanizeDuration(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	for _, u := range []struct {
+		d    time.Duration
+		name string
+	}{
+		{24 * time.Hour, "day"},
+		{time.Hour, "hour"},
+		{time.Minute, "minute"},
+		{time.Second, "second"},
+		{time.Millisecond, "millisecond"},
+		{time.Microsecond, "microsecond"},
+	} {
+		if d >= u.d {
+			return sign + plural(int64(d/u.d), u.name)
+		}
+	}
+	return sign + plural(int64(d), "nanosecond")
+}
+
+// plural formats n followed by name, adding an s unless n is one.
+func plural(n int64, name string) string {
+	if n == 1 {
+		return "1 " + name
+	}
+	return strconv.FormatInt(n, 10) + " " + name + "s"
+}
@@ -0,0 +1,49 @@
+package mustache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHumanizeHelpers(t *testing.T) {
+	for _, test := range []templateTest{
+		{`{{~bytes}}{{n}}{{/bytes}}`, map[string]interface{}{"n": 512}, "512 B"},
+		{`{{~bytes}}{{n}}{{/bytes}}`, map[string]interface{}{"n": 1024}, "1 KiB"},
+		{`{{~bytes}}{{n}}{{/bytes}}`, map[string]interface{}{"n": int64(1288490188)}, "1.2 GiB"},
+		{`{{~bytes units="si"}}{{n}}{{/bytes}}`, map[string]interface{}{"n": int64(1288490188)}, "1.3 GB"},
+		{`{{~bytes}}{{n}}{{/bytes}}`, map[string]interface{}{"n": -2048}, "-2 KiB"},
+		{`{{~duration}}{{d}}{{/duration}}`, map[string]interface{}{"d": int64(151 * time.Second)}, "2 minutes"},
+		{`{{~duration}}{{d}}{{/duration}}`, map[string]interface{}{"d": "2m31s"}, "2 minutes"},
+		{`{{~duration}}{{d}}{{/duration}}`, map[string]interface{}{"d": time.Hour}, "1 hour"},
+		{`{{~duration unit="s"}}{{d}}{{/duration}}`, map[string]interface{}{"d": 259200}, "3 days"},
+		{`{{~duration unit="ms"}}{{d}}{{/duration}}`, map[string]interface{}{"d": 1.5}, "1 millisecond"},
+		{`{{~duration}}{{d}}{{/duration}}`, map[string]interface{}{"d": 0}, "0 nanoseconds"},
+	} {
+		template := New(HumanizeHelpers())
+		if err := template.ParseString(test.template); err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(test.payload)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expect {
+			t.Errorf("%s: expected %q got %q", test.template, test.expect, output)
+		}
+	}
+
+	for _, tmpl := range []string{
+		`{{~bytes}}many{{/bytes}}`,
+		`{{~bytes units="x"}}1{{/bytes}}`,
+		`{{~duration}}long{{/duration}}`,
+		`{{~duration unit="y"}}1{{/duration}}`,
+	} {
+		template := New(HumanizeHelpers(), SilentMiss(false))
+		if err := template.ParseString(tmpl); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := template.RenderString(nil); err == nil {
+			t.Errorf("%s: expected an error", tmpl)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package mustache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SortedJSONOutput makes objects printed as JSON, such as a map or a struct
+// rendered with {{.}}, list their keys in sorted order whatever their type.
+// Maps are always printed with sorted keys, the option also sorts the fields
+// of structs, which are otherwise printed in the order of their declaration.
+func SortedJSONOutput() Option {
+	return func(t *Template) {
+		t.sortedJSON = true
+	}
+}
+
+// IndentJSONOutput makes the objects and lists printed as JSON indented as by
+// json.MarshalIndent, each element beginning on a new line starting with
+// prefix followed by copies of indent according to its nesting.
+func IndentJSONOutput(prefix, indent string) Option {
+	return func(t *Template) {
+		t.jsonPrefix, t.jsonIndent = prefix, indent
+	}
+}
+
+// formatJSON returns v printed as JSON after the options of t if it is an
+// object or a list which print would print as JSON, and v otherwise. Values in
+// JavaScript contexts are left to print, which writes them as JavaScript.
+func (t *Template) formatJSON(v interface{}, escape escapeType) (interface{}, error) {
+	if !t.sortedJSON && t.jsonPrefix == "" && t.jsonIndent == "" {
+		return v, nil
+	}
+	if escape == jsEscape || escape == jsAttrEscape {
+		return v, nil
+	}
+	if _, ok := v.(fmt.Stringer); ok {
+		return v, nil
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct, reflect.Ptr:
+	default:
+		return v, nil
+	}
+	// Values referencing themselves can not be printed.
+	if cyclic(reflect.ValueOf(v)) {
+		return nil, &CycleError{}
+	}
+	if t.sortedJSON {
+		// Decoding the value as generic JSON turns structs into maps, which
+		// are encoded with sorted keys.
+		b, err := json.Marshal(v)
+		if err != nil {
+			return v, nil
+		}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		var generic interface{}
+		if err := dec.Decode(&generic); err == nil {
+			v = generic
+		}
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent(t.jsonPrefix, t.jsonIndent)
+	if err := enc.Encode(v); err != nil {
+		return v, nil
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
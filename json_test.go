@@ -0,0 +1,53 @@
+package mustache
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestJSONOutput(t *testing.T) {
+	type user struct {
+		Name  string            `json:"name"`
+		Admin bool              `json:"admin"`
+		Tags  map[string]string `json:"tags"`
+	}
+	data := map[string]interface{}{
+		"user":  user{Name: "Ann", Admin: true, Tags: map[string]string{"b": "2", "a": "1"}},
+		"ids":   []int{1, 2},
+		"price": 1.5,
+	}
+	for _, test := range []struct {
+		options  []Option
+		template string
+		expected string
+	}{
+		{nil, "{{{user}}}", `{"name":"Ann","admin":true,"tags":{"a":"1","b":"2"}}`},
+		{[]Option{SortedJSONOutput()}, "{{{user}}} {{{ids}}} {{price}}", `{"admin":true,"name":"Ann","tags":{"a":"1","b":"2"}} [1,2] 1.5`},
+		{[]Option{IndentJSONOutput("", "  ")}, "{{{ids}}}", "[\n  1,\n  2\n]"},
+		{[]Option{SortedJSONOutput(), IndentJSONOutput("> ", "\t")}, "{{#user}}{{{Tags}}};{{/user}}", "{\n> \t\"a\": \"1\",\n> \t\"b\": \"2\"\n> };"},
+		{[]Option{SortedJSONOutput()}, "{{user}}", `{&quot;admin&quot;:true,&quot;name&quot;:&quot;Ann&quot;,&quot;tags&quot;:{&quot;a&quot;:&quot;1&quot;,&quot;b&quot;:&quot;2&quot;}}`},
+		{[]Option{SortedJSONOutput(), ContextualAutoEscape()}, "<script>var ids = {{ids}};</script>", "<script>var ids = [1,2];</script>"},
+	} {
+		template := New(test.options...)
+		if err := template.ParseString(test.template); err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(data)
+		if err != nil {
+			t.Errorf("%q: %s", test.template, err)
+		} else if output != test.expected {
+			t.Errorf("%q: expected %q got %q", test.template, test.expected, output)
+		}
+	}
+
+	cycle := map[string]interface{}{}
+	cycle["self"] = cycle
+	template := New(SortedJSONOutput())
+	if err := template.ParseString("{{{.}}}"); err != nil {
+		t.Fatal(err)
+	}
+	var cycleErr *CycleError
+	if _, err := template.RenderString(cycle); !errors.As(err, &cycleErr) {
+		t.Errorf("expected a *CycleError, got %v", err)
+	}
+}
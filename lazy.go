@@ -0,0 +1,122 @@
+package mustache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+)
+
+// PartialProvider returns the source of the template name for a TemplateSet
+// parsing its templates lazily, see Provide. It returns an error wrapping
+// fs.ErrNotExist if there is no such template.
+type PartialProvider func(ctx context.Context, name string) (string, error)
+
+// StoreProvider returns a PartialProvider reading the latest versions of the
+// templates of store.
+func StoreProvider(store Store) PartialProvider {
+	return func(ctx context.Context, name string) (string, error) {
+		stored, err := store.Get(ctx, name, 0)
+		if err != nil {
+			return "", err
+		}
+		return stored.Source, nil
+	}
+}
+
+// Provide makes the templates not otherwise defined in the set, whether
+// rendered or included as partials, resolve to the sources returned by p,
+// parsed with the options of the set on first use and cached in the set, so
+// that a set with many templates starts without parsing them all. Concurrent
+// renders needing the same template wait for a single parse of it, and a
+// render stops waiting when its context is done. The context given to p is
+// that of the render loading the template.
+//
+// Templates p does not provide render as nothing when included as partials,
+// and failures of p or of the parse are returned by the render and retried by
+// later renders. Lookup, Names and MissingPartials only know of the templates
+// parsed into the set.
+func (s *TemplateSet) Provide(p PartialProvider) {
+	s.lazy = &lazyTemplates{
+		set:      s,
+		provider: p,
+		cache:    make(map[string]*Template),
+		calls:    make(map[string]*lazyCall),
+	}
+}
+
+// lazyTemplates parses the templates of a provider on first use.
+type lazyTemplates struct {
+	set      *TemplateSet
+	provider PartialProvider
+
+	mu    sync.Mutex
+	cache map[string]*Template // nil for templates without a source
+	calls map[string]*lazyCall // parses in progress by name
+}
+
+// lazyCall is a parse in progress, whose result is set before done is closed.
+type lazyCall struct {
+	done chan struct{}
+	t    *Template
+	err  error
+}
+
+// load returns the template name, parsing it if it was not loaded before. It
+// returns nil if the provider has no such template.
+func (l *lazyTemplates) load(ctx context.Context, name string) (*Template, error) {
+	for {
+		l.mu.Lock()
+		if t, ok := l.cache[name]; ok {
+			l.mu.Unlock()
+			return t, nil
+		}
+		c, ok := l.calls[name]
+		if !ok {
+			c = &lazyCall{done: make(chan struct{})}
+			l.calls[name] = c
+			l.mu.Unlock()
+			c.t, c.err = l.parse(ctx, name)
+			l.mu.Lock()
+			delete(l.calls, name)
+			if c.err == nil {
+				l.cache[name] = c.t
+			}
+			l.mu.Unlock()
+			close(c.done)
+			return c.t, c.err
+		}
+		l.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-c.done:
+		}
+		// A render whose context ended while parsing leaves the template to
+		// the others.
+		if !errors.Is(c.err, context.Canceled) && !errors.Is(c.err, context.DeadlineExceeded) {
+			return c.t, c.err
+		}
+	}
+}
+
+// parse reads and parses the template name.
+func (l *lazyTemplates) parse(ctx context.Context, name string) (*Template, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	source, err := l.provider(ctx, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t := New(l.set.options...)
+	t.name = name
+	if err := t.ParseString(source); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return t, nil
+}
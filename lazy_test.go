@@ -0,0 +1,120 @@
+package mustache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestProvide(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for name, source := range map[string]string{
+		"page":   "{{>header}}<p>{{body}}</p>{{>footer}}",
+		"header": "<h1>{{title}}</h1>",
+		"broken": "{{#open}}",
+	} {
+		if _, err := store.Put(ctx, name, source); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var calls int32
+	provider := StoreProvider(store)
+	set := NewSet()
+	set.Provide(func(ctx context.Context, name string) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		return provider(ctx, name)
+	})
+
+	var wg sync.WaitGroup
+	outputs := make([]string, 8)
+	errs := make([]error, len(outputs))
+	for i := range outputs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var b strings.Builder
+			errs[i] = set.Render("page", &b, map[string]string{"title": "Hi", "body": "text"})
+			outputs[i] = b.String()
+		}(i)
+	}
+	wg.Wait()
+	for i, output := range outputs {
+		if errs[i] != nil || output != "<h1>Hi</h1><p>text</p>" {
+			t.Errorf("unexpected output %q, %v", output, errs[i])
+		}
+	}
+	// page, header and the missing footer are each read once.
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("expected 3 reads of the provider, got %d", n)
+	}
+
+	if err := set.Render("footer", &strings.Builder{}); err == nil {
+		t.Error("expected an error for a template not provided")
+	}
+	if err := set.Render("broken", &strings.Builder{}); err == nil || !strings.HasPrefix(err.Error(), "broken: ") {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+	if len(set.Names()) != 0 {
+		t.Errorf("expected no parsed templates, got %q", set.Names())
+	}
+}
+
+func TestProvideDeadline(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls int32
+	set := NewSet()
+	fsys := fstest.MapFS{"page.mustache": {Data: []byte("[{{>slow}}]")}}
+	if err := set.ParseFS(fsys, "*.mustache"); err != nil {
+		t.Fatal(err)
+	}
+	set.Provide(func(ctx context.Context, name string) (string, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+		}
+		select {
+		case <-release:
+			return "slow", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	})
+
+	// The first render parses the partial until its context is canceled.
+	first, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- set.RenderContext(first, "page", &strings.Builder{})
+	}()
+	<-started
+
+	// A render waiting for the partial stops at its deadline.
+	deadline, cancelDeadline := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelDeadline()
+	if err := set.RenderContext(deadline, "page", &strings.Builder{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to be exceeded, got %v", err)
+	}
+
+	// A render still waiting when the first gives up parses the partial.
+	result := make(chan string)
+	go func() {
+		var b strings.Builder
+		if err := set.Render("page", &b); err != nil {
+			t.Error(err)
+		}
+		result <- b.String()
+	}()
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the first render to be canceled, got %v", err)
+	}
+	close(release)
+	if output := <-result; output != "[slow]" {
+		t.Errorf("expected %q got %q", "[slow]", output)
+	}
+}
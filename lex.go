@@ -4,8 +4,10 @@
 package mustache
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"strings"
 	"unicode/utf8"
 )
@@ -16,6 +18,25 @@ type token struct {
 	val  string
 	line int
 	col  int
+	pos  int  // the byte offset of the start of the token
+	trim bool // a delimiter with a trim marker, as in "{{- " or " -}}"
+}
+
+// position returns the position of the end of the token, where its line and
+// column are reported. The value of an error token is its message, so its
+// position is where the error was found.
+func (t token) position() Position {
+	end := t.pos
+	if t.typ != tokenError {
+		end += len(t.val)
+	}
+	return Position{Offset: end, Line: t.line, Col: t.col}
+}
+
+// start returns the position of the start of the token, which must not hold
+// a line break, as delimiters don't.
+func (t token) start() Position {
+	return Position{Offset: t.pos, Line: t.line, Col: t.col - utf8.RuneCountInString(t.val)}
 }
 
 // String satisfies the fmt.Stringer interface making it easier to print tokens.
@@ -46,6 +67,9 @@ const (
 	tokenSetLeftDelim    // denotes a custom left delimiter
 	tokenSetRightDelim   // denotes a custom right delimiter
 	tokenTestValue       // denotes a test value section
+	tokenConst           // {{=const name "value"}} defines a constant
+	tokenEscape          // \ escapes the left delimiter following it
+	tokenVerbatim        // {{{{raw}}}} or {{{{/raw}}}} opens or closes a raw block
 )
 
 // Make the types prettyprint.
@@ -68,6 +92,10 @@ var tokenName = map[tokenType]string{
 	tokenSetDelim:        "t_set_delim",
 	tokenSetLeftDelim:    "t_set_left_delim",
 	tokenSetRightDelim:   "t_set_right_delim",
+	tokenTestValue:       "t_test_value",
+	tokenConst:           "t_const",
+	tokenEscape:          "t_escape",
+	tokenVerbatim:        "t_verbatim",
 }
 
 // String satisfies the fmt.Stringer interface making it easier to print tokens.
@@ -86,21 +114,106 @@ const eof = -1
 type stateFn func(*lexer) stateFn
 
 // lexer holds the state of the scanner.
+//
+// The input is either a string or read from a reader. In the latter case input
+// only holds a window of it, which is read as needed and from which the text
+// before the pending token is dropped, so that a template is scanned with
+// memory bounded by the size of its tokens. Positions are relative to the
+// window, which starts at offset in the input.
 type lexer struct {
-	input               string     // the string being scanned.
-	leftDelim           string     // start of action.
-	rightDelim          string     // end of action.
-	state               stateFn    // the next lexing function to enter.
-	pos                 int        // current position in the input.
-	start               int        // start position of this token.
-	width               int        // width of last rune read from input.
-	tokens              chan token // channel of scanned tokens.
-	useTestValueSection bool       // supports non-standard {{#test_value <ident> value}}
+	input               string        // the string being scanned.
+	r                   *bufio.Reader // the reader the input is read from, nil for a string.
+	rerr                error         // the error reading r, io.EOF once it is read entirely.
+	offset              int           // the offset of input in the whole input.
+	leftDelim           string        // start of action.
+	rightDelim          string        // end of action.
+	state               stateFn       // the next lexing function to enter.
+	pos                 int           // current position in the input.
+	start               int           // start position of this token.
+	width               int           // width of last rune read from input.
+	mark                int           // position of line and col, at or before pos.
+	line                int           // line at mark.
+	col                 int           // column at mark.
+	tokens              []token       // scanned tokens, returned from head on.
+	head                int           // index of the next token returned.
+	useTestValueSection bool          // supports non-standard {{#test_value <ident> value}}
+	tabWidth            int           // columns between tab stops, a tab is one column if 0.
+	escapeDelims        bool          // a backslash escapes the left delimiter, as in \{{
+}
+
+// readSize is the smallest number of bytes read from the reader at once.
+const readSize = 4096
+
+// more reads more of the input from the reader, dropping the part of the
+// window before the pending token, except for the byte preceding it, which
+// the lexer may look back at. It reports whether anything was read.
+func (l *lexer) more() bool {
+	if l.r == nil || l.rerr != nil {
+		return false
+	}
+	cut := l.start
+	if l.mark < cut {
+		cut = l.mark
+	}
+	if cut--; cut > 0 {
+		l.input = l.input[cut:]
+		l.offset += cut
+		l.pos -= cut
+		l.start -= cut
+		l.mark -= cut
+	}
+	// Reading at least as much as the window holds keeps the copying of
+	// long tokens linear.
+	size := len(l.input)
+	if size < readSize {
+		size = readSize
+	}
+	buf := make([]byte, size)
+	n, err := io.ReadFull(l.r, buf)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	if err != nil {
+		l.rerr = err
+	}
+	l.input += string(buf[:n])
+	return n > 0
+}
+
+// ahead returns the input following the current position, reading at least n
+// bytes of it unless the input ends before.
+func (l *lexer) ahead(n int) string {
+	for len(l.input)-l.pos < n && l.more() {
+	}
+	return l.input[l.pos:]
+}
+
+// hasPrefix reports whether the input continues with s.
+func (l *lexer) hasPrefix(s string) bool {
+	return strings.HasPrefix(l.ahead(len(s)), s)
+}
+
+// index returns the index of the first instance of s in the input following
+// the current position, or -1 if there is none. The input is read up to the
+// end of s.
+func (l *lexer) index(s string) int {
+	from := 0
+	for {
+		if i := strings.Index(l.input[l.pos+from:], s); i >= 0 {
+			return from + i
+		}
+		if from = len(l.input) - l.pos - len(s) + 1; from < 0 {
+			from = 0
+		}
+		if !l.more() {
+			return -1
+		}
+	}
 }
 
 // next returns the next rune in the input.
 func (l *lexer) next() (r rune) {
-	if l.pos >= len(l.input) {
+	if l.ahead(utf8.UTFMax) == "" {
 		l.width = 0
 		return eof
 	}
@@ -128,12 +241,20 @@ func (l *lexer) backup() {
 
 // emit passes an token back to the client.
 func (l *lexer) emit(t tokenType) {
-	l.tokens <- token{
-		t,
-		l.input[l.start:l.pos],
-		l.lineNum(),
-		l.columnNum(),
+	val := l.input[l.start:l.pos]
+	if l.r != nil {
+		// The value is copied so that it does not keep the window alive.
+		val = strings.Clone(val)
 	}
+	line, col := l.position()
+	l.tokens = append(l.tokens, token{
+		typ:  t,
+		val:  val,
+		line: line,
+		col:  col,
+		pos:  l.offset + l.start,
+		trim: t == tokenLeftDelim && val == l.leftDelim+trimMarker || t == tokenRightDelim && val == trimMarker+l.rightDelim,
+	})
 	l.start = l.pos
 }
 
@@ -150,42 +271,75 @@ func (l *lexer) consumeWhitespace() {
 	l.ignore()
 }
 
-// lineNum reports which line we're on. Doing it this way
-// means we don't have to worry about peek double counting.
-func (l *lexer) lineNum() int {
-	return 1 + strings.Count(l.input[:l.pos], "\n")
+// position reports the line and the column of the current position, counting
+// from the last position reported. Columns count the characters of the line
+// as runes, and tabs advance to the next tab stop if tabWidth is set.
+func (l *lexer) position() (line, col int) {
+	s := l.input[l.mark:l.pos]
+	if lf := strings.LastIndex(s, "\n"); lf != -1 {
+		l.line += strings.Count(s, "\n")
+		l.col = 0
+		s = s[lf+1:]
+	}
+	l.col = addColumns(l.col, s, l.tabWidth)
+	l.mark = l.pos
+	return l.line, l.col
 }
 
-// columnNum reports the character of the current line we're on.
-func (l *lexer) columnNum() int {
-	if lf := strings.LastIndex(l.input[:l.pos], "\n"); lf != -1 {
-		return len(l.input[lf+1 : l.pos])
+// columns returns the number of columns taken by line, counting runes and
+// advancing tabs to the next multiple of tabWidth if it is greater than 1.
+// Carriage returns take no column, so that lines ending in "\r\n" have the
+// same positions as lines ending in "\n".
+func columns(line string, tabWidth int) int {
+	return addColumns(0, line, tabWidth)
+}
+
+// addColumns returns the column reached by following s, which holds no line
+// break, from the column col.
+func addColumns(col int, s string, tabWidth int) int {
+	if tabWidth <= 1 {
+		return col + utf8.RuneCountInString(s) - strings.Count(s, "\r")
+	}
+	for _, r := range s {
+		if r == '\r' {
+			continue
+		} else if r == '\t' {
+			col += tabWidth - col%tabWidth
+		} else {
+			col++
+		}
 	}
-	return len(l.input[:l.pos])
+	return col
 }
 
 // error returns an error token and terminates the scan by passing
 // back a nil pointer that will be the next state, terminating l.token.
 func (l *lexer) errorf(format string, args ...interface{}) stateFn {
-	l.tokens <- token{
-		tokenError,
-		fmt.Sprintf(format, args...),
-		l.lineNum(),
-		l.columnNum(),
-	}
+	line, col := l.position()
+	l.tokens = append(l.tokens, token{
+		typ:  tokenError,
+		val:  fmt.Sprintf(format, args...),
+		line: line,
+		col:  col,
+		pos:  l.offset + l.pos,
+	})
 	return nil
 }
 
-// token returns the next token from the input.
+// token returns the next token from the input. States are run as functions
+// until one of them emits a token, and the tokens emitted are returned in
+// order. Once the input is scanned, token keeps returning an EOF token.
 func (l *lexer) token() token {
-	for {
-		select {
-		case token := <-l.tokens:
-			return token
-		default:
-			l.state = l.state(l)
+	for l.head == len(l.tokens) {
+		if l.state == nil {
+			return token{typ: tokenEOF, pos: l.offset + l.pos}
 		}
+		l.tokens, l.head = l.tokens[:0], 0
+		l.state = l.state(l)
 	}
+	t := l.tokens[l.head]
+	l.head++
+	return t
 }
 
 func (l *lexer) String() string {
@@ -203,13 +357,28 @@ func newLexer(input, left, right string, testValueSection bool) *lexer {
 		input:               input,
 		leftDelim:           left,
 		rightDelim:          right,
-		tokens:              make(chan token, 2),
+		line:                1,
 		useTestValueSection: testValueSection,
 	}
 	l.state = stateText // initial state
 	return l
 }
 
+// newReaderLexer creates a new scanner reading its input from r as needed.
+func newReaderLexer(r io.Reader, left, right string, testValueSection bool) *lexer {
+	l := newLexer("", left, right, testValueSection)
+	l.r = bufio.NewReader(r)
+	return l
+}
+
+// err returns the error reading the input, if any.
+func (l *lexer) err() error {
+	if l.rerr == io.EOF {
+		return nil
+	}
+	return l.rerr
+}
+
 // state functions.
 
 // stateText scans until an opening action delimiter, "{{".
@@ -217,10 +386,40 @@ func stateText(l *lexer) stateFn {
 	for {
 		// Lookahead for {{ which should switch to lexing an open tag instead of
 		// regular text tokens.
-		if strings.HasPrefix(l.input[l.pos:], l.leftDelim) {
+		if l.hasPrefix(l.leftDelim) {
+			if l.escapeDelims && l.pos > l.start && l.input[l.pos-1] == '\\' {
+				// Each pair of the backslashes before the delimiter is an
+				// escaped backslash, and an odd one escapes the delimiter.
+				// The backslashes left out are emitted on their own, so
+				// that the parser can leave them out, and an escaped
+				// delimiter is part of the text following it.
+				n := 1
+				for l.pos-n > l.start && l.input[l.pos-n-1] == '\\' {
+					n++
+				}
+				l.pos -= n
+				if l.pos > l.start {
+					l.emit(tokenText)
+				}
+				for i := 0; i < n/2; i++ {
+					l.seek(1)
+					l.emit(tokenText)
+					l.seek(1)
+					l.emit(tokenEscape)
+				}
+				if n%2 == 1 {
+					l.seek(1)
+					l.emit(tokenEscape)
+					l.seek(len(l.leftDelim))
+					return stateText
+				}
+			}
 			if l.pos > l.start {
 				l.emit(tokenText)
 			}
+			if open, _ := verbatimTags(l.leftDelim, l.rightDelim); l.hasPrefix(open) {
+				return stateVerbatim
+			}
 			return stateLeftDelim
 		}
 		// Produce a token and exit the loop if we have reached the end of file.
@@ -239,9 +438,38 @@ func stateText(l *lexer) stateFn {
 	return nil
 }
 
+// verbatimName is the name of raw blocks, whose content is rendered as is.
+const verbatimName = "raw"
+
+// verbatimTags returns the tags opening and closing a raw block with the
+// delimiters left and right, which are doubled: {{{{raw}}}} and {{{{/raw}}}}.
+func verbatimTags(left, right string) (open, close string) {
+	return left + left + verbatimName + right + right, left + left + "/" + verbatimName + right + right
+}
+
+// stateVerbatim scans a raw block, whose opening tag is known to be present:
+// the opening tag, the content of the block and its closing tag.
+func stateVerbatim(l *lexer) stateFn {
+	open, close := verbatimTags(l.leftDelim, l.rightDelim)
+	if l.index(close) < 0 {
+		return l.errorf("unclosed raw block")
+	}
+	l.seek(len(open))
+	l.emit(tokenVerbatim)
+	l.seek(l.index(close))
+	l.emit(tokenText)
+	l.seek(len(close))
+	l.emit(tokenVerbatim)
+	return stateText
+}
+
 // stateLeftDelim scans the left delimiter, which is known to be present.
 func stateLeftDelim(l *lexer) stateFn {
 	l.seek(len(l.leftDelim))
+	if l.peek() == '=' && l.isConst() {
+		l.emit(tokenLeftDelim)
+		return stateConst
+	}
 	if l.peek() == '=' {
 		// When the lexer encounters "{{=" it proceeds to the set delimiter
 		// state which alters the left and right delimiters. This operation is
@@ -249,12 +477,106 @@ func stateLeftDelim(l *lexer) stateFn {
 		l.next()
 		return stateSetDelim
 	}
+	if l.hasPrefix(trimMarker) && whitespace(l.peekAt(len(trimMarker))) {
+		l.seek(len(trimMarker))
+	}
 	l.emit(tokenLeftDelim)
 	return stateTag
 }
 
-// stateRightDelim scans the right delimiter, which is known to be present.
+// trimMarker marks a tag trimming the whitespace preceding it, as in
+// "{{- name}}", or following it, as in "{{name -}}". It is separated from the
+// content of the tag by whitespace, so that "{{-name}}" is a variable named
+// "-name".
+const trimMarker = "-"
+
+// peekAt returns but does not consume the rune n bytes after the current
+// position.
+func (l *lexer) peekAt(n int) rune {
+	s := l.ahead(n + utf8.UTFMax)
+	if n >= len(s) {
+		return eof
+	}
+	r, _ := utf8.DecodeRuneInString(s[n:])
+	return r
+}
+
+// quoted returns the length of the quoted string at the current position,
+// quotes included, or 0 if there is none. A backslash escapes the character
+// following it. Only the arguments of a tag, which follow an equals sign or
+// whitespace as in opt="v" or coalesce a "b", are scanned as strings, and a
+// quote which is not closed is an ordinary character. Quoted keys such as
+// a."b" are not, and cannot hold the right delimiter.
+func (l *lexer) quoted() int {
+	s := l.ahead(1)
+	if s == "" || s[0] != '"' && s[0] != '\'' || l.pos == l.start {
+		return 0
+	}
+	if prev := l.input[l.pos-1]; prev != '=' && !whitespace(rune(prev)) {
+		return 0
+	}
+	for i := 1; i < len(l.ahead(i+1)); i++ {
+		switch l.input[l.pos+i] {
+		case '\\':
+			i++
+		case s[0]:
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// atRightDelim reports whether the input continues with the right delimiter,
+// possibly preceded by a trim marker.
+func (l *lexer) atRightDelim() bool {
+	if l.hasPrefix(l.rightDelim) {
+		return true
+	}
+	return l.pos > 0 && whitespace(rune(l.input[l.pos-1])) && l.hasPrefix(trimMarker+l.rightDelim)
+}
+
+// trimRight returns s, the content of a tag up to its right delimiter,
+// without its trailing trim marker if there is one.
+func trimRight(s string) string {
+	trimmed := strings.TrimSuffix(s, trimMarker)
+	if len(trimmed) == len(s) || trimmed == "" || !whitespace(rune(trimmed[len(trimmed)-1])) {
+		return s
+	}
+	return trimmed
+}
+
+// isConst reports whether the tag following the left delimiter defines a
+// constant. Unlike a set delimiter tag, which also starts with "=", it does not
+// end with "=".
+func (l *lexer) isConst() bool {
+	if !l.hasPrefix("=const ") {
+		return false
+	}
+	i := l.index(l.rightDelim)
+	return i >= 0 && !strings.HasSuffix(strings.TrimSpace(l.input[l.pos+1:l.pos+i]), "=")
+}
+
+// stateConst scans a constant definition, which is known to be present. The
+// name and value of the constant are emitted as a single identifier.
+func stateConst(l *lexer) stateFn {
+	l.seek(len("=const"))
+	l.emit(tokenConst)
+	l.consumeWhitespace()
+	i := l.index(l.rightDelim)
+	end := l.pos + len(trimRight(l.input[l.pos:l.pos+i]))
+	l.seek(len(strings.TrimRight(l.input[l.pos:end], " \t\r\n")))
+	l.emit(tokenIdentifier)
+	l.pos = end
+	l.ignore()
+	return stateRightDelim
+}
+
+// stateRightDelim scans the right delimiter, which is known to be present,
+// along with the trim marker preceding it.
 func stateRightDelim(l *lexer) stateFn {
+	if !l.hasPrefix(l.rightDelim) {
+		l.seek(len(trimMarker))
+	}
 	l.seek(len(l.rightDelim))
 	l.emit(tokenRightDelim)
 	return stateText
@@ -300,7 +622,7 @@ func stateTestSentinel(l *lexer) stateFn {
 	l.emit(tokenIdentifier)
 	l.consumeWhitespace()
 
-	if strings.HasPrefix(l.input[l.pos:], l.leftDelim) {
+	if l.hasPrefix(l.leftDelim) {
 		return stateTestIdentLeftDelim
 	}
 
@@ -315,19 +637,22 @@ func stateTest(l *lexer) stateFn {
 
 // stateTag scans the elements inside action delimiters.
 func stateTag(l *lexer) stateFn {
-	if strings.HasPrefix(l.input[l.pos:], "}"+l.rightDelim) {
+	if l.hasPrefix("}" + l.rightDelim) {
 		l.seek(1)
 		l.emit(tokenRawEnd)
 		return stateRightDelim
 	}
-	if strings.HasPrefix(l.input[l.pos:], l.rightDelim) {
+	if l.atRightDelim() {
 		return stateRightDelim
 	}
-	if l.useTestValueSection && strings.HasPrefix(l.input[l.pos:], "#test_value") {
+	if l.useTestValueSection && l.hasPrefix("#test_value") {
 		return stateTest
 	}
 	switch r := l.next(); {
-	case r == eof || r == '\n':
+	case r == eof || r == '\n' || r == '\r' && l.hasPrefix("\n"):
+		// The error is reported at the end of the line of the tag, before
+		// its line break, whether it is "\n" or "\r\n".
+		l.backup()
 		return l.errorf("unclosed action")
 	case whitespace(r):
 		l.ignore()
@@ -340,6 +665,7 @@ func stateTag(l *lexer) stateFn {
 		l.emit(tokenSectionInverse)
 	case r == '~':
 		l.emit(tokenSectionFunction)
+		return stateFunctionIdent
 	case r == '/':
 		l.emit(tokenSectionEnd)
 	case r == '&':
@@ -364,10 +690,16 @@ func stateIdentWithMode(exitState stateFn) stateFn {
 		whitespaceCount := 0
 	Loop:
 		for {
+			if n := l.quoted(); n > 0 {
+				// A quoted argument may hold the right delimiter.
+				whitespaceCount = 0
+				l.seek(n)
+				continue
+			}
 			switch r := l.peek(); {
 			case r == eof:
 				return l.errorf("unclosed tag")
-			case !whitespace(r) && !strings.HasPrefix(l.input[l.pos:], l.rightDelim):
+			case !whitespace(r) && !l.atRightDelim():
 				// If we found something not whitespace or closing tag
 				// then this is internal to a token
 				whitespaceCount = 0
@@ -398,13 +730,53 @@ func stateIdentWithMode(exitState stateFn) stateFn {
 	}
 }
 
+// stateFunctionIdent scans the identifier of a function section, which holds
+// the name of the function followed by its options. Option values may be tags
+// themselves, as in {{~date tz={{user.tz}}}}, so nested tags are included in
+// the identifier rather than ending it.
+func stateFunctionIdent(l *lexer) stateFn {
+	l.consumeWhitespace()
+	end := l.pos
+	for {
+		switch n := l.quoted(); {
+		case n > 0:
+			// A quoted option value may hold delimiters.
+			l.seek(n)
+			end = l.pos
+		case l.hasPrefix(l.leftDelim):
+			l.seek(len(l.leftDelim))
+			i := l.index(l.rightDelim)
+			if i < 0 {
+				l.seek(-len(l.leftDelim))
+				return l.errorf("unclosed tag")
+			}
+			l.seek(i + len(l.rightDelim))
+			end = l.pos
+		case l.atRightDelim():
+			// Leave any trailing whitespace out of the identifier, it will be
+			// ignored by stateTag.
+			l.pos = end
+			l.emit(tokenIdentifier)
+			return stateTag
+		default:
+			r := l.next()
+			if r == eof {
+				return l.errorf("unclosed tag")
+			}
+			if !whitespace(r) {
+				end = l.pos
+			}
+		}
+	}
+}
+
 // stateComment scans a comment. The left comment marker is known to be present.
 func stateComment(l *lexer) stateFn {
-	i := strings.Index(l.input[l.pos:], l.rightDelim)
+	i := l.index(l.rightDelim)
 	if i < 0 {
 		return l.errorf("unclosed tag")
 	}
-	l.seek(i)
+	l.seek(len(trimRight(l.input[l.pos : l.pos+i])))
 	l.emit(tokenText)
 	return stateRightDelim
 }
@@ -413,7 +785,7 @@ func stateComment(l *lexer) stateFn {
 // and right delimiters to new values.
 func stateSetDelim(l *lexer) stateFn {
 	end := "=" + l.rightDelim
-	i := strings.Index(l.input[l.pos:], end)
+	i := l.index(end)
 	if i < 0 {
 		return l.errorf("unclosed tag")
 	}
@@ -430,7 +802,6 @@ func stateSetDelim(l *lexer) stateFn {
 		}
 	}
 	l.seek(i + len(end))
-	l.ignore()
 	l.emit(tokenSetDelim)
 	return stateText
 }
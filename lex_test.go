@@ -34,13 +34,13 @@ func TestLexer(t *testing.T) {
 				{typ: tokenIdentifier, val: "bar"},
 				{typ: tokenRightDelim, val: "}}"},
 				{typ: tokenText, val: " baz "},
-				{typ: tokenSetDelim},
+				{typ: tokenSetDelim, val: "{{=| |=}}"},
 				{typ: tokenText, val: "\r\n "},
 				{typ: tokenLeftDelim, val: "|"},
 				{typ: tokenIdentifier, val: "foo"},
 				{typ: tokenRightDelim, val: "|"},
 				{typ: tokenText, val: " "},
-				{typ: tokenSetDelim},
+				{typ: tokenSetDelim, val: "|={{! !}}=|"},
 				{typ: tokenText, val: " "},
 				{typ: tokenLeftDelim, val: "{{!"},
 				{typ: tokenIdentifier, val: "bar"},
@@ -81,6 +81,26 @@ func TestLexer(t *testing.T) {
 				{typ: tokenEOF},
 			},
 		},
+		{
+			// Trim markers are part of the delimiters, unless they are not
+			// separated from the identifier.
+			"a {{- b -}} {{-c}}{{! d -}}",
+			[]token{
+				{typ: tokenText, val: "a "},
+				{typ: tokenLeftDelim, val: "{{-"},
+				{typ: tokenIdentifier, val: "b"},
+				{typ: tokenRightDelim, val: "-}}"},
+				{typ: tokenText, val: " "},
+				{typ: tokenLeftDelim, val: "{{"},
+				{typ: tokenIdentifier, val: "-c"},
+				{typ: tokenRightDelim, val: "}}"},
+				{typ: tokenLeftDelim, val: "{{"},
+				{typ: tokenComment, val: "!"},
+				{typ: tokenText, val: " d "},
+				{typ: tokenRightDelim, val: "-}}"},
+				{typ: tokenEOF},
+			},
+		},
 		{
 			// A quoted key is emitted as a single identifier token, quotes and
 			// interior dots included; surrounding whitespace is trimmed.
@@ -145,3 +165,45 @@ func TestLexer(t *testing.T) {
 		}
 	}
 }
+
+func TestLexerColumns(t *testing.T) {
+	for _, test := range []struct {
+		template string
+		tabWidth int
+		line     int
+		col      int
+	}{
+		{"héllo {{name}}", 0, 1, 12},
+		{"日本語\n{{name}}", 0, 2, 6},
+		{"\t{{name}}", 0, 1, 7},
+		{"\t{{name}}", 4, 1, 10},
+		{"ab\t{{name}}", 4, 1, 10},
+		{"\r\n\t\t{{name}}", 8, 2, 22},
+	} {
+		lexer := newLexer(test.template, "{{", "}}", false)
+		lexer.tabWidth = test.tabWidth
+		for token := lexer.token(); token.typ > tokenEOF; token = lexer.token() {
+			if token.typ != tokenIdentifier {
+				continue
+			}
+			if token.line != test.line || token.col != test.col {
+				t.Errorf("%q: expected %d:%d got %d:%d", test.template, test.line, test.col, token.line, token.col)
+			}
+		}
+	}
+}
+
+func TestLexerAfterEOF(t *testing.T) {
+	for _, template := range []string{"a {{b}}", "a {{b"} {
+		lexer := newLexer(template, "{{", "}}", false)
+		token := lexer.token()
+		for token.typ > tokenEOF {
+			token = lexer.token()
+		}
+		for i := 0; i < 2; i++ {
+			if token = lexer.token(); token.typ != tokenEOF {
+				t.Errorf("%q: expected EOF after the end of the input, got %s", template, token)
+			}
+		}
+	}
+}
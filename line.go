@@ -0,0 +1,130 @@
+package mustache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SingleLine makes the template safe for single line contexts such as email
+// subjects or chat titles, where a stray newline in a value can break or even
+// inject into the downstream system. Newlines in the values of variables are
+// replaced by spaces and other control characters are removed. RenderLine
+// additionally cuts its output to maxLength runes, if maxLength is positive,
+// and reports what was changed.
+func SingleLine(maxLength int) Option {
+	return func(t *Template) {
+		t.singleLine = true
+		t.maxLineLength = maxLength
+	}
+}
+
+// LineReport describes the changes made while rendering a template in single
+// line mode.
+type LineReport struct {
+	// Sanitized holds the names of the variables whose values had newlines or
+	// control characters, in order of appearance.
+	Sanitized []string
+	// Truncated reports whether the output was cut to the maximum length.
+	Truncated bool
+}
+
+// RenderLine renders the template as a single line, returning the output along
+// with a report of the changes made to it. It behaves like RenderString for
+// templates without the SingleLine option.
+func (t *Template) RenderLine(data ...interface{}) (string, LineReport, error) {
+	var b bytes.Buffer
+	report := &LineReport{}
+	err := t.run(context.Background(), &b, data, func(w *writer) {
+		*report = LineReport{}
+		w.state.lineReport = report
+	})
+	s, truncated := t.truncateLine(b.String())
+	report.Truncated = truncated
+	return s, *report, err
+}
+
+// truncateLine cuts s to the maximum length of single line mode, reporting
+// whether it was cut.
+func (t *Template) truncateLine(s string) (string, bool) {
+	if t.singleLine && t.maxLineLength > 0 && utf8.RuneCountInString(s) > t.maxLineLength {
+		return string([]rune(s)[:t.maxLineLength]), true
+	}
+	return s, false
+}
+
+// printValue prints the value v of the variable name to w, sanitizing it in
+// single line mode. It returns the error of writing to w, or a *CycleError if
+// v references itself, which aborts the render whatever the options.
+func (t *Template) printValue(w *writer, name string, v interface{}, escape escapeType) error {
+	err := t.print(w, name, v, escape)
+	if e, ok := err.(*CycleError); ok {
+		e.Name = name
+		w.state.err = e
+	}
+	return err
+}
+
+func (t *Template) print(w *writer, name string, v interface{}, escape escapeType) error {
+	if !t.singleLine {
+		return t.printFormatted(w, v, escape)
+	}
+	var sb strings.Builder
+	if err := t.printFormatted(&sb, v, escape); err != nil {
+		return err
+	}
+	s, changed := toSingleLine(sb.String())
+	if changed && w.state.lineReport != nil {
+		w.state.lineReport.Sanitized = append(w.state.lineReport.Sanitized, name)
+	}
+	if changed {
+		w.warn(Warning{Kind: SanitizedWarning, Name: name})
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+// printFormatted prints v to w with the value printer of t, or after its
+// formatting options.
+func (t *Template) printFormatted(w io.Writer, v interface{}, escape escapeType) error {
+	if t.printCustom(w, v, escape) {
+		return nil
+	}
+	v, err := t.formatTime(v, "")
+	if err != nil {
+		return err
+	}
+	v = t.formatNumber(v)
+	if v, err = t.formatJSON(v, escape); err != nil {
+		return err
+	}
+	return print(w, v, escape)
+}
+
+// toSingleLine replaces each run of line breaks, including the Unicode line
+// and paragraph separators, and tabs in s with a space and removes all other
+// control characters. It reports whether s was changed.
+func toSingleLine(s string) (string, bool) {
+	if strings.IndexFunc(s, unicode.IsControl) < 0 && !strings.ContainsAny(s, "\u2028\u2029") {
+		return s, false
+	}
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t' || r == '\u2028' || r == '\u2029':
+			if !space {
+				b.WriteByte(' ')
+				space = true
+			}
+		case unicode.IsControl(r):
+		default:
+			b.WriteRune(r)
+			space = false
+		}
+	}
+	return b.String(), true
+}
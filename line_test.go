@@ -0,0 +1,51 @@
+package mustache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSingleLine(t *testing.T) {
+	template := New(SingleLine(30))
+	if err := template.ParseString("Re: {{subject}} ({{count}})"); err != nil {
+		t.Fatal(err)
+	}
+
+	output, report, err := template.RenderLine(map[string]interface{}{"subject": "Disk full\r\nBcc: x@example.com", "count": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Re: Disk full Bcc: x@example.c"; output != expected {
+		t.Errorf("expected %q got %q", expected, output)
+	}
+	expected := LineReport{Sanitized: []string{"subject"}, Truncated: true}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("expected %+v got %+v", expected, report)
+	}
+
+	output, report, err = template.RenderLine(map[string]interface{}{"subject": "a\x00b c\td", "count": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Re: ab c d (1)"; output != expected {
+		t.Errorf("expected %q got %q", expected, output)
+	}
+	if report.Truncated || len(report.Sanitized) != 1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	// Values are sanitized when rendering by other means too.
+	if output, _ := template.RenderString(map[string]interface{}{"subject": "a\nb"}); output != "Re: a b ()" {
+		t.Errorf("unexpected output %q", output)
+	}
+
+	// Without the option RenderLine behaves like RenderString.
+	template = New()
+	if err := template.ParseString("{{subject}}"); err != nil {
+		t.Fatal(err)
+	}
+	output, report, _ = template.RenderLine(map[string]string{"subject": "a\nb"})
+	if output != "a\nb" || len(report.Sanitized) != 0 {
+		t.Errorf("unexpected output %q and report %+v", output, report)
+	}
+}
@@ -0,0 +1,220 @@
+package mustache
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Rule is a policy templates are checked against by Lint. Check is given the
+// parse tree of a template and returns the violations of the rule it finds.
+type Rule struct {
+	Name  string
+	Check func(nodes []Node) []Finding
+}
+
+// Finding is a violation of a rule found by Lint.
+type Finding struct {
+	Rule    string // the name of the violated rule, set by Lint
+	Node    Node   // the offending node
+	Message string
+}
+
+func (f Finding) String() string {
+	return f.Rule + ": " + f.Message
+}
+
+// Lint checks the template against rules and returns the findings of all
+// rules, in the order of rules.
+func Lint(t *Template, rules ...Rule) []Finding {
+	nodes := t.Nodes()
+	var findings []Finding
+	for _, rule := range rules {
+		for _, f := range rule.Check(nodes) {
+			f.Rule = rule.Name
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// NoRawVariables returns a rule reporting variables which are not escaped,
+// such as {{{name}}} or {{&name}}, whose name matches one of patterns. The
+// patterns use the syntax of path.Match, e.g. "user.*". Without patterns all
+// unescaped variables are reported.
+func NoRawVariables(patterns ...string) Rule {
+	matches := func(name string) bool {
+		if len(patterns) == 0 {
+			return true
+		}
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+	return Rule{
+		Name: "no-raw-variables",
+		Check: func(nodes []Node) []Finding {
+			var findings []Finding
+			Walk(nodes, func(n Node) bool {
+				switch n := n.(type) {
+				case *VarNode:
+					if n.Unescaped && matches(n.Name) {
+						findings = append(findings, Finding{Node: n, Message: fmt.Sprintf("variable %q is not escaped", n.Name)})
+					}
+				case *CoalesceNode:
+					if !n.Unescaped {
+						break
+					}
+					for _, arg := range n.Args {
+						if arg != "" && arg[0] != '"' && matches(arg) {
+							findings = append(findings, Finding{Node: n, Message: fmt.Sprintf("variable %q is not escaped", arg)})
+						}
+					}
+				}
+				return true
+			})
+			return findings
+		},
+	}
+}
+
+// DeprecatedPartials returns a rule reporting references to the partials
+// named by the keys of partials. The values name the partials to use instead,
+// and may be empty.
+func DeprecatedPartials(partials map[string]string) Rule {
+	return Rule{
+		Name: "deprecated-partials",
+		Check: func(nodes []Node) []Finding {
+			var findings []Finding
+			Walk(nodes, func(n Node) bool {
+				p, ok := n.(*PartialNode)
+				if !ok {
+					return true
+				}
+				if replacement, ok := partials[p.Name]; ok {
+					msg := fmt.Sprintf("partial %q is deprecated", p.Name)
+					if replacement != "" {
+						msg += fmt.Sprintf(", use %q instead", replacement)
+					}
+					findings = append(findings, Finding{Node: n, Message: msg})
+				}
+				return true
+			})
+			return findings
+		},
+	}
+}
+
+// DeprecatedVariables returns a rule reporting variables, sections, let
+// bindings and the arguments of zip sections, coalesce and translation tags
+// referring to the names given by the keys of variables, or to names under
+// them such as user.email for user. The values name the variables to use
+// instead, and may be empty. The variables in the options of function
+// sections are not reported.
+func DeprecatedVariables(variables map[string]string) Rule {
+	return Rule{
+		Name: "deprecated-variables",
+		Check: func(nodes []Node) []Finding {
+			var findings []Finding
+			check := func(n Node, name string) {
+				replacement, ok := deprecatedName(variables, name)
+				if !ok {
+					return
+				}
+				msg := fmt.Sprintf("variable %q is deprecated", name)
+				if replacement != "" {
+					msg += fmt.Sprintf(", use %q instead", replacement)
+				}
+				findings = append(findings, Finding{Node: n, Message: msg})
+			}
+			Walk(nodes, func(n Node) bool {
+				switch n := n.(type) {
+				case *VarNode:
+					check(n, n.Name)
+				case *SectionNode:
+					switch n.Kind {
+					case "case", "default", "capture":
+					case "let":
+						// Bindings may refer to the bindings before them.
+						bound := make(map[string]bool, len(n.Args))
+						for _, arg := range n.Args {
+							name, value, _ := strings.Cut(arg, "=")
+							if stages := splitPipes(value); len(stages) > 1 && strings.HasSuffix(stages[0], " ") {
+								// The value is followed by filters.
+								value = strings.TrimSpace(stages[0])
+							}
+							if root, _, _ := strings.Cut(value, "."); value != "" && value[0] != '"' && !bound[root] {
+								check(n, value)
+							}
+							bound[name] = true
+						}
+					case "zip":
+						check(n, n.Name)
+						check(n, n.Args[0])
+					default:
+						check(n, n.Name)
+					}
+				case *CoalesceNode:
+					for _, arg := range n.Args {
+						if arg != "" && arg[0] != '"' {
+							check(n, arg)
+						}
+					}
+				case *TranslateNode:
+					for _, arg := range n.Args {
+						if _, value, _ := strings.Cut(arg, "="); value != "" && value[0] != '"' {
+							check(n, value)
+						}
+					}
+				}
+				return true
+			})
+			return findings
+		},
+	}
+}
+
+// MaxNesting returns a rule reporting sections and function sections nested
+// more than max levels deep. Only the outermost offending section of a branch
+// is reported, and the cases of a switch section do not count as a level.
+func MaxNesting(max int) Rule {
+	return Rule{
+		Name: "max-nesting",
+		Check: func(nodes []Node) []Finding {
+			var findings []Finding
+			var check func(nodes []Node, depth int)
+			check = func(nodes []Node, depth int) {
+				for _, n := range nodes {
+					var children []Node
+					switch n := n.(type) {
+					case *SectionNode:
+						if n.Kind == "case" || n.Kind == "default" {
+							// The cases of a switch are part of its level.
+							check(n.Children, depth)
+							continue
+						}
+						children = n.Children
+					case *FunctionNode:
+						children = n.Children
+					default:
+						continue
+					}
+					if depth+1 > max {
+						_, name := describeNode(n)
+						findings = append(findings, Finding{
+							Node:    n,
+							Message: fmt.Sprintf("section %q is nested %d levels deep, more than %d", name, depth+1, max),
+						})
+						continue
+					}
+					check(children, depth+1)
+				}
+			}
+			check(nodes, 0)
+			return findings
+		},
+	}
+}
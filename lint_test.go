@@ -0,0 +1,67 @@
+package mustache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	template := New(SwitchSections())
+	err := template.ParseString(`{{{user.bio}}}{{&title}}{{user.name}}{{>old_header}}{{>footer}}` +
+		`{{#a}}{{#b}}{{#c}}{{#d}}{{/d}}{{/c}}{{/b}}{{/a}}` +
+		`{{#switch s}}{{#case "x"}}{{#e}}{{/e}}{{/case}}{{/switch}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	for _, f := range Lint(template,
+		NoRawVariables("user.*"),
+		DeprecatedPartials(map[string]string{"old_header": "header"}),
+		DeprecatedVariables(map[string]string{"user.name": "user.login", "title": ""}),
+		MaxNesting(2),
+		Rule{Name: "custom", Check: func(nodes []Node) []Finding {
+			return []Finding{{Message: "checked"}}
+		}},
+	) {
+		messages = append(messages, f.String())
+	}
+	expected := []string{
+		`no-raw-variables: variable "user.bio" is not escaped`,
+		`deprecated-partials: partial "old_header" is deprecated, use "header" instead`,
+		`deprecated-variables: variable "title" is deprecated`,
+		`deprecated-variables: variable "user.name" is deprecated, use "user.login" instead`,
+		`max-nesting: section "c" is nested 3 levels deep, more than 2`,
+		`custom: checked`,
+	}
+	if !reflect.DeepEqual(messages, expected) {
+		t.Errorf("expected %q got %q", expected, messages)
+	}
+
+	if findings := Lint(template, NoRawVariables()); len(findings) != 2 {
+		t.Errorf("expected 2 raw variables got %v", findings)
+	}
+}
+
+func TestDeprecatedVariablesSections(t *testing.T) {
+	upper := func(s string) (string, error) { return s, nil }
+	template := New(LetSections(), ZipSections(), ChunkSections(), SwitchSections(), FilterPipes(), CustomizeFunction("upper", upper))
+	err := template.ParseString(`{{#let v=old.a w=v x="old" y=old | upper}}{{/let}}{{#zip a old}}{{/zip}}` +
+		`{{#chunk old 2}}{{/chunk}}{{#switch old}}{{#case "old"}}{{/case}}{{/switch}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	for _, f := range Lint(template, DeprecatedVariables(map[string]string{"old": ""})) {
+		messages = append(messages, f.String())
+	}
+	expected := []string{
+		`deprecated-variables: variable "old.a" is deprecated`,
+		`deprecated-variables: variable "old" is deprecated`,
+		`deprecated-variables: variable "old" is deprecated`,
+		`deprecated-variables: variable "old" is deprecated`,
+		`deprecated-variables: variable "old" is deprecated`,
+	}
+	if !reflect.DeepEqual(messages, expected) {
+		t.Errorf("expected %q got %q", expected, messages)
+	}
+}
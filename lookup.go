@@ -8,6 +8,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // pathSegment is a single key within a dotted lookup path. quoted reports whether
@@ -119,12 +120,31 @@ func lookupPath(path []pathSegment, context ...interface{}) (interface{}, bool)
 // probed in turn, and an unquoted "." returns the whole context as-is.
 func resolveSegment(seg pathSegment, context ...interface{}) (interface{}, bool) {
 	for _, c := range context {
-		reflectValue := reflect.ValueOf(c)
 		// If the segment is an unquoted ".", return the whole context as-is. A quoted
 		// "." is a literal key and falls through to the normal resolution below.
 		if !seg.quoted && seg.key == "." {
-			return c, truth(reflectValue)
+			return c, truthOf(c)
 		}
+		// The most common contexts, those decoded from JSON, are looked up
+		// without reflection.
+		switch c := c.(type) {
+		case map[string]interface{}:
+			if v, found := c[seg.key]; found {
+				return v, truthOf(v)
+			}
+			continue
+		case map[string]string:
+			if v, found := c[seg.key]; found {
+				return v, v != ""
+			}
+			continue
+		case []interface{}:
+			if i, err := strconv.Atoi(seg.key); err == nil && i >= 0 && i < len(c) {
+				return c[i], truthOf(c[i])
+			}
+			continue
+		}
+		reflectValue := reflect.ValueOf(c)
 		switch reflectValue.Kind() {
 		// If the current context is a map, we'll look for a key in that map
 		// that matches the segment.
@@ -168,31 +188,106 @@ func lookup_map(name string, reflectValue reflect.Value) (value interface{}, ok
 }
 
 func lookup_struct(name string, reflectValue reflect.Value) (value interface{}, ok bool, found bool) {
-	field := reflectValue.FieldByName(name)
-	if field.IsValid() && field.CanInterface() {
-		return field.Interface(), truth(field), true
+	m, exists := structMembersOf(reflectValue.Type())[name]
+	if !exists {
+		return nil, false, false
+	}
+	if m.field != nil {
+		field := reflectValue.FieldByIndex(m.field)
+		if field.IsValid() && field.CanInterface() {
+			return field.Interface(), truth(field), true
+		}
 	}
-	method := reflectValue.MethodByName(name)
-	if method.IsValid() && method.Type().NumIn() == 0 && method.Type().NumOut() >= 1 {
-		out := method.Call(nil)[0]
+	if m.method >= 0 {
+		out := reflectValue.Method(m.method).Call(nil)[0]
 		return out.Interface(), truth(out), true
 	}
+	if m.tag >= 0 {
+		field := reflectValue.Field(m.tag)
+		return field.Interface(), truth(field), true
+	}
+	return nil, false, false
+}
 
-	typ := reflectValue.Type()
+// structMember binds a name to the members of a struct type it may refer to,
+// in the order lookup_struct tries them: the field by that name, the method
+// by that name taking no arguments and the first exported field with that
+// name in its mustache tag. A negative index means there is no such member.
+type structMember struct {
+	field  []int
+	method int
+	tag    int
+}
+
+// structMembers caches the members of struct types by name, so that the
+// fields of a type are looked up by name once rather than on every render.
+var structMembers sync.Map // map[reflect.Type]map[string]structMember
+
+// structMembersOf returns the members of the struct type typ by name.
+func structMembersOf(typ reflect.Type) map[string]structMember {
+	if members, ok := structMembers.Load(typ); ok {
+		return members.(map[string]structMember)
+	}
+	members := make(map[string]structMember)
+	member := func(name string) structMember {
+		if m, ok := members[name]; ok {
+			return m
+		}
+		return structMember{method: -1, tag: -1}
+	}
+	for _, f := range reflect.VisibleFields(typ) {
+		if _, ok := members[f.Name]; ok {
+			continue
+		}
+		m := member(f.Name)
+		// FieldByName resolves ambiguous promoted fields as lookups always have.
+		if field, ok := typ.FieldByName(f.Name); ok {
+			m.field = field.Index
+		}
+		members[f.Name] = m
+	}
+	for i := 0; i < typ.NumMethod(); i++ {
+		method := typ.Method(i)
+		if method.Type.NumIn() == 1 && method.Type.NumOut() >= 1 {
+			m := member(method.Name)
+			m.method = i
+			members[method.Name] = m
+		}
+	}
 	for i := 0; i < typ.NumField(); i++ {
 		f := typ.Field(i)
 		if f.PkgPath != "" {
 			continue
 		}
 		tag := f.Tag.Get("mustache")
-		if tag == name {
-			field := reflectValue.Field(i)
-			if field.IsValid() {
-				return field.Interface(), truth(field), true
-			}
+		if m := member(tag); m.tag < 0 {
+			m.tag = i
+			members[tag] = m
+		}
+	}
+	actual, _ := structMembers.LoadOrStore(typ, members)
+	return actual.(map[string]structMember)
+}
+
+// bindStructs fills the member cache for the struct types reachable from typ
+// through its fields, elements and pointers.
+func bindStructs(typ reflect.Type, seen map[reflect.Type]bool) {
+	if typ == nil || seen[typ] {
+		return
+	}
+	seen[typ] = true
+	switch typ.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		bindStructs(typ.Elem(), seen)
+	case reflect.Map:
+		bindStructs(typ.Key(), seen)
+		bindStructs(typ.Elem(), seen)
+	case reflect.Struct:
+		structMembersOf(typ)
+		for i := 0; i < typ.NumField(); i++ {
+			bindStructs(typ.Field(i).Type, seen)
 		}
 	}
-	return nil, false, false
 }
 
 func lookup_array(name string, reflectValue reflect.Value) (value interface{}, ok bool, found bool) {
@@ -211,13 +306,37 @@ func lookup_array(name string, reflectValue reflect.Value) (value interface{}, o
 	return nil, false, false
 }
 
+// truthOf is the truth of v, avoiding reflection for the most common types.
+func truthOf(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case string:
+		return v != ""
+	case bool:
+		return v
+	case int:
+		return v > 0
+	case float64:
+		return v > 0
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}, map[string]string:
+		return true
+	}
+	return truth(reflect.ValueOf(v))
+}
+
 // The truth function will tell us if r is a truthy value or not. This is
 // important for sections as they will render their content based on the output
 // of this function.
 //
 // Zero values are considered falsy. For example an empty string, the integer 0
 // and so on are all considered falsy.
+//
+// A pointer which refers to itself, possibly through interfaces, is falsy.
 func truth(r reflect.Value) bool {
+	derefs := 0
 out:
 	switch r.Kind() {
 	case reflect.Array, reflect.Slice:
@@ -233,6 +352,11 @@ out:
 	case reflect.Bool:
 		return r.Bool()
 	case reflect.Ptr, reflect.Interface:
+		// Long chains of pointers are rare, so they are only checked for
+		// cycles past a number of steps.
+		if derefs++; derefs > maxDerefs && cyclic(r) {
+			return false
+		}
 		r = r.Elem()
 		goto out
 	case reflect.Invalid:
@@ -245,3 +369,58 @@ out:
 		}
 	}
 }
+
+// maxDerefs is the number of pointers truth follows before checking for cycles.
+const maxDerefs = 32
+
+// cyclic reports whether r references itself through pointers, interfaces,
+// maps, slices or the fields of structs.
+func cyclic(r reflect.Value) bool {
+	return cyclicValue(r, make(map[visit]bool))
+}
+
+// visit is a reference to a value, identified by its address and type.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// cyclicValue reports whether r references a value in seen, which holds the
+// references followed to reach r.
+func cyclicValue(r reflect.Value, seen map[visit]bool) bool {
+	switch r.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if r.IsNil() {
+			return false
+		}
+		v := visit{r.Pointer(), r.Type()}
+		if seen[v] {
+			return true
+		}
+		seen[v] = true
+		defer delete(seen, v)
+	}
+	switch r.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return cyclicValue(r.Elem(), seen)
+	case reflect.Map:
+		for iter := r.MapRange(); iter.Next(); {
+			if cyclicValue(iter.Value(), seen) {
+				return true
+			}
+		}
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < r.Len(); i++ {
+			if cyclicValue(r.Index(i), seen) {
+				return true
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < r.NumField(); i++ {
+			if cyclicValue(r.Field(i), seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
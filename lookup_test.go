@@ -3,7 +3,10 @@
 package mustache
 
 import (
+	"fmt"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -102,6 +105,26 @@ func TestSimpleLookup(t *testing.T) {
 				{"1.b", 2, true},
 			},
 		},
+		{
+			context: map[string]interface{}{
+				"strings": map[string]string{"a": "x", "empty": ""},
+				"list":    []interface{}{"x", 0},
+				"nil":     nil,
+			},
+			assertions: []struct {
+				name  string
+				value interface{}
+				truth bool
+			}{
+				{"strings.a", "x", true},
+				{"strings.empty", "", false},
+				{"strings.b", nil, false},
+				{"list.1", 0, false},
+				{"list.2", nil, false},
+				{"list.x", nil, false},
+				{"nil", nil, false},
+			},
+		},
 	} {
 		for _, assertion := range test.assertions {
 			path, err := parsePath(assertion.name)
@@ -119,6 +142,53 @@ func TestSimpleLookup(t *testing.T) {
 	}
 }
 
+type lookupEmbedded struct {
+	Inner string
+}
+
+type lookupMembers struct {
+	lookupEmbedded
+	Field  string
+	Tagged string `mustache:"tag"`
+	hidden string
+}
+
+func (lookupMembers) Method() string         { return "method" }
+func (lookupMembers) Field2(s string) string { return s }
+func (lookupMembers) hidden2() string        { return "hidden" }
+
+func TestLookupStructMembers(t *testing.T) {
+	context := lookupMembers{lookupEmbedded{"inner"}, "field", "tagged", "hidden"}
+	for _, test := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"Inner", "inner"},
+		{"lookupEmbedded.Inner", nil},
+		{"Field", "field"},
+		{"tag", "tagged"},
+		{"Tagged", "tagged"},
+		{"Method", "method"},
+		{"Field2", nil},
+		{"hidden", nil},
+		{"hidden2", nil},
+		{"missing", nil},
+	} {
+		for _, bound := range []bool{false, true} {
+			if bound {
+				New(ContextType(&context))
+			}
+			value, _ := lookupPath(mustPath(test.name), context)
+			if value != test.value {
+				t.Errorf("%q: unexpected value %v, expected %v", test.name, value, test.value)
+			}
+		}
+	}
+	if _, ok := structMembers.Load(reflect.TypeOf(lookupEmbedded{})); !ok {
+		t.Error("expected ContextType to bind the embedded struct type")
+	}
+}
+
 // mustPath parses raw into path segments for use in expected test trees,
 // panicking on a malformed path.
 func mustPath(raw string) []pathSegment {
@@ -140,10 +210,190 @@ func TestTruth(t *testing.T) {
 		{0, false},
 		{true, true},
 		{false, false},
+		{-1, false},
+		{0.5, true},
+		{nil, false},
+		{[]interface{}{}, false},
+		{[]interface{}{0}, true},
+		{map[string]string(nil), true},
+		{[]int{}, false},
 	} {
 		truth := truth(reflect.ValueOf(test.input))
 		if truth != test.expected {
 			t.Errorf("Unexpected truth %t != %t", truth, test.expected)
 		}
+		if truth := truthOf(test.input); truth != test.expected {
+			t.Errorf("Unexpected truthOf %#v: %t != %t", test.input, truth, test.expected)
+		}
+	}
+}
+
+func BenchmarkLookupMaps(b *testing.B) {
+	template := New()
+	err := template.ParseString("{{#items}}{{name}} {{user.email}} {{tags.0}} {{#active}}on{{/active}}\n{{/items}}")
+	if err != nil {
+		b.Fatal(err)
+	}
+	items := make([]interface{}, 100)
+	for i := range items {
+		items[i] = map[string]interface{}{
+			"name":   "item",
+			"user":   map[string]string{"email": "ann@example.com"},
+			"tags":   []interface{}{"a", "b"},
+			"active": true,
+		}
+	}
+	data := map[string]interface{}{"items": items}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := template.Render(io.Discard, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLookupStructs(b *testing.B) {
+	type user struct {
+		Email string `mustache:"email"`
+	}
+	type item struct {
+		Name   string
+		User   user
+		Active bool
+	}
+	template := New()
+	err := template.ParseString("{{#items}}{{Name}} {{User.email}} {{#Active}}on{{/Active}}\n{{/items}}")
+	if err != nil {
+		b.Fatal(err)
+	}
+	items := make([]item, 100)
+	for i := range items {
+		items[i] = item{Name: "item", User: user{Email: "ann@example.com"}, Active: true}
+	}
+	data := map[string]interface{}{"items": items}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := template.Render(io.Discard, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type lookupCounter struct {
+	calls *int
+}
+
+func (c lookupCounter) Name() string {
+	*c.calls++
+	return "Ann"
+}
+
+func TestMemoizeLookups(t *testing.T) {
+	for _, memoize := range []bool{false, true} {
+		calls := 0
+		template := New()
+		if memoize {
+			template.Option(MemoizeLookups())
+		}
+		if err := template.ParseString("{{user.Name}} {{user.Name}}{{#items}} {{user.Name}}{{user.Name}}{{/items}}"); err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(map[string]interface{}{
+			"user":  lookupCounter{&calls},
+			"items": []int{1, 2},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != "Ann Ann AnnAnn AnnAnn" {
+			t.Errorf("unexpected output %q", output)
+		}
+		// The lookups are memoized in each context chain: the top level and
+		// the two items.
+		expected := 6
+		if memoize {
+			expected = 3
+		}
+		if calls != expected {
+			t.Errorf("memoize %t: expected %d calls got %d", memoize, expected, calls)
+		}
+	}
+}
+
+func TestMemoizeLookupsSections(t *testing.T) {
+	for _, memoize := range []bool{false, true} {
+		calls := 0
+		template := New(LetSections(), ZipSections(), ChunkSections())
+		if memoize {
+			template.Option(MemoizeLookups())
+		}
+		err := template.ParseString(`{{#let n=user.Name m=n}}{{n}}{{m}} {{user.Name}}{{user.Name}}{{/let}}` +
+			`{{#zip items items}} {{user.Name}}{{user.Name}}{{/zip}}{{#chunk items 1}} {{user.Name}}{{user.Name}}{{/chunk}}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(map[string]interface{}{
+			"user":  lookupCounter{&calls},
+			"items": []int{1, 2},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != "AnnAnn AnnAnn AnnAnn AnnAnn AnnAnn AnnAnn" {
+			t.Errorf("unexpected output %q", output)
+		}
+		// The binding and the lookups of the let section are memoized in the
+		// context of the section, and those of each pair and chunk in the
+		// context of the iteration.
+		expected := 11
+		if memoize {
+			expected = 6
+		}
+		if calls != expected {
+			t.Errorf("memoize %t: expected %d calls got %d", memoize, expected, calls)
+		}
+	}
+}
+
+func TestMemoizeLookupsCapture(t *testing.T) {
+	for _, memoize := range []bool{false, true} {
+		template := New(CaptureSections())
+		if memoize {
+			template.Option(MemoizeLookups())
+		}
+		if err := template.ParseString(`[{{h}}]{{#capture "h"}}X{{name}}{{/capture}}[{{h}}]{{#capture "h"}}Y{{/capture}}[{{h}}]`); err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(map[string]string{"name": "Bob"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != "[][XBob][Y]" {
+			t.Errorf("memoize %t: unexpected output %q", memoize, output)
+		}
+	}
+}
+
+func BenchmarkMemoizeLookups(b *testing.B) {
+	type profile struct{ Name, Email string }
+	type user struct{ Profile profile }
+	source := strings.Repeat("{{user.Profile.Name}} <{{user.Profile.Email}}>\n", 50)
+	for _, memoize := range []bool{false, true} {
+		b.Run(fmt.Sprintf("memoize=%t", memoize), func(b *testing.B) {
+			template := New()
+			if memoize {
+				template.Option(MemoizeLookups())
+			}
+			if err := template.ParseString(source); err != nil {
+				b.Fatal(err)
+			}
+			data := map[string]interface{}{"user": user{profile{"Ann", "ann@example.com"}}}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := template.Render(io.Discard, data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
 	}
 }
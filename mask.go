@@ -0,0 +1,73 @@
+package mustache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaskHelpers makes customizers for redacting personally identifiable
+// information available to the template:
+//
+//	{{~mask_email}}{{email}}{{/mask_email}}  j***@example.com
+//	{{~last4}}{{card}}{{/last4}}             ************4242
+//	{{~hash}}{{user_id}}{{/hash}}            hex encoded SHA-256 of salt and content
+//
+// The hash helper accepts a length option which truncates the hex digest, e.g.
+// {{~hash length="12"}}. The salt is prepended to the content before hashing,
+// so that hashed identifiers can not be looked up in precomputed tables.
+func MaskHelpers(salt string) Option {
+	return func(t *Template) {
+		t.Option(
+			CustomizeFunction("mask_email", func(s string) (string, error) {
+				return maskEmail(strings.TrimSpace(s)), nil
+			}),
+			CustomizeFunction("last4", func(s string) (string, error) {
+				return maskAllButLast(strings.TrimSpace(s), 4), nil
+			}),
+			CustomizeFunctionWithOptions("hash", func(s string, opts map[string]string) (string, error) {
+				sum := sha256.Sum256([]byte(salt + s))
+				digest := hex.EncodeToString(sum[:])
+				if v, ok := opts["length"]; ok {
+					n, err := strconv.Atoi(v)
+					if err != nil || n <= 0 {
+						return "", fmt.Errorf("invalid hash length %q", v)
+					}
+					if n < len(digest) {
+						digest = digest[:n]
+					}
+				}
+				return digest, nil
+			}),
+		)
+	}
+}
+
+// maskEmail keeps the first character of the local part of an email address
+// and its domain, masking the rest. Values which are not email addresses keep
+// only their first character.
+func maskEmail(s string) string {
+	if s == "" {
+		return s
+	}
+	local, domain := s, ""
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		local, domain = s[:i], s[i:]
+	}
+	r := []rune(local)
+	if len(r) == 0 {
+		return "***" + domain
+	}
+	return string(r[0]) + "***" + domain
+}
+
+// maskAllButLast replaces all but the last n runes of s with asterisks.
+func maskAllButLast(s string, n int) string {
+	r := []rune(s)
+	for i := 0; i < len(r)-n; i++ {
+		r[i] = '*'
+	}
+	return string(r)
+}
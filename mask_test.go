@@ -0,0 +1,29 @@
+package mustache
+
+import (
+	"testing"
+)
+
+func TestMaskHelpers(t *testing.T) {
+	for _, test := range []templateTest{
+		{`{{~mask_email}}{{email}}{{/mask_email}}`, map[string]string{"email": "john.doe@example.com"}, "j***@example.com"},
+		{`{{~mask_email}}{{email}}{{/mask_email}}`, map[string]string{"email": "not an email"}, "n***"},
+		{`{{~mask_email}}{{email}}{{/mask_email}}`, map[string]string{"email": "@example.com"}, "***@example.com"},
+		{`{{~last4}}{{card}}{{/last4}}`, map[string]string{"card": "4111111111114242"}, "************4242"},
+		{`{{~last4}}{{card}}{{/last4}}`, map[string]string{"card": "42"}, "42"},
+		{`{{~hash}}{{id}}{{/hash}}`, map[string]string{"id": "user"}, "8031377c4c15e1611986089444c8ff58c95358ffdc95d692a6d10c7b633e99df"},
+		{`{{~hash length="8"}}{{id}}{{/hash}}`, map[string]string{"id": "user"}, "8031377c"},
+	} {
+		template := New(MaskHelpers("salt"))
+		if err := template.ParseString(test.template); err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(test.payload)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expect {
+			t.Errorf("expected %q got %q", test.expect, output)
+		}
+	}
+}
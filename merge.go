@@ -0,0 +1,158 @@
+package mustache
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ConflictPolicy decides which value MergeContexts keeps when contexts hold
+// different values at the same path.
+type ConflictPolicy int
+
+const (
+	// FirstWins keeps the value of the first context holding the path.
+	FirstWins ConflictPolicy = iota
+	// LastWins keeps the value of the last context holding the path.
+	LastWins
+	// ConflictError makes MergeContexts fail with a *MergeConflictError.
+	ConflictError
+)
+
+// MergeContexts deep merges ctxs, maps with string keys and structs, into a
+// single context, so that a context built from several sources has explicit
+// rules rather than the shadowing of the contexts given to Render. Structs
+// contribute their exported fields by name and by mustache tag, as they are
+// looked up when rendering. Values found at the same path in several contexts
+// are merged if all of them are maps or structs, and are otherwise resolved
+// by policy, structs without exported fields such as time.Time being merged
+// as values. Equal values do not conflict. Nil contexts are skipped, and the
+// contexts given are left unchanged. Merging values which reference
+// themselves, such as a map containing itself, fails with a *CycleError.
+func MergeContexts(policy ConflictPolicy, ctxs ...interface{}) (map[string]interface{}, error) {
+	merged := make(map[string]interface{})
+	for _, ctx := range ctxs {
+		if ctx == nil {
+			continue
+		}
+		m, ok := contextMap(ctx)
+		if !ok {
+			return nil, fmt.Errorf("cannot merge context of type %T", ctx)
+		}
+		if err := mergeInto(merged, m, policy, "", make(map[[2]visit]bool)); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
+
+// mergeInto merges src, the values at path, into dst. merging holds the
+// references of the pairs of values being merged into each other at the
+// paths leading to path.
+func mergeInto(dst, src map[string]interface{}, policy ConflictPolicy, path string, merging map[[2]visit]bool) error {
+	keys := make([]string, 0, len(src))
+	for key := range src {
+		keys = append(keys, key)
+	}
+	// Conflicts are reported in a stable order.
+	sort.Strings(keys)
+	for _, key := range keys {
+		v := src[key]
+		old, ok := dst[key]
+		if !ok {
+			dst[key] = v
+			continue
+		}
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+		oldMap, oldOK := contextMap(old)
+		newMap, newOK := contextMap(v)
+		if oldOK && newOK {
+			// Values referencing themselves would be merged without end.
+			pair := [2]visit{reference(old), reference(v)}
+			if pair != ([2]visit{}) {
+				if merging[pair] {
+					return &CycleError{Name: keyPath}
+				}
+				merging[pair] = true
+			}
+			// The maps of contextMap are new, so the values merged are left
+			// unchanged.
+			err := mergeInto(oldMap, newMap, policy, keyPath, merging)
+			delete(merging, pair)
+			if err != nil {
+				return err
+			}
+			dst[key] = oldMap
+			continue
+		}
+		if reflect.DeepEqual(old, v) {
+			continue
+		}
+		switch policy {
+		case FirstWins:
+		case LastWins:
+			dst[key] = v
+		default:
+			return &MergeConflictError{Path: keyPath}
+		}
+	}
+	return nil
+}
+
+// reference returns the reference v is identified by if it is a map or a
+// pointer, and otherwise the zero visit.
+func reference(v interface{}) visit {
+	r := reflect.ValueOf(v)
+	switch r.Kind() {
+	case reflect.Map, reflect.Ptr:
+		return visit{r.Pointer(), r.Type()}
+	}
+	return visit{}
+}
+
+// contextMap returns a new map of the members of v by name if v is a map with
+// string keys or a struct with exported fields, or a pointer to one.
+func contextMap(v interface{}) (map[string]interface{}, bool) {
+	r := reflect.ValueOf(v)
+	for r.Kind() == reflect.Ptr || r.Kind() == reflect.Interface {
+		if r.IsNil() {
+			return nil, false
+		}
+		r = r.Elem()
+	}
+	switch r.Kind() {
+	case reflect.Map:
+		if r.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		m := make(map[string]interface{}, r.Len())
+		iter := r.MapRange()
+		for iter.Next() {
+			m[iter.Key().String()] = iter.Value().Interface()
+		}
+		return m, true
+	case reflect.Struct:
+		m := make(map[string]interface{})
+		for name, member := range structMembersOf(r.Type()) {
+			if name == "" {
+				continue
+			}
+			if member.field != nil {
+				if f, err := r.FieldByIndexErr(member.field); err == nil && f.CanInterface() {
+					m[name] = f.Interface()
+					continue
+				}
+			}
+			if member.tag >= 0 {
+				m[name] = r.Field(member.tag).Interface()
+			}
+		}
+		// Structs without exported fields, such as time.Time, are values
+		// rather than contexts.
+		return m, len(m) > 0
+	}
+	return nil, false
+}
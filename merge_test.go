@@ -0,0 +1,108 @@
+package mustache
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeContexts(t *testing.T) {
+	type address struct {
+		City string
+		Zip  string `mustache:"postcode"`
+	}
+	type user struct {
+		Name    string
+		Address *address
+		secret  string
+	}
+	defaults := map[string]interface{}{
+		"site": "shop",
+		"user": map[string]interface{}{"name": "guest", "locale": "en"},
+	}
+	profile := map[string]interface{}{
+		"user": user{Name: "Ann", Address: &address{City: "Oslo", Zip: "0150"}, secret: "x"},
+	}
+	overrides := map[string]interface{}{
+		"site": "shop",
+		"user": map[string]interface{}{"locale": "nb", "Address": map[string]string{"City": "Bergen"}},
+	}
+
+	merged, err := MergeContexts(LastWins, defaults, nil, profile, overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"site": "shop",
+		"user": map[string]interface{}{
+			"name":    "guest",
+			"locale":  "nb",
+			"Name":    "Ann",
+			"Address": map[string]interface{}{"City": "Bergen", "Zip": "0150", "postcode": "0150"},
+		},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected %v got %v", expected, merged)
+	}
+	if defaults["user"].(map[string]interface{})["locale"] != "en" {
+		t.Error("expected the contexts to be left unchanged")
+	}
+
+	merged, err = MergeContexts(FirstWins, defaults, overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locale := merged["user"].(map[string]interface{})["locale"]; locale != "en" {
+		t.Errorf("expected the first locale to win, got %v", locale)
+	}
+
+	template := New()
+	if err := template.ParseString("{{site}}: {{user.Name}} in {{user.Address.City}} ({{user.locale}})"); err != nil {
+		t.Fatal(err)
+	}
+	merged, _ = MergeContexts(LastWins, defaults, profile, overrides)
+	if output, _ := template.RenderString(merged); output != "shop: Ann in Bergen (nb)" {
+		t.Errorf("unexpected output %q", output)
+	}
+
+	var conflict *MergeConflictError
+	if _, err := MergeContexts(ConflictError, defaults, overrides); !errors.As(err, &conflict) || conflict.Path != "user.locale" {
+		t.Errorf("expected a conflict at user.locale, got %v", err)
+	}
+	if _, err := MergeContexts(ConflictError, defaults, profile); err != nil {
+		t.Errorf("expected no conflict, got %v", err)
+	}
+	if _, err := MergeContexts(LastWins, defaults, "text"); err == nil {
+		t.Error("expected an error for a context which is not a map or a struct")
+	}
+	// Structs without exported fields are merged as values.
+	t1, t2 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	merged, err = MergeContexts(LastWins, map[string]interface{}{"t": t1}, map[string]interface{}{"t": t2})
+	if err != nil || merged["t"] != t2 {
+		t.Errorf("expected the last time to win, got %v, %v", merged, err)
+	}
+	if _, err := MergeContexts(ConflictError, map[string]interface{}{"t": t1}, map[string]interface{}{"t": t2}); !errors.As(err, &conflict) || conflict.Path != "t" {
+		t.Errorf("expected a conflict at t, got %v", err)
+	}
+
+	// Contexts referencing themselves are not merged without end.
+	self := map[string]interface{}{"name": "loop"}
+	self["self"] = self
+	type node struct{ Next *node }
+	ring := &node{}
+	ring.Next = ring
+	for _, ctxs := range [][]interface{}{
+		{self, self},
+		{self, map[string]interface{}{"self": self}},
+		{map[string]interface{}{"n": ring}, map[string]interface{}{"n": ring}},
+	} {
+		var cycle *CycleError
+		if _, err := MergeContexts(LastWins, ctxs...); !errors.As(err, &cycle) {
+			t.Errorf("expected a *CycleError, got %v", err)
+		}
+	}
+	if _, err := MergeContexts(LastWins, self, map[string]interface{}{"self": map[string]interface{}{"name": "other"}}); err != nil {
+		t.Errorf("expected a context merged once into a cycle to merge, got %v", err)
+	}
+}
@@ -4,32 +4,19 @@ package mustache
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
-type ErrorSlice []error
-
-func (es ErrorSlice) Error() string {
-	b := strings.Builder{}
-	b.WriteRune('[')
-	first := true
-	for _, e := range es {
-		if first {
-			first = false
-		} else {
-			b.WriteString(", ")
-		}
-		b.WriteString(e.Error())
-	}
-	b.WriteRune(']')
-
-	return b.String()
-}
-
 // The node type is the base type that represents a node in the parse tree.
 type node interface {
 	// The render function should be defined by any type wishing to satisfy the
@@ -38,17 +25,50 @@ type node interface {
 	render(t *Template, w *writer, c ...interface{}) error
 }
 
+// span is a range of bytes in the source of a template, end being exclusive.
+type span struct {
+	start, end int
+}
+
+// spans is embedded in the nodes of tags to record their range in the source.
+// The outer span covers the tags including their delimiters, from the opening
+// tag to the closing tag of sections, and the inner span covers the content
+// of sections.
+type spans struct {
+	outer, inner span
+}
+
+func (s *spans) setSpans(outer, inner span) {
+	s.outer, s.inner = outer, inner
+}
+
+func (s *spans) nodeSpans() spans {
+	return *s
+}
+
+// spanned is implemented by the nodes embedding spans.
+type spanned interface {
+	setSpans(outer, inner span)
+	nodeSpans() spans
+}
+
 // The textNode type represents a part of the template that is made up solely of
 // text. It's an alias to string and it ignores c when rendering.
 type textNode string
 
 func (n textNode) render(t *Template, w *writer, c ...interface{}) error {
-	for _, r := range n {
-		if !whitespace(r) {
+	// The text is written a line at a time, so that whether a line holds
+	// text is known before the writer flushes it at its line break.
+	for s := string(n); s != ""; {
+		line := s
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			line = s[:i+1]
+		}
+		s = s[len(line):]
+		if strings.TrimLeftFunc(line, whitespace) != "" {
 			w.text()
 		}
-		err := w.write(r)
-		if err != nil {
+		if _, err := w.WriteString(line); err != nil {
 			return err
 		}
 	}
@@ -68,12 +88,36 @@ type CustomizerFunc func(string) (string, error)
 // from the template.
 type CustomizerFuncWithOptions func(string, map[string]string) (string, error)
 
+// CustomizerFuncWithArgs is like CustomizerFuncWithOptions, but also receives
+// the positional arguments of the tag, in order.
+type CustomizerFuncWithArgs func(s string, args []string, opts map[string]string) (string, error)
+
+// customizerFunc is the form every customizer function is registered in.
+type customizerFunc func(ctx context.Context, s string, args []string, opts map[string]string) (string, error)
+
+// CustomizerStreamFunc is like CustomizerFuncWithOptions, but reads the
+// rendered section from r and writes the result to w.
+type CustomizerStreamFunc func(w io.Writer, r io.Reader, opts map[string]string) error
+
+// CustomizerFuncCtx is like CustomizerFuncWithOptions, but also receives the
+// context.Context given to RenderContext.
+type CustomizerFuncCtx func(context.Context, string, map[string]string) (string, error)
+
 type escapeType int
 
 const (
 	noEscape escapeType = iota
 	htmlEscape
 	jsonEscape
+	// The escapes set by ContextualAutoEscape.
+	attrEscape     // unquoted attribute values
+	urlEscape      // the start of URLs
+	urlPartEscape  // the rest of URLs, before the query
+	urlQueryEscape // the query and fragment of URLs
+	jsEscape       // JavaScript values in scripts
+	jsAttrEscape   // JavaScript values in event handler attributes
+	jsStringEscape // JavaScript string literals
+	cssEscape
 )
 
 func (e escapeType) String() string {
@@ -84,6 +128,22 @@ func (e escapeType) String() string {
 		return "htmlEscape"
 	case jsonEscape:
 		return "jsonEscape"
+	case attrEscape:
+		return "attrEscape"
+	case urlEscape:
+		return "urlEscape"
+	case urlPartEscape:
+		return "urlPartEscape"
+	case urlQueryEscape:
+		return "urlQueryEscape"
+	case jsEscape:
+		return "jsEscape"
+	case jsAttrEscape:
+		return "jsAttrEscape"
+	case jsStringEscape:
+		return "jsStringEscape"
+	case cssEscape:
+		return "cssEscape"
 	default:
 		return "invalidEscape"
 	}
@@ -92,27 +152,192 @@ func (e escapeType) String() string {
 // The varNode type represents a part of the template that needs to be replaced
 // by a variable that exists within c.
 type varNode struct {
-	name   string
-	path   []pathSegment
-	escape escapeType
+	name    string
+	path    []pathSegment
+	escape  escapeType
+	filters []filter // applied in order to the value, with FilterPipes
+	format  string   // the format option of the tag, see TimeFormat
+	tag     string
+	line    int
+	col     int
+	spans
+}
+
+// filter is a stage of a variable tag with filters, calling the customizer
+// function name with args.
+type filter struct {
+	name string
+	args []string
 }
 
 func (n *varNode) render(t *Template, w *writer, c ...interface{}) error {
 	w.text()
-	v, _ := lookupPath(n.path, c...)
+	t.deprecation(w, n.name, n.outer.start)
+	v, _ := w.lookup(n.name, n.path, c)
+	if v == nil && t.onMiss != nil {
+		if fallback, ok := t.onMiss(n.name, n.line, n.col); ok {
+			w.warn(n.warning(t, FallbackWarning))
+			if fallback != nil {
+				return n.print(t, w, fallback)
+			}
+			return nil
+		}
+	}
 	// If the value is present but 'falsy', such as a false bool, or a zero int,
 	// we still want to render that value.
 	if v != nil {
-		print(w, v, n.escape)
-		return nil
+		return n.print(t, w, v)
+	}
+	if t.keepMissing {
+		placeholder := n.tag
+		if t.missingPlaceholder != nil {
+			placeholder = *t.missingPlaceholder
+		}
+		w.warn(n.warning(t, FallbackWarning))
+		_, err := io.WriteString(w, placeholder)
+		return err
+	}
+	if !t.reportErrors() {
+		// The miss is ignored by the render.
+		w.warn(n.warning(t, MissWarning))
+	}
+	return &MissError{Name: n.name, Line: n.line, Col: n.col, Template: t.name}
+}
+
+// print writes v, passed through the filters of n, to w.
+func (n *varNode) print(t *Template, w *writer, v interface{}) error {
+	v, err := t.formatTime(v, n.format)
+	if err != nil {
+		return err
+	}
+	if len(n.filters) == 0 {
+		return t.printValue(w, n.name, v, n.escape)
+	}
+	v, err = t.filter(w, n.name, v, n.filters)
+	if err != nil {
+		return err
+	}
+	return t.printValue(w, n.name, v, n.escape)
+}
+
+// filter returns v, the value of name, printed without escaping and passed
+// through filters.
+func (t *Template) filter(w *writer, name string, v interface{}, filters []filter) (interface{}, error) {
+	var sb strings.Builder
+	if !t.printCustom(&sb, v, noEscape) {
+		if err := print(&sb, v, noEscape); err != nil {
+			if e, ok := err.(*CycleError); ok {
+				e.Name = name
+				w.state.err = e
+			}
+			return nil, err
+		}
+	}
+	s := sb.String()
+	for _, f := range filters {
+		fn := t.customizers[f.name]
+		if fn == nil {
+			return nil, &CustomizerError{Name: f.name, Err: errors.New("no such function")}
+		}
+		var err error
+		if s, err = fn(w.state.ctx, s, f.args, nil); err != nil {
+			return nil, &CustomizerError{Name: f.name, Err: err}
+		}
+	}
+	// Values which are not escaped remain so when filtered, e.g. captured
+	// output, which was escaped when rendered.
+	switch v.(type) {
+	case capturedText:
+		return capturedText(s), nil
+	case Safe:
+		return Safe(s), nil
+	case template.HTML:
+		return template.HTML(s), nil
 	}
-	return fmt.Errorf("failed to lookup %s", n.name)
+	return s, nil
+}
+
+// warning returns a warning of the kind about n, a tag of t.
+func (n *varNode) warning(t *Template, kind WarningKind) Warning {
+	return Warning{Kind: kind, Name: n.name, Line: n.line, Col: n.col, Template: t.name}
 }
 
 func (n *varNode) String() string {
 	return fmt.Sprintf("[var: %q escaped: %s]", n.name, n.escape.String())
 }
 
+// The coalesceNode type is a variable which renders the first of its arguments
+// which is not empty. Arguments are looked up, or given as literals.
+type coalesceNode struct {
+	args   []coalesceArg
+	escape escapeType
+	spans
+}
+
+// coalesceArg is either the value at path or a literal value.
+type coalesceArg struct {
+	ident   string
+	path    []pathSegment
+	literal string
+}
+
+func (n *coalesceNode) render(t *Template, w *writer, c ...interface{}) error {
+	w.text()
+	for _, arg := range n.args {
+		if arg.path == nil {
+			if arg.literal != "" {
+				return print(w, arg.literal, n.escape)
+			}
+			continue
+		}
+		t.deprecation(w, arg.ident, n.outer.start)
+		if v, ok := w.lookup(arg.ident, arg.path, c); ok {
+			return t.printValue(w, arg.ident, v, n.escape)
+		}
+	}
+	return nil
+}
+
+func (n *coalesceNode) String() string {
+	return fmt.Sprintf("[coalesce: %v escaped: %s]", n.args, n.escape.String())
+}
+
+// The translateNode type is a variable rendering a message of the translator
+// of the template, given its key and arguments.
+type translateNode struct {
+	key    string
+	args   []letBinding
+	escape escapeType
+	spans
+}
+
+func (n *translateNode) render(t *Template, w *writer, c ...interface{}) error {
+	w.text()
+	if t.translator == nil {
+		return fmt.Errorf("no translator for message %q", n.key)
+	}
+	args := make(map[string]interface{}, len(n.args))
+	for _, b := range n.args {
+		if b.path == nil {
+			args[b.name] = b.literal
+			continue
+		}
+		t.deprecation(w, b.ident, n.outer.start)
+		args[b.name], _ = w.lookup(b.ident, b.path, c)
+	}
+	var s string
+	if tr, ok := t.translator.(TranslatorContext); ok {
+		s = tr.TContext(w.state.ctx, n.key, args)
+	} else {
+		s = t.translator.T(n.key, args)
+	}
+	return t.printValue(w, n.key, s, n.escape)
+}
+
+func (n *translateNode) String() string {
+	return fmt.Sprintf("[translate: %q %v escaped: %s]", n.key, n.args, n.escape.String())
+}
+
 // The sectionNode type is a complex node which recursively renders its child
 // elements while passing along its context along with the global context.
 type sectionNode struct {
@@ -120,63 +345,164 @@ type sectionNode struct {
 	path     []pathSegment
 	inverted bool
 	elems    []node
+	offset   int
+	limit    int
+	spans
 }
 
 func (n *sectionNode) render(t *Template, w *writer, c ...interface{}) error {
 	w.tag()
 	defer w.tag()
+	t.deprecation(w, n.name, n.outer.start)
+
+	if err := w.enter(); err != nil {
+		return err
+	}
+	defer w.leave()
 
 	errs := ErrorSlice{}
 
 	elemFn := func(v ...interface{}) {
+		if w.abort() != nil {
+			return
+		}
+		if err := w.iterate(); err != nil {
+			errs = append(errs, err)
+			return
+		}
+		// The children share the context chain, so that their lookups may
+		// be memoized.
+		frame := append(v, c...)
 		for _, elem := range n.elems {
-			err := elem.render(t, w, append(v, c...)...)
+			err := elem.render(t, w, frame...)
 			if err != nil {
 				errs = append(errs, err)
 			}
 		}
 	}
 
-	v, ok := lookupPath(n.path, c...)
+	v, ok := w.lookup(n.name, n.path, c)
 	if ok != n.inverted {
 		r := reflect.ValueOf(v)
 		switch r.Kind() {
 		case reflect.Slice, reflect.Array:
-			if r.Len() > 0 {
+			if r.Len() > 0 && (n.offset > 0 || n.limit > 0 || t.loopVariables) {
+				// Only iterate over the requested page of the list. Each
+				// element is rendered along with a frame holding the total
+				// length of the list and the number of elements that
+				// follow the page, and with LoopVariables the position of
+				// the element.
+				start, end := n.offset, r.Len()
+				if start > end {
+					start = end
+				}
+				if n.limit > 0 && start+n.limit < end {
+					end = start + n.limit
+				}
+				for i := start; i < end; i++ {
+					meta := make(map[string]interface{}, 6)
+					if n.offset > 0 || n.limit > 0 {
+						meta["@total"] = r.Len()
+						meta["@more"] = r.Len() - end
+					}
+					if t.loopVariables {
+						meta["@index"] = i
+						meta["@first"] = i == start
+						meta["@last"] = i == end-1
+						meta["@length"] = end - start
+					}
+					elemFn(r.Index(i).Interface(), meta)
+				}
+			} else if r.Len() > 0 {
 				for i := 0; i < r.Len(); i++ {
 					elemFn(r.Index(i).Interface())
 				}
 			} else {
 				elemFn(v)
 			}
+		case reflect.Map:
+			if !t.mapSections {
+				elemFn(v)
+				break
+			}
+			// Each entry is rendered with its value pushed onto the context
+			// along with a frame holding its key and value.
+			keys := sortedKeys(r)
+			for i, key := range keys {
+				value := r.MapIndex(key).Interface()
+				meta := map[string]interface{}{
+					"@key":   key.Interface(),
+					"@value": value,
+				}
+				if t.loopVariables {
+					meta["@index"] = i
+					meta["@first"] = i == 0
+					meta["@last"] = i == len(keys)-1
+					meta["@length"] = len(keys)
+				}
+				elemFn(value, meta)
+			}
 		default:
 			elemFn(v)
 		}
 	}
+	if err := w.flushSection(); err != nil {
+		return err
+	}
 	if len(errs) != 0 {
-		if !t.silentMiss {
+		if t.reportErrors() {
 			return errs
 		}
 	}
 	return nil
 }
 
+// sortedKeys returns the keys of the map r in order: numbers by value, and
+// other keys by their printed form.
+func sortedKeys(r reflect.Value) []reflect.Value {
+	keys := r.MapKeys()
+	var less func(a, b reflect.Value) bool
+	switch r.Type().Key().Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		less = func(a, b reflect.Value) bool { return a.Int() < b.Int() }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		less = func(a, b reflect.Value) bool { return a.Uint() < b.Uint() }
+	case reflect.Float32, reflect.Float64:
+		less = func(a, b reflect.Value) bool { return a.Float() < b.Float() }
+	case reflect.String:
+		less = func(a, b reflect.Value) bool { return a.String() < b.String() }
+	default:
+		less = func(a, b reflect.Value) bool { return fmt.Sprint(a) < fmt.Sprint(b) }
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+	return keys
+}
+
 type functionSectionNode struct {
-	name  string
-	opts  map[string]string
-	elems []node
+	name     string
+	opts     map[string]string
+	elems    []node
+	optPaths map[string][]pathSegment // options whose values are looked up
+	optParts map[string][]optionPart  // options whose values interpolate variables
+	args     []string                 // positional arguments
+	spans
 }
 
 func (n *functionSectionNode) render(t *Template, w *writer, c ...interface{}) error {
 	w.tag()
 	defer w.tag()
 
+	n.deprecations(t, w)
+	if fn := t.streamCustomizers[n.name]; fn != nil {
+		return n.renderStream(t, w, fn, c)
+	}
+
 	// Render all of the children into an in-memory string and pass that to the
 	// custom function for processing. The function's returned value will then be
 	// rendered into the caller's writer.
 
 	var sb strings.Builder
-	subWriter := newWriter(&sb)
+	subWriter := w.sub(&sb)
 
 	errs := ErrorSlice{}
 
@@ -191,36 +517,201 @@ func (n *functionSectionNode) render(t *Template, w *writer, c ...interface{}) e
 	}
 
 	if len(errs) != 0 {
-		if !t.silentMiss {
+		if !t.silentMiss && !t.collectErrors {
 			return errs
 		}
 	}
 
+	// The output of the function is rendered as text, so that lines it
+	// produces are not mistaken for standalone tag lines and trimmed.
 	fn := t.customizers[n.name]
 	if fn != nil {
-		s, err := fn(sb.String(), n.opts)
+		s, err := fn(w.state.ctx, sb.String(), n.args, n.options(c))
 		if err != nil {
+			errs = append(errs, &CustomizerError{Name: n.name, Err: err})
+		} else if err = textNode(s).render(t, w); err != nil {
 			return err
 		}
-		_, err = w.Write([]byte(s))
-		return err
 	}
 
+	if len(errs) != 0 {
+		if t.reportErrors() {
+			return errs
+		}
+	}
+	return nil
+}
+
+// deprecations records the warnings of the deprecated variables referred to
+// by the options of the section, in the order of the options.
+func (n *functionSectionNode) deprecations(t *Template, w *writer) {
+	if len(t.deprecated) == 0 || len(n.optPaths)+len(n.optParts) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(n.optPaths)+len(n.optParts))
+	for k := range n.optPaths {
+		keys = append(keys, k)
+	}
+	for k := range n.optParts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if path, ok := n.optPaths[k]; ok {
+			t.deprecation(w, pathString(path), n.outer.start)
+		}
+		for _, part := range n.optParts[k] {
+			if part.path != nil {
+				t.deprecation(w, pathString(part.path), n.outer.start)
+			}
+		}
+	}
+}
+
+// options returns the options of the section, looking up those which refer to
+// variables in c.
+func (n *functionSectionNode) options(c []interface{}) map[string]string {
+	if len(n.optPaths)+len(n.optParts) == 0 {
+		return n.opts
+	}
+	opts := make(map[string]string, len(n.opts)+len(n.optPaths)+len(n.optParts))
+	for k, v := range n.opts {
+		opts[k] = v
+	}
+	for k, path := range n.optPaths {
+		if v, _ := lookupPath(path, c...); v != nil {
+			vs := strings.Builder{}
+			print(&vs, v, noEscape)
+			opts[k] = vs.String()
+		}
+	}
+	for k, parts := range n.optParts {
+		vs := strings.Builder{}
+		for _, part := range parts {
+			if part.path == nil {
+				vs.WriteString(part.literal)
+			} else if v, _ := lookupPath(part.path, c...); v != nil {
+				print(&vs, v, noEscape)
+			}
+		}
+		opts[k] = vs.String()
+	}
+	return opts
+}
+
+// optionPart is either literal text or a variable interpolated in the value of
+// a function section option.
+type optionPart struct {
+	literal string
+	path    []pathSegment
+}
+
+// optionSource returns the value of an option made of parts as written, with
+// the variables between the delimiters start and end.
+func optionSource(parts []optionPart, start, end string) string {
+	var b strings.Builder
+	for _, part := range parts {
+		if part.path == nil {
+			b.WriteString(part.literal)
+		} else {
+			b.WriteString(start + pathString(part.path) + end)
+		}
+	}
+	return b.String()
+}
+
+// renderStream renders the children of the section into a pipe read by the
+// streaming customizer fn, which writes to w as it goes.
+func (n *functionSectionNode) renderStream(t *Template, w *writer, fn CustomizerStreamFunc, c []interface{}) error {
+	opts := n.options(c)
+	pr, pw := io.Pipe()
+
+	// The children are rendered concurrently with fn, which writes to w, so
+	// they get a copy of the render state rather than sharing it with w. The
+	// output of the children is limited once fn writes it to w, and only the
+	// goroutine of fn flushes the destination.
+	state := *w.state
+	state.limit, state.writeErr, state.flusher = nil, nil, nil
+	sub := newWriter(pipeWriter{pw})
+	sub.state = &state
+
+	var errs ErrorSlice
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, elem := range n.elems {
+			if err := elem.render(t, sub, c...); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		err := sub.flush()
+		if err == nil {
+			err = state.err
+		}
+		pw.CloseWithError(err)
+	}()
+	err := fn(textWriter{t, w}, pr, opts)
+	// Unblock the children if fn stopped reading their output early.
+	pr.Close()
+	<-done
+
+	w.state.iterations = state.iterations
+	if state.err != nil {
+		w.state.err = state.err
+		return state.err
+	}
+	if err != nil {
+		errs = append(errs, &CustomizerError{Name: n.name, Err: err})
+	}
+	if len(errs) != 0 {
+		if t.reportErrors() {
+			return errs
+		}
+	}
 	return nil
 }
 
+// pipeWriter writes to a pipe, discarding the output once its reader is
+// closed.
+type pipeWriter struct {
+	w *io.PipeWriter
+}
+
+func (p pipeWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	if err == io.ErrClosedPipe {
+		return len(b), nil
+	}
+	return n, err
+}
+
+// textWriter writes to w as text of t, like the output of a customizer.
+type textWriter struct {
+	t *Template
+	w *writer
+}
+
+func (tw textWriter) Write(b []byte) (int, error) {
+	if err := textNode(b).render(tw.t, tw.w); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
 // The testNode type is a complex node which recursively renders its child
 // elements while passing along its context along with the global context.
 type testNode struct {
 	testIdentPath []pathSegment
 	testVal       string
 	elems         []node
+	spans
 }
 
 func (n *testNode) render(t *Template, w *writer, c ...interface{}) error {
 	w.tag()
 	defer w.tag()
 	errs := ErrorSlice{}
+	t.deprecation(w, pathString(n.testIdentPath), n.outer.start)
 	v, _ := lookupPath(n.testIdentPath, c...)
 	if v != nil {
 		vs := strings.Builder{}
@@ -235,81 +726,658 @@ func (n *testNode) render(t *Template, w *writer, c ...interface{}) error {
 		}
 	}
 	if len(errs) != 0 {
-		if !t.silentMiss {
+		if t.reportErrors() {
 			return errs
 		}
 	}
 	return nil
 }
 
-func (n *sectionNode) String() string {
-	return fmt.Sprintf("[section: %q inv: %t elems: %s]", n.name, n.inverted, n.elems)
+// typeTests maps the name of a type test section to the predicate that decides
+// whether a value is of that type.
+var typeTests = map[string]func(reflect.Value) bool{
+	"is_list": func(r reflect.Value) bool {
+		return r.Kind() == reflect.Slice || r.Kind() == reflect.Array
+	},
+	"is_map": func(r reflect.Value) bool {
+		return r.Kind() == reflect.Map || r.Kind() == reflect.Struct
+	},
+	"is_string": func(r reflect.Value) bool {
+		return r.Kind() == reflect.String
+	},
+	"is_number": func(r reflect.Value) bool {
+		switch r.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true
+		}
+		return false
+	},
+	"is_bool": func(r reflect.Value) bool {
+		return r.Kind() == reflect.Bool
+	},
 }
 
-// The commentNode type is a part of the template which gets ignored. Perhaps it
-// can be optionally enabled to print comments.
-type commentNode string
+// The typeTestNode type is a section which renders its child elements, with
+// the unchanged context, when the looked up value is of a given type. Unlike
+// regular sections the truthiness of the value does not matter, so an empty
+// string still satisfies is_string.
+type typeTestNode struct {
+	kind     string
+	name     string
+	path     []pathSegment
+	inverted bool
+	elems    []node
+	spans
+}
 
-func (n commentNode) render(t *Template, w *writer, c ...interface{}) error {
+func (n *typeTestNode) render(t *Template, w *writer, c ...interface{}) error {
 	w.tag()
+	defer w.tag()
+	t.deprecation(w, n.name, n.outer.start)
+	errs := ErrorSlice{}
+	v, _ := w.lookup(n.name, n.path, c)
+	r := reflect.ValueOf(v)
+	for r.Kind() == reflect.Ptr || r.Kind() == reflect.Interface {
+		r = r.Elem()
+	}
+	if typeTests[n.kind](r) != n.inverted {
+		for _, elem := range n.elems {
+			err := elem.render(t, w, c...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) != 0 {
+		if t.reportErrors() {
+			return errs
+		}
+	}
 	return nil
 }
 
-func (n commentNode) String() string {
-	return fmt.Sprintf("[comment: %q]", string(n))
+func (n *typeTestNode) String() string {
+	return fmt.Sprintf("[%s: %q inv: %t elems: %s]", n.kind, n.name, n.inverted, n.elems)
 }
 
-// The partialNode type represents a named partial template.
-type partialNode struct {
-	name string
+// The countNode type is a section which renders its child elements, with the
+// unchanged context, when the length of a collection meets a threshold. For
+// min_count the length must be at least count, for max_count at most count.
+// Missing values and values which are not collections have a length of zero.
+type countNode struct {
+	kind     string
+	name     string
+	path     []pathSegment
+	count    int
+	inverted bool
+	elems    []node
+	spans
 }
 
-func (p *partialNode) render(t *Template, w *writer, c ...interface{}) error {
+func (n *countNode) render(t *Template, w *writer, c ...interface{}) error {
 	w.tag()
-	if template, ok := t.partials[p.name]; ok {
-
-		// We can avoid cycles by removing this node's template from the lookup
-		// before we render
-		template.partials = make(map[string]*Template)
-		for k, v := range t.partials {
-			if k != p.name {
-				template.partials[k] = v
+	defer w.tag()
+	t.deprecation(w, n.name, n.outer.start)
+	errs := ErrorSlice{}
+	v, _ := w.lookup(n.name, n.path, c)
+	length := 0
+	r := reflect.ValueOf(v)
+	for r.Kind() == reflect.Ptr || r.Kind() == reflect.Interface {
+		r = r.Elem()
+	}
+	switch r.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		length = r.Len()
+	}
+	match := length >= n.count
+	if n.kind == "max_count" {
+		match = length <= n.count
+	}
+	if match != n.inverted {
+		for _, elem := range n.elems {
+			err := elem.render(t, w, c...)
+			if err != nil {
+				errs = append(errs, err)
 			}
 		}
-
-		err := template.render(w, c...)
-		if err != nil {
-			if !t.silentMiss {
-				return err
-			}
+	}
+	if len(errs) != 0 {
+		if t.reportErrors() {
+			return errs
 		}
 	}
-
 	return nil
 }
 
-func (p *partialNode) String() string {
-	return fmt.Sprintf("[partial: %s]", p.name)
+func (n *countNode) String() string {
+	return fmt.Sprintf("[%s: %q %d inv: %t elems: %s]", n.kind, n.name, n.count, n.inverted, n.elems)
 }
 
-type delimNode string
-
-func (n delimNode) String() string {
-	return "[delim]"
+// The chunkNode type is a section which splits a list into consecutive rows of
+// at most size elements and renders its child elements once per row, with the
+// row pushed onto the context. Values which are not lists are treated as a
+// list holding only that value, and missing or falsy values render nothing.
+type chunkNode struct {
+	name  string
+	path  []pathSegment
+	size  int
+	elems []node
+	spans
 }
 
-func (n delimNode) render(t *Template, w *writer, c ...interface{}) error {
+func (n *chunkNode) render(t *Template, w *writer, c ...interface{}) error {
 	w.tag()
+	defer w.tag()
+	t.deprecation(w, n.name, n.outer.start)
+	if err := w.enter(); err != nil {
+		return err
+	}
+	defer w.leave()
+	errs := ErrorSlice{}
+	v, ok := w.lookup(n.name, n.path, c)
+	if !ok {
+		return nil
+	}
+	var items []interface{}
+	r := reflect.ValueOf(v)
+	switch r.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < r.Len(); i++ {
+			items = append(items, r.Index(i).Interface())
+		}
+	default:
+		items = []interface{}{v}
+	}
+	for start := 0; start < len(items); start += n.size {
+		if w.abort() != nil {
+			break
+		}
+		if err := w.iterate(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		end := start + n.size
+		if end > len(items) {
+			end = len(items)
+		}
+		// The children share the context chain, so that their lookups may
+		// be memoized.
+		frame := append([]interface{}{items[start:end]}, c...)
+		for _, elem := range n.elems {
+			err := elem.render(t, w, frame...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) != 0 {
+		if t.reportErrors() {
+			return errs
+		}
+	}
 	return nil
 }
 
-// The print function is able to format the interface v and write it to w using
-// the best possible formatting flags.
-func print(w io.Writer, v interface{}, needEscape escapeType) {
-	var output string
-	if s, ok := v.(fmt.Stringer); ok {
-		output = s.String()
-	} else {
+func (n *chunkNode) String() string {
+	return fmt.Sprintf("[chunk: %q %d elems: %s]", n.name, n.size, n.elems)
+}
+
+// The zipNode type is a section which iterates over two lists in lockstep. For
+// each pair of elements it renders its child elements with a frame holding the
+// elements under names, by default @a and @b, pushed onto the context. When
+// the lists differ in length the iteration stops at the end of the shorter.
+type zipNode struct {
+	idents [2]string
+	paths  [2][]pathSegment
+	names  [2]string
+	elems  []node
+	spans
+}
+
+func (n *zipNode) render(t *Template, w *writer, c ...interface{}) error {
+	w.tag()
+	defer w.tag()
+	for _, ident := range n.idents {
+		t.deprecation(w, ident, n.outer.start)
+	}
+	if err := w.enter(); err != nil {
+		return err
+	}
+	defer w.leave()
+	errs := ErrorSlice{}
+	var lists [2]reflect.Value
+	for i, path := range n.paths {
+		v, _ := w.lookup(n.idents[i], path, c)
+		lists[i] = reflect.ValueOf(v)
+		if k := lists[i].Kind(); k != reflect.Slice && k != reflect.Array {
+			return nil
+		}
+	}
+	length := lists[0].Len()
+	if lists[1].Len() < length {
+		length = lists[1].Len()
+	}
+	for i := 0; i < length; i++ {
+		if w.abort() != nil {
+			break
+		}
+		if err := w.iterate(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		pair := map[string]interface{}{
+			n.names[0]: lists[0].Index(i).Interface(),
+			n.names[1]: lists[1].Index(i).Interface(),
+		}
+		frame := append([]interface{}{pair}, c...)
+		for _, elem := range n.elems {
+			err := elem.render(t, w, frame...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) != 0 {
+		if t.reportErrors() {
+			return errs
+		}
+	}
+	return nil
+}
+
+func (n *zipNode) String() string {
+	return fmt.Sprintf("[zip: %q %q as %s %s elems: %s]", n.idents[0], n.idents[1], n.names[0], n.names[1], n.elems)
+}
+
+// The letNode type is a section which binds names to values for its child
+// elements. Each value is looked up, or given as a literal, once when the
+// section is rendered and the bindings are pushed onto the context.
+type letNode struct {
+	bindings []letBinding
+	elems    []node
+	spans
+}
+
+// letBinding binds name to either the value at path or a literal value,
+// passed through filters if any.
+type letBinding struct {
+	name    string
+	ident   string
+	path    []pathSegment
+	literal string
+	filters []filter // with FilterPipes, for let sections only
+}
+
+func (n *letNode) render(t *Template, w *writer, c ...interface{}) error {
+	w.tag()
+	defer w.tag()
+	bound := make(map[string]interface{}, len(n.bindings))
+	for _, b := range n.bindings {
+		var v interface{} = b.literal
+		if b.path != nil {
+			// Bindings are evaluated in order, so later ones may refer to
+			// earlier. Those are looked up in the bindings alone, as the
+			// memo of the context does not know of them.
+			if _, ok := bound[b.path[0].key]; ok {
+				v, _ = lookupPath(b.path, bound)
+			} else {
+				t.deprecation(w, b.ident, n.outer.start)
+				v, _ = w.lookup(b.ident, b.path, c)
+			}
+		}
+		if len(b.filters) > 0 && v != nil {
+			var err error
+			if v, err = t.filter(w, b.name, v, b.filters); err != nil {
+				return err
+			}
+		}
+		bound[b.name] = v
+	}
+	errs := ErrorSlice{}
+	frame := append([]interface{}{bound}, c...)
+	for _, elem := range n.elems {
+		err := elem.render(t, w, frame...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 0 {
+		if t.reportErrors() {
+			return errs
+		}
+	}
+	return nil
+}
+
+func (n *letNode) String() string {
+	return fmt.Sprintf("[let: %v elems: %s]", n.bindings, n.elems)
+}
+
+// The captureNode type is a section whose output is not written but stored
+// under name in the captures of the render, from where later tags may look it
+// up.
+type captureNode struct {
+	name  string
+	elems []node
+	spans
+}
+
+// capturedText is the output of a capture section. It was escaped while being
+// rendered, so it is printed as is.
+type capturedText string
+
+func (n *captureNode) render(t *Template, w *writer, c ...interface{}) error {
+	w.tag()
+	defer w.tag()
+	var sb strings.Builder
+	subWriter := w.sub(&sb)
+	errs := ErrorSlice{}
+	for _, elem := range n.elems {
+		err := elem.render(t, subWriter, c...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := subWriter.flush(); err != nil {
+		return err
+	}
+	if w.state.captures != nil {
+		w.state.captures[n.name] = capturedText(sb.String())
+		if w.state.memo != nil {
+			// The lookups made so far may have missed the capture.
+			w.state.memo = make(map[memoKey]memoValue)
+		}
+	}
+	if len(errs) != 0 {
+		if t.reportErrors() {
+			return errs
+		}
+	}
+	return nil
+}
+
+func (n *captureNode) String() string {
+	return fmt.Sprintf("[capture: %q elems: %s]", n.name, n.elems)
+}
+
+// The switchNode type dispatches on the printed value of a variable, rendering
+// the elements of the matching case or, if none matches, those of the default.
+type switchNode struct {
+	name         string
+	path         []pathSegment
+	cases        map[string][]node
+	values       []string // the case values in source order
+	caseSpans    []spans  // the ranges of the cases, in the order of values
+	defaultSpans spans
+	defaultElems []node
+	hasDefault   bool
+	spans
+}
+
+func (n *switchNode) render(t *Template, w *writer, c ...interface{}) error {
+	w.tag()
+	defer w.tag()
+	t.deprecation(w, n.name, n.outer.start)
+	elems := n.defaultElems
+	v, _ := w.lookup(n.name, n.path, c)
+	if v != nil {
+		vs := strings.Builder{}
+		print(&vs, v, noEscape)
+		if caseElems, ok := n.cases[vs.String()]; ok {
+			elems = caseElems
+		}
+	}
+	errs := ErrorSlice{}
+	for _, elem := range elems {
+		err := elem.render(t, w, c...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 0 {
+		if t.reportErrors() {
+			return errs
+		}
+	}
+	return nil
+}
+
+func (n *switchNode) String() string {
+	return fmt.Sprintf("[switch: %q cases: %v default: %s]", n.name, n.cases, n.defaultElems)
+}
+
+// The caseNode type is a case or default section found while parsing a switch.
+// It only exists in the parse tree until the enclosing switchNode is built, so
+// on its own it renders nothing.
+type caseNode struct {
+	value     string
+	isDefault bool
+	elems     []node
+	spans
+}
+
+func (n *caseNode) render(t *Template, w *writer, c ...interface{}) error {
+	w.tag()
+	return nil
+}
+
+func (n *caseNode) String() string {
+	if n.isDefault {
+		return fmt.Sprintf("[default elems: %s]", n.elems)
+	}
+	return fmt.Sprintf("[case: %q elems: %s]", n.value, n.elems)
+}
+
+func (n *sectionNode) String() string {
+	return fmt.Sprintf("[section: %q inv: %t elems: %s]", n.name, n.inverted, n.elems)
+}
+
+// The commentNode type is a part of the template which gets ignored. Perhaps it
+// can be optionally enabled to print comments.
+type commentNode struct {
+	text string
+	spans
+}
+
+func (n *commentNode) render(t *Template, w *writer, c ...interface{}) error {
+	w.tag()
+	return nil
+}
+
+// constNode marks where a constant was defined. Constants are made available
+// to the whole template, so the node itself renders nothing.
+type constNode struct {
+	name string
+	spans
+}
+
+func (n *constNode) render(t *Template, w *writer, c ...interface{}) error {
+	w.tag()
+	return nil
+}
+
+func (n *constNode) String() string {
+	return fmt.Sprintf("[const: %s]", n.name)
+}
+
+func (n *commentNode) String() string {
+	return fmt.Sprintf("[comment: %q]", n.text)
+}
+
+// The partialNode type represents a named partial template.
+type partialNode struct {
+	name string
+	spans
+}
+
+func (p *partialNode) render(t *Template, w *writer, c ...interface{}) error {
+	w.tag()
+	// We can avoid cycles by not rendering a partial which is already being
+	// rendered further up the chain.
+	if w.state.partialChain[p.name] {
+		return nil
+	}
+	template, ok := t.partials[p.name]
+	if !ok {
+		template, ok = w.state.partials[p.name]
+	}
+	if !ok && w.state.lazy != nil {
+		var err error
+		template, err = w.state.lazy.load(w.state.ctx, p.name)
+		if err != nil {
+			// The error is not a miss, so it aborts the render even if
+			// misses are silent.
+			w.state.err = err
+			return err
+		}
+		ok = template != nil
+	}
+	if !ok && t.partialDir != nil {
+		var err error
+		template, err = t.partialDir.load(t, p.name)
+		if err != nil {
+			return err
+		}
+		ok = template != nil
+	}
+	if ok {
+		if err := w.enter(); err != nil {
+			return err
+		}
+		defer w.leave()
+		t.partialDeprecation(w, p, template)
+
+		w.state.partialChain[p.name] = true
+		defer delete(w.state.partialChain, p.name)
+
+		if len(t.partialFuncs) > 0 {
+			return p.renderProcessed(t, w, template, c)
+		}
+		err := template.render(w, c...)
+		if err != nil {
+			if t.reportErrors() {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// renderProcessed renders the partial template into memory and writes its
+// output as processed by the post-processors of t.
+func (p *partialNode) renderProcessed(t *Template, w *writer, template *Template, c []interface{}) error {
+	var b bytes.Buffer
+	if err := template.render(w.sub(&b), c...); err != nil {
+		if t.reportErrors() {
+			return err
+		}
+	}
+	output := b.Bytes()
+	for _, f := range t.partialFuncs {
+		var err error
+		if output, err = f(p.name, output); err != nil {
+			// The error is not a miss, so it aborts the render even if misses
+			// are silent.
+			w.state.err = &PartialFuncError{Name: p.name, Err: err}
+			return w.state.err
+		}
+	}
+	// Like the output of function sections, the output is rendered as text so
+	// that its blank lines are kept.
+	return textNode(output).render(t, w)
+}
+
+func (p *partialNode) String() string {
+	return fmt.Sprintf("[partial: %s]", p.name)
+}
+
+// delimNode is a set delimiter tag such as {{=<% %>=}}, holding the source of
+// the tag.
+type delimNode string
+
+func (n delimNode) String() string {
+	return "[delim]"
+}
+
+func (n delimNode) render(t *Template, w *writer, c ...interface{}) error {
+	w.tag()
+	return nil
+}
+
+// trimNode is text of the source left out of the output: whitespace removed
+// next to a tag by a trim marker, as in {{- name -}}, or a backslash escaping
+// a delimiter. Like delimNode it renders nothing, and is kept so that the
+// ranges of the nodes following it can be derived.
+type trimNode string
+
+func (n trimNode) String() string {
+	return "[trim]"
+}
+
+func (n trimNode) render(t *Template, w *writer, c ...interface{}) error {
+	return nil
+}
+
+// verbatimNode is a raw block such as {{{{raw}}}}{{name}}{{{{/raw}}}}, whose
+// text is rendered as is, without interpreting tags.
+type verbatimNode struct {
+	text string
+	spans
+}
+
+func (n *verbatimNode) String() string {
+	return fmt.Sprintf("[raw: %q]", n.text)
+}
+
+func (n *verbatimNode) render(t *Template, w *writer, c ...interface{}) error {
+	return textNode(n.text).render(t, w)
+}
+
+// Safe is a string which is printed as is, whatever the escape mode of the
+// template, e.g. markup rendered beforehand or JSON encoded by the caller:
+//
+//	template.Render(w, map[string]interface{}{"body": mustache.Safe(html)})
+//
+// Values of type template.HTML, from html/template, are likewise not escaped
+// in the HTML escape mode, and are escaped as strings in the JSON one.
+type Safe string
+
+// The print function is able to format the interface v and write it to w using
+// the best possible formatting flags. It returns the error of writing to w.
+func print(w io.Writer, v interface{}, needEscape escapeType) error {
+	switch s := v.(type) {
+	case capturedText:
+		_, err := io.WriteString(w, string(s))
+		return err
+	case Safe:
+		_, err := io.WriteString(w, string(s))
+		return err
+	case template.HTML:
+		if needEscape == htmlEscape || needEscape == noEscape {
+			_, err := io.WriteString(w, string(s))
+			return err
+		}
+		v = string(s)
+	}
+	if needEscape == jsEscape || needEscape == jsAttrEscape {
+		// Values referencing themselves can not be printed.
+		if cyclic(reflect.ValueOf(v)) {
+			return &CycleError{}
+		}
+		output := jsValue(v)
+		if needEscape == jsAttrEscape {
+			output = escapeAttr(output)
+		}
+		_, err := io.WriteString(w, output)
+		return err
+	}
+	var output string
+	if s, ok := v.(fmt.Stringer); ok {
+		output = s.String()
+	} else {
 		switch v.(type) {
 		case string:
 			output = fmt.Sprintf("%s", v)
@@ -318,6 +1386,10 @@ func print(w io.Writer, v interface{}, needEscape escapeType) {
 		case float32, float64:
 			output = fmt.Sprintf("%g", v)
 		default:
+			// Values referencing themselves can not be printed.
+			if cyclic(reflect.ValueOf(v)) {
+				return &CycleError{}
+			}
 			// The default json encoder will HTML escape &, <, and >.
 			// Since we explicitly handle escape by user directive, let's make
 			// sure that doesn't happen in the case we just got asked to
@@ -334,12 +1406,8 @@ func print(w io.Writer, v interface{}, needEscape escapeType) {
 		}
 	}
 
-	if needEscape == htmlEscape {
-		output = escapeHtml(output)
-	} else if needEscape == jsonEscape {
-		output = escapeJson(output)
-	}
-	fmt.Fprint(w, output)
+	_, err := io.WriteString(w, EscapeType(needEscape).Escape(output))
+	return err
 }
 
 // The escape function replicates the text/template.HTMLEscapeString but keeps
@@ -393,6 +1461,43 @@ func Name(n string) Option {
 	}
 }
 
+// ContextType binds the field indices of the struct types reachable from the
+// type of v, such as the type of the context the template is rendered with,
+// when the option is applied rather than on the first render to look them up.
+// Lookups in values of other types work as before.
+func ContextType(v interface{}) Option {
+	return func(t *Template) {
+		bindStructs(reflect.TypeOf(v), make(map[reflect.Type]bool))
+	}
+}
+
+// WithMetadata attaches metadata to the template, such as the tenant it
+// belongs to, the file it was read from or its version. The errors of parsing,
+// rendering and validating the template are wrapped in a *MetadataError
+// carrying it, so that they can be traced back to the template.
+func WithMetadata(metadata map[string]string) Option {
+	return func(t *Template) {
+		t.metadata = make(map[string]string, len(metadata))
+		for k, v := range metadata {
+			t.metadata[k] = v
+		}
+	}
+}
+
+// Metadata returns the metadata attached to the template with WithMetadata.
+// It must not be modified.
+func (t *Template) Metadata() map[string]string {
+	return t.metadata
+}
+
+// tag wraps err in a *MetadataError if t has metadata.
+func (t *Template) tag(err error) error {
+	if err == nil || len(t.metadata) == 0 {
+		return err
+	}
+	return &MetadataError{Metadata: t.metadata, Err: err}
+}
+
 // Delimiters sets the start and end delimiters of the template.
 func Delimiters(start, end string) Option {
 	return func(t *Template) {
@@ -401,6 +1506,15 @@ func Delimiters(start, end string) Option {
 	}
 }
 
+// TabWidth sets the number of columns between tab stops used to report the
+// columns of parse errors and variables. By default a tab is a single column,
+// like any other character.
+func TabWidth(n int) Option {
+	return func(t *Template) {
+		t.tabWidth = n
+	}
+}
+
 // Partial sets p as a partial to the template. It is important to set the name
 // of p so that it may be looked up by the parent template.
 func Partial(p *Template) Option {
@@ -412,8 +1526,8 @@ func Partial(p *Template) Option {
 // CustomizeFunction sets the function f as available for the template.
 func CustomizeFunction(name string, f CustomizerFunc) Option {
 	return func(t *Template) {
-		// wrap the CustomizerFunc as a CustomizerFuncWithOptions
-		t.customizers[name] = func(s string, _ map[string]string) (string, error) {
+		// wrap the CustomizerFunc as a customizerFunc
+		t.customizers[name] = func(_ context.Context, s string, _ []string, _ map[string]string) (string, error) {
 			return f(s)
 		}
 	}
@@ -422,7 +1536,48 @@ func CustomizeFunction(name string, f CustomizerFunc) Option {
 // CustomizeFunctionWithOptions sets the function f as available for the template.
 func CustomizeFunctionWithOptions(name string, f CustomizerFuncWithOptions) Option {
 	return func(t *Template) {
-		t.customizers[name] = f
+		// wrap the CustomizerFuncWithOptions as a customizerFunc
+		t.customizers[name] = func(_ context.Context, s string, _ []string, opts map[string]string) (string, error) {
+			return f(s, opts)
+		}
+	}
+}
+
+// CustomizeFunctionWithArgs sets the function f as available for the
+// template. Along with the options of the tag, f receives its positional
+// arguments, e.g. ", " for {{~join ", "}}.
+func CustomizeFunctionWithArgs(name string, f CustomizerFuncWithArgs) Option {
+	return func(t *Template) {
+		t.customizers[name] = func(_ context.Context, s string, args []string, opts map[string]string) (string, error) {
+			return f(s, args, opts)
+		}
+	}
+}
+
+// CustomizeFunctionCtx sets the function f as available for the template. The
+// function receives the context.Context given to RenderContext, or
+// context.Background when rendering with Render.
+func CustomizeFunctionCtx(name string, f CustomizerFuncCtx) Option {
+	return func(t *Template) {
+		t.customizers[name] = func(ctx context.Context, s string, _ []string, opts map[string]string) (string, error) {
+			return f(ctx, s, opts)
+		}
+	}
+}
+
+// CustomizeFunctionStream sets the streaming function f as available for the
+// template, in place of any other function of the same name. Rather than
+// buffering the output of a function section in memory, f reads it from r
+// while the section is rendered, and writes its result to w, so large sections
+// may be transformed, e.g. encoded or compressed, without holding them whole.
+// As f runs while the section is rendered, errors of the section, such as
+// misses with SilentMiss(false), are returned after f has written its result.
+func CustomizeFunctionStream(name string, f CustomizerStreamFunc) Option {
+	return func(t *Template) {
+		if t.streamCustomizers == nil {
+			t.streamCustomizers = make(map[string]CustomizerStreamFunc)
+		}
+		t.streamCustomizers[name] = f
 	}
 }
 
@@ -475,17 +1630,410 @@ func TestValueSection() Option {
 	}
 }
 
-// The Template type represents a template and its components.
+// TypeTestSections enables sections which branch on the type of a value rather
+// than its truthiness: {{#is_list ident}}, {{#is_map ident}},
+// {{#is_string ident}}, {{#is_number ident}} and {{#is_bool ident}}. Each is
+// closed by the test name alone, e.g. {{/is_list}}, and may be inverted with ^.
+func TypeTestSections() Option {
+	return func(t *Template) {
+		t.typeTestSections = true
+	}
+}
+
+// PartialFunc post-processes the rendered output of the partial name, such as
+// to wrap it in an element or measure its size. It returns the output to
+// write in place of the partial.
+type PartialFunc func(name string, output []byte) ([]byte, error)
+
+// PostProcessPartials registers f to process the output of the partials the
+// template includes. Post-processors registered by several options run in
+// order. The partials included by a partial are processed by the options of
+// that partial. A failure aborts the render with a *PartialFuncError.
+func PostProcessPartials(f PartialFunc) Option {
+	return func(t *Template) {
+		t.partialFuncs = append(t.partialFuncs[:len(t.partialFuncs):len(t.partialFuncs)], f)
+	}
+}
+
+// RenderFunc renders a template to w with the given data, stopping once ctx
+// is done.
+type RenderFunc func(ctx context.Context, w io.Writer, data ...interface{}) error
+
+// Middleware wraps the render of a template. It is given the function making
+// the render, and returns the function to call in its place, which may call
+// next any number of times, e.g. with fallback data after a failure, or with
+// a writer compressing the output. The output written by a failed call to
+// next is not undone, so middleware retrying a render should give next a
+// buffer.
+type Middleware func(next RenderFunc) RenderFunc
+
+// Use wraps every render of the template in m, along with the middleware
+// already in use. The first middleware used is the outermost. Middleware wraps
+// whole renders, so it is not applied to the template when it is rendered as a
+// partial.
+func Use(m ...Middleware) Option {
+	return func(t *Template) {
+		t.middleware = append(t.middleware[:len(t.middleware):len(t.middleware)], m...)
+	}
+}
+
+// MissFunc is called when a variable can not be found in the context. It
+// receives the name of the variable along with the line and column of the
+// start of its tag.
+// If it returns true, the returned value is rendered in place of the variable
+// and the miss is not reported as an error.
+type MissFunc func(name string, line, col int) (interface{}, bool)
+
+// OnMiss sets the function f to be called whenever a variable lookup fails.
+// It can be used to supply fallback values, log misses or record metrics. When
+// f declines to handle a miss, the SilentMiss behavior applies as usual.
+func OnMiss(f MissFunc) Option {
+	return func(t *Template) {
+		t.onMiss = f
+	}
+}
+
+// SwitchSections enables {{#switch ident}} sections, which render the
+// {{#case "value"}} section whose value matches the printed value of ident, or
+// the {{#default}} section if no case matches.
+//
+//	{{#switch status}}
+//	  {{#case "firing"}}Alert is firing{{/case}}
+//	  {{#case "resolved"}}Alert resolved{{/case}}
+//	  {{#default}}Alert is {{status}}{{/default}}
+//	{{/switch}}
+//
+// Case sections are only allowed directly within a switch, and default
+// sections elsewhere are ordinary sections.
+func SwitchSections() Option {
+	return func(t *Template) {
+		t.switchSections = true
+	}
+}
+
+// KeepMissingTags makes variables which can not be found in the context render
+// as their original tag, e.g. {{foo}}, instead of being left out. This allows
+// the output to be used as a template itself, as in two-pass templating. Tags
+// are kept without surrounding whitespace, so {{ foo }} is kept as {{foo}}.
+// Missing variables kept this way are not reported as errors. Sections are not
+// affected by this option.
+func KeepMissingTags() Option {
+	return func(t *Template) {
+		t.keepMissing = true
+	}
+}
+
+// MissingPlaceholder is like KeepMissingTags, but missing variables render as
+// the placeholder s instead of their original tag.
+func MissingPlaceholder(s string) Option {
+	return func(t *Template) {
+		t.keepMissing = true
+		t.missingPlaceholder = &s
+	}
+}
+
+// CountSections enables sections which render depending on the length of a
+// collection: {{#min_count items 3}} renders when items has at least 3
+// elements and {{#max_count items 3}} when it has at most 3. Each is closed by
+// the section name alone, e.g. {{/min_count}}, and may be inverted with ^.
+func CountSections() Option {
+	return func(t *Template) {
+		t.countSections = true
+	}
+}
+
+// PaginateSections enables offset and limit arguments on sections iterating
+// over a list, e.g. {{#items offset="10" limit="5"}}, which render only the
+// given range of the list. The section is closed by its name alone. Within the
+// section {{@more}} holds the number of elements following the range and
+// {{@total}} the length of the whole list.
+func PaginateSections() Option {
+	return func(t *Template) {
+		t.paginate = true
+	}
+}
+
+// LoopVariables exposes variables describing the iteration within sections
+// iterating over a list, so that templates may number elements and separate
+// them without preprocessing the data:
+//
+//	{{#items}}{{@index}}. {{name}}{{^@last}}, {{/@last}}{{/items}}
+//
+// {{@index}} is the index of the element in the list, counted from 0,
+// {{@first}} and {{@last}} report whether it is the first or last element
+// rendered and {{@length}} is the number of elements rendered, which differ
+// from the whole list for paginated sections.
+func LoopVariables() Option {
+	return func(t *Template) {
+		t.loopVariables = true
+	}
+}
+
+// MapSections makes sections iterate over the entries of maps, in the order
+// of their keys, rather than render once with the map as the context:
+//
+//	{{#headers}}{{@key}}: {{@value}}{{/headers}}
+//
+// Within the section {{@key}} is the key of the entry and {{@value}} its
+// value, which is also pushed onto the context so that its fields may be
+// looked up by name. With LoopVariables the position of the entry is exposed
+// as for lists.
+func MapSections() Option {
+	return func(t *Template) {
+		t.mapSections = true
+	}
+}
+
+// ChunkSections enables {{#chunk ident size}} sections, which split the list
+// ident into rows of at most size elements and render once per row with the
+// row as the context. This is useful for grid layouts:
+//
+//	{{#chunk items 3}}<tr>{{#.}}<td>{{name}}</td>{{/.}}</tr>{{/chunk}}
+func ChunkSections() Option {
+	return func(t *Template) {
+		t.chunkSections = true
+	}
+}
+
+// CollectErrors makes rendering run to completion regardless of errors, such
+// as missing variables or failing customizer functions, and return all of them
+// together as an ErrorSlice. It takes precedence over SilentMiss.
+func CollectErrors() Option {
+	return func(t *Template) {
+		t.collectErrors = true
+	}
+}
+
+// ZipSections enables {{#zip a b}} sections, which iterate over the lists a
+// and b in lockstep exposing each pair of elements as {{@a}} and {{@b}}. The
+// names may be changed with an as argument:
+//
+//	{{#zip labels values as="label value"}}{{@label}}: {{@value}}{{/zip}}
+func ZipSections() Option {
+	return func(t *Template) {
+		t.zipSections = true
+	}
+}
+
+// LetSections enables {{#let}} sections, which bind names to values for the
+// rest of the section. A value is either looked up, once, or given as a
+// quoted literal:
+//
+//	{{#let total=order.summary.totals.grand currency="EUR"}}
+//	  {{total}} {{currency}}
+//	{{/let}}
+//
+// This avoids repeating long dotted paths and repeatedly calling expensive
+// methods of the context. With FilterPipes, a value may be passed through
+// filters before it is bound, as in {{#let t=total | upper}}; a stage ends at
+// the next pipe or binding.
+func LetSections() Option {
+	return func(t *Template) {
+		t.letSections = true
+	}
+}
+
+// CaptureSections enables {{#capture "name"}} sections. Their output is not
+// written where the section appears, but made available as {{name}} to the
+// tags following it in the same render, so that a fragment can be rendered
+// once and placed in several spots:
+//
+//	{{#capture "preheader"}}Your order {{id}} has shipped{{/capture}}
+//	<title>{{preheader}}</title> ... <p>{{preheader}}</p>
+//
+// The captured output was escaped while rendering, so it is not escaped again.
+// Captures are looked up after the data given to the template.
+func CaptureSections() Option {
+	return func(t *Template) {
+		t.captureSections = true
+	}
+}
+
+// CoalesceTags enables {{coalesce a b "c"}} tags, which render the first of
+// their arguments which is not empty. Arguments are identifiers, which are
+// looked up, or quoted literals:
+//
+//	Hi {{coalesce nickname first_name "there"}},
+//
+// Values which are falsy, such as empty strings, zero or false, are skipped.
+// If all arguments are empty, nothing is rendered and no error is reported.
+func CoalesceTags() Option {
+	return func(t *Template) {
+		t.coalesceTags = true
+	}
+}
+
+// FilterPipes enables filters on variables, which pass the value of the
+// variable through customizer functions before it is escaped:
+//
+//	{{name | trim | upper}}
+//
+// Each stage names a function registered with CustomizeFunction or one of its
+// variants, which is called with the output of the previous stage. Positional
+// arguments follow the name, quoted or not, as in {{title | truncate 20 "..."}}.
+// Pipes within quoted keys are not stages. A stage naming a function not
+// registered when the template is parsed is a parse error, so FilterPipes and
+// the functions must be given together. A failing function fails the render
+// with a *CustomizerError; the variable is then not rendered.
+func FilterPipes() Option {
+	return func(t *Template) {
+		t.filterPipes = true
+	}
+}
+
+// Translator translates the messages of translation tags. T returns the
+// message key, in the language of the translator, given its arguments.
+type Translator interface {
+	T(key string, args map[string]interface{}) string
+}
+
+// TranslatorContext is implemented by translators which choose the language
+// of a message from the context of the render, e.g. a locale set by an HTTP
+// middleware. TContext is then called in place of T with the context given to
+// RenderContext.
+type TranslatorContext interface {
+	Translator
+	TContext(ctx context.Context, key string, args map[string]interface{}) string
+}
+
+// Translate enables translation tags, which render the message with a quoted
+// key translated by tr, given the arguments which follow it:
+//
+//	{{_ "cart.items" count=cart.size label="Cart"}}
+//
+// Arguments are bound like those of let sections: identifiers are looked up,
+// a missing value being given as nil, and quoted values are literals. The
+// message is escaped like a variable, and not escaped in {{{_ "key"}}} or
+// {{&_ "key"}}.
+func Translate(tr Translator) Option {
+	return func(t *Template) {
+		t.translator = tr
+	}
+}
+
+// EscapeDelimiters enables escaping the left delimiter with a backslash, so
+// that it is rendered literally rather than opening a tag:
+//
+//	Use \{{name}} to print the name.
+//
+// renders as "Use {{name}} to print the name.". The backslash is not rendered.
+// A delimiter set with a set delimiter tag is escaped the same way. Two
+// backslashes before a delimiter are an escaped backslash, so that C:\\{{dir}}
+// renders a backslash followed by the value of dir, and C:\\\{{dir}} a
+// backslash followed by the text {{dir}}. Other backslashes are text.
+func EscapeDelimiters() Option {
+	return func(t *Template) {
+		t.escapeDelims = true
+	}
+}
+
+// MemoizeLookups makes each render remember the values it looks up, so that
+// variables referenced many times in the same context are resolved once. The
+// memo lasts for a single render, and assumes the context does not change
+// while rendering, e.g. through methods with side effects. It is forgotten
+// whenever a capture section stores its output.
+func MemoizeLookups() Option {
+	return func(t *Template) {
+		t.memoize = true
+	}
+}
+
+// MaxOutputBytes limits the output of a render to n bytes. Once the limit is
+// exceeded rendering stops and an *OutputLimitError is returned. The output
+// written up to that point, at most n bytes, is left in the writer.
+func MaxOutputBytes(n int64) Option {
+	return func(t *Template) {
+		t.maxOutputBytes = n
+	}
+}
+
+// MaxIterations limits the total number of times sections may render their
+// contents during a single render to n, each chunk of a chunk section and
+// each pair of a zip section counting once. Once the limit is exceeded
+// rendering stops and an *IterationLimitError is returned.
+func MaxIterations(n int) Option {
+	return func(t *Template) {
+		t.maxIterations = n
+	}
+}
+
+// MaxDepth limits the nesting of sections and partials during a render to n
+// levels. Once the limit is exceeded rendering stops and a *DepthLimitError
+// is returned.
+func MaxDepth(n int) Option {
+	return func(t *Template) {
+		t.maxDepth = n
+	}
+}
+
+// Renderer is implemented by anything which renders output from a context,
+// such as a Template. Code which only renders templates may depend on it rather
+// than on Template, so that it can be given other implementations, e.g. mocks
+// in tests.
+type Renderer interface {
+	Render(w io.Writer, context ...interface{}) error
+}
+
+var _ Renderer = (*Template)(nil)
+
+// The Template type represents a template and its components. Once parsed, a
+// Template may be rendered by multiple goroutines concurrently, provided that
+// it is not parsed again or given new options in the meantime.
 type Template struct {
-	name             string
-	elems            []node
-	partials         map[string]*Template
-	customizers      map[string]CustomizerFuncWithOptions
-	startDelim       string
-	endDelim         string
-	silentMiss       bool
-	testValueSection bool
-	escape           escapeType
+	name               string
+	elems              []node
+	partials           map[string]*Template
+	customizers        map[string]customizerFunc
+	streamCustomizers  map[string]CustomizerStreamFunc
+	startDelim         string
+	endDelim           string
+	silentMiss         bool
+	collectErrors      bool
+	maxOutputBytes     int64
+	maxIterations      int
+	maxDepth           int
+	flushDepth         int
+	testValueSection   bool
+	typeTestSections   bool
+	switchSections     bool
+	countSections      bool
+	paginate           bool
+	loopVariables      bool
+	mapSections        bool
+	chunkSections      bool
+	zipSections        bool
+	letSections        bool
+	captureSections    bool
+	singleLine         bool
+	maxLineLength      int
+	coalesceTags       bool
+	filterPipes        bool
+	translator         Translator
+	contextualEscape   bool
+	timeLayout         string        // the layout of times, see TimeFormat
+	durationUnit       time.Duration // the rounding of durations, see DurationFormat
+	floatFormat        string
+	thousandsSep       string
+	decimalMark        string
+	numberFormatter    func(n interface{}) string
+	sortedJSON         bool
+	jsonPrefix         string
+	jsonIndent         string
+	valuePrinter       ValuePrinter
+	escape             escapeType
+	onMiss             MissFunc
+	keepMissing        bool
+	missingPlaceholder *string
+	partialDir         *partialDir
+	tabWidth           int
+	escapeDelims       bool
+	starts             map[int]Position // the positions of the tags by offset
+	metadata           map[string]string
+	deprecated         map[string]string // deprecated variables and their replacements
+	partialFuncs       []PartialFunc     // post-processors of the output of partials
+	middleware         []Middleware
+	memoize            bool
+	consts             map[string]string
 }
 
 // New returns a new Template instance.
@@ -493,7 +2041,7 @@ func New(options ...Option) *Template {
 	t := &Template{
 		elems:            make([]node, 0),
 		partials:         make(map[string]*Template),
-		customizers:      make(map[string]CustomizerFuncWithOptions),
+		customizers:      make(map[string]customizerFunc),
 		startDelim:       "{{",
 		endDelim:         "}}",
 		silentMiss:       true,
@@ -511,49 +2059,405 @@ func (t *Template) Option(options ...Option) {
 	}
 }
 
+// Clone returns a copy of the template. The parse tree, partials and
+// customizers are copied, so options given to the clone, such as additional
+// partials, do not affect t. The partial templates themselves are shared,
+// except for those loaded from a PartialDir, which the clone loads again.
+func (t *Template) Clone() *Template {
+	c := *t
+	c.elems = cloneNodes(t.elems)
+	c.partials = make(map[string]*Template, len(t.partials))
+	for k, v := range t.partials {
+		c.partials[k] = v
+	}
+	c.customizers = make(map[string]customizerFunc, len(t.customizers))
+	for k, v := range t.customizers {
+		c.customizers[k] = v
+	}
+	if t.streamCustomizers != nil {
+		c.streamCustomizers = make(map[string]CustomizerStreamFunc, len(t.streamCustomizers))
+		for k, v := range t.streamCustomizers {
+			c.streamCustomizers[k] = v
+		}
+	}
+	if t.partialDir != nil {
+		c.partialDir = t.partialDir.clone()
+	}
+	c.partialFuncs = t.partialFuncs[:len(t.partialFuncs):len(t.partialFuncs)]
+	c.middleware = t.middleware[:len(t.middleware):len(t.middleware)]
+	return &c
+}
+
+// cloneNodes returns a deep copy of the nodes of a parse tree.
+func cloneNodes(nodes []node) []node {
+	if nodes == nil {
+		return nil
+	}
+	clones := make([]node, len(nodes))
+	for i, n := range nodes {
+		clones[i] = cloneNode(n)
+	}
+	return clones
+}
+
+// cloneNode returns a deep copy of n. Nodes which are plain values, such as
+// textNode, are returned as they are.
+func cloneNode(n node) node {
+	switch n := n.(type) {
+	case *varNode:
+		c := *n
+		return &c
+	case *sectionNode:
+		c := *n
+		c.elems = cloneNodes(n.elems)
+		return &c
+	case *functionSectionNode:
+		c := *n
+		if n.opts != nil {
+			c.opts = make(map[string]string, len(n.opts))
+			for k, v := range n.opts {
+				c.opts[k] = v
+			}
+		}
+		if n.optPaths != nil {
+			c.optPaths = make(map[string][]pathSegment, len(n.optPaths))
+			for k, v := range n.optPaths {
+				c.optPaths[k] = v
+			}
+		}
+		c.args = append([]string(nil), n.args...)
+		if n.optParts != nil {
+			c.optParts = make(map[string][]optionPart, len(n.optParts))
+			for k, v := range n.optParts {
+				c.optParts[k] = append([]optionPart(nil), v...)
+			}
+		}
+		c.elems = cloneNodes(n.elems)
+		return &c
+	case *testNode:
+		c := *n
+		c.elems = cloneNodes(n.elems)
+		return &c
+	case *typeTestNode:
+		c := *n
+		c.elems = cloneNodes(n.elems)
+		return &c
+	case *countNode:
+		c := *n
+		c.elems = cloneNodes(n.elems)
+		return &c
+	case *chunkNode:
+		c := *n
+		c.elems = cloneNodes(n.elems)
+		return &c
+	case *zipNode:
+		c := *n
+		c.elems = cloneNodes(n.elems)
+		return &c
+	case *letNode:
+		c := *n
+		c.bindings = append([]letBinding(nil), n.bindings...)
+		c.elems = cloneNodes(n.elems)
+		return &c
+	case *captureNode:
+		c := *n
+		c.elems = cloneNodes(n.elems)
+		return &c
+	case *switchNode:
+		c := *n
+		c.cases = make(map[string][]node, len(n.cases))
+		for k, v := range n.cases {
+			c.cases[k] = cloneNodes(v)
+		}
+		c.defaultElems = cloneNodes(n.defaultElems)
+		return &c
+	case *caseNode:
+		c := *n
+		c.elems = cloneNodes(n.elems)
+		return &c
+	case *partialNode:
+		c := *n
+		return &c
+	case *verbatimNode:
+		c := *n
+		return &c
+	case *coalesceNode:
+		c := *n
+		c.args = append([]coalesceArg(nil), n.args...)
+		return &c
+	case *translateNode:
+		c := *n
+		c.args = append([]letBinding(nil), n.args...)
+		return &c
+	}
+	return n
+}
+
 // Parse parses a stream of bytes read from r and creates a parse tree that
 // represents the template.
+//
+// The source is read as it is parsed rather than all at once, so that large
+// templates are parsed with memory bounded by the size of their parse tree.
 func (t *Template) Parse(r io.Reader) error {
-	b, err := io.ReadAll(r)
+	return t.parse(newReaderLexer(r, t.startDelim, t.endDelim, t.testValueSection))
+}
+
+// ParseString is a helper function that uses a string as input.
+func (t *Template) ParseString(s string) error {
+	return t.parse(newLexer(s, t.startDelim, t.endDelim, t.testValueSection))
+}
+
+// ParseBytes is a helper function that uses a byte array as input.
+func (t *Template) ParseBytes(b []byte) error {
+	return t.ParseString(string(b))
+}
+
+// ParseAll is like ParseString, but reports every syntax error of the template
+// rather than the first one, as an ErrorSlice of *ParseError sorted by
+// position. After an error, parsing resumes with the malformed tag blanked
+// out, so that an error may also follow from an earlier one, e.g. a closing tag
+// left without the section it closes. The template is only changed if there is
+// no error.
+func (t *Template) ParseAll(s string) error {
+	source := []byte(s)
+	var perrs []*ParseError
+	for {
+		l := newLexer(string(source), t.startDelim, t.endDelim, t.testValueSection)
+		p, elems, err := t.parseTree(l)
+		if err == nil {
+			if len(perrs) == 0 {
+				err = t.setTree(p, elems)
+				if perr, ok := err.(*ParseError); ok {
+					perr.Excerpt = excerpt(s, perr.Offset)
+				}
+				return t.tag(err)
+			}
+			break
+		}
+		perr, ok := err.(*ParseError)
+		if !ok {
+			return t.tag(err)
+		}
+		perr.Excerpt = excerpt(s, perr.Offset)
+		perrs = append(perrs, perr)
+		if !blankTag(source, perr.Offset, l.leftDelim, l.rightDelim) {
+			break
+		}
+	}
+	sort.SliceStable(perrs, func(i, j int) bool {
+		return perrs[i].Offset < perrs[j].Offset
+	})
+	errs := make(ErrorSlice, len(perrs))
+	for i, perr := range perrs {
+		errs[i] = perr
+	}
+	return t.tag(errs)
+}
+
+// blankTag replaces the tag with the delimiters left and right in which a
+// syntax error was found at offset with spaces, up to its right delimiter or
+// the end of its line. It reports whether a tag was found.
+func blankTag(source []byte, offset int, left, right string) bool {
+	end := offset + len(left)
+	if end > len(source) {
+		end = len(source)
+	}
+	start := bytes.LastIndex(source[:end], []byte(left))
+	if start < 0 {
+		return false
+	}
+	end = len(source)
+	if i := bytes.IndexByte(source[start:], '\n'); i >= 0 {
+		end = start + i
+	}
+	if i := bytes.Index(source[start+len(left):end], []byte(right)); i >= 0 {
+		end = start + len(left) + i + len(right)
+	}
+	for i := start; i < end; i++ {
+		if source[i] != '\t' && source[i] != '\r' {
+			source[i] = ' '
+		}
+	}
+	return true
+}
+
+// parse parses the template scanned by l.
+func (t *Template) parse(l *lexer) error {
+	p, elems, err := t.parseTree(l)
+	if err == nil {
+		err = t.setTree(p, elems)
+	}
 	if err != nil {
-		return err
+		// The source of a lexer reading a string is at hand for the excerpt.
+		if perr, ok := err.(*ParseError); ok && l.r == nil {
+			perr.Excerpt = excerpt(l.input, perr.Offset)
+		}
+		return t.tag(err)
 	}
-	l := newLexer(string(b), t.startDelim, t.endDelim, t.testValueSection)
+	return nil
+}
+
+// parseTree parses the template scanned by l, without changing t.
+func (t *Template) parseTree(l *lexer) (*parser, []node, error) {
+	l.tabWidth = t.tabWidth
+	l.escapeDelims = t.escapeDelims
 	p := newParser(l, t.escape)
+	p.typeTestSections = t.typeTestSections
+	p.switchSections = t.switchSections
+	p.countSections = t.countSections
+	p.paginate = t.paginate
+	p.chunkSections = t.chunkSections
+	p.zipSections = t.zipSections
+	p.letSections = t.letSections
+	p.captureSections = t.captureSections
+	p.coalesceTags = t.coalesceTags
+	p.filterPipes = t.filterPipes
+	p.customizers = t.customizers
+	p.translateTags = t.translator != nil
+	p.formatOptions = t.timeLayout != "" || t.durationUnit > 0
 	elems, err := p.parse()
-	if err != nil {
-		return err
+	// A syntax error found in a template which could not be read entirely
+	// is a consequence of the read error.
+	if rerr := l.err(); rerr != nil {
+		return nil, nil, rerr
 	}
-	t.elems = elems
-	return nil
+	return p, elems, err
 }
 
-// ParseString is a helper function that uses a string as input.
-func (t *Template) ParseString(s string) error {
-	return t.Parse(strings.NewReader(s))
+// setTree makes elems, parsed by p, the parse tree of t. With
+// ContextualAutoEscape, it returns a *ParseError, leaving t unchanged, if the
+// escaping of the variables of elems can not be set.
+func (t *Template) setTree(p *parser, elems []node) error {
+	if t.contextualEscape {
+		if err := escapeTree(elems); err != nil {
+			pos := p.last.position()
+			if err.offset >= 0 {
+				pos = p.starts[err.offset]
+			}
+			return &ParseError{Position: pos, Msg: err.msg}
+		}
+	}
+	t.elems = elems
+	t.starts = p.starts
+	t.consts = nil
+	if len(p.consts) > 0 {
+		t.consts = p.consts
+	}
+	return nil
 }
 
-// ParseBytes is a helper function that uses a byte array as input.
-func (t *Template) ParseBytes(b []byte) error {
-	return t.Parse(bytes.NewReader(b))
+// execute renders t as the outermost template of a render.
+func (t *Template) execute(w *writer, context []interface{}) error {
+	if t.captureSections {
+		w.state.captures = make(map[string]interface{})
+		context = append(context[:len(context):len(context)], w.state.captures)
+	}
+	return t.tag(t.render(w, context...))
 }
 
 func (t *Template) render(w *writer, context ...interface{}) error {
+	if t.consts != nil {
+		// Constants are looked up last, so the data given to the template
+		// takes precedence.
+		context = append(context[:len(context):len(context)], t.consts)
+	}
+	var errs ErrorSlice
 	for _, elem := range t.elems {
+		if err := w.abort(); err != nil {
+			return err
+		}
 		err := elem.render(t, w, context...)
 		if err != nil {
+			if t.collectErrors {
+				errs = append(errs, flattenErrors(err)...)
+				continue
+			}
 			if !t.silentMiss {
 				return err
 			}
 		}
 	}
-	return w.flush()
+	if err := w.abort(); err != nil {
+		return err
+	}
+	if err := w.flush(); err != nil {
+		return err
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+// reportErrors reports whether errors found while rendering a section should
+// be returned to the caller rather than being ignored.
+func (t *Template) reportErrors() bool {
+	return !t.silentMiss || t.collectErrors
+}
+
+// flattenErrors returns the errors held by err, expanding any nested
+// ErrorSlice values into a single list.
+func flattenErrors(err error) ErrorSlice {
+	es, ok := err.(ErrorSlice)
+	if !ok {
+		return ErrorSlice{err}
+	}
+	var flat ErrorSlice
+	for _, e := range es {
+		flat = append(flat, flattenErrors(e)...)
+	}
+	return flat
 }
 
 // Render walks through the template's parse tree and writes the output to w
-// replacing the values found in context.
-func (t *Template) Render(w io.Writer, context ...interface{}) error {
-	return t.render(newWriter(w), context...)
+// replacing the values found in data.
+func (t *Template) Render(w io.Writer, data ...interface{}) error {
+	return t.run(context.Background(), w, data, nil)
+}
+
+// RenderContext is like Render, but stops rendering and returns ctx.Err() once
+// ctx is done. Cancellation is checked between the elements of the template
+// and between the iterations of sections. The ctx is also passed to customizer
+// functions registered with CustomizeFunctionCtx.
+func (t *Template) RenderContext(ctx context.Context, w io.Writer, data ...interface{}) error {
+	return t.run(ctx, w, data, nil)
+}
+
+// run renders t to w through the middleware of t. If setup is not nil, it
+// configures the writer of each render made by the middleware.
+func (t *Template) run(ctx context.Context, w io.Writer, data []interface{}, setup func(*writer)) error {
+	var render RenderFunc = func(ctx context.Context, w io.Writer, data ...interface{}) error {
+		tw := t.newWriter(w)
+		tw.state.ctx = ctx
+		if setup != nil {
+			setup(tw)
+		}
+		return t.execute(tw, data)
+	}
+	for i := len(t.middleware) - 1; i >= 0; i-- {
+		render = t.middleware[i](render)
+	}
+	return render(ctx, w, data...)
+}
+
+// newWriter returns a writer to w configured for rendering t.
+func (t *Template) newWriter(w io.Writer) *writer {
+	tw := newWriter(w)
+	tw.checkWrites()
+	if t.maxOutputBytes > 0 {
+		tw.setLimit(t.maxOutputBytes)
+	}
+	tw.state.partials = t.partials
+	tw.state.maxIterations = t.maxIterations
+	tw.state.maxDepth = t.maxDepth
+	if t.flushDepth > 0 {
+		tw.state.flushDepth = t.flushDepth
+		tw.state.flusher = flusherOf(w)
+	}
+	if t.memoize {
+		tw.state.memo = make(map[memoKey]memoValue)
+	}
+	return tw
 }
 
 // RenderString is a helper function that renders the template as a string.
@@ -565,9 +2469,73 @@ func (t *Template) RenderString(context ...interface{}) (string, error) {
 
 // RenderBytes is a helper function that renders the template as a byte slice.
 func (t *Template) RenderBytes(context ...interface{}) ([]byte, error) {
-	var b *bytes.Buffer
+	return t.AppendRender(nil, context...)
+}
+
+// AppendRender renders the template and appends the output to dst, returning
+// the extended slice. Rendering goes through a pooled buffer, so callers which
+// reuse dst avoid allocating per render.
+func (t *Template) AppendRender(dst []byte, context ...interface{}) ([]byte, error) {
+	b := bufferPool.Get().(*bytes.Buffer)
+	b.Reset()
 	err := t.Render(b, context...)
-	return b.Bytes(), err
+	dst = append(dst, b.Bytes()...)
+	// Very large buffers are left to the garbage collector rather than kept
+	// alive by the pool.
+	if b.Cap() <= maxPooledBuffer {
+		bufferPool.Put(b)
+	}
+	return dst, err
+}
+
+// RenderAtomic is like Render, but writes to w only once the whole template is
+// rendered without error. If rendering fails, nothing is written, so that an
+// HTTP handler can respond with an error page rather than with half of the
+// page. Errors collected with CollectErrors also prevent writing. The output
+// is buffered, so it is written to w with a single call to its Write method.
+func (t *Template) RenderAtomic(w io.Writer, context ...interface{}) error {
+	b := bufferPool.Get().(*bytes.Buffer)
+	b.Reset()
+	err := t.Render(b, context...)
+	if err == nil {
+		err = t.tag(writeAll(w, b.Bytes()))
+	}
+	if b.Cap() <= maxPooledBuffer {
+		bufferPool.Put(b)
+	}
+	return err
+}
+
+// bufferPool holds the buffers used by AppendRender and RenderAtomic.
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// maxPooledBuffer is the capacity above which buffers are not returned to
+// bufferPool.
+const maxPooledBuffer = 64 << 10
+
+// Must is a helper that wraps a call to a function returning (*Template, error)
+// and panics if the error is non-nil. It is intended for use in variable
+// initializations such as
+//
+//	var t = mustache.Must(mustache.ParseFiles("page.mustache"))
+func Must(t *Template, err error) *Template {
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// MustParseString is like ParseString but panics if the template can not be
+// parsed. It returns t, so that templates can be initialized in one line:
+//
+//	var t = mustache.New().MustParseString("Hello, {{subject}}!")
+func (t *Template) MustParseString(s string) *Template {
+	if err := t.ParseString(s); err != nil {
+		panic(err)
+	}
+	return t
 }
 
 // Parse wraps the creation of a new template and parsing from r in one go.
@@ -4,7 +4,16 @@ package mustache
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"testing"
 )
@@ -49,14 +58,14 @@ func TestParseTree(t *testing.T) {
 	template := New()
 	template.elems = []node{
 		textNode("Lorem ipsum dolor sit "),
-		&varNode{"foo", mustPath("foo"), noEscape},
+		&varNode{name: "foo", path: mustPath("foo"), escape: noEscape},
 		textNode(", "),
-		&sectionNode{"bar", mustPath("bar"), false, []node{
-			&varNode{"baz", mustPath("baz"), htmlEscape},
+		&sectionNode{name: "bar", path: mustPath("bar"), inverted: false, elems: []node{
+			&varNode{name: "baz", path: mustPath("baz"), escape: htmlEscape},
 			textNode(" adipiscing"),
 		}},
 		textNode(" elit. Proin commodo viverra elit "),
-		&varNode{"zer", mustPath("zer"), noEscape},
+		&varNode{name: "zer", path: mustPath("zer"), escape: noEscape},
 		textNode("."),
 	}
 	data := map[string]interface{}{
@@ -228,6 +237,329 @@ func TestCustomFunctionsWithOptions(t *testing.T) {
 	}
 }
 
+func TestCustomFunctionsStream(t *testing.T) {
+	upper := CustomizeFunctionStream("upper", func(w io.Writer, r io.Reader, opts map[string]string) error {
+		if _, err := io.WriteString(w, opts["prefix"]); err != nil {
+			return err
+		}
+		b := make([]byte, 3)
+		for {
+			n, err := r.Read(b)
+			if _, werr := w.Write(bytes.ToUpper(b[:n])); werr != nil {
+				return werr
+			}
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+	// head writes the first byte of the section and stops reading.
+	head := CustomizeFunctionStream("head", func(w io.Writer, r io.Reader, opts map[string]string) error {
+		_, err := io.CopyN(w, r, 1)
+		return err
+	})
+	failure := errors.New("failed")
+	fail := CustomizeFunctionStream("fail", func(w io.Writer, r io.Reader, opts map[string]string) error {
+		return failure
+	})
+	for _, test := range []struct {
+		template string
+		expected string
+		err      error
+	}{
+		{`a {{~upper prefix="> "}}{{#items}}{{.}} {{/items}}{{/upper}}b`, "a > X Y Z b", nil},
+		{"{{~upper}}\n  \nline\n{{/upper}}", "  \nLINE\n", nil},
+		{`{{~head}}{{#items}}{{.}}{{/items}}{{/head}}!`, "x!", nil},
+		{`{{~fail}}{{#items}}{{.}}{{/items}}{{/fail}}`, "", nil},
+	} {
+		template := New(upper, head, fail)
+		if err := template.ParseString(test.template); err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(map[string]interface{}{"items": []string{"x", "y", "z"}})
+		if err != test.err {
+			t.Errorf("%q: unexpected error %v", test.template, err)
+		}
+		if output != test.expected {
+			t.Errorf("%q: expected %q got %q", test.template, test.expected, output)
+		}
+	}
+
+	template := New(fail, SilentMiss(false))
+	if err := template.ParseString(`{{~fail}}x{{/fail}}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := template.RenderString(nil); !errors.Is(err, failure) {
+		t.Errorf("expected the error of the function, got %v", err)
+	}
+	template = New(upper, MaxIterations(2))
+	if err := template.ParseString(`{{~upper}}{{#items}}{{.}}{{/items}}{{/upper}}`); err != nil {
+		t.Fatal(err)
+	}
+	var limit *IterationLimitError
+	if _, err := template.RenderString(map[string]interface{}{"items": []int{1, 2, 3}}); !errors.As(err, &limit) {
+		t.Errorf("expected an *IterationLimitError, got %v", err)
+	}
+}
+
+func TestCustomFunctionsWithArgs(t *testing.T) {
+	join := CustomizeFunctionWithArgs("join", func(s string, args []string, opts map[string]string) (string, error) {
+		return strings.Join(append(strings.Fields(s), args[1:]...), args[0]) + opts["end"], nil
+	})
+	for _, test := range []struct {
+		template string
+		expected string
+	}{
+		{`{{~join ", "}}a b c{{/join}}`, "a, b, c"},
+		{`{{~join "-" x "y z" end="!"}}a b{{/join}}`, "a-b-x-y z!"},
+		{`{{~join end="." | "\"}}"}}a b{{/join}}`, `a|b|"}}.`},
+	} {
+		template := New(join)
+		if err := template.ParseString(test.template); err != nil {
+			t.Errorf("%q: %v", test.template, err)
+			continue
+		}
+		output, err := template.RenderString(nil)
+		if err != nil {
+			t.Errorf("%q: %v", test.template, err)
+		}
+		if output != test.expected {
+			t.Errorf("%q: expected %q got %q", test.template, test.expected, output)
+		}
+	}
+}
+
+func TestFilterPipes(t *testing.T) {
+	options := []Option{
+		FilterPipes(),
+		CustomizeFunction("trim", func(s string) (string, error) {
+			return strings.TrimSpace(s), nil
+		}),
+		CustomizeFunction("upper", func(s string) (string, error) {
+			return strings.ToUpper(s), nil
+		}),
+		CustomizeFunctionWithArgs("truncate", func(s string, args []string, _ map[string]string) (string, error) {
+			n, err := strconv.Atoi(args[0])
+			if err != nil {
+				return "", err
+			}
+			if len(s) > n {
+				s = s[:n] + strings.Join(args[1:], "")
+			}
+			return s, nil
+		}),
+	}
+	for _, test := range []struct {
+		template string
+		expected string
+		err      bool
+	}{
+		{template: "{{name | trim | upper}}", expected: "&lt;ANN&gt;"},
+		{template: "{{{name|trim}}}", expected: "<ann>"},
+		{template: "{{&name | upper | trim}}", expected: "<ANN>"},
+		{template: `{{title | truncate 5 "..."}}`, expected: "Hello..."},
+		{template: `{{title | truncate 5 " | "}}`, expected: "Hello | "},
+		{template: "{{count | truncate 1}}", expected: "4"},
+		{template: `{{map."a|b" | upper}}`, expected: "OK"},
+		{template: "{{title | truncate x}}", expected: "", err: true},
+	} {
+		template := New(append(options, SilentMiss(false))...)
+		if err := template.ParseString(test.template); err != nil {
+			t.Errorf("%q: %v", test.template, err)
+			continue
+		}
+		context := map[string]interface{}{
+			"name":  " <ann> ",
+			"title": "Hello, world",
+			"count": 42,
+			"map":   map[string]string{"a|b": "ok"},
+		}
+		output, err := template.RenderString(context)
+		if test.err {
+			var cerr *CustomizerError
+			if !errors.As(err, &cerr) {
+				t.Errorf("%q: expected a *CustomizerError got %v", test.template, err)
+			}
+		} else if err != nil {
+			t.Errorf("%q: %v", test.template, err)
+		}
+		if output != test.expected {
+			t.Errorf("%q: expected %q got %q", test.template, test.expected, output)
+		}
+	}
+
+	template := New(options...)
+	if err := template.ParseString("{{a | }}"); err == nil {
+		t.Error("expected an error for an empty filter")
+	}
+	if err := template.ParseString("{{a | unknown}}"); err == nil || !strings.Contains(err.Error(), `unknown filter "unknown"`) {
+		t.Errorf("expected an error for an unknown filter, got %v", err)
+	}
+	// Without FilterPipes, the pipe is part of the name.
+	template = New()
+	if err := template.ParseString("{{a | upper}}"); err != nil {
+		t.Fatal(err)
+	}
+	output, _ := template.RenderString(map[string]string{"a | upper": "x"})
+	if output != "x" {
+		t.Errorf("expected %q got %q", "x", output)
+	}
+}
+
+// messages is a Translator formatting messages with their arguments sorted by
+// name, in the language found in the render context, if any.
+type messages map[string]string
+
+type languageKey struct{}
+
+func (m messages) T(key string, args map[string]interface{}) string {
+	return m.TContext(context.Background(), key, args)
+}
+
+func (m messages) TContext(ctx context.Context, key string, args map[string]interface{}) string {
+	if lang, ok := ctx.Value(languageKey{}).(string); ok {
+		key = lang + "." + key
+	}
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msg := m[key]
+	for _, name := range names {
+		msg += fmt.Sprintf(" %s=%v", name, args[name])
+	}
+	return msg
+}
+
+func TestTranslate(t *testing.T) {
+	tr := messages{"greeting": "Hello", "fr.greeting": "Bonjour", "html": "<b>"}
+	for _, test := range []struct {
+		template string
+		expected string
+	}{
+		{`{{_ "greeting"}}!`, "Hello!"},
+		{`{{_ "greeting" name=user.name n=count label="x y"}}`, "Hello label=x y n=2 name=Ann"},
+		{`{{_ "greeting" name=missing}}`, "Hello name=&lt;nil&gt;"},
+		{`{{_ "html"}} {{{_ "html"}}} {{&_ "html"}}`, "&lt;b&gt; <b> <b>"},
+		{`{{#items}}{{_ "greeting" item=.}}{{/items}}`, "Hello item=1Hello item=2"},
+	} {
+		template := New(Translate(tr))
+		if err := template.ParseString(test.template); err != nil {
+			t.Errorf("%q: %v", test.template, err)
+			continue
+		}
+		output, err := template.RenderString(map[string]interface{}{
+			"user":  map[string]string{"name": "Ann"},
+			"count": 2,
+			"items": []int{1, 2},
+		})
+		if err != nil {
+			t.Errorf("%q: %v", test.template, err)
+		}
+		if output != test.expected {
+			t.Errorf("%q: expected %q got %q", test.template, test.expected, output)
+		}
+	}
+
+	template := New(Translate(tr))
+	if err := template.ParseString(`{{_ "greeting"}}`); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	ctx := context.WithValue(context.Background(), languageKey{}, "fr")
+	if err := template.RenderContext(ctx, &b, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "Bonjour" {
+		t.Errorf("expected the message in the language of the context, got %q", b.String())
+	}
+
+	for _, source := range []string{`{{_ greeting}}`, `{{_ "greeting"x}}`, `{{_ "greeting" name}}`} {
+		if err := New(Translate(tr)).ParseString(source); err == nil {
+			t.Errorf("%q: expected a parse error", source)
+		}
+	}
+	// Without a translator, _ is an ordinary name.
+	template = New()
+	if err := template.ParseString(`{{_ "greeting"}}`); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSafe(t *testing.T) {
+	context := map[string]interface{}{
+		"safe":   Safe(`<b>"x"</b>`),
+		"html":   template.HTML(`<b>"x"</b>`),
+		"string": `<b>"x"</b>`,
+	}
+	for _, test := range []struct {
+		options  []Option
+		template string
+		expected string
+	}{
+		{nil, "{{safe}} {{{safe}}}", `<b>"x"</b> <b>"x"</b>`},
+		{nil, "{{html}}|{{string}}", `<b>"x"</b>|&lt;b&gt;&quot;x&quot;&lt;/b&gt;`},
+		{nil, "{{coalesce missing safe}}", `<b>"x"</b>`},
+		{nil, "{{#safe}}{{.}}{{/safe}}", `<b>"x"</b>`},
+		{nil, "{{safe | upper}}", `<B>"X"</B>`},
+		{nil, "{{html | upper}}", `<B>"X"</B>`},
+		{[]Option{JsonEscape()}, "{{safe}}|{{html}}", `<b>"x"</b>|<b>\"x\"</b>`},
+	} {
+		options := append(test.options, CoalesceTags(), FilterPipes(), CustomizeFunction("upper", func(s string) (string, error) {
+			return strings.ToUpper(s), nil
+		}))
+		tmpl := New(options...)
+		if err := tmpl.ParseString(test.template); err != nil {
+			t.Errorf("%q: %v", test.template, err)
+			continue
+		}
+		output, err := tmpl.RenderString(context)
+		if err != nil {
+			t.Errorf("%q: %v", test.template, err)
+		}
+		if output != test.expected {
+			t.Errorf("%q: expected %q got %q", test.template, test.expected, output)
+		}
+	}
+}
+
+func TestQuotedArguments(t *testing.T) {
+	wrap := CustomizeFunctionWithOptions("wrap", func(s string, opts map[string]string) (string, error) {
+		return opts["prefix"] + s + opts["suffix"], nil
+	})
+	for _, test := range []struct {
+		template string
+		expected string
+	}{
+		{`{{~wrap suffix="}}"}}x{{/wrap}}`, "x}}"},
+		{`{{~wrap prefix="{{" suffix="\"}}\""}}{{name}}{{/wrap}}`, `{{n"}}"`},
+		{`{{~wrap prefix="\\" suffix="\d"}}x{{/wrap}}`, `\x\d`},
+		{`{{~wrap prefix="<{{name}}|{{x.a}}{{missing}}|" suffix="{{name}}>"}}x{{/wrap}}`, "<n||xn>"},
+		{`{{coalesce missing "}}"}}`, "}}"},
+		{`{{#let x="{{a}}"}}{{x}}{{/let}}`, "{{a}}"},
+		{`{{#switch name}}{{#case "}}"}}1{{/case}}{{#default}}2{{/default}}{{/switch}}`, "2"},
+		{`{{x."a}b"}}`, "ok"},
+	} {
+		template := New(wrap, CoalesceTags(), LetSections(), SwitchSections(), NoEscape())
+		if err := template.ParseString(test.template); err != nil {
+			t.Errorf("%q: %v", test.template, err)
+			continue
+		}
+		context := map[string]interface{}{"name": "n", "x": map[string]string{"a}b": "ok"}}
+		output, err := template.RenderString(context)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expected {
+			t.Errorf("%q: expected %q got %q", test.template, test.expected, output)
+		}
+	}
+}
+
 type templateTest struct {
 	template string
 	payload  interface{}
@@ -282,6 +614,101 @@ func TestSectionTestValue(t *testing.T) {
 
 }
 
+func TestPostProcessPartials(t *testing.T) {
+	header := New(Name("header"))
+	if err := header.ParseString("<h1>{{title}}</h1>\n"); err != nil {
+		t.Fatal(err)
+	}
+	sizes := map[string]int{}
+	template := New(
+		Partial(header),
+		PostProcessPartials(func(name string, output []byte) ([]byte, error) {
+			sizes[name] = len(output)
+			return output, nil
+		}),
+		PostProcessPartials(func(name string, output []byte) ([]byte, error) {
+			return []byte("<x-" + name + ">" + string(output) + "</x-" + name + ">"), nil
+		}),
+	)
+	if err := template.ParseString("{{>header}}\nbody"); err != nil {
+		t.Fatal(err)
+	}
+	output, err := template.RenderString(map[string]string{"title": "Hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "<x-header><h1>Hi</h1>\n</x-header>\nbody"; output != expected {
+		t.Errorf("expected %q got %q", expected, output)
+	}
+	if sizes["header"] != 12 {
+		t.Errorf("unexpected sizes %v", sizes)
+	}
+
+	failure := errors.New("failed")
+	template.Option(PostProcessPartials(func(name string, output []byte) ([]byte, error) {
+		return nil, failure
+	}))
+	var e *PartialFuncError
+	if _, err := template.RenderString(nil); !errors.As(err, &e) || e.Name != "header" || !errors.Is(err, failure) {
+		t.Errorf("expected a *PartialFuncError, got %v", err)
+	}
+}
+
+func TestUse(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next RenderFunc) RenderFunc {
+			return func(ctx context.Context, w io.Writer, data ...interface{}) error {
+				calls = append(calls, name)
+				return next(ctx, w, data...)
+			}
+		}
+	}
+	// fallback renders again with fallback data if the render fails.
+	fallback := func(next RenderFunc) RenderFunc {
+		return func(ctx context.Context, w io.Writer, data ...interface{}) error {
+			var b bytes.Buffer
+			if err := next(ctx, &b, data...); err != nil {
+				b.Reset()
+				if err := next(ctx, &b, map[string]string{"name": "stranger"}); err != nil {
+					return err
+				}
+			}
+			_, err := w.Write(b.Bytes())
+			return err
+		}
+	}
+	template := New(SilentMiss(false), Use(trace("outer"), fallback), Use(trace("inner")))
+	if err := template.ParseString("Hello {{name}}"); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		data     interface{}
+		expected string
+		calls    []string
+	}{
+		{map[string]string{"name": "Ann"}, "Hello Ann", []string{"outer", "inner"}},
+		{nil, "Hello stranger", []string{"outer", "inner", "inner"}},
+	} {
+		calls = nil
+		output, err := template.RenderString(test.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != test.expected {
+			t.Errorf("expected %q got %q", test.expected, output)
+		}
+		if !reflect.DeepEqual(calls, test.calls) {
+			t.Errorf("expected calls %q got %q", test.calls, calls)
+		}
+	}
+
+	res, err := template.RenderResult(nil)
+	if err != nil || string(res.Output) != "Hello stranger" {
+		t.Errorf("unexpected result %q, %v", res.Output, err)
+	}
+}
+
 func TestPartialsCannotCycle(t *testing.T) {
 	innerTemplate := New(Name("inner"))
 	err := innerTemplate.Parse(strings.NewReader(`I am the inner.{{>outer}}`))
@@ -412,3 +839,1018 @@ func TestRenderJSONBodyWithQuotedKeys(t *testing.T) {
 		t.Errorf("got %q want %q", got, want)
 	}
 }
+
+func TestTypeTestSections(t *testing.T) {
+	tests := []templateTest{
+		{
+			`{{#is_list tags}}{{#tags}}[{{.}}]{{/tags}}{{/is_list}}{{#is_string tags}}({{tags}}){{/is_string}}`,
+			map[string]interface{}{"tags": []string{"a", "b"}},
+			`[a][b]`,
+		},
+		{
+			`{{#is_list tags}}{{#tags}}[{{.}}]{{/tags}}{{/is_list}}{{#is_string tags}}({{tags}}){{/is_string}}`,
+			map[string]interface{}{"tags": "a"},
+			`(a)`,
+		},
+		{ // falsy values still match their type
+			`{{#is_string s}}string{{/is_string}} {{#is_number n}}number{{/is_number}} {{#is_bool b}}bool{{/is_bool}}`,
+			map[string]interface{}{"s": "", "n": 0, "b": false},
+			`string number bool`,
+		},
+		{ // inverted and missing values
+			`{{^is_map m}}not a map{{/is_map}}{{#is_map m}}map{{/is_map}}`,
+			map[string]interface{}{},
+			`not a map`,
+		},
+		{
+			`{{#is_map m}}{{m.k}}{{/is_map}}`,
+			map[string]interface{}{"m": map[string]string{"k": "v"}},
+			`v`,
+		},
+	}
+	for _, test := range tests {
+		template := New(TypeTestSections())
+		err := template.ParseString(test.template)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		output, err := template.RenderString(test.payload)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expect {
+			t.Errorf("expected %q got %q", test.expect, output)
+		}
+	}
+}
+
+func TestOnMiss(t *testing.T) {
+	type miss struct {
+		name      string
+		line, col int
+	}
+	var misses []miss
+	template := New(SilentMiss(false), OnMiss(func(name string, line, col int) (interface{}, bool) {
+		misses = append(misses, miss{name, line, col})
+		if name == "greeting" {
+			return "Hello", true
+		}
+		return nil, false
+	}))
+	err := template.ParseString("{{greeting}}, {{name}}!\n{{missing}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := template.RenderString(map[string]string{"name": "world"})
+	if err == nil || !strings.Contains(err.Error(), "failed to lookup missing") {
+		t.Errorf("expected miss error, got %v", err)
+	}
+	expected := "Hello, world!\n"
+	if output != expected {
+		t.Errorf("expected %q got %q", expected, output)
+	}
+	expectedMisses := []miss{{"greeting", 1, 0}, {"missing", 2, 0}}
+	if !reflect.DeepEqual(misses, expectedMisses) {
+		t.Errorf("expected misses %v got %v", expectedMisses, misses)
+	}
+}
+
+func TestSwitchSections(t *testing.T) {
+	input := "{{#switch status}}\n" +
+		"  {{#case \"firing\"}}Alert {{name}} is firing{{/case}}\n" +
+		"  {{#case resolved}}Alert {{name}} resolved{{/case}}\n" +
+		"  {{#default}}Alert {{name}} is {{status}}{{/default}}\n" +
+		"{{/switch}}"
+	tests := []templateTest{
+		{input, map[string]string{"name": "cpu", "status": "firing"}, "Alert cpu is firing"},
+		{input, map[string]string{"name": "cpu", "status": "resolved"}, "Alert cpu resolved"},
+		{input, map[string]string{"name": "cpu", "status": "muted"}, "Alert cpu is muted"},
+		{`{{#switch n}}{{#case "1"}}one{{/case}}{{/switch}}`, map[string]int{"n": 1}, "one"},
+		{`{{#switch n}}{{#case "1"}}one{{/case}}{{/switch}}`, map[string]int{"n": 2}, ""},
+		{`{{#default}}D{{/default}}1`, map[string]bool{"default": true}, "D1"},
+		{`{{#switch n}}{{#case "1"}}{{#default}}D{{/default}}{{/case}}{{/switch}}`, map[string]interface{}{"n": 1, "default": true}, "D"},
+	}
+	for _, test := range tests {
+		template := New(SwitchSections())
+		err := template.ParseString(test.template)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		output, err := template.RenderString(test.payload)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expect {
+			t.Errorf("expected %q got %q", test.expect, output)
+		}
+	}
+
+	// Default sections outside a switch are ordinary sections, which may be
+	// encoded.
+	template := New(SwitchSections())
+	if err := template.ParseString(`{{#default}}D{{/default}}`); err != nil {
+		t.Fatal(err)
+	}
+	if source := template.Source(); source != `{{#default}}D{{/default}}` {
+		t.Errorf("unexpected source %q", source)
+	}
+	if _, err := template.MarshalJSON(); err != nil {
+		t.Error(err)
+	}
+
+	for _, input := range []string{
+		`{{#switch a}}text{{/switch}}`,
+		`{{#switch a}}{{#case "x"}}{{/case}}{{#case "x"}}{{/case}}{{/switch}}`,
+		`{{#switch a}}{{b}}{{/switch}}`,
+		`{{#case "a"}}A{{/case}}`,
+		`{{#switch a}}{{#case "a"}}{{#case "b"}}{{/case}}{{/case}}{{/switch}}`,
+	} {
+		template := New(SwitchSections())
+		if err := template.ParseString(input); err == nil {
+			t.Errorf("expected parse error for %q", input)
+		}
+	}
+}
+
+func TestKeepMissingTags(t *testing.T) {
+	for _, test := range []struct {
+		template string
+		options  []Option
+		expect   string
+	}{
+		{"{{a}} {{b}} {{{c}}} {{&d}} {{ e }}", []Option{KeepMissingTags()}, "A {{b}} {{{c}}} {{&d}} {{e}}"},
+		{"{{=<% %>=}}<%a%> <%b%> <%&c%>", []Option{KeepMissingTags()}, "A <%b%> <%&c%>"},
+		{"{{a}} {{b}}", []Option{MissingPlaceholder("?")}, "A ?"},
+		{"{{a}} {{b}}", []Option{KeepMissingTags(), SilentMiss(false)}, "A {{b}}"},
+	} {
+		template := New(test.options...)
+		err := template.ParseString(test.template)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		output, err := template.RenderString(map[string]string{"a": "A"})
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expect {
+			t.Errorf("expected %q got %q", test.expect, output)
+		}
+	}
+}
+
+func TestMissError(t *testing.T) {
+	template := New(Name("greeting"), SilentMiss(false))
+	err := template.ParseString("Hello,\n  {{#user}}{{ first }}{{/user}}!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = template.RenderString(map[string]interface{}{"user": map[string]string{"last": "Doe"}})
+	errs, ok := err.(ErrorSlice)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("expected a single error, got %v", err)
+	}
+	missErr, ok := errs[0].(*MissError)
+	if !ok {
+		t.Fatalf("expected *MissError, got %T", errs[0])
+	}
+	expected := MissError{Name: "first", Line: 2, Col: 11, Template: "greeting"}
+	if *missErr != expected {
+		t.Errorf("expected %+v got %+v", expected, *missErr)
+	}
+	if msg := "greeting:2:11 failed to lookup first"; missErr.Error() != msg {
+		t.Errorf("expected %q got %q", msg, missErr.Error())
+	}
+}
+
+func TestCountSections(t *testing.T) {
+	input := `{{#min_count items 3}}many{{/min_count}}{{^min_count items 3}}{{#items}}{{.}}{{/items}}{{/min_count}}`
+	tests := []templateTest{
+		{input, map[string]interface{}{"items": []string{"a", "b"}}, "ab"},
+		{input, map[string]interface{}{"items": []string{"a", "b", "c"}}, "many"},
+		{input, map[string]interface{}{}, ""},
+		{`{{#max_count m 1}}small{{/max_count}}`, map[string]interface{}{"m": map[string]int{"a": 1}}, "small"},
+		{`{{#max_count m 1}}small{{/max_count}}`, map[string]interface{}{"m": map[string]int{"a": 1, "b": 2}}, ""},
+		{`{{#min_count m 0}}always{{/min_count}}`, nil, "always"},
+	}
+	for _, test := range tests {
+		template := New(CountSections())
+		err := template.ParseString(test.template)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		output, err := template.RenderString(test.payload)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expect {
+			t.Errorf("expected %q got %q", test.expect, output)
+		}
+	}
+
+	for _, input := range []string{
+		`{{#min_count items}}{{/min_count}}`,
+		`{{#min_count items x}}{{/min_count}}`,
+		`{{#min_count items -1}}{{/min_count}}`,
+	} {
+		template := New(CountSections())
+		if err := template.ParseString(input); err == nil {
+			t.Errorf("expected parse error for %q", input)
+		}
+	}
+}
+
+func TestPaginateSections(t *testing.T) {
+	data := map[string]interface{}{"items": []string{"a", "b", "c", "d", "e"}}
+	for _, test := range []templateTest{
+		{`{{#items limit="2"}}{{.}}{{/items}}`, data, "ab"},
+		{`{{#items offset="3"}}{{.}}{{/items}}`, data, "de"},
+		{`{{#items offset="1" limit="2"}}{{.}}({{@more}}/{{@total}}){{/items}}`, data, "b(2/5)c(2/5)"},
+		{`{{#items offset="9"}}{{.}}{{/items}}`, data, ""},
+		{`{{#items}}{{.}}{{/items}}`, data, "abcde"},
+		{`{{#items limit="2"}}{{.}}{{/items}}`, map[string]interface{}{"items": "x"}, "x"},
+	} {
+		template := New(PaginateSections())
+		err := template.ParseString(test.template)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		output, err := template.RenderString(test.payload)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expect {
+			t.Errorf("expected %q got %q", test.expect, output)
+		}
+	}
+
+	template := New(PaginateSections())
+	if err := template.ParseString(`{{#items limit="0"}}{{/items}}`); err == nil {
+		t.Error("expected parse error for a zero limit")
+	}
+}
+
+func TestMapSections(t *testing.T) {
+	type person struct{ Name string }
+	data := map[string]interface{}{
+		"env":    map[string]string{"PATH": "/bin", "HOME": "/root", "LANG": "C"},
+		"people": map[string]person{"b": {"Bob"}, "a": {"Ann"}},
+		"codes":  map[int]string{10: "ten", 2: "two", -1: "minus one"},
+		"empty":  map[string]int{},
+	}
+	for _, test := range []templateTest{
+		{`{{#env}}{{@key}}={{@value}};{{/env}}`, data, "HOME=/root;LANG=C;PATH=/bin;"},
+		{`{{#people}}{{@key}}:{{Name}} {{/people}}`, data, "a:Ann b:Bob "},
+		{`{{#codes}}{{@key}}={{.}} {{/codes}}`, data, "-1=minus one 2=two 10=ten "},
+		{`{{#env}}{{@index}}{{@key}}{{^@last}},{{/@last}}{{/env}}`, data, "0HOME,1LANG,2PATH"},
+		{`[{{#empty}}{{@key}}{{/empty}}]`, data, "[]"},
+	} {
+		template := New(MapSections(), LoopVariables())
+		err := template.ParseString(test.template)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		output, err := template.RenderString(test.payload)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expect {
+			t.Errorf("expected %q got %q", test.expect, output)
+		}
+	}
+
+	template := New()
+	if err := template.ParseString(`{{#env}}{{PATH}}{{@key}}{{/env}}`); err != nil {
+		t.Fatal(err)
+	}
+	if output, _ := template.RenderString(data); output != "/bin" {
+		t.Errorf("expected the map as the context without the option, got %q", output)
+	}
+}
+
+func TestLoopVariables(t *testing.T) {
+	data := map[string]interface{}{
+		"items":  []string{"a", "b", "c", "d"},
+		"matrix": [][]int{{1, 2}, {3}},
+		"user":   map[string]interface{}{"name": "Ann"},
+	}
+	for _, test := range []templateTest{
+		{`{{#items}}{{@index}}:{{.}}{{^@last}}, {{/@last}}{{/items}}`, data, "0:a, 1:b, 2:c, 3:d"},
+		{`{{#items}}{{#@first}}[{{/@first}}{{.}}{{#@last}}]/{{@length}}{{/@last}}{{/items}}`, data, "[abcd]/4"},
+		{`{{#items offset="1" limit="2"}}{{@index}}{{@first}}{{@last}}{{@length}}{{@total}} {{/items}}`, data, "1truefalse24 2falsetrue24 "},
+		{`{{#matrix}}{{#.}}{{@index}}{{/.}}/{{@index}} {{/matrix}}`, data, "01/0 0/1 "},
+		{`{{#items}}{{#user}}{{name}}{{@index}}{{/user}}{{/items}}`, data, "Ann0Ann1Ann2Ann3"},
+		{`{{#user}}{{name}}{{@index}}{{/user}}`, data, "Ann"},
+	} {
+		template := New(LoopVariables(), PaginateSections())
+		err := template.ParseString(test.template)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		output, err := template.RenderString(test.payload)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expect {
+			t.Errorf("expected %q got %q", test.expect, output)
+		}
+	}
+
+	template := New()
+	if err := template.ParseString(`{{#items}}{{.}}{{@index}}{{/items}}`); err != nil {
+		t.Fatal(err)
+	}
+	if output, _ := template.RenderString(data); output != "abcd" {
+		t.Errorf("expected no loop variables without the option, got %q", output)
+	}
+}
+
+func TestChunkSections(t *testing.T) {
+	items := []map[string]string{{"name": "a"}, {"name": "b"}, {"name": "c"}, {"name": "d"}}
+	for _, test := range []templateTest{
+		{
+			`{{#chunk items 3}}<tr>{{#.}}<td>{{name}}</td>{{/.}}</tr>{{/chunk}}`,
+			map[string]interface{}{"items": items},
+			`<tr><td>a</td><td>b</td><td>c</td></tr><tr><td>d</td></tr>`,
+		},
+		{
+			`{{#chunk items 2}}[{{#.}}{{name}}{{/.}}]{{/chunk}}`,
+			map[string]interface{}{"items": items},
+			`[ab][cd]`,
+		},
+		{
+			`{{#chunk items 2}}[{{#.}}{{.}}{{/.}}]{{/chunk}}`,
+			map[string]interface{}{"items": "x"},
+			`[x]`,
+		},
+		{
+			`{{#chunk items 2}}[{{#.}}{{.}}{{/.}}]{{/chunk}}`,
+			map[string]interface{}{"items": []int{}},
+			``,
+		},
+	} {
+		template := New(ChunkSections())
+		err := template.ParseString(test.template)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		output, err := template.RenderString(test.payload)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expect {
+			t.Errorf("expected %q got %q", test.expect, output)
+		}
+	}
+
+	template := New(ChunkSections())
+	if err := template.ParseString(`{{#chunk items 0}}{{/chunk}}`); err == nil {
+		t.Error("expected parse error for a zero chunk size")
+	}
+}
+
+func TestZipSections(t *testing.T) {
+	data := map[string]interface{}{
+		"labels": []string{"cpu", "mem", "disk"},
+		"values": []float64{0.5, 0.25},
+	}
+	for _, test := range []templateTest{
+		{`{{#zip labels values}}{{@a}}={{@b}};{{/zip}}`, data, "cpu=0.5;mem=0.25;"},
+		{`{{#zip labels values as="label value"}}{{@label}}={{@value}};{{/zip}}`, data, "cpu=0.5;mem=0.25;"},
+		{`{{#zip labels missing}}{{@a}}{{/zip}}`, data, ""},
+	} {
+		template := New(ZipSections())
+		err := template.ParseString(test.template)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		output, err := template.RenderString(test.payload)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expect {
+			t.Errorf("expected %q got %q", test.expect, output)
+		}
+	}
+
+	for _, input := range []string{
+		`{{#zip labels}}{{/zip}}`,
+		`{{#zip a b as="x"}}{{/zip}}`,
+	} {
+		template := New(ZipSections())
+		if err := template.ParseString(input); err == nil {
+			t.Errorf("expected parse error for %q", input)
+		}
+	}
+}
+
+func TestConstants(t *testing.T) {
+	for _, test := range []templateTest{
+		{
+			"{{=const support \"https://example.com/help\"}}\nVisit {{support}}.\n",
+			nil,
+			"Visit https://example.com/help.\n",
+		},
+		{
+			`{{=const product "Acme \"Pro\""}}{{#items}}{{product}} {{.}}; {{/items}}`,
+			map[string]interface{}{"items": []string{"a", "b"}},
+			"Acme &quot;Pro&quot; a; Acme &quot;Pro&quot; b; ",
+		},
+		{
+			`{{#show}}{{=const name "const"}}{{/show}}{{name}}`,
+			map[string]interface{}{"show": false},
+			"const",
+		},
+		{
+			`{{=const name "const"}}{{name}}`,
+			map[string]interface{}{"name": "data"},
+			"data",
+		},
+		{
+			`{{=<% %>=}}<%=const name "x"%><%name%>`,
+			nil,
+			"x",
+		},
+	} {
+		template := New()
+		if err := template.ParseString(test.template); err != nil {
+			t.Error(err)
+			continue
+		}
+		output, err := template.RenderString(test.payload)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expect {
+			t.Errorf("expected %q got %q", test.expect, output)
+		}
+	}
+
+	for _, input := range []string{
+		`{{=const name}}`,
+		`{{=const name value}}`,
+		`{{=const name "a"}}{{=const name "b"}}`,
+	} {
+		if err := New().ParseString(input); err == nil {
+			t.Errorf("expected parse error for %q", input)
+		}
+	}
+}
+
+// letCounter counts the calls of its Total method.
+type letCounter struct{ calls *int }
+
+func (c letCounter) Total() int {
+	*c.calls++
+	return 42
+}
+
+func TestLetSections(t *testing.T) {
+	data := map[string]interface{}{
+		"order": map[string]interface{}{
+			"summary": map[string]interface{}{"grand total": 99.5},
+		},
+		"items": []string{"a", "b"},
+	}
+	for _, test := range []templateTest{
+		{`{{#let total=order.summary."grand total"}}{{total}}/{{total}}{{/let}}`, data, "99.5/99.5"},
+		{`{{#let cur="EUR" total=order.summary."grand total"}}{{#items}}{{.}}:{{total}} {{cur}};{{/items}}{{/let}}`, data, "a:99.5 EUR;b:99.5 EUR;"},
+		{`{{#let s=order.summary g=s."grand total"}}{{g}}{{/let}}`, data, "99.5"},
+		{`{{#let x=missing}}[{{x}}]{{/let}}`, data, "[]"},
+		{`{{#let items="shadowed"}}{{items}}{{/let}}{{#items}}{{.}}{{/items}}`, data, "shadowedab"},
+	} {
+		template := New(LetSections())
+		if err := template.ParseString(test.template); err != nil {
+			t.Error(err)
+			continue
+		}
+		output, err := template.RenderString(test.payload)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expect {
+			t.Errorf("expected %q got %q", test.expect, output)
+		}
+	}
+
+	counter := letCounter{calls: new(int)}
+	template := New(LetSections())
+	if err := template.ParseString(`{{#let t=c.Total}}{{#items}}{{t}} {{/items}}{{/let}}`); err != nil {
+		t.Fatal(err)
+	}
+	output, err := template.RenderString(map[string]interface{}{"c": counter, "items": []int{1, 2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "42 42 42 " || *counter.calls != 1 {
+		t.Errorf("expected one call rendering %q, got %d calls rendering %q", "42 42 42 ", *counter.calls, output)
+	}
+
+	for _, input := range []string{
+		`{{#let x}}{{/let}}`,
+		`{{#let x="a}}{{/let}}`,
+		`{{#let x=a."b}}{{/let}}`,
+	} {
+		if err := New(LetSections()).ParseString(input); err == nil {
+			t.Errorf("expected parse error for %q", input)
+		}
+	}
+}
+
+func TestLetFilters(t *testing.T) {
+	options := []Option{
+		LetSections(),
+		FilterPipes(),
+		CustomizeFunction("upper", func(s string) (string, error) {
+			return strings.ToUpper(s), nil
+		}),
+		CustomizeFunctionWithArgs("truncate", func(s string, args []string, _ map[string]string) (string, error) {
+			n, err := strconv.Atoi(args[0])
+			if err != nil {
+				return "", err
+			}
+			if len(s) > n {
+				s = s[:n] + strings.Join(args[1:], "")
+			}
+			return s, nil
+		}),
+	}
+	data := map[string]interface{}{"total": "<eur> 99", "title": "Hello, world"}
+	for _, test := range []templateTest{
+		{`{{#let t=total | upper}}{{t}} {{{t}}}{{/let}}`, data, "&lt;EUR&gt; 99 <EUR> 99"},
+		{`{{#let t=total|upper}}{{t}}{{/let}}`, data, "&lt;EUR&gt; 99"},
+		{`{{#let s=title | truncate 5 "..." | upper l="x" | upper}}{{s}}{{l}}{{/let}}`, data, "HELLO...X"},
+		{`{{#let s=title | truncate 5 " = " l=s}}{{l}}{{/let}}`, data, "Hello = "},
+		{`{{#let x=missing | upper}}[{{x}}]{{/let}}`, data, "[]"},
+	} {
+		template := New(options...)
+		if err := template.ParseString(test.template); err != nil {
+			t.Errorf("%q: %v", test.template, err)
+			continue
+		}
+		output, err := template.RenderString(test.payload)
+		if err != nil {
+			t.Errorf("%q: %v", test.template, err)
+		}
+		if output != test.expect {
+			t.Errorf("%q: expected %q got %q", test.template, test.expect, output)
+		}
+	}
+
+	template := New(append(options, SilentMiss(false))...)
+	if err := template.ParseString(`{{#let s=title | truncate x}}{{s}}{{/let}}`); err != nil {
+		t.Fatal(err)
+	}
+	var cerr *CustomizerError
+	if _, err := template.RenderString(data); !errors.As(err, &cerr) {
+		t.Errorf("expected a *CustomizerError got %v", err)
+	}
+	for _, input := range []string{
+		`{{#let t=total | }}{{/let}}`,
+		`{{#let t=total | unknown}}{{/let}}`,
+	} {
+		if err := New(options...).ParseString(input); err == nil {
+			t.Errorf("expected parse error for %q", input)
+		}
+	}
+	// Without FilterPipes, filters are not parsed.
+	if err := New(LetSections()).ParseString(`{{#let t=total | upper}}{{/let}}`); err == nil {
+		t.Error("expected parse error without FilterPipes")
+	}
+}
+
+func TestCaptureSections(t *testing.T) {
+	data := map[string]interface{}{"id": "<42>", "items": []string{"a", "b"}}
+	for _, test := range []templateTest{
+		{
+			"{{#capture \"pre\"}}Order {{id}} shipped{{/capture}}<title>{{pre}}</title><p>{{pre}}</p>",
+			data,
+			"<title>Order &lt;42&gt; shipped</title><p>Order &lt;42&gt; shipped</p>",
+		},
+		{
+			"{{#capture list}}{{#items}}{{.}},{{/items}}{{/capture}}\n[{{list}}] [{{{list}}}]",
+			data,
+			"[a,b,] [a,b,]",
+		},
+		{
+			"[{{late}}]{{#capture late}}x{{/capture}}[{{late}}]",
+			data,
+			"[][x]",
+		},
+		{
+			"{{#capture id}}captured{{/capture}}{{id}}",
+			data,
+			"&lt;42&gt;",
+		},
+		{
+			"{{#items}}{{#capture last}}{{.}}{{/capture}}{{/items}}{{last}}",
+			data,
+			"b",
+		},
+	} {
+		template := New(CaptureSections())
+		if err := template.ParseString(test.template); err != nil {
+			t.Error(err)
+			continue
+		}
+		output, err := template.RenderString(test.payload)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expect {
+			t.Errorf("expected %q got %q", test.expect, output)
+		}
+	}
+
+	// Captures do not leak from one render into the next.
+	template := New(CaptureSections())
+	if err := template.ParseString("[{{c}}]{{#capture c}}{{id}}{{/capture}}"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if output, _ := template.RenderString(data); output != "[]" {
+			t.Errorf("expected %q got %q", "[]", output)
+		}
+	}
+
+	for _, input := range []string{
+		`{{#capture "a}}{{/capture}}`,
+		`{{#capture a b}}{{/capture}}`,
+	} {
+		if err := New(CaptureSections()).ParseString(input); err == nil {
+			t.Errorf("expected parse error for %q", input)
+		}
+	}
+}
+
+func TestRenderBytes(t *testing.T) {
+	template := New()
+	if err := template.ParseString("Hello, {{subject}}!"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := template.RenderBytes(map[string]string{"subject": "world"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "Hello, world!" {
+		t.Errorf("unexpected output %q", b)
+	}
+	// The result must not share memory with pooled buffers.
+	c, _ := template.RenderBytes(map[string]string{"subject": "there"})
+	if string(b) != "Hello, world!" || string(c) != "Hello, there!" {
+		t.Errorf("unexpected outputs %q and %q", b, c)
+	}
+
+	dst := []byte("> ")
+	dst, err = template.AppendRender(dst, map[string]string{"subject": "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, _ = template.AppendRender(append(dst, ' '), map[string]string{"subject": "b"})
+	if expected := "> Hello, a! Hello, b!"; string(dst) != expected {
+		t.Errorf("expected %q got %q", expected, dst)
+	}
+}
+
+func TestRenderAtomic(t *testing.T) {
+	template := New(SilentMiss(false))
+	if err := template.ParseString("Hello, {{subject}}! {{#list}}{{name}}{{/list}}"); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	err := template.RenderAtomic(&b, map[string]interface{}{"subject": "world", "list": []int{1}})
+	if !errors.Is(err, ErrMissingVariable) {
+		t.Errorf("expected a missing variable error, got %v", err)
+	}
+	if b.Len() != 0 {
+		t.Errorf("expected no output, got %q", b.String())
+	}
+
+	err = template.RenderAtomic(&b, map[string]interface{}{"subject": "world", "list": []map[string]string{{"name": "a"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Hello, world! a"; b.String() != expected {
+		t.Errorf("expected %q got %q", expected, b.String())
+	}
+}
+
+func TestCoalesceTags(t *testing.T) {
+	for _, test := range []templateTest{
+		{`Hi {{coalesce nickname first_name "there"}}!`, map[string]string{"first_name": "Jane"}, "Hi Jane!"},
+		{`Hi {{coalesce nickname first_name "there"}}!`, map[string]string{"nickname": "JJ", "first_name": "Jane"}, "Hi JJ!"},
+		{`Hi {{coalesce nickname first_name "there"}}!`, map[string]string{"nickname": ""}, "Hi there!"},
+		{`Hi {{coalesce nickname "a \"b\"" x}}!`, nil, "Hi a &quot;b&quot;!"},
+		{`Hi {{{coalesce nickname "<you>"}}}!`, nil, "Hi <you>!"},
+		{`Hi {{&coalesce user."nick name" user.name}}!`, map[string]interface{}{"user": map[string]string{"nick name": "<JJ>"}}, "Hi <JJ>!"},
+		{`[{{coalesce a b}}]`, map[string]interface{}{"a": 0, "b": false}, "[]"},
+	} {
+		template := New(CoalesceTags(), SilentMiss(false))
+		if err := template.ParseString(test.template); err != nil {
+			t.Error(err)
+			continue
+		}
+		output, err := template.RenderString(test.payload)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expect {
+			t.Errorf("expected %q got %q", test.expect, output)
+		}
+	}
+
+	if err := New(CoalesceTags()).ParseString(`{{coalesce a "b}}`); err == nil {
+		t.Error("expected a parse error for an unterminated literal")
+	}
+}
+
+func TestRenderContext(t *testing.T) {
+	type key struct{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "tenant"))
+	defer cancel()
+	template := New(
+		CustomizeFunctionCtx("tenant", func(ctx context.Context, s string, _ map[string]string) (string, error) {
+			return s + ctx.Value(key{}).(string), nil
+		}),
+		CustomizeFunctionCtx("cancel", func(ctx context.Context, s string, _ map[string]string) (string, error) {
+			cancel()
+			return s, nil
+		}),
+	)
+	err := template.ParseString("{{~tenant}}for {{/tenant}}{{#list}}{{.}}{{~cancel}}!{{/cancel}}{{/list}} never")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output bytes.Buffer
+	err = template.RenderContext(ctx, &output, map[string]interface{}{"list": []int{1, 2, 3}})
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if s := output.String(); strings.Contains(s, "2") || strings.Contains(s, "never") {
+		t.Errorf("expected rendering to stop after the first element, got %q", s)
+	}
+
+	output.Reset()
+	err = template.RenderContext(context.WithValue(context.Background(), key{}, "tenant"), &output, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "for tenant never"; output.String() != expected {
+		t.Errorf("expected %q got %q", expected, output.String())
+	}
+}
+
+func TestConcurrentRender(t *testing.T) {
+	inner := New(Name("inner"))
+	if err := inner.ParseString(`[{{name}}{{>outer}}]`); err != nil {
+		t.Fatal(err)
+	}
+	outer := New(Name("outer"))
+	if err := outer.ParseString(`({{>inner}})`); err != nil {
+		t.Fatal(err)
+	}
+	template := New(Partial(inner), Partial(outer))
+	if err := template.ParseString(`{{>outer}}{{>inner}}`); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := strconv.Itoa(i)
+			for j := 0; j < 100; j++ {
+				output, err := template.RenderString(map[string]string{"name": name})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if expected := "([" + name + "])[" + name + "()]"; output != expected {
+					t.Errorf("expected %q got %q", expected, output)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestClone(t *testing.T) {
+	header := New(Name("header"))
+	if err := header.ParseString("Default header"); err != nil {
+		t.Fatal(err)
+	}
+	base := New(Partial(header), CustomizeFunction("upper", func(s string) (string, error) {
+		return strings.ToUpper(s), nil
+	}))
+	if err := base.ParseString("{{>header}}: {{#items}}{{~upper}}{{.}}{{/upper}}{{/items}}"); err != nil {
+		t.Fatal(err)
+	}
+
+	tenantHeader := New(Name("header"))
+	if err := tenantHeader.ParseString("Tenant header"); err != nil {
+		t.Fatal(err)
+	}
+	tenant := base.Clone()
+	tenant.Option(Partial(tenantHeader), CustomizeFunction("upper", func(s string) (string, error) {
+		return "<" + s + ">", nil
+	}))
+	tenant.elems[2].(*sectionNode).name = "changed"
+
+	data := map[string][]string{"items": {"a", "b"}}
+	for _, test := range []struct {
+		template *Template
+		expected string
+	}{
+		{base, "Default header: AB"},
+		{tenant, "Tenant header: <a><b>"},
+	} {
+		output, err := test.template.RenderString(data)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expected {
+			t.Errorf("expected %q got %q", test.expected, output)
+		}
+	}
+	if name := base.elems[2].(*sectionNode).name; name != "items" {
+		t.Errorf("expected the parse tree of the base template to be unchanged, got %q", name)
+	}
+}
+
+func TestMust(t *testing.T) {
+	template := New().MustParseString("Hello, {{subject}}!")
+	if output, _ := template.RenderString(map[string]string{"subject": "world"}); output != "Hello, world!" {
+		t.Errorf("unexpected output %q", output)
+	}
+	if Must(template, nil) != template {
+		t.Error("expected Must to return the template")
+	}
+
+	for _, f := range []func(){
+		func() { New().MustParseString("{{#open}}") },
+		func() { Must(Parse(strings.NewReader("{{#open}}"))) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestCRLFTemplates(t *testing.T) {
+	// Templates with "\r\n" line breaks render as those with "\n" do.
+	for _, input := range []string{
+		"a\n{{#list}}\n- {{.}}\n{{/list}}\nb\n",
+		"a\n  {{! comment }}\nb",
+		"{{^empty}}\nnone\n{{/empty}}\n",
+		"a {{#list}}{{.}}{{/list}}\n",
+	} {
+		var outputs [2]string
+		for i, input := range []string{input, strings.ReplaceAll(input, "\n", "\r\n")} {
+			template := New()
+			if err := template.ParseString(input); err != nil {
+				t.Fatal(err)
+			}
+			output, err := template.RenderString(map[string]interface{}{"list": []int{1, 2}})
+			if err != nil {
+				t.Error(err)
+			}
+			outputs[i] = output
+		}
+		if expected := strings.ReplaceAll(outputs[0], "\n", "\r\n"); outputs[1] != expected {
+			t.Errorf("%q: expected %q got %q", input, expected, outputs[1])
+		}
+	}
+}
+
+func TestTrimMarkers(t *testing.T) {
+	upper := CustomizeFunction("upper", func(s string) (string, error) { return strings.ToUpper(s), nil })
+	for _, test := range []struct {
+		template string
+		expected string
+	}{
+		{"a  {{- x -}}  b", "a1b"},
+		{"a \n {{- x}} \n b", "a1 \n b"},
+		{"a {{-x}} {{x -}} b", "a -x 1b"},
+		{"<ul>\n{{#list -}}\n  <li>{{.}}</li>\n{{- /list}}\n</ul>", "<ul>\n<li>1</li><li>2</li>\n</ul>"},
+		{"a {{- ! comment -}} b", "ab"},
+		{"a {{- & html -}} b", "a<b>b"},
+		{"{{~upper tz={{x}} -}}\n  y {{- /upper}}", "Y"},
+		{`a {{=const c "v" -}}  {{c}}`, "a v"},
+		{"{{=<% %>=}}a <%- x -%> b", "a1b"},
+	} {
+		template := New(upper)
+		if err := template.ParseString(test.template); err != nil {
+			t.Errorf("%q: %v", test.template, err)
+			continue
+		}
+		context := map[string]interface{}{"x": 1, "-x": "-x", "list": []int{1, 2}, "html": "<b>"}
+		output, err := template.RenderString(context)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expected {
+			t.Errorf("%q: expected %q got %q", test.template, test.expected, output)
+		}
+
+		// The source of the template renders the same without the trimmed
+		// whitespace.
+		source := New(upper)
+		if err := source.ParseString(template.Source()); err != nil {
+			t.Errorf("%q: %v", template.Source(), err)
+			continue
+		}
+		if output, _ := source.RenderString(context); output != test.expected {
+			t.Errorf("%q: expected %q got %q", template.Source(), test.expected, output)
+		}
+	}
+}
+
+func TestEscapeDelimiters(t *testing.T) {
+	for _, test := range []struct {
+		template string
+		expected string
+	}{
+		{`Use \{{name}} for {{name}}.`, "Use {{name}} for Ann."},
+		{`\{{#list}}\{{/list}} \{{`, "{{#list}}{{/list}} {{"},
+		{`a\b \{{{name}}}`, `a\b {{{name}}}`},
+		{`{{=<% %>=}}\<%name%> \{{name}} <%name%>`, `<%name%> \{{name}} Ann`},
+		{"{{#list}}\\{{.}}={{.}} {{/list}}", "{{.}}=1 {{.}}=2 "},
+		{`C:\\{{name}} C:\\\{{name}} C:\dir\\`, `C:\Ann C:\{{name}} C:\dir\\`},
+		{`\\\\{{name}}`, `\\Ann`},
+	} {
+		template := New(EscapeDelimiters())
+		if err := template.ParseString(test.template); err != nil {
+			t.Errorf("%q: %v", test.template, err)
+			continue
+		}
+		output, err := template.RenderString(map[string]interface{}{"name": "Ann", "list": []int{1, 2}})
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expected {
+			t.Errorf("%q: expected %q got %q", test.template, test.expected, output)
+		}
+		if source := template.Source(); source != test.template {
+			t.Errorf("expected source %q got %q", test.template, source)
+		}
+	}
+
+	// Without the option, the backslash is text.
+	template := New()
+	if err := template.ParseString(`\{{name}}`); err != nil {
+		t.Fatal(err)
+	}
+	if output, _ := template.RenderString(map[string]string{"name": "Ann"}); output != `\Ann` {
+		t.Errorf("expected %q got %q", `\Ann`, output)
+	}
+}
+
+func TestVerbatimBlocks(t *testing.T) {
+	for _, test := range []struct {
+		template string
+		expected string
+	}{
+		{"{{{{raw}}}}{{name}}{{{{/raw}}}} {{name}}", "{{name}} Ann"},
+		{"{{{{raw}}}}{{#list}}{{{x}}}{{/list}}{{{{/raw}}}}", "{{#list}}{{{x}}}{{/list}}"},
+		{"a{{{{raw}}}}{{{{/raw}}}}b", "ab"},
+		{"{{#list}}{{{{raw}}}}{{.}}{{{{/raw}}}}{{.}} {{/list}}", "{{.}}1 {{.}}2 "},
+		{"{{=<% %>=}}<%<%raw%>%>{{name}} <%name%><%<%/raw%>%> <%name%>", "{{name}} <%name%> Ann"},
+	} {
+		template := New()
+		if err := template.ParseString(test.template); err != nil {
+			t.Errorf("%q: %v", test.template, err)
+			continue
+		}
+		output, err := template.RenderString(map[string]interface{}{"name": "Ann", "list": []int{1, 2}})
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expected {
+			t.Errorf("%q: expected %q got %q", test.template, test.expected, output)
+		}
+		if source := template.Source(); source != test.template {
+			t.Errorf("expected source %q got %q", test.template, source)
+		}
+	}
+
+	template := New()
+	err := template.ParseString("{{name}}\n{{{{raw}}}}{{name}}")
+	if err == nil || !strings.Contains(err.Error(), "unclosed raw block") {
+		t.Errorf("expected an unclosed raw block error got %v", err)
+	}
+}
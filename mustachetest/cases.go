@@ -0,0 +1,164 @@
+package mustachetest
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/observeinc/mustache"
+)
+
+// CasesSuffix is the suffix of the files holding the test cases of templates.
+// The cases of welcome.mustache are read from welcome.tests.yaml, a list of
+// contexts and the output expected when rendering the template with them:
+//
+//	# welcome.tests.yaml
+//	- name: greets the user
+//	  context:
+//	    name: Ann
+//	  expected: Hello Ann!
+const CasesSuffix = ".tests.yaml"
+
+// Case is a test case of a template.
+type Case struct {
+	Name     string      `yaml:"name"`
+	Context  interface{} `yaml:"context"`
+	Expected string      `yaml:"expected"`
+}
+
+// Result is the outcome of a test case.
+type Result struct {
+	File   string // the template file, relative to the root of the file system
+	Case   Case
+	Output string
+	Err    error // the error of the render, if any
+}
+
+// Failed reports whether the render failed or its output was not the expected
+// one.
+func (r Result) Failed() bool {
+	return r.Err != nil || r.Output != r.Case.Expected
+}
+
+func (r Result) String() string {
+	switch {
+	case r.Err != nil:
+		return fmt.Sprintf("%s: %s: %s", r.File, r.Case.Name, r.Err)
+	case r.Failed():
+		return fmt.Sprintf("%s: %s: expected %q got %q", r.File, r.Case.Name, r.Case.Expected, r.Output)
+	}
+	return fmt.Sprintf("%s: %s", r.File, r.Case.Name)
+}
+
+// RunCases runs the test cases of the .mustache templates in the directory
+// dir of fsys, and in its subdirectories if recursive is true. The templates
+// of a directory are parsed into a mustache.TemplateSet with options, so that
+// they may include each other as partials. Templates without test cases are
+// skipped. The results are sorted by file, then in the order of the cases.
+func RunCases(fsys fs.FS, dir string, recursive bool, options ...mustache.Option) ([]Result, error) {
+	var results []Result
+	err := fs.WalkDir(fsys, dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if name != dir && !recursive {
+			return fs.SkipDir
+		}
+		r, err := runDir(fsys, name, options)
+		results = append(results, r...)
+		return err
+	})
+	return results, err
+}
+
+// runDir runs the test cases of the templates of dir.
+func runDir(fsys fs.FS, dir string, options []mustache.Option) ([]Result, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*"+CasesSuffix))
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+	set := mustache.NewSet(options...)
+	if err := set.ParseFS(fsys, path.Join(dir, "*.mustache")); err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	var results []Result
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), CasesSuffix)
+		if set.Lookup(name) == nil {
+			return results, fmt.Errorf("%s: no template %s.mustache", file, name)
+		}
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return results, err
+		}
+		var cases []Case
+		if err := yaml.Unmarshal(b, &cases); err != nil {
+			return results, fmt.Errorf("%s: %w", file, err)
+		}
+		for i, c := range cases {
+			if c.Name == "" {
+				c.Name = fmt.Sprintf("case %d", i+1)
+			}
+			var out bytes.Buffer
+			err := set.Render(name, &out, c.Context)
+			results = append(results, Result{
+				File:   path.Join(dir, name+".mustache"),
+				Case:   c,
+				Output: out.String(),
+				Err:    err,
+			})
+		}
+	}
+	return results, nil
+}
+
+// TestCases runs the test cases of the templates of fsys found in dir and its
+// subdirectories as subtests of t, named after the template file and case:
+//
+//	func TestTemplates(t *testing.T) {
+//		mustachetest.TestCases(t, os.DirFS("templates"), ".")
+//	}
+func TestCases(t *testing.T, fsys fs.FS, dir string, options ...mustache.Option) {
+	t.Helper()
+	results, err := RunCases(fsys, dir, true, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		r := r
+		t.Run(r.File+"/"+r.Case.Name, func(t *testing.T) {
+			if r.Failed() {
+				t.Error(r)
+			}
+		})
+	}
+}
+
+// AddResults adds the failed results to report, as errors of the rule "test".
+func AddResults(report *mustache.Report, results []Result) {
+	for _, r := range results {
+		if !r.Failed() {
+			continue
+		}
+		msg := fmt.Sprintf("%s: expected %q got %q", r.Case.Name, r.Case.Expected, r.Output)
+		if r.Err != nil {
+			msg = r.Case.Name + ": " + r.Err.Error()
+		}
+		report.Issues = append(report.Issues, mustache.Issue{
+			Rule:    "test",
+			Level:   mustache.LevelError,
+			Message: msg,
+			File:    r.File,
+		})
+	}
+}
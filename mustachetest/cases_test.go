@@ -0,0 +1,73 @@
+package mustachetest
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var casesFS = fstest.MapFS{
+	"welcome.mustache": {Data: []byte("{{>header}}Hello {{name}}!")},
+	"header.mustache":  {Data: []byte("[{{title}}] ")},
+	"welcome.tests.yaml": {Data: []byte(`
+- name: greets the user
+  context:
+    name: Ann
+    title: Hi
+  expected: "[Hi] Hello Ann!"
+- context: {name: Bob}
+  expected: "[] Hello Bob?"
+`)},
+	"mail/body.mustache": {Data: []byte("{{#items}}{{.}},{{/items}}")},
+	"mail/body.tests.yaml": {Data: []byte(`
+- name: lists the items
+  context:
+    items: [1, 2]
+  expected: "1,2,"
+`)},
+}
+
+func TestRunCases(t *testing.T) {
+	for _, test := range []struct {
+		recursive bool
+		expected  []string
+	}{
+		{false, []string{
+			"welcome.mustache: greets the user",
+			`welcome.mustache: case 2: expected "[] Hello Bob?" got "[] Hello Bob!"`,
+		}},
+		{true, []string{
+			"welcome.mustache: greets the user",
+			`welcome.mustache: case 2: expected "[] Hello Bob?" got "[] Hello Bob!"`,
+			"mail/body.mustache: lists the items",
+		}},
+	} {
+		results, err := RunCases(casesFS, ".", test.recursive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(test.expected, "\n") {
+			t.Errorf("recursive %t: unexpected results\n%s", test.recursive, strings.Join(got, "\n"))
+		}
+		if results[0].Failed() || !results[1].Failed() {
+			t.Errorf("recursive %t: unexpected failures", test.recursive)
+		}
+	}
+
+	_, err := RunCases(fstest.MapFS{"a.tests.yaml": {Data: []byte("[]")}, "b.mustache": {}}, ".", false)
+	if err == nil || !strings.Contains(err.Error(), "no template a.mustache") {
+		t.Errorf("expected an error for cases without a template, got %v", err)
+	}
+	_, err = RunCases(fstest.MapFS{"a.tests.yaml": {Data: []byte("{")}, "a.mustache": {}}, ".", false)
+	if err == nil || !strings.HasPrefix(err.Error(), "a.tests.yaml: ") {
+		t.Errorf("expected an error for invalid cases, got %v", err)
+	}
+}
+
+func TestTestCases(t *testing.T) {
+	TestCases(t, casesFS, "mail")
+}
@@ -0,0 +1,8 @@
+module github.com/observeinc/mustache/mustachetest
+
+go 1.20
+
+require (
+	github.com/observeinc/mustache v1.5.0
+	gopkg.in/yaml.v3 v3.0.1
+)
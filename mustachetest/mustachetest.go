@@ -0,0 +1,126 @@
+// Package mustachetest provides fakes of mustache renderers for the tests of
+// code which depends on the mustache.Renderer interface rather than on
+// templates:
+//
+//	var rec mustachetest.Recorder
+//	svc := NewService(rec.Fake("welcome", "Hello!"), rec.Fake("goodbye", "Bye!"))
+//	svc.Greet(w, user)
+//	mustachetest.AssertRendered(t, rec.Calls(), "welcome")
+//	mustachetest.AssertContext(t, rec.Calls()[0], user)
+package mustachetest
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/observeinc/mustache"
+)
+
+// Call is a call to the Render method of a FakeRenderer.
+type Call struct {
+	Name    string        // the name of the fake
+	Context []interface{} // the context the fake was rendered with
+}
+
+// FakeRenderer is a mustache.Renderer which writes canned output and records
+// the calls to its Render method. It may be rendered by multiple goroutines
+// concurrently.
+type FakeRenderer struct {
+	Name   string // recorded in calls, to tell fakes apart
+	Output string // written by Render
+	Err    error  // returned by Render, after writing Output
+
+	rec   *Recorder
+	mu    sync.Mutex
+	calls []Call
+}
+
+var _ mustache.Renderer = (*FakeRenderer)(nil)
+
+// Render records the call, writes f.Output to w and returns f.Err, or the
+// error of writing to w.
+func (f *FakeRenderer) Render(w io.Writer, context ...interface{}) error {
+	call := Call{Name: f.Name, Context: context}
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+	f.mu.Unlock()
+	if f.rec != nil {
+		f.rec.record(call)
+	}
+	if _, err := io.WriteString(w, f.Output); err != nil {
+		return err
+	}
+	return f.Err
+}
+
+// Calls returns the calls made to f, in order.
+func (f *FakeRenderer) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// Recorder records the calls made to the fakes it creates, so that the order
+// in which several templates are rendered can be checked. Its zero value is
+// ready to use.
+type Recorder struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Fake returns a FakeRenderer named name which writes output, and whose calls
+// are recorded by r.
+func (r *Recorder) Fake(name, output string) *FakeRenderer {
+	return &FakeRenderer{Name: name, Output: output, rec: r}
+}
+
+func (r *Recorder) record(call Call) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+// Calls returns the calls made to the fakes of r, in order.
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// Names returns the names of the fakes rendered by calls, in order.
+func Names(calls []Call) []string {
+	names := make([]string, len(calls))
+	for i, call := range calls {
+		names[i] = call.Name
+	}
+	return names
+}
+
+// AssertRendered reports an error to t unless calls rendered exactly the fakes
+// named names, in order.
+func AssertRendered(t testing.TB, calls []Call, names ...string) {
+	t.Helper()
+	if got := Names(calls); !reflect.DeepEqual(got, names) && (len(got) != 0 || len(names) != 0) {
+		t.Errorf("expected renders of %s, got %s", list(names), list(got))
+	}
+}
+
+// AssertContext reports an error to t unless call was rendered with context,
+// compared with reflect.DeepEqual.
+func AssertContext(t testing.TB, call Call, context ...interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(call.Context, context) && (len(call.Context) != 0 || len(context) != 0) {
+		t.Errorf("expected %s to be rendered with %#v, got %#v", call.Name, context, call.Context)
+	}
+}
+
+// list formats names for messages.
+func list(names []string) string {
+	if len(names) == 0 {
+		return "no template"
+	}
+	return fmt.Sprintf("%q", names)
+}
@@ -0,0 +1,77 @@
+package mustachetest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/observeinc/mustache"
+)
+
+// recordingT records the errors reported to it.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+// greet stands in for code depending on the Renderer interface.
+func greet(w *bytes.Buffer, r mustache.Renderer, name string) error {
+	return r.Render(w, map[string]string{"name": name})
+}
+
+func TestFakeRenderer(t *testing.T) {
+	var rec Recorder
+	welcome, goodbye := rec.Fake("welcome", "Hello!"), rec.Fake("goodbye", "Bye!")
+	var b bytes.Buffer
+	if err := greet(&b, welcome, "Ann"); err != nil {
+		t.Fatal(err)
+	}
+	goodbye.Err = errors.New("failed")
+	if err := greet(&b, goodbye, "Bob"); err != goodbye.Err {
+		t.Errorf("expected the canned error, got %v", err)
+	}
+	if b.String() != "Hello!Bye!" {
+		t.Errorf("expected %q got %q", "Hello!Bye!", b.String())
+	}
+
+	AssertRendered(t, rec.Calls(), "welcome", "goodbye")
+	AssertRendered(t, welcome.Calls(), "welcome")
+	AssertContext(t, rec.Calls()[1], map[string]string{"name": "Bob"})
+
+	rt := &recordingT{}
+	AssertRendered(rt, rec.Calls(), "goodbye")
+	AssertRendered(rt, nil, "welcome")
+	AssertContext(rt, rec.Calls()[0], map[string]string{"name": "Bob"})
+	expected := []string{
+		`expected renders of ["goodbye"], got ["welcome" "goodbye"]`,
+		`expected renders of ["welcome"], got no template`,
+		`expected welcome to be rendered with []interface {}{map[string]string{"name":"Bob"}}, got []interface {}{map[string]string{"name":"Ann"}}`,
+	}
+	if fmt.Sprint(rt.errors) != fmt.Sprint(expected) {
+		t.Errorf("expected %q got %q", expected, rt.errors)
+	}
+}
+
+func TestFakeRendererConcurrent(t *testing.T) {
+	f := &FakeRenderer{Name: "page"}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			f.Render(&bytes.Buffer{}, i)
+		}(i)
+	}
+	wg.Wait()
+	if n := len(f.Calls()); n != 10 {
+		t.Errorf("expected 10 calls got %d", n)
+	}
+}
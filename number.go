@@ -0,0 +1,343 @@
+package mustache
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// NumberHelpers makes customizers for writing out integers available to the
+// template:
+//
+//	{{~ordinal}}{{rank}}{{/ordinal}}  3rd
+//	{{~spell}}{{amount}}{{/spell}}    forty-two
+//
+// Both accept a locale option. The ordinal helper supports en (the default),
+// de (3.), es (3.º) and fr (3e), the spell helper supports en and de.
+func NumberHelpers() Option {
+	return func(t *Template) {
+		t.Option(
+			CustomizeFunctionWithOptions("ordinal", func(s string, opts map[string]string) (string, error) {
+				n, err := parseInteger(s)
+				if err != nil {
+					return "", err
+				}
+				switch language(opts["locale"]) {
+				case "en":
+					return ordinalEn(n), nil
+				case "de":
+					return strconv.FormatInt(n, 10) + ".", nil
+				case "es":
+					return strconv.FormatInt(n, 10) + ".º", nil
+				case "fr":
+					if n == 1 {
+						return "1er", nil
+					}
+					return strconv.FormatInt(n, 10) + "e", nil
+				default:
+					return "", fmt.Errorf("unsupported ordinal locale %q", opts["locale"])
+				}
+			}),
+			CustomizeFunctionWithOptions("spell", func(s string, opts map[string]string) (string, error) {
+				n, err := parseInteger(s)
+				if err != nil {
+					return "", err
+				}
+				switch language(opts["locale"]) {
+				case "en":
+					return spellEn(n), nil
+				case "de":
+					return spellDe(n), nil
+				default:
+					return "", fmt.Errorf("unsupported spell locale %q", opts["locale"])
+				}
+			}),
+		)
+	}
+}
+
+// FloatFormat makes floating point numbers render with format, a fmt verb such
+// as "%.2f", rather than "%g".
+func FloatFormat(format string) Option {
+	return func(t *Template) {
+		t.floatFormat = format
+	}
+}
+
+// NumberSeparators makes numbers render with thousands between the groups of
+// thousands of their integer part and decimal as their decimal mark, e.g. ","
+// and "." for 1,234.5, or "." and "," for 1.234,5. An empty decimal keeps the
+// period.
+func NumberSeparators(thousands, decimal string) Option {
+	return func(t *Template) {
+		t.thousandsSep, t.decimalMark = thousands, decimal
+	}
+}
+
+// NumberFormatter makes numbers render as formatted by f, in place of
+// FloatFormat and NumberSeparators, e.g. with the locale aware printer of
+// golang.org/x/text/message:
+//
+//	p := message.NewPrinter(language.German)
+//	mustache.NumberFormatter(func(n interface{}) string { return p.Sprint(n) })
+func NumberFormatter(f func(n interface{}) string) Option {
+	return func(t *Template) {
+		t.numberFormatter = f
+	}
+}
+
+// formatNumber returns v formatted after the options of t if it is a number,
+// and v otherwise. Numbers implementing fmt.Stringer are left to their String
+// method.
+func (t *Template) formatNumber(v interface{}) interface{} {
+	if t.floatFormat == "" && t.thousandsSep == "" && t.decimalMark == "" && t.numberFormatter == nil {
+		return v
+	}
+	if _, ok := v.(fmt.Stringer); ok {
+		return v
+	}
+	var s string
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if t.numberFormatter != nil {
+			return t.numberFormatter(v)
+		}
+		s = fmt.Sprint(v)
+	case reflect.Float32, reflect.Float64:
+		if t.numberFormatter != nil {
+			return t.numberFormatter(v)
+		}
+		format := t.floatFormat
+		if format == "" {
+			format = "%g"
+		}
+		s = fmt.Sprintf(format, v)
+	default:
+		return v
+	}
+	return separateNumber(s, t.thousandsSep, t.decimalMark)
+}
+
+// separateNumber inserts thousands between the groups of thousands of the
+// integer part of s, a formatted number, and replaces its decimal point with
+// decimal if not empty.
+func separateNumber(s, thousands, decimal string) string {
+	start := 0
+	if start < len(s) && (s[0] == '-' || s[0] == '+') {
+		start++
+	}
+	end := start
+	for end < len(s) && '0' <= s[end] && s[end] <= '9' {
+		end++
+	}
+	var b strings.Builder
+	b.WriteString(s[:start])
+	for i := start; i < end; i++ {
+		if i > start && (end-i)%3 == 0 {
+			b.WriteString(thousands)
+		}
+		b.WriteByte(s[i])
+	}
+	rest := s[end:]
+	if decimal != "" && strings.HasPrefix(rest, ".") {
+		rest = decimal + rest[1:]
+	}
+	b.WriteString(rest)
+	return b.String()
+}
+
+// language returns the lower cased language code of locale, en if empty.
+func language(locale string) string {
+	if locale == "" {
+		return "en"
+	}
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		locale = locale[:i]
+	}
+	return strings.ToLower(locale)
+}
+
+// parseInteger parses s, ignoring surrounding whitespace, as a base 10
+// integer.
+func parseInteger(s string) (int64, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer %q", s)
+	}
+	return n, nil
+}
+
+// ordinalEn formats n as an English ordinal such as 1st, 12th or 23rd.
+func ordinalEn(n int64) string {
+	suffix := "th"
+	u := abs(n)
+	if u%100 < 11 || u%100 > 13 {
+		switch u % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return strconv.FormatInt(n, 10) + suffix
+}
+
+// spellScale is a power of a thousand with its singular and plural name.
+type spellScale struct {
+	n              uint64
+	single, plural string
+}
+
+var (
+	onesEn = []string{
+		"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine",
+		"ten", "eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen",
+		"seventeen", "eighteen", "nineteen",
+	}
+	tensEn   = []string{"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety"}
+	scalesEn = []spellScale{
+		{1e18, "quintillion", "quintillion"},
+		{1e15, "quadrillion", "quadrillion"},
+		{1e12, "trillion", "trillion"},
+		{1e9, "billion", "billion"},
+		{1e6, "million", "million"},
+		{1e3, "thousand", "thousand"},
+	}
+
+	onesDe = []string{
+		"null", "eins", "zwei", "drei", "vier", "fünf", "sechs", "sieben", "acht", "neun",
+		"zehn", "elf", "zwölf", "dreizehn", "vierzehn", "fünfzehn", "sechzehn",
+		"siebzehn", "achtzehn", "neunzehn",
+	}
+	tensDe   = []string{"", "", "zwanzig", "dreißig", "vierzig", "fünfzig", "sechzig", "siebzig", "achtzig", "neunzig"}
+	scalesDe = []spellScale{
+		{1e18, "Trillion", "Trillionen"},
+		{1e15, "Billiarde", "Billiarden"},
+		{1e12, "Billion", "Billionen"},
+		{1e9, "Milliarde", "Milliarden"},
+		{1e6, "Million", "Millionen"},
+	}
+)
+
+// abs returns the absolute value of n, which is representable for all int64
+// values as a uint64.
+func abs(n int64) uint64 {
+	if n < 0 {
+		return uint64(-(n + 1)) + 1
+	}
+	return uint64(n)
+}
+
+// spellEn writes out n in English words, e.g. one hundred twenty-three.
+func spellEn(n int64) string {
+	var words []string
+	if n < 0 {
+		words = append(words, "minus")
+	}
+	u := abs(n)
+	if u == 0 {
+		return onesEn[0]
+	}
+	for _, s := range scalesEn {
+		if u >= s.n {
+			words = append(words, spellHundredsEn(u/s.n), s.single)
+			u %= s.n
+		}
+	}
+	if u > 0 {
+		words = append(words, spellHundredsEn(u))
+	}
+	return strings.Join(words, " ")
+}
+
+// spellHundredsEn writes out 0 < n < 1000 in English words.
+func spellHundredsEn(n uint64) string {
+	var words []string
+	if n >= 100 {
+		words = append(words, onesEn[n/100], "hundred")
+		n %= 100
+	}
+	switch {
+	case n == 0:
+	case n < 20:
+		words = append(words, onesEn[n])
+	case n%10 == 0:
+		words = append(words, tensEn[n/10])
+	default:
+		words = append(words, tensEn[n/10]+"-"+onesEn[n%10])
+	}
+	return strings.Join(words, " ")
+}
+
+// spellDe writes out n in German words. Numbers below a million are written
+// as one word, e.g. zweihundertvierunddreißig, larger scales as separate
+// words, e.g. zwei Millionen dreitausend.
+func spellDe(n int64) string {
+	var words []string
+	if n < 0 {
+		words = append(words, "minus")
+	}
+	u := abs(n)
+	if u == 0 {
+		return onesDe[0]
+	}
+	for _, s := range scalesDe {
+		if u >= s.n {
+			count := u / s.n
+			if count == 1 {
+				words = append(words, "eine", s.single)
+			} else {
+				words = append(words, spellThousandsDe(count), s.plural)
+			}
+			u %= s.n
+		}
+	}
+	if u > 0 {
+		words = append(words, spellThousandsDe(u))
+	}
+	return strings.Join(words, " ")
+}
+
+// spellThousandsDe writes out 0 < n < 1000000 as one German word.
+func spellThousandsDe(n uint64) string {
+	s := ""
+	if n >= 1000 {
+		s = spellHundredsDe(n/1000, true) + "tausend"
+		n %= 1000
+	}
+	if n > 0 {
+		s += spellHundredsDe(n, false)
+	}
+	return s
+}
+
+// spellHundredsDe writes out 0 < n < 1000 as one German word. A trailing one
+// is written as ein when it is followed by another word, as in eintausend.
+func spellHundredsDe(n uint64, prefix bool) string {
+	s := ""
+	if n >= 100 {
+		s = "einhundert"
+		if n/100 > 1 {
+			s = onesDe[n/100] + "hundert"
+		}
+		n %= 100
+	}
+	switch {
+	case n == 0:
+	case n == 1 && prefix:
+		s += "ein"
+	case n < 20:
+		s += onesDe[n]
+	case n%10 == 0:
+		s += tensDe[n/10]
+	case n%10 == 1:
+		s += "einund" + tensDe[n/10]
+	default:
+		s += onesDe[n%10] + "und" + tensDe[n/10]
+	}
+	return s
+}
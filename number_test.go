@@ -0,0 +1,123 @@
+package mustache
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNumberHelpers(t *testing.T) {
+	for _, test := range []templateTest{
+		{`{{~ordinal}}{{n}}{{/ordinal}}`, map[string]interface{}{"n": 3}, "3rd"},
+		{`{{~ordinal locale="fr"}}{{n}}{{/ordinal}}`, map[string]interface{}{"n": 1}, "1er"},
+		{`{{~ordinal locale={{lang}}}}{{n}}{{/ordinal}}`, map[string]interface{}{"n": 3, "lang": "de-AT"}, "3."},
+		{`{{~ordinal locale="es"}}{{n}}{{/ordinal}}`, map[string]interface{}{"n": 2}, "2.º"},
+		{`{{~spell}}{{n}}{{/spell}}`, map[string]interface{}{"n": 42}, "forty-two"},
+		{`{{~spell locale="de"}}{{n}}{{/spell}}`, map[string]interface{}{"n": 42}, "zweiundvierzig"},
+	} {
+		template := New(NumberHelpers())
+		if err := template.ParseString(test.template); err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(test.payload)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expect {
+			t.Errorf("%s: expected %q got %q", test.template, test.expect, output)
+		}
+	}
+
+	for _, tmpl := range []string{
+		`{{~ordinal}}third{{/ordinal}}`,
+		`{{~ordinal locale="xx"}}3{{/ordinal}}`,
+		`{{~spell locale="fr"}}3{{/spell}}`,
+	} {
+		template := New(NumberHelpers(), SilentMiss(false))
+		if err := template.ParseString(tmpl); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := template.RenderString(nil); err == nil {
+			t.Errorf("%s: expected an error", tmpl)
+		}
+	}
+}
+
+func TestOrdinalEn(t *testing.T) {
+	for n, expected := range map[int64]string{
+		0: "0th", 1: "1st", 2: "2nd", 3: "3rd", 4: "4th", 11: "11th", 12: "12th",
+		13: "13th", 21: "21st", 102: "102nd", 111: "111th", -1: "-1st",
+	} {
+		if output := ordinalEn(n); output != expected {
+			t.Errorf("ordinalEn(%d): expected %q got %q", n, expected, output)
+		}
+	}
+}
+
+func TestSpell(t *testing.T) {
+	for _, test := range []struct {
+		n      int64
+		en, de string
+	}{
+		{0, "zero", "null"},
+		{1, "one", "eins"},
+		{17, "seventeen", "siebzehn"},
+		{21, "twenty-one", "einundzwanzig"},
+		{30, "thirty", "dreißig"},
+		{101, "one hundred one", "einhunderteins"},
+		{1001, "one thousand one", "eintausendeins"},
+		{234567, "two hundred thirty-four thousand five hundred sixty-seven", "zweihundertvierunddreißigtausendfünfhundertsiebenundsechzig"},
+		{1000000, "one million", "eine Million"},
+		{2003000, "two million three thousand", "zwei Millionen dreitausend"},
+		{-5, "minus five", "minus fünf"},
+		{math.MinInt64, "minus nine quintillion two hundred twenty-three quadrillion three hundred seventy-two trillion thirty-six billion eight hundred fifty-four million seven hundred seventy-five thousand eight hundred eight",
+			"minus neun Trillionen zweihundertdreiundzwanzig Billiarden dreihundertzweiundsiebzig Billionen sechsunddreißig Milliarden achthundertvierundfünfzig Millionen siebenhundertfünfundsiebzigtausendachthundertacht"},
+	} {
+		if output := spellEn(test.n); output != test.en {
+			t.Errorf("spellEn(%d): expected %q got %q", test.n, test.en, output)
+		}
+		if output := spellDe(test.n); output != test.de {
+			t.Errorf("spellDe(%d): expected %q got %q", test.n, test.de, output)
+		}
+	}
+}
+
+type level int
+
+func (l level) String() string {
+	return fmt.Sprintf("L%d", int(l))
+}
+
+func TestNumberFormat(t *testing.T) {
+	data := map[string]interface{}{
+		"price": 1234567.891,
+		"count": -1234,
+		"small": float32(0.5),
+		"level": level(1200),
+		"id":    "12345",
+		"at":    time.Duration(1500),
+	}
+	for _, test := range []struct {
+		options  []Option
+		expected string
+	}{
+		{nil, "1.234567891e+06 -1234 0.5 L1200 12345 1.5µs"},
+		{[]Option{FloatFormat("%.2f")}, "1234567.89 -1234 0.50 L1200 12345 1.5µs"},
+		{[]Option{FloatFormat("%.2f"), NumberSeparators(",", "")}, "1,234,567.89 -1,234 0.50 L1200 12345 1.5µs"},
+		{[]Option{FloatFormat("%.1f"), NumberSeparators(".", ",")}, "1.234.567,9 -1.234 0,5 L1200 12345 1.5µs"},
+		{[]Option{NumberSeparators(" ", "")}, "1.234567891e+06 -1 234 0.5 L1200 12345 1.5µs"},
+		{[]Option{NumberFormatter(func(n interface{}) string { return fmt.Sprintf("<%v>", n) })}, "&lt;1.234567891e+06&gt; &lt;-1234&gt; &lt;0.5&gt; L1200 12345 1.5µs"},
+	} {
+		template := New(test.options...)
+		if err := template.ParseString("{{price}} {{count}} {{small}} {{level}} {{id}} {{at}}"); err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(data)
+		if err != nil {
+			t.Error(err)
+		} else if output != test.expected {
+			t.Errorf("expected %q got %q", test.expected, output)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Package objectstore loads mustache templates from S3-compatible object
+// storage, caching them and optionally pinning them to object versions.
+//
+// The package does not depend on a storage SDK. Instead it reads objects
+// through any type with the methods of Client, which takes a few lines to
+// write for the client of the storage in use. The FS it returns is an fs.FS,
+// so it works with PartialDir and TemplateSet.ParseFS:
+//
+//	store := objectstore.New(client,
+//		objectstore.Prefix("templates/"),
+//		objectstore.Pin(map[string]string{"header.mustache": "3HL4kqtJlcpXroDTDmJ"}),
+//		objectstore.CacheTTL(time.Minute))
+//	set := mustache.NewSet()
+//	err := set.ParseFS(store, "*.mustache")
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client reads the objects of a bucket. GetObject returns the content of the
+// object key, at the given version, or at its latest version if version is
+// empty. It returns an error wrapping fs.ErrNotExist if there is no such
+// object. ListObjects returns the keys of the objects starting with prefix.
+type Client interface {
+	GetObject(ctx context.Context, key, version string) (io.ReadCloser, error)
+	ListObjects(ctx context.Context, prefix string) ([]string, error)
+}
+
+// FS is a read-only fs.FS of the objects of a bucket. It may be used by
+// multiple goroutines concurrently.
+type FS struct {
+	client   Client
+	prefix   string
+	versions map[string]string
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]object
+}
+
+// object is a cached object.
+type object struct {
+	data []byte
+	at   time.Time // when the object was read
+}
+
+// Option configures an FS.
+type Option func(*FS)
+
+// Prefix sets the prefix of the keys of the objects, such as "templates/".
+// The name of a file of the FS is its key without the prefix.
+func Prefix(prefix string) Option {
+	return func(f *FS) {
+		f.prefix = prefix
+	}
+}
+
+// Pin reads the files named by the keys of versions at the object versions
+// given by the values, rather than at their latest version. Pinned files are
+// cached for good, as their versions do not change.
+func Pin(versions map[string]string) Option {
+	return func(f *FS) {
+		for name, version := range versions {
+			f.versions[name] = version
+		}
+	}
+}
+
+// CacheTTL sets how long files are cached before they are read again. Files
+// are cached for good by default, or if ttl is 0, and never if it is
+// negative.
+func CacheTTL(ttl time.Duration) Option {
+	return func(f *FS) {
+		f.ttl = ttl
+	}
+}
+
+// New returns the FS of the objects read by client.
+func New(client Client, options ...Option) *FS {
+	f := &FS{
+		client:   client,
+		versions: make(map[string]string),
+		now:      time.Now,
+		cache:    make(map[string]object),
+	}
+	for _, option := range options {
+		option(f)
+	}
+	return f
+}
+
+// Open opens the file name.
+func (f *FS) Open(name string) (fs.File, error) {
+	data, err := f.read("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &file{Reader: bytes.NewReader(data), info: fileInfo{name: path.Base(name), size: int64(len(data))}}, nil
+}
+
+// ReadFile returns the content of the file name.
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	data, err := f.read("read", name)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Clone(data), nil
+}
+
+// Glob returns the names of the files matching pattern, using the syntax of
+// path.Match. The objects are listed on every call.
+func (f *FS) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	keys, err := f.client.ListObjects(context.Background(), f.prefix)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, f.prefix)
+		if ok, _ := path.Match(pattern, name); ok && fs.ValidPath(name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Invalidate drops the files named from the cache, or every file if no names
+// are given, so that they are read again on their next use. Note that
+// templates parsed from the files, such as the partials of PartialDir, are
+// cached by the templates themselves.
+func (f *FS) Invalidate(names ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(names) == 0 {
+		f.cache = make(map[string]object)
+		return
+	}
+	for _, name := range names {
+		delete(f.cache, name)
+	}
+}
+
+// read returns the content of the file name, from the cache if it is fresh.
+// Errors are reported as an *fs.PathError for op.
+func (f *FS) read(op, name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	f.mu.Lock()
+	version, pinned := f.versions[name]
+	o, ok := f.cache[name]
+	f.mu.Unlock()
+	if ok && (pinned || f.ttl == 0 || f.now().Sub(o.at) < f.ttl) {
+		return o.data, nil
+	}
+
+	r, err := f.client.GetObject(context.Background(), f.prefix+name, version)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if pinned || f.ttl >= 0 {
+		f.mu.Lock()
+		f.cache[name] = object{data: data, at: f.now()}
+		f.mu.Unlock()
+	}
+	return data, nil
+}
+
+// file is an open file of an FS.
+type file struct {
+	*bytes.Reader
+	info fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Close() error               { return nil }
+
+// fileInfo describes a file of an FS.
+type fileInfo struct {
+	name string
+	size int64
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.size }
+func (i fileInfo) Mode() fs.FileMode  { return 0o444 }
+func (i fileInfo) ModTime() time.Time { return time.Time{} }
+func (i fileInfo) IsDir() bool        { return false }
+func (i fileInfo) Sys() interface{}   { return nil }
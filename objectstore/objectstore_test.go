@@ -0,0 +1,118 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/observeinc/mustache"
+)
+
+// fakeClient serves objects from memory, by key and version. The latest
+// version of an object has the empty version.
+type fakeClient struct {
+	objects map[string]map[string]string
+	gets    []string // the keys and versions read
+}
+
+func (c *fakeClient) GetObject(ctx context.Context, key, version string) (io.ReadCloser, error) {
+	c.gets = append(c.gets, key+"@"+version)
+	s, ok := c.objects[key][version]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return io.NopCloser(strings.NewReader(s)), nil
+}
+
+func (c *fakeClient) ListObjects(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for key := range c.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func TestFS(t *testing.T) {
+	client := &fakeClient{objects: map[string]map[string]string{
+		"t/page.mustache":   {"": "{{>header}} {{name}}"},
+		"t/header.mustache": {"": "<h1>new</h1>", "v1": "<h1>old</h1>"},
+		"other.mustache":    {"": "x"},
+	}}
+	store := New(client, Prefix("t/"), Pin(map[string]string{"header.mustache": "v1"}))
+
+	set := mustache.NewSet()
+	if err := set.ParseFS(store, "*.mustache"); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := set.Render("page", &b, map[string]string{"name": "Ann"}); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "<h1>old</h1> Ann" {
+		t.Errorf("unexpected output %q", b.String())
+	}
+
+	template := mustache.New(mustache.PartialDir(store, ".", ".mustache"))
+	if err := template.ParseString("{{>header}}{{>missing}}"); err != nil {
+		t.Fatal(err)
+	}
+	if output, err := template.RenderString(nil); err != nil || output != "<h1>old</h1>" {
+		t.Errorf("unexpected output %q, %v", output, err)
+	}
+	// The files are read once.
+	expected := []string{"t/header.mustache@v1", "t/page.mustache@", "t/missing.mustache@"}
+	if !reflect.DeepEqual(client.gets, expected) {
+		t.Errorf("expected reads %q got %q", expected, client.gets)
+	}
+
+	if _, err := fs.ReadFile(store, "missing.mustache"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+	if _, err := store.Open("../page.mustache"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("expected fs.ErrInvalid, got %v", err)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	client := &fakeClient{objects: map[string]map[string]string{"a": {"": "1"}}}
+	now := time.Unix(0, 0)
+	for _, test := range []struct {
+		ttl   time.Duration
+		reads int
+	}{
+		{0, 1},
+		{time.Minute, 2},
+		{-1, 4},
+	} {
+		client.gets = nil
+		store := New(client, CacheTTL(test.ttl))
+		store.now = func() time.Time { return now }
+		for _, d := range []time.Duration{0, time.Second, 2 * time.Minute, 2 * time.Minute} {
+			now = time.Unix(0, 0).Add(d)
+			if b, err := store.ReadFile("a"); err != nil || string(b) != "1" {
+				t.Fatalf("unexpected content %q, %v", b, err)
+			}
+		}
+		if len(client.gets) != test.reads {
+			t.Errorf("ttl %v: expected %d reads got %d", test.ttl, test.reads, len(client.gets))
+		}
+	}
+
+	client.gets = nil
+	store := New(client)
+	store.ReadFile("a")
+	store.Invalidate("a")
+	store.ReadFile("a")
+	if len(client.gets) != 2 {
+		t.Errorf("expected the invalidated file to be read again, got %d reads", len(client.gets))
+	}
+}
@@ -5,110 +5,282 @@ package mustache
 import (
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
 type parser struct {
-	lexer  *lexer
-	escape escapeType
-	buf    []token
+	lexer            *lexer
+	escape           escapeType
+	buf              []token
+	typeTestSections bool
+	switchSections   bool
+	countSections    bool
+	paginate         bool
+	chunkSections    bool
+	zipSections      bool
+	letSections      bool
+	captureSections  bool
+	coalesceTags     bool
+	filterPipes      bool
+	translateTags    bool
+	formatOptions    bool
+	customizers      map[string]customizerFunc // the functions filters may name
+	inSwitch         bool                      // whether parsing the body of a switch
+	consts           map[string]string         // shared with sub parsers
+	starts           map[int]Position          // the positions of the tags recorded by offset, shared with sub parsers
+	last             token                     // the last token read
+	tag              token                     // the delimiter opening the tag being parsed
+	body             span                      // the content of the last section parsed
 }
 
 // read returns the next token from the lexer and advances the cursor. This
 // token will not be available by the parser after it has been read.
 func (p *parser) read() token {
 	if len(p.buf) > 0 {
-		r := p.buf[0]
+		p.last = p.buf[0]
 		p.buf = p.buf[1:]
-		return r
+		return p.last
 	}
-	return p.lexer.token()
+	p.last = p.lexer.token()
+	return p.last
 }
 
-// readt returns the tokens starting from the current position until the first
-// match of t. Similar to readn it will return an error if a tokenEOF was
-// returned by the lexer before a match was made.
-func (p *parser) readt(t tokenType) ([]token, error) {
-	var tokens []token
+// peek returns the next token from the lexer without advancing the cursor.
+func (p *parser) peek() token {
+	last := p.last
+	t := p.read()
+	p.buf = append([]token{t}, p.buf...)
+	p.last = last
+	return t
+}
+
+// record sets the range of n in the source, from the start of the token start
+// to the end of the last token read, along with the content of the section
+// parsed for n, if any. The position of start is recorded as well, for
+// reporting errors once the source is gone, and set as the position of
+// variables.
+func (p *parser) record(n node, start token) {
+	if s, ok := n.(spanned); ok {
+		s.setSpans(span{start.pos, p.last.pos + len(p.last.val)}, p.body)
+		// Tags start with a delimiter, which holds no line break, so its
+		// start is on the line of its end.
+		p.starts[start.pos] = start.start()
+	}
+	if n, ok := n.(*varNode); ok {
+		pos := start.start()
+		n.line, n.col = pos.Line, pos.Col
+	}
+}
+
+// readBody returns the tokens of the content of the section opened by t,
+// followed by the left delimiter, section end and identifier tokens of its
+// closing tag. Sections are matched by nesting rather than by name, so that
+// sections nested in t, whatever their name, are part of its content. The
+// closing tag of t must repeat the name of t exactly.
+func (p *parser) readBody(t token) ([]token, error) {
+	var (
+		tokens []token
+		depth  int
+	)
+	notFound := func(msg string) error {
+		msg = fmt.Sprintf("failed to find closing tag for section %q opened at %s%s", t.val, p.tag.start(), msg)
+		if strings.ContainsAny(t.val, `"'`) {
+			msg += " (quoted section names must match the opening tag exactly, including quote style)"
+		}
+		return p.errorf(t, "%s", msg)
+	}
 	for {
 		token := p.read()
 		tokens = append(tokens, token)
 		switch token.typ {
 		case tokenEOF:
-			return tokens, fmt.Errorf("token %q not found", t)
+			return nil, notFound("")
 		case tokenError:
 			return nil, p.errorf(token, "%s", token.val)
-		case t:
+		case tokenSectionStart, tokenSectionInverse, tokenSectionFunction, tokenTestValue:
+			depth++
+		case tokenSectionEnd:
+			if depth > 0 {
+				depth--
+				continue
+			}
+			ident := p.read()
+			tokens = append(tokens, ident)
+			if ident.typ == tokenError {
+				return nil, p.errorf(ident, "%s", ident.val)
+			}
+			if ident.typ != tokenIdentifier || ident.val != t.val {
+				return nil, notFound(", found closing tag " + p.closer(tokens[len(tokens)-3], ident))
+			}
 			return tokens, nil
 		}
 	}
 }
 
-// readv returns the tokens starting from the current position until the first
-// match of t. A match is made only of t.typ and t.val are equal to the examined
-// token.
-func (p *parser) readv(t token) ([]token, error) {
-	var tokens []token
-	for {
-		read, err := p.readt(t.typ)
-		tokens = append(tokens, read...)
-		if err != nil {
-			return tokens, err
-		}
-		if len(read) > 0 && read[len(read)-1].val == t.val {
-			break
+// closer returns the closing tag of the identifier ident opened by the left
+// delimiter left, as written in the source but for spaces around the name.
+func (p *parser) closer(left, ident token) string {
+	s := left.val
+	if left.trim {
+		s += " "
+	}
+	s += "/" + ident.val
+	if right := p.peek(); right.typ == tokenRightDelim {
+		if right.trim {
+			s += " "
 		}
+		s += right.val
 	}
-	return tokens, nil
+	return s
 }
 
+// errorf returns a ParseError about the token t. Errors found by the lexer are
+// reported where they were found, and the others at the start of the tag
+// holding t, so that they point at the same position as those found when
+// rendering.
 func (p *parser) errorf(t token, format string, v ...interface{}) error {
-	return fmt.Errorf("%d:%d syntax error: %s", t.line, t.col, fmt.Sprintf(format, v...))
+	pos := t.position()
+	if t.typ != tokenError && p.tag.typ != tokenError {
+		pos = p.tag.start()
+	}
+	return &ParseError{Position: pos, Msg: fmt.Sprintf(format, v...)}
 }
 
 // parse begins parsing based on tokens read from the lexer.
 func (p *parser) parse() ([]node, error) {
-	var nodes []node
+	var (
+		nodes []node
+		trim  bool // the last tag has a trailing trim marker
+	)
 loop:
 	for {
 		token := p.read()
+		if token.typ != tokenText {
+			trim = false
+		}
 		switch token.typ {
 		case tokenEOF:
 			break loop
 		case tokenError:
 			return nil, p.errorf(token, "%s", token.val)
 		case tokenText:
-			nodes = append(nodes, textNode(token.val))
+			if trim {
+				nodes = append(nodes, trimStart([]node{textNode(token.val)})...)
+			} else {
+				nodes = append(nodes, textNode(token.val))
+			}
 		case tokenLeftDelim:
-			node, err := p.parseTag()
+			if token.trim {
+				nodes = trimEnd(nodes)
+			}
+			p.body = span{}
+			p.tag = token
+			node, err := p.parseTag(token)
 			if err != nil {
 				return nodes, err
 			}
+			p.record(node, token)
 			nodes = append(nodes, node)
+			trim = p.last.typ == tokenRightDelim && p.last.trim
 		case tokenRawStart:
-			node, err := p.parseRawTag()
+			p.tag = token
+			node, err := p.parseRawTag(token.val)
 			if err != nil {
 				return nodes, err
 			}
+			p.record(node, token)
 			nodes = append(nodes, node)
 		case tokenSetDelim:
-			nodes = append(nodes, new(delimNode))
+			nodes = append(nodes, delimNode(token.val))
+		case tokenEscape:
+			nodes = append(nodes, trimNode(token.val))
+		case tokenVerbatim:
+			p.body = span{}
+			p.tag = token
+			node, err := p.parseVerbatim()
+			if err != nil {
+				return nodes, err
+			}
+			p.record(node, token)
+			nodes = append(nodes, node)
 		}
 	}
 	return nodes, nil
 }
 
+// trimStart returns nodes with the whitespace at the start of its first node,
+// if it is text, split off into a trimNode.
+func trimStart(nodes []node) []node {
+	if len(nodes) == 0 {
+		return nodes
+	}
+	text, ok := nodes[0].(textNode)
+	if !ok {
+		return nodes
+	}
+	trimmed := textNode(strings.TrimLeftFunc(string(text), whitespace))
+	var out []node
+	if len(trimmed) < len(text) {
+		out = append(out, trimNode(text[:len(text)-len(trimmed)]))
+	}
+	if trimmed != "" {
+		out = append(out, trimmed)
+	}
+	return append(out, nodes[1:]...)
+}
+
+// trimEnd returns nodes with the whitespace at the end of its last node, if it
+// is text, split off into a trimNode.
+func trimEnd(nodes []node) []node {
+	if len(nodes) == 0 {
+		return nodes
+	}
+	text, ok := nodes[len(nodes)-1].(textNode)
+	if !ok {
+		return nodes
+	}
+	trimmed := textNode(strings.TrimRightFunc(string(text), whitespace))
+	nodes = nodes[:len(nodes)-1]
+	if trimmed != "" {
+		nodes = append(nodes, trimmed)
+	}
+	if len(trimmed) < len(text) {
+		nodes = append(nodes, trimNode(text[len(trimmed):]))
+	}
+	return nodes
+}
+
+// parseVerbatim parses a raw block. It is assumed that the tag opening the
+// block was already read by the parser.
+func (p *parser) parseVerbatim() (node, error) {
+	text := p.read()
+	if text.typ != tokenText {
+		return nil, p.errorf(text, "unexpected token %s", text)
+	}
+	if end := p.read(); end.typ != tokenVerbatim {
+		return nil, p.errorf(end, "unexpected token %s", end)
+	}
+	p.body = span{text.pos, text.pos + len(text.val)}
+	return &verbatimNode{text: text.val}, nil
+}
+
 // parseTag parses a beginning of a mustache tag. It is assumed that a leftDelim
-// was already read by the parser.
-func (p *parser) parseTag() (node, error) {
+// was already read by the parser and is given as left.
+func (p *parser) parseTag(left token) (node, error) {
+	open := left.val
+	if left.trim {
+		// A trim marker is separated from the rest of the tag.
+		open += " "
+	}
 	token := p.read()
 	switch token.typ {
 	case tokenIdentifier:
-		return p.parseVar(token, p.escape)
+		return p.parseVar(token, p.escape, open)
 	case tokenRawStart:
-		return p.parseRawTag()
+		return p.parseRawTag(open + token.val)
 	case tokenRawAlt:
-		return p.parseVar(p.read(), noEscape)
+		return p.parseVar(p.read(), noEscape, open+token.val)
 	case tokenComment:
 		return p.parseComment()
 	case tokenSectionInverse:
@@ -116,46 +288,180 @@ func (p *parser) parseTag() (node, error) {
 	case tokenSectionStart:
 		return p.parseSection(false)
 	case tokenSectionFunction:
-		return p.parseFunctionSection()
+		return p.parseFunctionSection(left)
 	case tokenTestValue:
 		return p.parseTest()
 	case tokenPartial:
 		return p.parsePartial()
+	case tokenConst:
+		return p.parseConst()
 	}
 	return nil, p.errorf(token, "unreachable code %s", token)
 }
 
 // parseRawTag parses a simple variable tag. It is assumed that the read from
-// the parser should return an identifier.
-func (p *parser) parseRawTag() (node, error) {
+// the parser should return an identifier. The open argument holds the source
+// text preceding the identifier.
+func (p *parser) parseRawTag(open string) (node, error) {
 	t := p.read()
 	if t.typ != tokenIdentifier {
 		return nil, p.errorf(t, "unexpected token %s", t)
 	}
-	if next := p.read(); next.typ != tokenRawEnd {
+	rawEnd := p.read()
+	if rawEnd.typ != tokenRawEnd {
 		return nil, p.errorf(t, "unexpected token %s", t)
 	}
-	if next := p.read(); next.typ != tokenRightDelim {
+	right := p.read()
+	if right.typ != tokenRightDelim {
 		return nil, p.errorf(t, "unexpected token %s", t)
 	}
-	path, err := parsePath(t.val)
-	if err != nil {
-		return nil, p.errorf(t, "%s", err)
-	}
-	return &varNode{name: t.val, path: path, escape: noEscape}, nil
+	return p.newVar(t, noEscape, open+t.val+rawEnd.val+right.val)
 }
 
 // parseVar parses a simple variable tag. It is assumed that the read from the
-// parser should return an identifier.
-func (p *parser) parseVar(ident token, escape escapeType) (node, error) {
-	if t := p.read(); t.typ != tokenRightDelim {
-		return nil, p.errorf(t, "unexpected token %s", t)
+// parser should return an identifier. The open argument holds the source text
+// preceding the identifier.
+func (p *parser) parseVar(ident token, escape escapeType, open string) (node, error) {
+	right := p.read()
+	if right.typ != tokenRightDelim {
+		return nil, p.errorf(right, "unexpected token %s", right)
+	}
+	end := right.val
+	if right.trim {
+		end = " " + end
+	}
+	return p.newVar(ident, escape, open+ident.val+end)
+}
+
+// newVar returns the node for a variable tag with the identifier ident, tag
+// being the source of the whole tag.
+func (p *parser) newVar(ident token, escape escapeType, tag string) (node, error) {
+	if p.translateTags {
+		if splits := strings.SplitN(ident.val, " ", 2); len(splits) > 1 && splits[0] == "_" {
+			return p.parseTranslate(ident, strings.TrimSpace(splits[1]), escape)
+		}
+	}
+	if p.coalesceTags {
+		if splits := strings.SplitN(ident.val, " ", 2); len(splits) > 1 && splits[0] == "coalesce" {
+			return p.parseCoalesce(ident, strings.TrimSpace(splits[1]), escape)
+		}
+	}
+	name := ident.val
+	var filters []filter
+	if p.filterPipes {
+		if stages := splitPipes(ident.val); len(stages) > 1 {
+			name = strings.TrimSpace(stages[0])
+			for _, stage := range stages[1:] {
+				f, err := parseFilter(stage)
+				if err != nil {
+					return nil, p.errorf(ident, "%s", err)
+				}
+				if p.customizers[f.name] == nil {
+					return nil, p.errorf(ident, "unknown filter %q", f.name)
+				}
+				filters = append(filters, f)
+			}
+		}
 	}
-	path, err := parsePath(ident.val)
+	var format string
+	if p.formatOptions {
+		if m := formatOptionRe.FindStringSubmatch(name); m != nil {
+			name, format = m[1], optionUnescaper.Replace(m[2])
+		}
+	}
+	path, err := parsePath(name)
 	if err != nil {
 		return nil, p.errorf(ident, "%s", err)
 	}
-	return &varNode{name: ident.val, path: path, escape: escape}, nil
+	return &varNode{
+		name:    name,
+		path:    path,
+		escape:  escape,
+		filters: filters,
+		format:  format,
+		tag:     tag,
+	}, nil
+}
+
+// formatOptionRe matches a variable name followed by a format option, as in
+// `created_at format="Jan 2"`.
+var formatOptionRe = regexp.MustCompile(`^(.*?)\s+format="((?:[^"\\]|\\.)*)"$`)
+
+// splitPipes splits the identifier of a variable tag on the pipes which are
+// not within quotes, e.g. `name | trim | upper` into the name and two stages.
+func splitPipes(s string) []string {
+	var stages []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '|':
+			stages = append(stages, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(stages, s[start:])
+}
+
+// filterArgRe matches the name and arguments of a filter stage, each being
+// quoted or a run of non-space characters.
+var filterArgRe = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"|([^\s"]+)`)
+
+// parseFilter parses a stage of a variable tag with filters, such as `upper`
+// or `truncate 20 "..."`.
+func parseFilter(stage string) (filter, error) {
+	matches := filterArgRe.FindAllStringSubmatchIndex(stage, -1)
+	if len(matches) == 0 || matches[0][4] < 0 {
+		return filter{}, fmt.Errorf("invalid filter %q", strings.TrimSpace(stage))
+	}
+	f := filter{name: stage[matches[0][4]:matches[0][5]]}
+	for _, m := range matches[1:] {
+		if m[2] >= 0 {
+			f.args = append(f.args, optionUnescaper.Replace(stage[m[2]:m[3]]))
+		} else {
+			f.args = append(f.args, stage[m[4]:m[5]])
+		}
+	}
+	return f, nil
+}
+
+// coalesceArgRe matches a single argument of a coalesce tag, which is either
+// a quoted literal or an identifier which may contain quoted keys.
+var coalesceArgRe = regexp.MustCompile(`^\s*(?:("(?:[^"\\]|\\.)*")(?:\s|$)|((?:[^\s"']|"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*')+))`)
+
+// parseCoalesce parses the arguments of a coalesce tag such as
+// {{coalesce nickname first_name "there"}}.
+func (p *parser) parseCoalesce(t token, args string, escape escapeType) (node, error) {
+	n := &coalesceNode{escape: escape}
+	for rest := args; strings.TrimSpace(rest) != ""; {
+		m := coalesceArgRe.FindStringSubmatch(rest)
+		if m == nil {
+			return nil, p.errorf(t, "invalid coalesce argument %q", strings.TrimSpace(rest))
+		}
+		rest = rest[len(m[0]):]
+		if m[1] != "" {
+			literal, err := strconv.Unquote(m[1])
+			if err != nil {
+				return nil, p.errorf(t, "invalid coalesce literal %s", m[1])
+			}
+			n.args = append(n.args, coalesceArg{literal: literal})
+			continue
+		}
+		path, err := parsePath(m[2])
+		if err != nil {
+			return nil, p.errorf(t, "%s", err)
+		}
+		n.args = append(n.args, coalesceArg{ident: m[2], path: path})
+	}
+	return n, nil
 }
 
 // parseComment parses a comment block. It is assumed that the next read should
@@ -170,7 +476,7 @@ func (p *parser) parseComment() (node, error) {
 		case tokenError:
 			return nil, p.errorf(t, "%s", t.val)
 		case tokenRightDelim:
-			return commentNode(comment), nil
+			return &commentNode{text: comment}, nil
 		default:
 			comment += t.val
 		}
@@ -185,6 +491,77 @@ func (p *parser) parseSection(inverse bool) (node, error) {
 		return nil, p.errorf(t, "unexpected token %s", t)
 	}
 
+	if p.switchSections && !inverse {
+		splits := strings.SplitN(t.val, " ", 2)
+		switch {
+		case splits[0] == "switch" && len(splits) > 1:
+			return p.parseSwitch(t, strings.TrimSpace(splits[1]))
+		case splits[0] == "case" && len(splits) > 1:
+			if !p.inSwitch {
+				return nil, p.errorf(t, "case %s outside of a switch", strings.TrimSpace(splits[1]))
+			}
+			return p.parseCase(t, strings.TrimSpace(splits[1]))
+		case t.val == "default" && p.inSwitch:
+			return p.parseCase(t, "")
+		}
+	}
+
+	if p.countSections {
+		if splits := strings.SplitN(t.val, " ", 2); len(splits) > 1 && (splits[0] == "min_count" || splits[0] == "max_count") {
+			return p.parseCount(t, splits[0], strings.TrimSpace(splits[1]), inverse)
+		}
+	}
+
+	if p.chunkSections && !inverse {
+		if splits := strings.SplitN(t.val, " ", 2); len(splits) > 1 && splits[0] == "chunk" {
+			return p.parseChunk(t, strings.TrimSpace(splits[1]))
+		}
+	}
+
+	if p.zipSections && !inverse {
+		if splits := strings.SplitN(t.val, " ", 2); len(splits) > 1 && splits[0] == "zip" {
+			return p.parseZip(t, strings.TrimSpace(splits[1]))
+		}
+	}
+
+	if p.letSections && !inverse {
+		if splits := strings.SplitN(t.val, " ", 2); len(splits) > 1 && splits[0] == "let" {
+			return p.parseLet(t, strings.TrimSpace(splits[1]))
+		}
+	}
+
+	if p.captureSections && !inverse {
+		if splits := strings.SplitN(t.val, " ", 2); len(splits) > 1 && splits[0] == "capture" {
+			return p.parseCapture(t, strings.TrimSpace(splits[1]))
+		}
+	}
+
+	if p.typeTestSections {
+		if splits := strings.SplitN(t.val, " ", 2); len(splits) > 1 {
+			if _, ok := typeTests[splits[0]]; ok {
+				return p.parseTypeTest(t, splits[0], strings.TrimSpace(splits[1]), inverse)
+			}
+		}
+	}
+
+	offset, limit := 0, 0
+	if p.paginate {
+		if m := paginationRe.FindStringSubmatch(t.val); m != nil {
+			t.val = m[1]
+			for _, arg := range paginationArgRe.FindAllStringSubmatch(m[2], -1) {
+				n, err := strconv.Atoi(arg[2])
+				if err != nil || n < 0 || (arg[1] == "limit" && n == 0) {
+					return nil, p.errorf(t, "invalid %s %q for section %q", arg[1], arg[2], t.val)
+				}
+				if arg[1] == "offset" {
+					offset = n
+				} else {
+					limit = n
+				}
+			}
+		}
+	}
+
 	path, err := parsePath(t.val)
 	if err != nil {
 		return nil, p.errorf(t, "%s", err)
@@ -200,28 +577,455 @@ func (p *parser) parseSection(inverse bool) (node, error) {
 		path:     path,
 		inverted: inverse,
 		elems:    nodes,
+		offset:   offset,
+		limit:    limit,
 	}
 	return section, nil
 }
 
-func (p *parser) parseFunctionSection() (node, error) {
+var (
+	// paginationRe matches a section name followed by offset and limit
+	// arguments, e.g. items offset="10" limit="5".
+	paginationRe = regexp.MustCompile(`^(.*?)((?:\s+(?:offset|limit)\s*=\s*"[^"]*")+)\s*$`)
+	// paginationArgRe matches a single offset or limit argument.
+	paginationArgRe = regexp.MustCompile(`(offset|limit)\s*=\s*"([^"]*)"`)
+)
+
+// parseTypeTest parses a type test section such as {{#is_list items}}. The
+// section is closed by the test name alone, e.g. {{/is_list}}.
+func (p *parser) parseTypeTest(t token, kind, ident string, inverse bool) (node, error) {
+	path, err := parsePath(ident)
+	if err != nil {
+		return nil, p.errorf(t, "%s", err)
+	}
+
+	t.val = kind
+	nodes, err := p.parseSectionInternal(t)
+	if err != nil {
+		return nil, err
+	}
+
+	section := &typeTestNode{
+		kind:     kind,
+		name:     ident,
+		path:     path,
+		inverted: inverse,
+		elems:    nodes,
+	}
+	return section, nil
+}
+
+// parseSwitch parses a {{#switch ident}} section. The only elements allowed
+// directly within a switch are case and default sections, optionally separated
+// by whitespace.
+func (p *parser) parseSwitch(t token, ident string) (node, error) {
+	path, err := parsePath(ident)
+	if err != nil {
+		return nil, p.errorf(t, "%s", err)
+	}
+
+	t.val = "switch"
+	nodes, err := p.parseBody(t, true)
+	if err != nil {
+		return nil, err
+	}
+
+	section := &switchNode{
+		name:  ident,
+		path:  path,
+		cases: make(map[string][]node),
+	}
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *caseNode:
+			if n.isDefault {
+				if section.hasDefault {
+					return nil, p.errorf(t, "duplicate default in switch %q", ident)
+				}
+				section.hasDefault = true
+				section.defaultElems = n.elems
+				section.defaultSpans = n.spans
+				continue
+			}
+			if _, ok := section.cases[n.value]; ok {
+				return nil, p.errorf(t, "duplicate case %q in switch %q", n.value, ident)
+			}
+			section.cases[n.value] = n.elems
+			section.values = append(section.values, n.value)
+			section.caseSpans = append(section.caseSpans, n.spans)
+		case textNode:
+			if strings.TrimSpace(string(n)) != "" {
+				return nil, p.errorf(t, "unexpected text %q in switch %q", string(n), ident)
+			}
+		case *commentNode, trimNode:
+		default:
+			return nil, p.errorf(t, "unexpected %s in switch %q", n, ident)
+		}
+	}
+	return section, nil
+}
+
+// parseCase parses a {{#case "value"}} or {{#default}} section. The value may
+// be given with or without quotes. An empty value denotes the default case.
+func (p *parser) parseCase(t token, value string) (node, error) {
+	isDefault := t.val == "default"
+	if !isDefault {
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		t.val = "case"
+	}
+
+	nodes, err := p.parseSectionInternal(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return &caseNode{value: value, isDefault: isDefault, elems: nodes}, nil
+}
+
+// parseCount parses a threshold section such as {{#min_count items 3}}. The
+// arguments are an identifier followed by a non-negative integer, and the
+// section is closed by the section name alone, e.g. {{/min_count}}.
+func (p *parser) parseCount(t token, kind, args string, inverse bool) (node, error) {
+	ident, path, count, err := p.parseIdentCount(t, kind, args)
+	if err != nil {
+		return nil, err
+	}
+
+	t.val = kind
+	nodes, err := p.parseSectionInternal(t)
+	if err != nil {
+		return nil, err
+	}
+
+	section := &countNode{
+		kind:     kind,
+		name:     ident,
+		path:     path,
+		count:    count,
+		inverted: inverse,
+		elems:    nodes,
+	}
+	return section, nil
+}
+
+// parseChunk parses a {{#chunk items 3}} section. The arguments are an
+// identifier followed by a positive integer, and the section is closed by
+// {{/chunk}}.
+func (p *parser) parseChunk(t token, args string) (node, error) {
+	ident, path, size, err := p.parseIdentCount(t, "chunk", args)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, p.errorf(t, "invalid chunk size %d", size)
+	}
+
+	t.val = "chunk"
+	nodes, err := p.parseSectionInternal(t)
+	if err != nil {
+		return nil, err
+	}
+
+	section := &chunkNode{
+		name:  ident,
+		path:  path,
+		size:  size,
+		elems: nodes,
+	}
+	return section, nil
+}
+
+// parseZip parses a {{#zip a b}} section. The two identifiers may be followed
+// by an as="x y" argument naming the variables exposed for each pair, and the
+// section is closed by {{/zip}}.
+func (p *parser) parseZip(t token, args string) (node, error) {
+	names := [2]string{"@a", "@b"}
+	if m := zipAsRe.FindStringSubmatch(args); m != nil {
+		as := strings.Fields(m[2])
+		if len(as) != 2 {
+			return nil, p.errorf(t, "zip requires two names in as=%q", m[2])
+		}
+		names = [2]string{"@" + as[0], "@" + as[1]}
+		args = m[1]
+	}
+	idents := strings.Fields(args)
+	if len(idents) != 2 {
+		return nil, p.errorf(t, "zip requires two identifiers, got %q", args)
+	}
+	var paths [2][]pathSegment
+	for i, ident := range idents {
+		path, err := parsePath(ident)
+		if err != nil {
+			return nil, p.errorf(t, "%s", err)
+		}
+		paths[i] = path
+	}
+
+	t.val = "zip"
+	nodes, err := p.parseSectionInternal(t)
+	if err != nil {
+		return nil, err
+	}
+
+	section := &zipNode{
+		idents: [2]string{idents[0], idents[1]},
+		paths:  paths,
+		names:  names,
+		elems:  nodes,
+	}
+	return section, nil
+}
+
+// zipAsRe matches the arguments of a zip section ending in an as argument.
+var zipAsRe = regexp.MustCompile(`^(.*?)\s+as\s*=\s*"([^"]*)"\s*$`)
+
+// letBindingRe matches a single binding of a let section, where the value is
+// either a quoted literal or an identifier which may contain quoted keys.
+var letBindingRe = regexp.MustCompile(`^\s*([^\s="']+)\s*=\s*(?:("(?:[^"\\]|\\.)*")|((?:[^\s"']|"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*')+))`)
+
+// pipedBindingRe is letBindingRe for the bindings of let sections with
+// FilterPipes, where a pipe outside of quoted keys ends the identifier.
+var pipedBindingRe = regexp.MustCompile(`^\s*([^\s="']+)\s*=\s*(?:("(?:[^"\\]|\\.)*")|((?:[^\s"'|]|"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*')+))`)
+
+// pipeRe matches the pipe starting a filter stage of a binding.
+var pipeRe = regexp.MustCompile(`^\s*\|`)
+
+// stageWordRe matches the name or an argument of a filter stage of a binding,
+// and bindingStartRe the start of the next binding, which ends the stage.
+var (
+	stageWordRe    = regexp.MustCompile(`^\s*(?:"(?:[^"\\]|\\.)*"|[^\s"|]+)`)
+	bindingStartRe = regexp.MustCompile(`^\s*[^\s="'|]+\s*=`)
+)
+
+// parseLet parses the bindings of a let section such as
+// {{#let total=order.total label="Total"}}.
+func (p *parser) parseLet(t token, args string) (node, error) {
+	bindings, err := p.parseBindings(t, args, "let")
+	if err != nil {
+		return nil, err
+	}
+
+	t.val = "let"
+	nodes, err := p.parseSectionInternal(t)
+	if err != nil {
+		return nil, err
+	}
+	return &letNode{bindings: bindings, elems: nodes}, nil
+}
+
+// parseBindings parses bindings such as total=order.total label="Total", as
+// given to a let section or a translation tag, kind. With FilterPipes, the
+// values of let bindings may be followed by filters, as in
+// total=order.total | money "EUR".
+func (p *parser) parseBindings(t token, args, kind string) ([]letBinding, error) {
+	var bindings []letBinding
+	pipes := p.filterPipes && kind == "let"
+	bindingRe := letBindingRe
+	if pipes {
+		bindingRe = pipedBindingRe
+	}
+	for rest := args; strings.TrimSpace(rest) != ""; {
+		m := bindingRe.FindStringSubmatch(rest)
+		if m == nil {
+			return nil, p.errorf(t, "invalid %s binding %q", kind, strings.TrimSpace(rest))
+		}
+		rest = rest[len(m[0]):]
+		b := letBinding{name: m[1]}
+		if m[2] != "" {
+			literal, err := strconv.Unquote(m[2])
+			if err != nil {
+				return nil, p.errorf(t, "invalid %s value %s", kind, m[2])
+			}
+			b.literal = literal
+		} else {
+			path, err := parsePath(m[3])
+			if err != nil {
+				return nil, p.errorf(t, "%s", err)
+			}
+			b.ident, b.path = m[3], path
+		}
+		for pipes {
+			m := pipeRe.FindStringIndex(rest)
+			if m == nil {
+				break
+			}
+			rest = rest[m[1]:]
+			stage := stageLen(rest)
+			f, err := parseFilter(rest[:stage])
+			if err != nil {
+				return nil, p.errorf(t, "%s", err)
+			}
+			if p.customizers[f.name] == nil {
+				return nil, p.errorf(t, "unknown filter %q", f.name)
+			}
+			b.filters = append(b.filters, f)
+			rest = rest[stage:]
+		}
+		bindings = append(bindings, b)
+	}
+	return bindings, nil
+}
+
+// stageLen returns the length of the filter stage at the start of s, which
+// ends before the next pipe or binding. Arguments containing an equals sign
+// must therefore be quoted.
+func stageLen(s string) int {
+	n := 0
+	for {
+		if n > 0 && bindingStartRe.MatchString(s[n:]) {
+			return n
+		}
+		m := stageWordRe.FindStringIndex(s[n:])
+		if m == nil {
+			return n
+		}
+		n += m[1]
+	}
+}
+
+// translateKeyRe matches the quoted message key of a translation tag.
+var translateKeyRe = regexp.MustCompile(`^"(?:[^"\\]|\\.)*"`)
+
+// parseTranslate parses the key and arguments of a translation tag such as
+// {{_ "cart.items" count=cart.size}}.
+func (p *parser) parseTranslate(t token, args string, escape escapeType) (node, error) {
+	quoted := translateKeyRe.FindString(args)
+	if quoted == "" {
+		return nil, p.errorf(t, "translation key must be quoted: %q", args)
+	}
+	key, err := strconv.Unquote(quoted)
+	if err != nil {
+		return nil, p.errorf(t, "invalid translation key %s", quoted)
+	}
+	rest := args[len(quoted):]
+	if rest != "" && rest[0] != ' ' {
+		return nil, p.errorf(t, "invalid translation key %s", args)
+	}
+	bindings, err := p.parseBindings(t, rest, "translation")
+	if err != nil {
+		return nil, err
+	}
+	return &translateNode{key: key, args: bindings, escape: escape}, nil
+}
+
+// parseCapture parses a capture section. The name under which the output is
+// captured may be quoted.
+func (p *parser) parseCapture(t token, name string) (node, error) {
+	if strings.HasPrefix(name, `"`) {
+		unquoted, err := strconv.Unquote(name)
+		if err != nil {
+			return nil, p.errorf(t, "invalid capture name %s", name)
+		}
+		name = unquoted
+	}
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return nil, p.errorf(t, "invalid capture name %q", name)
+	}
+
+	t.val = "capture"
+	nodes, err := p.parseSectionInternal(t)
+	if err != nil {
+		return nil, err
+	}
+	return &captureNode{name: name, elems: nodes}, nil
+}
+
+// parseIdentCount splits the arguments of a section such as min_count or
+// chunk into the identifier and the non-negative integer following it.
+func (p *parser) parseIdentCount(t token, kind, args string) (string, []pathSegment, int, error) {
+	i := strings.LastIndexAny(args, " \t")
+	if i < 0 {
+		return "", nil, 0, p.errorf(t, "%s requires an identifier and a count", kind)
+	}
+	ident := strings.TrimSpace(args[:i])
+	count, err := strconv.Atoi(args[i+1:])
+	if err != nil || count < 0 {
+		return "", nil, 0, p.errorf(t, "invalid %s count %q", kind, args[i+1:])
+	}
+	path, err := parsePath(ident)
+	if err != nil {
+		return "", nil, 0, p.errorf(t, "%s", err)
+	}
+	return ident, path, count, nil
+}
+
+// parseFunctionSection parses a function section. It is assumed that left,
+// the left delimiter of the tag, and the function section token were already
+// read by the parser. Options are given as key="value" pairs, or as
+// key={{ident}} pairs whose value is looked up in the context when rendering.
+// Quoted values may hold the delimiters, and a backslash escapes a quote or a
+// backslash in them. Variables in quoted values, as in token="{{sep}}", are
+// interpolated when rendering. Values given without a key, quoted or not, as
+// in {{~join ", "}}, are positional arguments, kept in order.
+func (p *parser) parseFunctionSection(left token) (node, error) {
 	t := p.read()
 	if t.typ != tokenIdentifier {
 		return nil, p.errorf(t, "unexpected token %s", t)
 	}
 
-	var opts map[string]string
+	var (
+		opts     map[string]string
+		optPaths map[string][]pathSegment
+		optParts map[string][]optionPart
+		args     []string
+	)
 	splits := strings.SplitN(t.val, " ", 2)
 	if len(splits) > 1 {
 		t.val = splits[0]
 
 		opts = make(map[string]string)
 
-		r := regexp.MustCompile(`\s*([a-zA-Z][a-zA-Z0-9_]*)\s*=\s*"(.*?)"`)
-		matches := r.FindAllStringSubmatch(splits[1], 16)
+		// The delimiters of the tag may hold trim markers, which the
+		// delimiters of option values do not.
+		start, end := left.val, p.peek().val
+		if left.trim {
+			start = strings.TrimSuffix(start, trimMarker)
+		}
+		if p.peek().trim {
+			end = strings.TrimPrefix(end, trimMarker)
+		}
+		tag := regexp.QuoteMeta(start) + `\s*(.*?)\s*` + regexp.QuoteMeta(end)
+		tagRe := regexp.MustCompile(tag)
+		r := regexp.MustCompile(`\s*(?:([a-zA-Z][a-zA-Z0-9_]*)\s*=\s*(?:"((?:[^"\\]|\\.)*)"|` + tag + `)` +
+			`|"((?:[^"\\]|\\.)*)"|([^\s"=]+))`)
+		matches := r.FindAllStringSubmatchIndex(splits[1], -1)
 
 		for _, match := range matches {
-			opts[match[1]] = match[2]
+			switch {
+			case match[8] >= 0:
+				args = append(args, optionUnescaper.Replace(splits[1][match[8]:match[9]]))
+				continue
+			case match[10] >= 0:
+				args = append(args, splits[1][match[10]:match[11]])
+				continue
+			}
+			key := splits[1][match[2]:match[3]]
+			if match[6] < 0 {
+				value := optionUnescaper.Replace(splits[1][match[4]:match[5]])
+				parts, err := parseOptionParts(value, tagRe)
+				if err != nil {
+					return nil, p.errorf(t, "%s", err)
+				}
+				if parts == nil {
+					opts[key] = value
+					continue
+				}
+				if optParts == nil {
+					optParts = make(map[string][]optionPart)
+				}
+				optParts[key] = parts
+				continue
+			}
+			path, err := parsePath(splits[1][match[6]:match[7]])
+			if err != nil {
+				return nil, p.errorf(t, "%s", err)
+			}
+			if optPaths == nil {
+				optPaths = make(map[string][]pathSegment)
+			}
+			optPaths[key] = path
 		}
 	}
 
@@ -231,13 +1035,55 @@ func (p *parser) parseFunctionSection() (node, error) {
 	}
 
 	f := &functionSectionNode{
-		name:  t.val,
-		opts:  opts,
-		elems: nodes,
+		name:     t.val,
+		opts:     opts,
+		elems:    nodes,
+		optPaths: optPaths,
+		optParts: optParts,
+		args:     args,
 	}
 	return f, nil
 }
 
+// parseOptionParts splits the quoted option value s into literal text and the
+// variables interpolated in it, whose tags are matched by tag. It returns nil
+// if s interpolates no variables.
+func parseOptionParts(s string, tag *regexp.Regexp) ([]optionPart, error) {
+	matches := tag.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return nil, nil
+	}
+	var parts []optionPart
+	last := 0
+	for _, match := range matches {
+		if match[0] > last {
+			parts = append(parts, optionPart{literal: s[last:match[0]]})
+		}
+		path, err := parsePath(s[match[2]:match[3]])
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, optionPart{path: path})
+		last = match[1]
+	}
+	if last < len(s) {
+		parts = append(parts, optionPart{literal: s[last:]})
+	}
+	return parts, nil
+}
+
+// optionUnescaper and optionEscaper convert the quoted values of function
+// options from and to their source, in which a backslash escapes a quote or
+// another backslash, as in suffix="\"}}\"".
+var (
+	optionUnescaper = strings.NewReplacer(`\"`, `"`, `\\`, `\`)
+	optionEscaper   = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// bareArgRe matches the positional arguments of function sections which may be
+// given without quotes.
+var bareArgRe = regexp.MustCompile(`^[^\s"=]+$`)
+
 // parsePartial parses a partial block. It is assumed that the next read should
 // return a t_ident token.
 func (p *parser) parsePartial() (node, error) {
@@ -248,49 +1094,77 @@ func (p *parser) parsePartial() (node, error) {
 	if next := p.read(); next.typ != tokenRightDelim {
 		return nil, p.errorf(t, "unexpected token %s", t)
 	}
-	return &partialNode{t.val}, nil
+	return &partialNode{name: t.val}, nil
 }
 
-func (p *parser) parseSectionInternal(t token) ([]node, error) {
+// constRe matches the name and quoted value of a constant definition.
+var constRe = regexp.MustCompile(`^([^\s"]+)\s+("(?:[^"\\]|\\.)*")$`)
 
+// parseConst parses a constant definition such as {{=const name "value"}}. It
+// is assumed that the const token was already read by the parser. The value
+// is a Go string literal.
+func (p *parser) parseConst() (node, error) {
+	t := p.read()
+	if t.typ != tokenIdentifier {
+		return nil, p.errorf(t, "unexpected token %s", t)
+	}
 	if next := p.read(); next.typ != tokenRightDelim {
 		return nil, p.errorf(next, "unexpected token %s", next)
 	}
+	m := constRe.FindStringSubmatch(t.val)
+	if m == nil {
+		return nil, p.errorf(t, "invalid constant definition %q", t.val)
+	}
+	value, err := strconv.Unquote(m[2])
+	if err != nil {
+		return nil, p.errorf(t, "invalid constant value %s", m[2])
+	}
+	if _, ok := p.consts[m[1]]; ok {
+		return nil, p.errorf(t, "constant %q already defined", m[1])
+	}
+	p.consts[m[1]] = value
+	return &constNode{name: m[1]}, nil
+}
 
-	var (
-		tokens []token
-		stack  = 1
-	)
-	for {
-		read, err := p.readv(t)
-		if err != nil {
-			msg := fmt.Sprintf("failed to find closing tag for section %q opened at %d:%d", t.val, t.line, t.col)
-			if strings.ContainsAny(t.val, `"'`) {
-				msg += " (quoted section names must match the opening tag exactly, including quote style)"
-			}
-			return nil, fmt.Errorf("%s", msg)
-		}
-		tokens = append(tokens, read...)
-		if len(read) > 1 {
-			// Check the token that preceded the matching identifier. For
-			// section start and inverse tokens we increase the stack for sections or testValue for those special sections, otherwise
-			// decrease.
-			tt := read[len(read)-2]
-			switch tt.typ {
-			case tokenSectionStart, tokenTestValue, tokenSectionInverse, tokenSectionFunction:
-				stack++
-			case tokenSectionEnd:
-				stack--
-			}
-		}
-		if stack == 0 {
-			break
-		}
+func (p *parser) parseSectionInternal(t token) ([]node, error) {
+	return p.parseBody(t, false)
+}
+
+// parseBody parses the body of the section opened by t up to its closing tag.
+// Case and default sections are only recognized in the body of a switch.
+func (p *parser) parseBody(t token, inSwitch bool) ([]node, error) {
+
+	open := p.read()
+	if open.typ != tokenRightDelim {
+		return nil, p.errorf(open, "unexpected token %s", open)
+	}
+
+	tokens, err := p.readBody(t)
+	if err != nil {
+		return nil, err
 	}
-	nodes, err := subParser(tokens[:len(tokens)-3], p.escape).parse()
+	// The content ends at the left delimiter of the closing tag, which is
+	// overwritten when the sub parser appends to the tokens.
+	end := tokens[len(tokens)-3]
+	body := span{open.pos + len(open.val), end.pos}
+	sub := subParser(tokens[:len(tokens)-3], p)
+	sub.inSwitch = inSwitch
+	nodes, err := sub.parse()
 	if err != nil {
 		return nil, err
 	}
+	if open.trim {
+		nodes = trimStart(nodes)
+	}
+	if end.trim {
+		nodes = trimEnd(nodes)
+	}
+	p.body = body
+	// Consume the right delimiter of the closing tag, so that the range of
+	// the section includes it.
+	if p.peek().typ == tokenRightDelim {
+		p.read()
+	}
 
 	return nodes, nil
 }
@@ -338,10 +1212,29 @@ func (p *parser) parseTest() (node, error) {
 
 // newParser creates a new parser using the suppliad lexer.
 func newParser(l *lexer, escape escapeType) *parser {
-	return &parser{lexer: l, escape: escape}
+	return &parser{lexer: l, escape: escape, consts: make(map[string]string), starts: make(map[int]Position)}
 }
 
-// subParser creates a new parser with a pre-defined token buffer.
-func subParser(b []token, escape escapeType) *parser {
-	return &parser{buf: append(b, token{typ: tokenEOF}), escape: escape}
+// subParser creates a new parser with a pre-defined token buffer. The new
+// parser inherits the settings of its parent.
+func subParser(b []token, parent *parser) *parser {
+	return &parser{
+		buf:              append(b, token{typ: tokenEOF}),
+		escape:           parent.escape,
+		typeTestSections: parent.typeTestSections,
+		switchSections:   parent.switchSections,
+		countSections:    parent.countSections,
+		paginate:         parent.paginate,
+		chunkSections:    parent.chunkSections,
+		zipSections:      parent.zipSections,
+		letSections:      parent.letSections,
+		captureSections:  parent.captureSections,
+		coalesceTags:     parent.coalesceTags,
+		filterPipes:      parent.filterPipes,
+		translateTags:    parent.translateTags,
+		formatOptions:    parent.formatOptions,
+		customizers:      parent.customizers,
+		consts:           parent.consts,
+		starts:           parent.starts,
+	}
 }
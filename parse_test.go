@@ -3,9 +3,12 @@
 package mustache
 
 import (
+	"errors"
+	"io"
 	"reflect"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestParser(t *testing.T) {
@@ -16,9 +19,9 @@ func TestParser(t *testing.T) {
 		{
 			"{{#foo}}\n\t{{#foo}}hello nested{{/foo}}{{/foo}}",
 			[]node{
-				&sectionNode{"foo", mustPath("foo"), false, []node{
+				&sectionNode{name: "foo", path: mustPath("foo"), inverted: false, elems: []node{
 					textNode("\n\t"),
-					&sectionNode{"foo", mustPath("foo"), false, []node{
+					&sectionNode{name: "foo", path: mustPath("foo"), inverted: false, elems: []node{
 						textNode("hello nested"),
 					}},
 				}},
@@ -28,20 +31,20 @@ func TestParser(t *testing.T) {
 			"\nfoo {{bar}} {{#alex}}\r\n\tbaz\n{{/alex}} {{!foo}}",
 			[]node{
 				textNode("\nfoo "),
-				&varNode{"bar", mustPath("bar"), htmlEscape},
+				&varNode{name: "bar", path: mustPath("bar"), escape: htmlEscape},
 				textNode(" "),
-				&sectionNode{"alex", mustPath("alex"), false, []node{
+				&sectionNode{name: "alex", path: mustPath("alex"), inverted: false, elems: []node{
 					textNode("\r\n\tbaz\n"),
 				}},
 				textNode(" "),
-				commentNode("foo"),
+				&commentNode{text: "foo"},
 			},
 		},
 		{
 			"this will{{^foo}}not{{/foo}} be rendered",
 			[]node{
 				textNode("this will"),
-				&sectionNode{"foo", mustPath("foo"), true, []node{
+				&sectionNode{name: "foo", path: mustPath("foo"), inverted: true, elems: []node{
 					textNode("not"),
 				}},
 				textNode(" be rendered"),
@@ -50,9 +53,9 @@ func TestParser(t *testing.T) {
 		{
 			"{{#list}}({{.}}){{/list}}",
 			[]node{
-				&sectionNode{"list", mustPath("list"), false, []node{
+				&sectionNode{name: "list", path: mustPath("list"), inverted: false, elems: []node{
 					textNode("("),
-					&varNode{".", mustPath("."), htmlEscape},
+					&varNode{name: ".", path: mustPath("."), escape: htmlEscape},
 					textNode(")"),
 				}},
 			},
@@ -60,9 +63,9 @@ func TestParser(t *testing.T) {
 		{
 			"{{#*}}({{.}}){{/*}}",
 			[]node{
-				&sectionNode{"*", mustPath("*"), false, []node{
+				&sectionNode{name: "*", path: mustPath("*"), inverted: false, elems: []node{
 					textNode("("),
-					&varNode{".", mustPath("."), htmlEscape},
+					&varNode{name: ".", path: mustPath("."), escape: htmlEscape},
 					textNode(")"),
 				}},
 			},
@@ -70,9 +73,9 @@ func TestParser(t *testing.T) {
 		{
 			"{{#list}}({{*}}){{/list}}",
 			[]node{
-				&sectionNode{"list", mustPath("list"), false, []node{
+				&sectionNode{name: "list", path: mustPath("list"), inverted: false, elems: []node{
 					textNode("("),
-					&varNode{"*", mustPath("*"), htmlEscape},
+					&varNode{name: "*", path: mustPath("*"), escape: htmlEscape},
 					textNode(")"),
 				}},
 			},
@@ -80,9 +83,9 @@ func TestParser(t *testing.T) {
 		{
 			"{{#test_value {{foo}} \"bar\"}}({{a}a}}){{/test_value}}",
 			[]node{
-				&testNode{mustPath("foo"), "bar", []node{
+				&testNode{testIdentPath: mustPath("foo"), testVal: "bar", elems: []node{
 					textNode("("),
-					&varNode{"a}a", mustPath("a}a"), htmlEscape},
+					&varNode{name: "a}a", path: mustPath("a}a"), escape: htmlEscape},
 					textNode(")"),
 				}},
 			},
@@ -90,9 +93,9 @@ func TestParser(t *testing.T) {
 		{
 			"{{#test_value {{foo}} \"bar\"}}{{#a}}{{b}}{{/a}}{{/test_value}}",
 			[]node{
-				&testNode{mustPath("foo"), "bar", []node{
-					&sectionNode{"a", mustPath("a"), false, []node{
-						&varNode{"b", mustPath("b"), htmlEscape},
+				&testNode{testIdentPath: mustPath("foo"), testVal: "bar", elems: []node{
+					&sectionNode{name: "a", path: mustPath("a"), inverted: false, elems: []node{
+						&varNode{name: "b", path: mustPath("b"), escape: htmlEscape},
 					}},
 				}},
 			},
@@ -100,9 +103,9 @@ func TestParser(t *testing.T) {
 		{
 			"{{#list}}({{a}a}}){{/list}}",
 			[]node{
-				&sectionNode{"list", mustPath("list"), false, []node{
+				&sectionNode{name: "list", path: mustPath("list"), inverted: false, elems: []node{
 					textNode("("),
-					&varNode{"a}a", mustPath("a}a"), htmlEscape},
+					&varNode{name: "a}a", path: mustPath("a}a"), escape: htmlEscape},
 					textNode(")"),
 				}},
 			},
@@ -111,9 +114,8 @@ func TestParser(t *testing.T) {
 			"{{~customize}}blah blah{{/customize}}",
 			[]node{
 				&functionSectionNode{
-					"customize",
-					nil,
-					[]node{
+					name: "customize",
+					elems: []node{
 						textNode("blah blah"),
 					},
 				},
@@ -123,31 +125,44 @@ func TestParser(t *testing.T) {
 			`{{~customize opt1="value1" opt2="value2"}}blah blah{{/customize}}`,
 			[]node{
 				&functionSectionNode{
-					"customize",
-					map[string]string{"opt1": "value1", "opt2": "value2"},
-					[]node{
+					name: "customize",
+					opts: map[string]string{"opt1": "value1", "opt2": "value2"},
+					elems: []node{
 						textNode("blah blah"),
 					},
 				},
 			},
 		},
+		{
+			`{{~date tz={{ user.tz }} layout="Jan 2"}}{{at}}{{/date}}`,
+			[]node{
+				&functionSectionNode{
+					name:     "date",
+					opts:     map[string]string{"layout": "Jan 2"},
+					optPaths: map[string][]pathSegment{"tz": mustPath("user.tz")},
+					elems: []node{
+						&varNode{name: "at", path: mustPath("at"), escape: htmlEscape},
+					},
+				},
+			},
+		},
 		{
 			`{{ metrics."http.request.count" }}`,
 			[]node{
-				&varNode{`metrics."http.request.count"`, mustPath(`metrics."http.request.count"`), htmlEscape},
+				&varNode{name: `metrics."http.request.count"`, path: mustPath(`metrics."http.request.count"`), escape: htmlEscape},
 			},
 		},
 		{
 			`{{ fields.'service.name'.value }}`,
 			[]node{
-				&varNode{`fields.'service.name'.value`, mustPath(`fields.'service.name'.value`), htmlEscape},
+				&varNode{name: `fields.'service.name'.value`, path: mustPath(`fields.'service.name'.value`), escape: htmlEscape},
 			},
 		},
 		{
 			`{{#config."feature.flags"}}{{enabled}}{{/config."feature.flags"}}`,
 			[]node{
-				&sectionNode{`config."feature.flags"`, mustPath(`config."feature.flags"`), false, []node{
-					&varNode{"enabled", mustPath("enabled"), htmlEscape},
+				&sectionNode{name: `config."feature.flags"`, path: mustPath(`config."feature.flags"`), inverted: false, elems: []node{
+					&varNode{name: "enabled", path: mustPath("enabled"), escape: htmlEscape},
 				}},
 			},
 		},
@@ -157,6 +172,7 @@ func TestParser(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
+		clearPositions(elems)
 		for i, elem := range elems {
 			if !reflect.DeepEqual(elem, test.expected[i]) {
 				t.Errorf("elements are not equal %v != %v", elem, test.expected[i])
@@ -165,6 +181,22 @@ func TestParser(t *testing.T) {
 	}
 }
 
+// clearPositions zeroes the source positions and tags recorded on nodes so
+// that parsed trees can be compared against hand written ones.
+func clearPositions(nodes []node) {
+	for _, n := range nodes {
+		if v, ok := n.(*varNode); ok {
+			v.tag, v.line, v.col = "", 0, 0
+		}
+		if s, ok := n.(spanned); ok {
+			s.setSpans(span{}, span{})
+		}
+		for _, elems := range children(n) {
+			clearPositions(elems)
+		}
+	}
+}
+
 func TestParserNegative(t *testing.T) {
 	for _, test := range []struct {
 		template string
@@ -230,3 +262,95 @@ func TestParserNegative(t *testing.T) {
 		}
 	}
 }
+
+func TestParserNestedSections(t *testing.T) {
+	upper := CustomizeFunction("upper", func(s string) (string, error) { return strings.ToUpper(s), nil })
+	context := map[string]interface{}{
+		"user": map[string]interface{}{"name": "ann", "user": map[string]interface{}{"name": "bob"}},
+		"a":    []int{1},
+		"b":    "x",
+		"s":    "1",
+		"t":    "2",
+	}
+	for _, test := range []struct {
+		template string
+		expected string
+	}{
+		{"{{#user}}{{name}}{{#user}}({{name}}){{/user}}{{user.name}}{{/user}}", "ann(bob)bob"},
+		{"{{# user }}{{name}}{{/ user }}", "ann"},
+		{"{{#is_list a}}[{{#is_list b}}b{{/is_list}}{{^is_list b}}!b{{/is_list}}]{{/is_list}}", "[!b]"},
+		{"{{~upper}}a{{~upper}}b{{/upper}}c{{/upper}}", "ABC"},
+		{`{{#switch s}}{{#case "1"}}{{#switch t}}{{#case "2"}}both{{/case}}{{/switch}}{{/case}}{{/switch}}`, "both"},
+	} {
+		template := New(TypeTestSections(), SwitchSections(), upper)
+		if err := template.ParseString(test.template); err != nil {
+			t.Errorf("%q: %v", test.template, err)
+			continue
+		}
+		output, err := template.RenderString(context)
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expected {
+			t.Errorf("%q: expected %q got %q", test.template, test.expected, output)
+		}
+	}
+
+	for _, test := range []struct {
+		template string
+		expErr   string
+	}{
+		{"{{#is_list a}}{{#is_list b}}{{/is_list}}", `failed to find closing tag for section "is_list" opened at 1:0`},
+		{"{{#a}}{{/b}}{{/a}}", `failed to find closing tag for section "a" opened at 1:0, found closing tag {{/b}}`},
+		{"{{#a}}{{- / b -}}", `failed to find closing tag for section "a" opened at 1:0, found closing tag {{- /b -}}`},
+		{"{{=<% %>=}}<%#a%><%/b%>", `failed to find closing tag for section "a" opened at 1:11, found closing tag <%/b%>`},
+	} {
+		err := New(TypeTestSections()).ParseString(test.template)
+		if err == nil || !strings.Contains(err.Error(), test.expErr) {
+			t.Errorf("expect error: %q, got %q", test.expErr, err)
+		}
+	}
+}
+
+func TestParseReader(t *testing.T) {
+	long := strings.Repeat("x", 3*readSize)
+	for _, source := range []string{
+		"Hello {{name}}!\n{{#items}}\n- {{.}}\n{{/items}}",
+		"{{=<% %>=}}<%#a%>\t<%b%><%/a%> {{c}}",
+		`{{~f opt="a }} b" tz={{user.tz}}}}{{>p}}{{/f}}`,
+		"{{=const c \"v\"}} {{- x -}} \\{{y}} {{{{raw}}}}{{z}}{{{{/raw}}}}",
+		long + "{{a}}" + long + "{{#b}}" + long + "{{/b}}",
+		strings.Repeat("{{#s}}\t日本語 {{v}}\r\n{{/s}}", 2000),
+		"{{#a}}{{b}}",
+		"text {{unclosed\n",
+		"{{{{raw}}}}" + long,
+	} {
+		expected := New(TabWidth(4), EscapeDelimiters())
+		expectedErr := expected.ParseString(source)
+		template := New(TabWidth(4), EscapeDelimiters())
+		err := template.Parse(iotest.OneByteReader(strings.NewReader(source)))
+		// Templates read from a reader have no excerpt in their errors.
+		if perr, ok := expectedErr.(*ParseError); ok {
+			perr.Excerpt = ""
+		}
+		if expectedErr != nil || err != nil {
+			if expectedErr == nil || err == nil || err.Error() != expectedErr.Error() {
+				t.Errorf("expected error %v got %v", expectedErr, err)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(template.Nodes(), expected.Nodes()) {
+			t.Errorf("%.40q: nodes differ from ParseString", source)
+		}
+		if !reflect.DeepEqual(template.Validate(nil), expected.Validate(nil)) {
+			t.Errorf("%.40q: positions differ from ParseString", source)
+		}
+	}
+
+	errRead := errors.New("read failed")
+	template := New()
+	err := template.Parse(io.MultiReader(strings.NewReader("{{#a}}"), iotest.ErrReader(errRead)))
+	if err != errRead {
+		t.Errorf("expected the read error, got %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package mustache
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// GetPath returns the value at the dotted path in ctx, resolved as the
+// renderer resolves the variable of a tag such as {{user.address.city}}: the
+// path may quote keys holding dots, structs are looked up by field name,
+// method and mustache tag, lists by index, and a falsy value ends the walk.
+// It returns an error matching ErrMissingVariable if nothing is found, as the
+// renderer would report with SilentMiss(false).
+func GetPath(ctx interface{}, path string) (interface{}, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	v, _ := lookupPath(segments, ctx)
+	if v == nil {
+		return nil, fmt.Errorf("%w: %s", ErrMissingVariable, path)
+	}
+	return v, nil
+}
+
+// SetPath sets the value at the dotted path in ctx to v, so that GetPath and
+// the renderer find v for the path unless it goes through a pointer, which
+// lookups do not follow. The path is resolved as by GetPath, except that
+// missing maps and nil pointers along the way are created, maps of empty
+// interfaces as map[string]interface{}. ctx must be a map with string
+// keys, or a pointer to a struct or list to set its members in place. Struct
+// members are set through the field of that name or the field with that name
+// in its mustache tag; methods can not be set. v must be assignable to the
+// type of the value it replaces.
+func SetPath(ctx interface{}, path string, v interface{}) error {
+	segments, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 1 && !segments[0].quoted && segments[0].key == "." {
+		return fmt.Errorf("cannot set the whole context")
+	}
+	r := reflect.ValueOf(ctx)
+	switch r.Kind() {
+	case reflect.Map, reflect.Ptr:
+	default:
+		return fmt.Errorf("cannot set %s in context of type %T", path, ctx)
+	}
+	_, err = setPath(r, segments, v, path)
+	return err
+}
+
+// setPath sets the value at path in r to v, returning r, or a changed copy of
+// r if it is a struct or array which can not be set in place.
+func setPath(r reflect.Value, path []pathSegment, v interface{}, raw string) (reflect.Value, error) {
+	seg, rest := path[0], path[1:]
+	switch r.Kind() {
+	case reflect.Interface:
+		if r.IsNil() {
+			return r, fmt.Errorf("cannot set %s: nil value at %q", raw, seg.key)
+		}
+		return setPath(r.Elem(), path, v, raw)
+	case reflect.Ptr:
+		if r.IsNil() {
+			return r, fmt.Errorf("cannot set %s: nil value at %q", raw, seg.key)
+		}
+		_, err := setPath(r.Elem(), path, v, raw)
+		return r, err
+	case reflect.Map:
+		typ := r.Type()
+		if typ.Key().Kind() != reflect.String {
+			return r, fmt.Errorf("cannot set %s: map of type %s has no string keys", raw, typ)
+		}
+		if r.IsNil() {
+			return r, fmt.Errorf("cannot set %s: nil map at %q", raw, seg.key)
+		}
+		key := reflect.ValueOf(seg.key).Convert(typ.Key())
+		child, err := setChild(r.MapIndex(key), typ.Elem(), rest, v, raw)
+		if err != nil {
+			return r, err
+		}
+		r.SetMapIndex(key, child)
+		return r, nil
+	case reflect.Struct:
+		m, ok := structMembersOf(r.Type())[seg.key]
+		var field reflect.Value
+		if ok && m.field != nil {
+			field, _ = r.FieldByIndexErr(m.field)
+			if field.IsValid() && !field.CanInterface() {
+				field = reflect.Value{}
+			}
+		}
+		if !field.IsValid() && ok && m.method < 0 && m.tag >= 0 {
+			field = r.Field(m.tag)
+		}
+		if !field.IsValid() {
+			return r, fmt.Errorf("cannot set %s: no field %q in %s", raw, seg.key, r.Type())
+		}
+		r, field = settable(r, field, func(c reflect.Value) reflect.Value {
+			if m.field != nil {
+				return c.FieldByIndex(m.field)
+			}
+			return c.Field(m.tag)
+		})
+		child, err := setChild(field, field.Type(), rest, v, raw)
+		if err != nil {
+			return r, err
+		}
+		field.Set(child)
+		return r, nil
+	case reflect.Slice, reflect.Array:
+		i, err := strconv.Atoi(seg.key)
+		if err != nil || i < 0 || i >= r.Len() {
+			return r, fmt.Errorf("cannot set %s: no index %q in %s", raw, seg.key, r.Type())
+		}
+		var elem reflect.Value
+		r, elem = settable(r, r.Index(i), func(c reflect.Value) reflect.Value {
+			return c.Index(i)
+		})
+		child, err := setChild(elem, elem.Type(), rest, v, raw)
+		if err != nil {
+			return r, err
+		}
+		elem.Set(child)
+		return r, nil
+	}
+	return r, fmt.Errorf("cannot set %s: value of type %s has no member %q", raw, r.Type(), seg.key)
+}
+
+// settable returns r and its member m, found by member, copying r if m can not
+// be set in place.
+func settable(r, m reflect.Value, member func(reflect.Value) reflect.Value) (reflect.Value, reflect.Value) {
+	if m.CanSet() {
+		return r, m
+	}
+	c := reflect.New(r.Type()).Elem()
+	c.Set(r)
+	return c, member(c)
+}
+
+// setChild returns the value of type typ to store in place of old, the value
+// found for the previous segment of a path: v if rest is empty, and otherwise
+// old with the value at rest set to v, creating old if it is missing.
+func setChild(old reflect.Value, typ reflect.Type, rest []pathSegment, v interface{}, raw string) (reflect.Value, error) {
+	if len(rest) == 0 {
+		if v == nil {
+			switch typ.Kind() {
+			case reflect.Interface, reflect.Map, reflect.Ptr, reflect.Slice, reflect.Func, reflect.Chan:
+				return reflect.Zero(typ), nil
+			}
+		} else if rv := reflect.ValueOf(v); rv.Type().AssignableTo(typ) {
+			return rv, nil
+		}
+		return old, fmt.Errorf("cannot set %s: value of type %T is not assignable to %s", raw, v, typ)
+	}
+	if !old.IsValid() || isNil(old) {
+		switch {
+		case typ.Kind() == reflect.Interface && typ.NumMethod() == 0:
+			old = reflect.ValueOf(make(map[string]interface{}))
+		case typ.Kind() == reflect.Map:
+			old = reflect.MakeMap(typ)
+		case typ.Kind() == reflect.Ptr:
+			old = reflect.New(typ.Elem())
+		case typ.Kind() != reflect.Interface:
+			old = reflect.New(typ).Elem()
+		default:
+			return old, fmt.Errorf("cannot set %s: nil value at %q", raw, rest[0].key)
+		}
+	}
+	return setPath(old, rest, v, raw)
+}
+
+// isNil reports whether r is a nil map, pointer or interface.
+func isNil(r reflect.Value) bool {
+	switch r.Kind() {
+	case reflect.Interface, reflect.Map, reflect.Ptr:
+		return r.IsNil()
+	}
+	return false
+}
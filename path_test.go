@@ -0,0 +1,130 @@
+package mustache
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestGetPath(t *testing.T) {
+	type address struct {
+		City string
+		Zip  string `mustache:"postcode"`
+	}
+	ctx := map[string]interface{}{
+		"user": map[string]interface{}{
+			"address": address{City: "Oslo", Zip: "0150"},
+			"tags":    []interface{}{"a", "b"},
+			"active":  false,
+		},
+		"a.b": "quoted",
+	}
+	for _, test := range []struct {
+		path  string
+		value interface{}
+		err   error
+	}{
+		{"user.address.City", "Oslo", nil},
+		{"user.address.postcode", "0150", nil},
+		{"user.tags.1", "b", nil},
+		{"user.active", false, nil},
+		{`"a.b"`, "quoted", nil},
+		{"user.address.city", nil, ErrMissingVariable},
+		{"user.active.value", nil, ErrMissingVariable},
+		{"missing", nil, ErrMissingVariable},
+	} {
+		v, err := GetPath(ctx, test.path)
+		if !errors.Is(err, test.err) || test.err == nil && err != nil {
+			t.Errorf("%s: expected error %v got %v", test.path, test.err, err)
+		}
+		if v != test.value {
+			t.Errorf("%s: expected %v got %v", test.path, test.value, v)
+		}
+	}
+	if _, err := GetPath(ctx, `"a`); err == nil {
+		t.Error("expected an error for an invalid path")
+	}
+}
+
+func TestSetPath(t *testing.T) {
+	type address struct {
+		City string
+		Zip  string `mustache:"postcode"`
+	}
+	type user struct {
+		Name    string
+		Address address
+		Work    *address
+		Tags    []string
+		Meta    map[string]int
+	}
+
+	ctx := map[string]interface{}{
+		"user": user{Name: "Ann", Tags: []string{"a", "b"}},
+	}
+	for _, test := range []struct {
+		path  string
+		value interface{}
+	}{
+		{"user.Name", "Bob"},
+		{"user.Address.City", "Bergen"},
+		{"user.Address.postcode", "5003"},
+		{"user.Tags.1", "c"},
+		{"user.Meta.visits", 3},
+		{"site.name", "shop"},
+		{`"a.b".c`, true},
+	} {
+		if err := SetPath(ctx, test.path, test.value); err != nil {
+			t.Errorf("%s: unexpected error %v", test.path, err)
+			continue
+		}
+		if v, err := GetPath(ctx, test.path); err != nil || v != test.value {
+			t.Errorf("%s: expected %v got %v (%v)", test.path, test.value, v, err)
+		}
+	}
+	expected := map[string]interface{}{
+		"user": user{
+			Name:    "Bob",
+			Address: address{City: "Bergen", Zip: "5003"},
+			Tags:    []string{"a", "c"},
+			Meta:    map[string]int{"visits": 3},
+		},
+		"site": map[string]interface{}{"name": "shop"},
+		"a.b":  map[string]interface{}{"c": true},
+	}
+	if !reflect.DeepEqual(ctx, expected) {
+		t.Errorf("expected %#v got %#v", expected, ctx)
+	}
+
+	tmpl := New()
+	if err := tmpl.ParseString("{{user.Name}} {{user.Address.postcode}} {{site.name}}"); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := tmpl.RenderString(ctx); s != "Bob 5003 shop" {
+		t.Errorf("expected %q got %q", "Bob 5003 shop", s)
+	}
+
+	u := &user{}
+	if err := SetPath(u, "Work.City", "Oslo"); err != nil || u.Work == nil || u.Work.City != "Oslo" {
+		t.Errorf("expected the struct to be set in place, got %+v (%v)", u, err)
+	}
+
+	for _, test := range []struct {
+		ctx   interface{}
+		path  string
+		value interface{}
+	}{
+		{ctx, ".", 1},
+		{ctx, "user.Name", 1},
+		{ctx, "user.Tags.5", "x"},
+		{ctx, "user.Missing", "x"},
+		{ctx, "user.Name.first", "x"},
+		{user{}, "Name", "x"},
+		{map[int]string{}, "1", "x"},
+		{ctx, `"a`, "x"},
+	} {
+		if err := SetPath(test.ctx, test.path, test.value); err == nil {
+			t.Errorf("%s: expected an error", test.path)
+		}
+	}
+}
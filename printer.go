@@ -0,0 +1,66 @@
+package mustache
+
+import "io"
+
+// EscapeType is the escaping of a printed value, as given to a ValuePrinter.
+// Besides the escapes below, ContextualAutoEscape escapes values after their
+// context, e.g. as URLs or JavaScript, which Escape applies likewise.
+type EscapeType int
+
+// The escapes of the escape modes.
+const (
+	EscapeNone = EscapeType(noEscape)
+	EscapeHTML = EscapeType(htmlEscape)
+	EscapeJSON = EscapeType(jsonEscape)
+)
+
+func (e EscapeType) String() string {
+	return escapeType(e).String()
+}
+
+// Escape returns s escaped as e.
+func (e EscapeType) Escape(s string) string {
+	switch escapeType(e) {
+	case noEscape:
+		return s
+	case htmlEscape:
+		return escapeHtml(s)
+	case jsonEscape:
+		return escapeJson(s)
+	case jsEscape:
+		return jsValue(s)
+	case jsAttrEscape:
+		return escapeAttr(jsValue(s))
+	}
+	return escapeContextual(s, escapeType(e))
+}
+
+// ValuePrinter prints v, the value of a variable, to w, escaped as esc, and
+// reports whether it did. Values it does not handle are printed as usual.
+type ValuePrinter func(w io.Writer, v interface{}, esc EscapeType) (handled bool)
+
+// WithValuePrinter makes f print the values of variables before they are
+// printed as usual, so that applications may choose how values of some types
+// are written, e.g. to redact secrets or format identifiers:
+//
+//	mustache.WithValuePrinter(func(w io.Writer, v interface{}, esc mustache.EscapeType) bool {
+//		if _, ok := v.(Secret); ok {
+//			io.WriteString(w, "[redacted]")
+//			return true
+//		}
+//		return false
+//	})
+//
+// f is given values before the formatting options such as TimeFormat apply.
+// Values passed to filters are printed by f unescaped, with EscapeNone.
+func WithValuePrinter(f ValuePrinter) Option {
+	return func(t *Template) {
+		t.valuePrinter = f
+	}
+}
+
+// printCustom prints v to w with the value printer of t, if any, and reports
+// whether it did.
+func (t *Template) printCustom(w io.Writer, v interface{}, escape escapeType) bool {
+	return t.valuePrinter != nil && t.valuePrinter(w, v, EscapeType(escape))
+}
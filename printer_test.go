@@ -0,0 +1,61 @@
+package mustache
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+type secret string
+
+type uuid [4]byte
+
+func TestWithValuePrinter(t *testing.T) {
+	var escapes []string
+	printer := WithValuePrinter(func(w io.Writer, v interface{}, esc EscapeType) bool {
+		escapes = append(escapes, esc.String())
+		switch v := v.(type) {
+		case secret:
+			io.WriteString(w, "[redacted]")
+			return true
+		case uuid:
+			io.WriteString(w, esc.Escape(fmt.Sprintf("<%x>", v[:])))
+			return true
+		}
+		return false
+	})
+	data := map[string]interface{}{
+		"password": secret("hunter2"),
+		"id":       uuid{0xde, 0xad, 0xbe, 0xef},
+		"name":     "Ann",
+	}
+	for _, test := range []struct {
+		options  []Option
+		template string
+		expected string
+		escapes  string
+	}{
+		{nil, "{{password}} {{id}} {{{id}}} {{name}}", "[redacted] &lt;deadbeef&gt; <deadbeef> Ann", "htmlEscape htmlEscape noEscape htmlEscape"},
+		{[]Option{JsonEscape()}, `{"id": "{{id}}"}`, `{"id": "<deadbeef>"}`, "jsonEscape"},
+		{[]Option{FilterPipes(), CustomizeFunction("upper", func(s string) (string, error) {
+			return strings.ToUpper(s), nil
+		})}, "{{id | upper}}", "&lt;DEADBEEF&gt;", "noEscape htmlEscape"},
+		{[]Option{ContextualAutoEscape()}, `<a href="/u/{{id}}">`, `<a href="/u/%3Cdeadbeef%3E">`, "urlPartEscape"},
+	} {
+		escapes = nil
+		template := New(append(test.options, printer)...)
+		if err := template.ParseString(test.template); err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(data)
+		if err != nil {
+			t.Errorf("%q: %s", test.template, err)
+		} else if output != test.expected {
+			t.Errorf("%q: expected %q got %q", test.template, test.expected, output)
+		}
+		if strings.Join(escapes, " ") != test.escapes {
+			t.Errorf("%q: expected escapes %q got %q", test.template, test.escapes, escapes)
+		}
+	}
+}
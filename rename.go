@@ -0,0 +1,180 @@
+package mustache
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RenameVariable renames the variable old to new in every tag of the template
+// referring to it, including tags referring to a field of it: renaming user
+// to customer turns {{user.name}} into {{customer.name}}. It returns the
+// number of renamed references. Renamed identifiers are written with double
+// quotes around quoted keys.
+//
+// Partials are not renamed. RenameVariable must not be called while the
+// template is being rendered.
+func (t *Template) RenameVariable(old, new string) (int, error) {
+	oldPath, err := parsePath(old)
+	if err != nil {
+		return 0, err
+	}
+	newPath, err := parsePath(new)
+	if err != nil {
+		return 0, err
+	}
+	if old == "" || new == "" {
+		return 0, fmt.Errorf("empty variable name")
+	}
+	r := renamer{old: oldPath, new: newPath}
+	r.nodes(t.elems)
+	return r.count, nil
+}
+
+// RenamePartial renames the partial old to new in every {{>old}} tag of the
+// template, and moves a partial registered as old to new. It returns the
+// number of renamed tags. RenamePartial must not be called while the template
+// is being rendered.
+func (t *Template) RenamePartial(old, new string) (int, error) {
+	if new == "" || strings.ContainsAny(new, " \t\r\n") {
+		return 0, fmt.Errorf("invalid partial name %q", new)
+	}
+	count := 0
+	var rename func(nodes []node)
+	rename = func(nodes []node) {
+		for _, n := range nodes {
+			if p, ok := n.(*partialNode); ok {
+				if p.name == old {
+					p.name = new
+					count++
+				}
+				continue
+			}
+			for _, elems := range children(n) {
+				rename(elems)
+			}
+		}
+	}
+	rename(t.elems)
+	if p, ok := t.partials[old]; ok {
+		delete(t.partials, old)
+		t.partials[new] = p
+	}
+	return count, nil
+}
+
+// children returns the lists of child elements of n.
+func children(n node) [][]node {
+	switch n := n.(type) {
+	case *sectionNode:
+		return [][]node{n.elems}
+	case *functionSectionNode:
+		return [][]node{n.elems}
+	case *testNode:
+		return [][]node{n.elems}
+	case *typeTestNode:
+		return [][]node{n.elems}
+	case *countNode:
+		return [][]node{n.elems}
+	case *chunkNode:
+		return [][]node{n.elems}
+	case *zipNode:
+		return [][]node{n.elems}
+	case *letNode:
+		return [][]node{n.elems}
+	case *captureNode:
+		return [][]node{n.elems}
+	case *caseNode:
+		return [][]node{n.elems}
+	case *switchNode:
+		lists := make([][]node, 0, len(n.cases)+1)
+		for _, elems := range n.cases {
+			lists = append(lists, elems)
+		}
+		return append(lists, n.defaultElems)
+	}
+	return nil
+}
+
+// renamer renames the variable at path old to new.
+type renamer struct {
+	old, new []pathSegment
+	count    int
+}
+
+// path returns the renamed ident and path, and whether path refers to the
+// renamed variable.
+func (r *renamer) path(ident string, path []pathSegment) (string, []pathSegment, bool) {
+	if len(path) < len(r.old) {
+		return ident, path, false
+	}
+	for i, seg := range r.old {
+		if path[i] != seg {
+			return ident, path, false
+		}
+	}
+	renamed := append(append([]pathSegment{}, r.new...), path[len(r.old):]...)
+	r.count++
+	return pathString(renamed), renamed, true
+}
+
+func (r *renamer) nodes(nodes []node) {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *varNode:
+			if name, path, ok := r.path(n.name, n.path); ok {
+				if i := strings.Index(n.tag, n.name); i >= 0 {
+					n.tag = n.tag[:i] + name + n.tag[i+len(n.name):]
+				}
+				n.name, n.path = name, path
+			}
+		case *coalesceNode:
+			for i, arg := range n.args {
+				if arg.path != nil {
+					n.args[i].ident, n.args[i].path, _ = r.path(arg.ident, arg.path)
+				}
+			}
+		case *translateNode:
+			for i, b := range n.args {
+				if b.path != nil {
+					n.args[i].ident, n.args[i].path, _ = r.path(b.ident, b.path)
+				}
+			}
+		case *sectionNode:
+			n.name, n.path, _ = r.path(n.name, n.path)
+		case *functionSectionNode:
+			for k, path := range n.optPaths {
+				_, n.optPaths[k], _ = r.path("", path)
+			}
+			for _, parts := range n.optParts {
+				for i, part := range parts {
+					if part.path != nil {
+						_, parts[i].path, _ = r.path("", part.path)
+					}
+				}
+			}
+		case *testNode:
+			_, n.testIdentPath, _ = r.path("", n.testIdentPath)
+		case *typeTestNode:
+			n.name, n.path, _ = r.path(n.name, n.path)
+		case *countNode:
+			n.name, n.path, _ = r.path(n.name, n.path)
+		case *chunkNode:
+			n.name, n.path, _ = r.path(n.name, n.path)
+		case *zipNode:
+			for i := range n.paths {
+				n.idents[i], n.paths[i], _ = r.path(n.idents[i], n.paths[i])
+			}
+		case *switchNode:
+			n.name, n.path, _ = r.path(n.name, n.path)
+		case *letNode:
+			for i, b := range n.bindings {
+				if b.path != nil {
+					n.bindings[i].ident, n.bindings[i].path, _ = r.path(b.ident, b.path)
+				}
+			}
+		}
+		for _, elems := range children(n) {
+			r.nodes(elems)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package mustache
+
+import (
+	"testing"
+)
+
+func TestRenameVariable(t *testing.T) {
+	template := New(LetSections(), CoalesceTags())
+	err := template.ParseString(`{{user}} {{{ user.name }}} {{username}} {{#user.tags}}{{.}}{{/user.tags}}` +
+		`{{#let n=user.name}}{{coalesce user.nick n}}{{/let}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone := template.Clone()
+	n, err := template.RenameVariable("user", `customer."primary"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("expected 5 renames got %d", n)
+	}
+	expected := `{{customer."primary"}} {{{customer."primary".name}}} {{username}} ` +
+		`{{#customer."primary".tags}}{{.}}{{/customer."primary".tags}}` +
+		`{{#let n=customer."primary".name}}{{coalesce customer."primary".nick n}}{{/let}}`
+	if source := template.Source(); source != expected {
+		t.Errorf("expected %q got %q", expected, source)
+	}
+	output, err := template.RenderString(map[string]interface{}{
+		"customer": map[string]interface{}{
+			"primary": map[string]interface{}{"name": "Jane", "tags": []string{"a"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{&quot;name&quot;:&quot;Jane&quot;,&quot;tags&quot;:[&quot;a&quot;]} Jane  aJane`; output != expected {
+		t.Errorf("expected %q got %q", expected, output)
+	}
+	if source := clone.Source(); source == template.Source() {
+		t.Error("expected the clone to be unaffected")
+	}
+
+	if _, err := template.RenameVariable("a", `b."c`); err == nil {
+		t.Error("expected an error for an invalid name")
+	}
+}
+
+func TestRenamePartial(t *testing.T) {
+	header := New(Name("header"))
+	if err := header.ParseString("H"); err != nil {
+		t.Fatal(err)
+	}
+	template := New(Partial(header))
+	if err := template.ParseString("{{>header}}{{#a}}{{>header}}{{/a}}{{>footer}}"); err != nil {
+		t.Fatal(err)
+	}
+	n, err := template.RenamePartial("header", "page_header")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 renames got %d", n)
+	}
+	if expected := "{{>page_header}}{{#a}}{{>page_header}}{{/a}}{{>footer}}"; template.Source() != expected {
+		t.Errorf("expected %q got %q", expected, template.Source())
+	}
+	if output, _ := template.RenderString(map[string]bool{"a": true}); output != "HH" {
+		t.Errorf("unexpected output %q", output)
+	}
+	if _, err := template.RenamePartial("footer", "a b"); err == nil {
+		t.Error("expected an error for an invalid name")
+	}
+}
@@ -0,0 +1,190 @@
+package mustache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Issue is a problem with a template reported by a tool: a lint finding, a
+// validation or parse error, or a failed test case.
+type Issue struct {
+	Rule     string `json:"rule"`  // the lint rule, or "parse", "validate" or "test"
+	Level    string `json:"level"` // "error" or "warning"
+	Message  string `json:"message"`
+	File     string `json:"file,omitempty"`
+	Template string `json:"template,omitempty"`
+	Line     int    `json:"line,omitempty"` // counted from 1, zero if unknown
+	Col      int    `json:"col,omitempty"`  // the characters preceding the position on its line
+}
+
+func (i Issue) String() string {
+	pos := i.File
+	if pos == "" {
+		pos = i.Template
+	}
+	if i.Line > 0 {
+		pos += fmt.Sprintf(":%d:%d", i.Line, i.Col)
+	}
+	if pos != "" {
+		pos += ": "
+	}
+	return pos + i.Rule + ": " + i.Message
+}
+
+// The levels of issues.
+const (
+	LevelError   = "error"
+	LevelWarning = "warning"
+)
+
+// Report collects the issues found in templates by lint rules, validation and
+// tests, to write them in formats understood by other tools. Its zero value is
+// an empty report.
+type Report struct {
+	Issues []Issue
+}
+
+// AddFindings adds the findings of Lint for t, read from file, as warnings.
+func (r *Report) AddFindings(t *Template, file string, findings []Finding) {
+	for _, f := range findings {
+		issue := Issue{Rule: f.Rule, Level: LevelWarning, Message: f.Message, File: file, Template: t.name}
+		if f.Node != nil {
+			pos := t.position(f.Node.Range().Start)
+			issue.Line, issue.Col = pos.Line, pos.Col
+		}
+		r.Issues = append(r.Issues, issue)
+	}
+}
+
+// AddErrors adds errs, the errors of parsing or validating the template read
+// from file, as errors of the rule "parse" or "validate". The positions of
+// *ParseError and *MissError errors are kept.
+func (r *Report) AddErrors(file string, errs ...error) {
+	for _, err := range errs {
+		issue := Issue{Rule: "validate", Level: LevelError, Message: err.Error(), File: file}
+		var parseErr *ParseError
+		var missErr *MissError
+		var metaErr *MetadataError
+		if errors.As(err, &parseErr) {
+			issue.Rule, issue.Message = "parse", parseErr.Msg
+			issue.Line, issue.Col = parseErr.Line, parseErr.Col
+		} else if errors.As(err, &missErr) {
+			issue.Message = "failed to lookup " + missErr.Name
+			issue.Template, issue.Line, issue.Col = missErr.Template, missErr.Line, missErr.Col
+		} else if errors.As(err, &metaErr) {
+			issue.Message = metaErr.Err.Error()
+		}
+		r.Issues = append(r.Issues, issue)
+	}
+}
+
+// Failed reports whether the report has issues of level error.
+func (r *Report) Failed() bool {
+	for _, issue := range r.Issues {
+		if issue.Level == LevelError {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteText writes the issues to w, one per line.
+func (r *Report) WriteText(w io.Writer) error {
+	for _, issue := range r.Issues {
+		if _, err := fmt.Fprintln(w, issue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the report to w as a JSON object whose "issues" field holds
+// the issues.
+func (r *Report) WriteJSON(w io.Writer) error {
+	issues := r.Issues
+	if issues == nil {
+		issues = []Issue{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Issues []Issue `json:"issues"`
+	}{issues})
+}
+
+// WriteSARIF writes the report to w as a SARIF 2.1.0 log of a single run of
+// the tool named tool, for code review and code scanning tools.
+func (r *Report) WriteSARIF(w io.Writer, tool string) error {
+	type (
+		message struct {
+			Text string `json:"text"`
+		}
+		region struct {
+			StartLine   int `json:"startLine"`
+			StartColumn int `json:"startColumn"`
+		}
+		physicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+			Region *region `json:"region,omitempty"`
+		}
+		location struct {
+			PhysicalLocation physicalLocation `json:"physicalLocation"`
+		}
+		result struct {
+			RuleID    string     `json:"ruleId"`
+			Level     string     `json:"level"`
+			Message   message    `json:"message"`
+			Locations []location `json:"locations,omitempty"`
+		}
+		rule struct {
+			ID string `json:"id"`
+		}
+	)
+	var rules []rule
+	seen := make(map[string]bool)
+	results := make([]result, 0, len(r.Issues))
+	for _, issue := range r.Issues {
+		if !seen[issue.Rule] {
+			seen[issue.Rule] = true
+			rules = append(rules, rule{ID: issue.Rule})
+		}
+		res := result{RuleID: issue.Rule, Level: issue.Level, Message: message{issue.Message}}
+		if issue.File != "" {
+			var loc location
+			loc.PhysicalLocation.ArtifactLocation.URI = issue.File
+			if issue.Line > 0 {
+				// SARIF columns count from 1.
+				loc.PhysicalLocation.Region = &region{StartLine: issue.Line, StartColumn: issue.Col + 1}
+			}
+			res.Locations = []location{loc}
+		}
+		results = append(results, res)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+
+	var run struct {
+		Tool struct {
+			Driver struct {
+				Name  string `json:"name"`
+				Rules []rule `json:"rules,omitempty"`
+			} `json:"driver"`
+		} `json:"tool"`
+		Results []result `json:"results"`
+	}
+	run.Tool.Driver.Name = tool
+	run.Tool.Driver.Rules = rules
+	run.Results = results
+	log := map[string]interface{}{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs":    []interface{}{run},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
@@ -0,0 +1,99 @@
+package mustache
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	template := New(Name("page"))
+	if err := template.ParseString("Hi\n  {{{name}}} {{user.email}}"); err != nil {
+		t.Fatal(err)
+	}
+	var report Report
+	if report.Failed() {
+		t.Error("expected an empty report not to fail")
+	}
+	report.AddFindings(template, "page.mustache", Lint(template, NoRawVariables()))
+	if report.Failed() {
+		t.Error("expected lint findings not to fail the report")
+	}
+	report.AddErrors("page.mustache", template.Validate(map[string]string{"name": "Ann"})...)
+	report.AddErrors("broken.mustache", New().ParseString("{{#a}}"))
+
+	var text bytes.Buffer
+	if err := report.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	expected := `page.mustache:2:2: no-raw-variables: variable "name" is not escaped
+page.mustache:2:13: validate: failed to lookup user.email
+broken.mustache:1:0: parse: failed to find closing tag for section "a" opened at 1:0
+`
+	if text.String() != expected {
+		t.Errorf("expected %q got %q", expected, text.String())
+	}
+	if !report.Failed() {
+		t.Error("expected errors to fail the report")
+	}
+
+	var b bytes.Buffer
+	if err := report.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct{ Issues []Issue }
+	if err := json.Unmarshal(b.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Issues, report.Issues) {
+		t.Errorf("expected %+v got %+v", report.Issues, decoded.Issues)
+	}
+
+	b.Reset()
+	if err := report.WriteSARIF(&b, "mustache"); err != nil {
+		t.Fatal(err)
+	}
+	var log struct {
+		Version string
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name  string
+					Rules []struct{ ID string }
+				}
+			}
+			Results []struct {
+				RuleID    string
+				Level     string
+				Message   struct{ Text string }
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI string }
+						Region           struct{ StartLine, StartColumn int }
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(b.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || log.Runs[0].Tool.Driver.Name != "mustache" {
+		t.Fatalf("unexpected log %s", b.String())
+	}
+	var rules []string
+	for _, rule := range log.Runs[0].Tool.Driver.Rules {
+		rules = append(rules, rule.ID)
+	}
+	if strings.Join(rules, ",") != "no-raw-variables,parse,validate" {
+		t.Errorf("unexpected rules %q", rules)
+	}
+	res := log.Runs[0].Results[1]
+	loc := res.Locations[0].PhysicalLocation
+	if res.RuleID != "validate" || res.Level != "error" || res.Message.Text != "failed to lookup user.email" ||
+		loc.ArtifactLocation.URI != "page.mustache" || loc.Region.StartLine != 2 || loc.Region.StartColumn != 14 {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
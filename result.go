@@ -0,0 +1,113 @@
+package mustache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+)
+
+// WarningKind identifies the soft issues reported as warnings by RenderResult.
+type WarningKind string
+
+// The kinds of warnings.
+const (
+	// MissWarning is a variable missing from the context, which was rendered
+	// empty because misses are silent.
+	MissWarning WarningKind = "miss"
+	// FallbackWarning is a variable missing from the context, which was
+	// replaced by the value of OnMiss or by a placeholder.
+	FallbackWarning WarningKind = "fallback"
+	// SanitizedWarning is a value whose newlines or control characters were
+	// removed in single line mode.
+	SanitizedWarning WarningKind = "sanitized"
+	// TruncatedWarning is output cut to the maximum length of single line
+	// mode.
+	TruncatedWarning WarningKind = "truncated"
+	// DeprecatedWarning is a tag referring to a variable marked with
+	// Deprecate, or a partial whose metadata has the DeprecatedKey.
+	DeprecatedWarning WarningKind = "deprecated"
+)
+
+// Warning is a soft issue found while rendering, which did not fail the
+// render. The position of the tag concerned is recorded when it is known.
+type Warning struct {
+	Kind        WarningKind
+	Name        string // the name of the variable or partial concerned, if any
+	Replacement string // the name to use instead of a deprecated one, if any
+	Line        int
+	Col         int
+	Template    string
+}
+
+func (w Warning) String() string {
+	s := string(w.Kind)
+	if w.Name != "" {
+		s += " " + w.Name
+	}
+	if w.Replacement != "" {
+		s += ", use " + w.Replacement
+	}
+	if w.Line > 0 {
+		s = fmt.Sprintf("%d:%d %s", w.Line, w.Col, s)
+		if w.Template != "" {
+			s = w.Template + ":" + s
+		}
+	}
+	return s
+}
+
+// RenderStats describes a render.
+type RenderStats struct {
+	Bytes      int // the size of the output
+	Iterations int // the number of section iterations
+	Duration   time.Duration
+}
+
+// Result is the outcome of RenderResult.
+type Result struct {
+	Output   []byte
+	Warnings []Warning
+	Stats    RenderStats
+}
+
+// RenderResult renders the template like RenderBytes, reporting the soft
+// issues of the render as warnings rather than swallowing them: variables
+// missing while misses are silent, missing variables replaced by OnMiss or
+// KeepMissingTags, values sanitized in single line mode and references to
+// deprecated variables and partials. Like RenderLine, it cuts the output to
+// the maximum length of single line mode, with a warning. Errors are returned
+// as by RenderBytes.
+func (t *Template) RenderResult(data ...interface{}) (Result, error) {
+	var b bytes.Buffer
+	var res Result
+	var w *writer
+	start := time.Now()
+	err := t.run(context.Background(), &b, data, func(tw *writer) {
+		// Only the last render made by middleware is reported.
+		res.Warnings = nil
+		tw.state.warnings = &res.Warnings
+		w = tw
+	})
+	res.Output = b.Bytes()
+	if output, truncated := t.truncateLine(string(res.Output)); truncated {
+		res.Output = []byte(output)
+		res.Warnings = append(res.Warnings, Warning{Kind: TruncatedWarning})
+	}
+	res.Stats = RenderStats{
+		Bytes:    len(res.Output),
+		Duration: time.Since(start),
+	}
+	if w != nil {
+		// The writer is nil if middleware skipped the render.
+		res.Stats.Iterations = w.state.iterations
+	}
+	return res, err
+}
+
+// warn records a warning if the render reports warnings.
+func (w *writer) warn(warning Warning) {
+	if w.state.warnings != nil {
+		*w.state.warnings = append(*w.state.warnings, warning)
+	}
+}
@@ -0,0 +1,62 @@
+package mustache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRenderResult(t *testing.T) {
+	template := New(Name("greeting"))
+	if err := template.ParseString("Hi {{name}}{{#items}} {{.}}{{/items}}\n{{missing}}"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := template.RenderResult(map[string]interface{}{"name": "Ann", "items": []int{1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Output) != "Hi Ann 1 2\n" {
+		t.Errorf("unexpected output %q", res.Output)
+	}
+	expected := []Warning{{Kind: MissWarning, Name: "missing", Line: 2, Col: 0, Template: "greeting"}}
+	if !reflect.DeepEqual(res.Warnings, expected) {
+		t.Errorf("expected %v got %v", expected, res.Warnings)
+	}
+	if res.Stats.Bytes != len(res.Output) || res.Stats.Iterations != 2 {
+		t.Errorf("unexpected stats %+v", res.Stats)
+	}
+	if s := res.Warnings[0].String(); s != "greeting:2:0 miss missing" {
+		t.Errorf("unexpected warning %q", s)
+	}
+
+	// Misses which fail the render are errors, not warnings.
+	template.Option(SilentMiss(false))
+	if res, err := template.RenderResult(nil); err == nil || len(res.Warnings) != 0 {
+		t.Errorf("expected an error and no warnings, got %v and %v", err, res.Warnings)
+	}
+
+	template = New(SingleLine(8), OnMiss(func(name string, line, col int) (interface{}, bool) {
+		return "?", true
+	}))
+	if err := template.ParseString("{{a}} {{b}}"); err != nil {
+		t.Fatal(err)
+	}
+	res, err = template.RenderResult(map[string]string{"a": "x\ny"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Output) != "x y ?" {
+		t.Errorf("unexpected output %q", res.Output)
+	}
+	var kinds []WarningKind
+	for _, w := range res.Warnings {
+		kinds = append(kinds, w.Kind)
+	}
+	if expected := []WarningKind{SanitizedWarning, FallbackWarning}; !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("expected %v got %v", expected, kinds)
+	}
+
+	res, _ = template.RenderResult(map[string]string{"a": "a long value", "b": "b"})
+	if string(res.Output) != "a long v" || res.Warnings[len(res.Warnings)-1].Kind != TruncatedWarning {
+		t.Errorf("expected a truncated output, got %q and %v", res.Output, res.Warnings)
+	}
+}
@@ -0,0 +1,97 @@
+package mustache
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// Selector chooses the version of the template name rendered by a render of a
+// TemplateSet, among the versions loaded with ParseStoreVersions, sorted. It
+// returns 0, or a version which is not loaded, to render the template parsed
+// by ParseStore or ParseFS. The context is the one given to RenderContext,
+// from which a selector may learn e.g. the tenant the render is made for:
+//
+//	set.Select(func(ctx context.Context, name string, versions []int) int {
+//		if tenant, _ := ctx.Value(tenantKey{}).(string); tenant == "acme" {
+//			return 7
+//		}
+//		return 0
+//	})
+type Selector func(ctx context.Context, name string, versions []int) int
+
+// ParseStoreVersions parses the given versions of the template name of store
+// into the set, next to the version of the template parsed by ParseStore,
+// for a Selector to choose from at render time.
+func (s *TemplateSet) ParseStoreVersions(ctx context.Context, store Store, name string, versions ...int) error {
+	for _, version := range versions {
+		stored, err := store.Get(ctx, name, version)
+		if err != nil {
+			return err
+		}
+		t := New(s.options...)
+		t.name = name
+		if err := t.ParseString(stored.Source); err != nil {
+			return fmt.Errorf("%s@%d: %w", name, stored.Version, err)
+		}
+		if s.versions == nil {
+			s.versions = make(map[string]map[int]*Template)
+		}
+		if s.versions[name] == nil {
+			s.versions[name] = make(map[int]*Template)
+		}
+		s.versions[name][stored.Version] = t
+	}
+	return nil
+}
+
+// Select makes f choose the versions of the templates rendered. It is called
+// once per render for each template having versions, whether the template is
+// rendered or included as a partial, so that a render uses a single version
+// of each template.
+func (s *TemplateSet) Select(f Selector) {
+	s.selector = f
+}
+
+// selected returns the templates of the set, with the versions chosen by the
+// selector of the set in place of those of the templates having versions.
+func (s *TemplateSet) selected(ctx context.Context) map[string]*Template {
+	if s.selector == nil || len(s.versions) == 0 {
+		return s.templates
+	}
+	templates := make(map[string]*Template, len(s.templates))
+	for name, t := range s.templates {
+		templates[name] = t
+	}
+	for name, loaded := range s.versions {
+		versions := make([]int, 0, len(loaded))
+		for version := range loaded {
+			versions = append(versions, version)
+		}
+		sort.Ints(versions)
+		if t, ok := loaded[s.selector(ctx, name, versions)]; ok {
+			templates[name] = t
+		}
+	}
+	return templates
+}
+
+// Canary returns a Selector rendering the given version of the template name
+// for percent out of 100 of the keys of renders, and the default version for
+// the others. key returns the key of a render from its context, such as a
+// user or tenant ID, so that a key always renders the same version. Other
+// templates render their default version.
+func Canary(name string, version, percent int, key func(context.Context) string) Selector {
+	return func(ctx context.Context, n string, _ []int) int {
+		if n != name {
+			return 0
+		}
+		h := fnv.New32a()
+		h.Write([]byte(name + "\x00" + key(ctx)))
+		if int(h.Sum32()%100) < percent {
+			return version
+		}
+		return 0
+	}
+}
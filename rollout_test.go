@@ -0,0 +1,91 @@
+package mustache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+type tenantKey struct{}
+
+func TestSelect(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, source := range []string{"v1 {{name}}", "v2 {{name}}", "v3 {{name}}"} {
+		if _, err := store.Put(ctx, "greeting", source); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.Put(ctx, "page", "[{{>greeting}}]"); err != nil {
+		t.Fatal(err)
+	}
+	set := NewSet()
+	if err := set.ParseStore(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.ParseStoreVersions(ctx, store, "greeting", 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.ParseStoreVersions(ctx, store, "greeting", 9); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+
+	render := func(tenant, name string) string {
+		var b strings.Builder
+		ctx := context.WithValue(ctx, tenantKey{}, tenant)
+		if err := set.RenderContext(ctx, name, &b, map[string]string{"name": "Ann"}); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+	if output := render("acme", "page"); output != "[v3 Ann]" {
+		t.Errorf("expected the latest version without a selector, got %q", output)
+	}
+
+	var seen []int
+	set.Select(func(ctx context.Context, name string, versions []int) int {
+		seen = versions
+		if ctx.Value(tenantKey{}) == "acme" {
+			return 1
+		}
+		return 0
+	})
+	for _, test := range []struct {
+		tenant, name, expected string
+	}{
+		{"acme", "page", "[v1 Ann]"},
+		{"acme", "greeting", "v1 Ann"},
+		{"other", "page", "[v3 Ann]"},
+	} {
+		if output := render(test.tenant, test.name); output != test.expected {
+			t.Errorf("%s %s: expected %q got %q", test.tenant, test.name, test.expected, output)
+		}
+	}
+	if fmt.Sprint(seen) != "[1 2]" {
+		t.Errorf("unexpected versions %v", seen)
+	}
+
+	tenant := func(ctx context.Context) string {
+		return ctx.Value(tenantKey{}).(string)
+	}
+	for _, percent := range []int{0, 30, 100} {
+		set.Select(Canary("greeting", 2, percent, tenant))
+		canaried := 0
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprint("tenant", i)
+			output := render(key, "page")
+			if output != render(key, "page") {
+				t.Fatalf("%s: expected the same version for a key", key)
+			}
+			if output == "[v2 Ann]" {
+				canaried++
+			}
+		}
+		if canaried < percent*10-50 || canaried > percent*10+50 {
+			t.Errorf("%d%%: %d renders of 1000 canaried", percent, canaried)
+		}
+	}
+}
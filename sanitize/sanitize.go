@@ -0,0 +1,55 @@
+// Package sanitize provides a mustache customizer which sanitizes HTML
+// fragments, such as user generated content, so they can be embedded raw in an
+// otherwise escaped template.
+//
+// The package does not implement HTML sanitization policies itself. Instead it
+// accepts any type with a Sanitize method, which includes the policies of
+// github.com/microcosm-cc/bluemonday:
+//
+//	template := mustache.New(sanitize.Helper(map[string]sanitize.Policy{
+//		"basic":  bluemonday.UGCPolicy(),
+//		"strict": bluemonday.StrictPolicy(),
+//	}))
+//	err := template.ParseString(`<div>{{~sanitize policy="basic"}}{{{comment}}}{{/sanitize}}</div>`)
+package sanitize
+
+import (
+	"fmt"
+	"html"
+
+	"github.com/observeinc/mustache"
+)
+
+// Policy sanitizes an HTML fragment.
+type Policy interface {
+	Sanitize(s string) string
+}
+
+// PolicyFunc adapts an ordinary function to the Policy interface.
+type PolicyFunc func(string) string
+
+// Sanitize calls f(s).
+func (f PolicyFunc) Sanitize(s string) string {
+	return f(s)
+}
+
+// Escape is a Policy which escapes all HTML, leaving no markup at all.
+var Escape Policy = PolicyFunc(html.EscapeString)
+
+// Helper makes the {{~sanitize policy="name"}} customizer available to the
+// template. The content of the section is passed through the named policy.
+// The policy option may be left out if policies holds a policy named
+// "default". Naming an unknown policy is an error.
+func Helper(policies map[string]Policy) mustache.Option {
+	return mustache.CustomizeFunctionWithOptions("sanitize", func(s string, opts map[string]string) (string, error) {
+		name, ok := opts["policy"]
+		if !ok {
+			name = "default"
+		}
+		policy, ok := policies[name]
+		if !ok {
+			return "", fmt.Errorf("unknown sanitize policy %q", name)
+		}
+		return policy.Sanitize(s), nil
+	})
+}
@@ -0,0 +1,45 @@
+package sanitize
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/observeinc/mustache"
+)
+
+// stripTags is a crude stand-in for a real policy which removes all tags.
+var stripTags = PolicyFunc(func(s string) string {
+	return regexp.MustCompile(`<[^>]*>`).ReplaceAllString(s, "")
+})
+
+func TestHelper(t *testing.T) {
+	template := mustache.New(mustache.SilentMiss(false), Helper(map[string]Policy{
+		"default": Escape,
+		"strip":   stripTags,
+	}))
+	for _, test := range []struct {
+		template string
+		expected string
+	}{
+		{`<p>{{~sanitize policy="strip"}}{{{comment}}}{{/sanitize}}</p>`, `<p>hi there</p>`},
+		{`<p>{{~sanitize}}{{{comment}}}{{/sanitize}}</p>`, `<p>hi &lt;b onclick=&#34;x()&#34;&gt;there&lt;/b&gt;</p>`},
+	} {
+		if err := template.ParseString(test.template); err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(map[string]string{"comment": `hi <b onclick="x()">there</b>`})
+		if err != nil {
+			t.Error(err)
+		}
+		if output != test.expected {
+			t.Errorf("expected %q got %q", test.expected, output)
+		}
+	}
+
+	if err := template.ParseString(`{{~sanitize policy="unknown"}}x{{/sanitize}}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := template.RenderString(nil); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
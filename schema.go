@@ -0,0 +1,372 @@
+package mustache
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kind is the kind of a value described by a Type.
+type Kind int
+
+// The kinds of values. A value of AnyKind may be of any kind, so nothing is
+// checked about its use.
+const (
+	AnyKind Kind = iota
+	StringKind
+	NumberKind
+	BoolKind
+	ListKind
+	MapKind
+)
+
+func (k Kind) String() string {
+	switch k {
+	case StringKind:
+		return "string"
+	case NumberKind:
+		return "number"
+	case BoolKind:
+		return "bool"
+	case ListKind:
+		return "list"
+	case MapKind:
+		return "map"
+	}
+	return "any"
+}
+
+// Type describes a value of the context a template is rendered with.
+type Type struct {
+	Kind   Kind
+	Elem   *Type           // the type of the elements of a list
+	Fields map[string]Type // the fields of a map
+}
+
+// ListOf returns the type of a list of elem.
+func ListOf(elem Type) Type {
+	return Type{Kind: ListKind, Elem: &elem}
+}
+
+// MapOf returns the type of a map with fields.
+func MapOf(fields map[string]Type) Type {
+	return Type{Kind: MapKind, Fields: fields}
+}
+
+// Schema describes the context a template is rendered with, by the types of
+// its top level names.
+type Schema map[string]Type
+
+// SchemaRule returns a rule checking the variables of a template against
+// schema. It reports variables which are not in the schema, sections over
+// strings and numbers, which are rendered once rather than iterated over, and
+// lists and maps printed as variables. Once the template is checked, it
+// reports the names in the schema which the template does not use.
+//
+// Names bound by let and zip sections, captures and constants are known to
+// the rule. Partials are not checked.
+func SchemaRule(schema Schema) Rule {
+	return Rule{
+		Name: "schema",
+		Check: func(nodes []Node) []Finding {
+			c := schemaChecker{used: make(map[string]bool)}
+			consts := make(map[string]schemaValue)
+			Walk(nodes, func(n Node) bool {
+				if n, ok := n.(*ConstNode); ok {
+					consts[n.Name] = schemaValue{typ: Type{Kind: StringKind}}
+				}
+				return true
+			})
+			c.captures = make(map[string]schemaValue)
+			scopes := []schemaScope{
+				{names: consts},
+				{names: c.captures},
+				{value: schemaValue{typ: MapOf(schema)}},
+			}
+			c.nodes(nodes, scopes)
+			c.unused("", MapOf(schema))
+			return c.findings
+		},
+	}
+}
+
+// schemaValue is a value of a known type. Its path is the name of the value
+// in the schema, and is empty for values not in the schema.
+type schemaValue struct {
+	typ  Type
+	path string
+}
+
+// schemaScope is a frame of the context. It is either a value pushed by a
+// section, or the names bound by let and zip sections.
+type schemaScope struct {
+	value schemaValue
+	names map[string]schemaValue
+}
+
+// loopNames holds the variables bound by LoopVariables in list sections.
+var loopNames = map[string]schemaValue{
+	"@index":  {typ: Type{Kind: NumberKind}},
+	"@first":  {typ: Type{Kind: BoolKind}},
+	"@last":   {typ: Type{Kind: BoolKind}},
+	"@length": {typ: Type{Kind: NumberKind}},
+}
+
+// pageNames holds the variables bound in paginated list sections, along with
+// those of LoopVariables.
+var pageNames = map[string]schemaValue{
+	"@total":  {typ: Type{Kind: NumberKind}},
+	"@more":   {typ: Type{Kind: NumberKind}},
+	"@index":  loopNames["@index"],
+	"@first":  loopNames["@first"],
+	"@last":   loopNames["@last"],
+	"@length": loopNames["@length"],
+}
+
+// mapNames holds the variables bound by MapSections, and LoopVariables, in
+// map sections.
+var mapNames = map[string]schemaValue{
+	"@key":    {typ: Type{Kind: StringKind}},
+	"@value":  {},
+	"@index":  loopNames["@index"],
+	"@first":  loopNames["@first"],
+	"@last":   loopNames["@last"],
+	"@length": loopNames["@length"],
+}
+
+type schemaChecker struct {
+	findings []Finding
+	captures map[string]schemaValue
+	used     map[string]bool // paths in the schema used by the template
+}
+
+func (c *schemaChecker) report(n Node, format string, v ...interface{}) {
+	c.findings = append(c.findings, Finding{Node: n, Message: fmt.Sprintf(format, v...)})
+}
+
+// resolve returns the value name refers to with scopes, innermost last. It
+// reports names which are not found.
+func (c *schemaChecker) resolve(n Node, name string, scopes []schemaScope) (schemaValue, bool) {
+	path, err := parsePath(name)
+	if err != nil {
+		return schemaValue{}, false
+	}
+	value, ok := schemaValue{}, false
+	for i := len(scopes) - 1; i >= 0 && !ok; i-- {
+		if scopes[i].names != nil {
+			value, ok = scopes[i].names[path[0].key]
+			continue
+		}
+		if !path[0].quoted && path[0].key == "." {
+			value, ok = scopes[i].value, true
+			continue
+		}
+		value, ok = scopes[i].value.field(path[0].key)
+	}
+	for _, seg := range path[1:] {
+		if !ok {
+			break
+		}
+		value, ok = value.field(seg.key)
+	}
+	if !ok {
+		c.report(n, "variable %q is not in the schema", name)
+		return schemaValue{}, false
+	}
+	for p := value.path; p != ""; {
+		c.used[p] = true
+		i := strings.LastIndex(p, ".")
+		if i < 0 {
+			break
+		}
+		p = p[:i]
+	}
+	return value, true
+}
+
+// field returns the value of the field key of v. The elements of a list, and
+// the fields of a value of any kind, have the path of v.
+func (v schemaValue) field(key string) (schemaValue, bool) {
+	switch v.typ.Kind {
+	case AnyKind:
+		return schemaValue{path: v.path}, true
+	case MapKind:
+		typ, ok := v.typ.Fields[key]
+		if !ok {
+			return schemaValue{}, false
+		}
+		path := key
+		if v.path != "" {
+			path = v.path + "." + key
+		}
+		return schemaValue{typ: typ, path: path}, true
+	case ListKind:
+		if _, err := strconv.Atoi(key); err == nil {
+			return v.elem(), true
+		}
+	}
+	return schemaValue{}, false
+}
+
+// elem returns the value of the elements of a list.
+func (v schemaValue) elem() schemaValue {
+	if v.typ.Elem == nil {
+		return schemaValue{path: v.path}
+	}
+	return schemaValue{typ: *v.typ.Elem, path: v.path}
+}
+
+func (c *schemaChecker) nodes(nodes []Node, scopes []schemaScope) {
+	for _, n := range nodes {
+		c.node(n, scopes)
+	}
+}
+
+func (c *schemaChecker) node(n Node, scopes []schemaScope) {
+	switch n := n.(type) {
+	case *VarNode:
+		if value, ok := c.resolve(n, n.Name, scopes); ok {
+			if k := value.typ.Kind; k == ListKind || k == MapKind {
+				c.report(n, "variable %q is printed but is a %s", n.Name, k)
+			}
+		}
+	case *CoalesceNode:
+		for _, arg := range n.Args {
+			if !strings.HasPrefix(arg, `"`) {
+				c.resolve(n, arg, scopes)
+			}
+		}
+	case *TranslateNode:
+		for _, arg := range n.Args {
+			if _, value, _ := strings.Cut(arg, "="); !strings.HasPrefix(value, `"`) {
+				c.resolve(n, value, scopes)
+			}
+		}
+	case *FunctionNode:
+		c.nodes(n.Children, scopes)
+	case *SectionNode:
+		c.section(n, scopes)
+	}
+}
+
+func (c *schemaChecker) section(n *SectionNode, scopes []schemaScope) {
+	push := func(scope schemaScope) []schemaScope {
+		return append(scopes[:len(scopes):len(scopes)], scope)
+	}
+	switch n.Kind {
+	case "":
+		value, ok := c.resolve(n, n.Name, scopes)
+		if !ok {
+			return
+		}
+		if n.Inverted {
+			c.nodes(n.Children, scopes)
+			return
+		}
+		switch value.typ.Kind {
+		case StringKind, NumberKind:
+			c.report(n, "section %q is used as a list but is a %s", n.Name, value.typ.Kind)
+			c.nodes(n.Children, push(schemaScope{value: value}))
+		case ListKind:
+			// The variables of LoopVariables, and of pagination given offset
+			// or limit arguments, are bound within the section.
+			names := loopNames
+			if len(n.Args) > 0 {
+				names = pageNames
+			}
+			inner := append(push(schemaScope{names: names}), schemaScope{value: value.elem()})
+			c.nodes(n.Children, inner)
+		case MapKind:
+			// The variables of MapSections are bound within the section.
+			inner := append(push(schemaScope{names: mapNames}), schemaScope{value: value})
+			c.nodes(n.Children, inner)
+		default:
+			c.nodes(n.Children, push(schemaScope{value: value}))
+		}
+	case "case", "default":
+		c.nodes(n.Children, scopes)
+	case "let":
+		names := make(map[string]schemaValue, len(n.Args))
+		inner := push(schemaScope{names: names})
+		for _, arg := range n.Args {
+			name, ident := arg, ""
+			if i := strings.Index(arg, "="); i >= 0 {
+				name, ident = arg[:i], arg[i+1:]
+			}
+			if strings.HasPrefix(ident, `"`) {
+				names[name] = schemaValue{typ: Type{Kind: StringKind}}
+			} else if value, ok := c.resolve(n, ident, inner); ok {
+				names[name] = value
+			} else {
+				names[name] = schemaValue{}
+			}
+		}
+		c.nodes(n.Children, inner)
+	case "capture":
+		c.nodes(n.Children, scopes)
+		c.captures[n.Name] = schemaValue{typ: Type{Kind: StringKind}}
+	case "zip":
+		names := make(map[string]schemaValue, 2)
+		as := [2]string{"@a", "@b"}
+		if len(n.Args) > 1 {
+			if s, err := strconv.Unquote(strings.TrimPrefix(n.Args[1], "as=")); err == nil {
+				if fields := strings.Fields(s); len(fields) == 2 {
+					as = [2]string{"@" + fields[0], "@" + fields[1]}
+				}
+			}
+		}
+		for i, ident := range []string{n.Name, n.Args[0]} {
+			value, ok := c.resolve(n, ident, scopes)
+			if ok && value.typ.Kind != ListKind && value.typ.Kind != AnyKind {
+				c.report(n, "zip section over %q, which is a %s", ident, value.typ.Kind)
+			}
+			names[as[i]] = value.elem()
+		}
+		c.nodes(n.Children, push(schemaScope{names: names}))
+	case "chunk":
+		value, ok := c.resolve(n, n.Name, scopes)
+		if !ok {
+			return
+		}
+		row := value
+		if value.typ.Kind != ListKind && value.typ.Kind != AnyKind {
+			row = schemaValue{typ: ListOf(value.typ), path: value.path}
+		}
+		c.nodes(n.Children, push(schemaScope{value: row}))
+	default:
+		// Switch, test_value, type test and count sections render their
+		// children with the unchanged context.
+		if n.Name != "" {
+			c.resolve(n, n.Name, scopes)
+		}
+		c.nodes(n.Children, scopes)
+	}
+}
+
+// unused reports the fields of typ, a map at path in the schema, which are
+// not used by the template.
+func (c *schemaChecker) unused(path string, typ Type) {
+	if typ.Kind == ListKind && typ.Elem != nil {
+		typ = *typ.Elem
+	}
+	if typ.Kind != MapKind {
+		return
+	}
+	keys := make([]string, 0, len(typ.Fields))
+	for key := range typ.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		p := key
+		if path != "" {
+			p = path + "." + key
+		}
+		if !c.used[p] {
+			c.report(nil, "schema key %q is not used", p)
+			continue
+		}
+		c.unused(p, typ.Fields[key])
+	}
+}
@@ -0,0 +1,46 @@
+package mustache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSchemaRule(t *testing.T) {
+	template := New(LetSections(), ZipSections(), ChunkSections(), PaginateSections())
+	err := template.ParseString(`{{user.name}} {{user.nmae}} {{#items}}{{label}}{{price}}{{/items}}` +
+		`{{#items}}{{@index}}{{^@last}},{{/@last}}{{/items}}{{#user}}{{@key}}={{@value}}{{/user}}` +
+		`{{#items limit="2"}}{{label}}+{{@more}}/{{@total}}{{/items}}{{#items}}{{@total}}{{/items}}` +
+		`{{#title}}{{.}}{{/title}}{{^title}}none{{/title}}{{tags}}` +
+		`{{#let who=user.name}}{{who}}{{/let}}{{#zip xs ys}}{{@a}}{{@b}}{{/zip}}` +
+		`{{#chunk items 2}}{{#.}}{{label}}{{/.}}{{/chunk}}{{extra.anything}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := Schema{
+		"user":  MapOf(map[string]Type{"name": {Kind: StringKind}, "email": {Kind: StringKind}}),
+		"items": ListOf(MapOf(map[string]Type{"label": {Kind: StringKind}})),
+		"title": {Kind: StringKind},
+		"tags":  ListOf(Type{Kind: StringKind}),
+		"xs":    ListOf(Type{Kind: NumberKind}),
+		"ys":    {Kind: NumberKind},
+		"extra": {},
+		"debug": {Kind: BoolKind},
+	}
+	var messages []string
+	for _, f := range Lint(template, SchemaRule(schema)) {
+		messages = append(messages, f.String())
+	}
+	expected := []string{
+		`schema: variable "user.nmae" is not in the schema`,
+		`schema: variable "price" is not in the schema`,
+		`schema: variable "@total" is not in the schema`,
+		`schema: section "title" is used as a list but is a string`,
+		`schema: variable "tags" is printed but is a list`,
+		`schema: zip section over "ys", which is a number`,
+		`schema: schema key "debug" is not used`,
+		`schema: schema key "user.email" is not used`,
+	}
+	if !reflect.DeepEqual(messages, expected) {
+		t.Errorf("expected %q got %q", expected, messages)
+	}
+}
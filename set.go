@@ -0,0 +1,137 @@
+package mustache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// TemplateSet is a collection of named templates sharing the same options,
+// typically loaded from an embed.FS. Every template of the set may include
+// any other as a partial, referring to it by name.
+//
+//	//go:embed templates
+//	var templates embed.FS
+//
+//	set := mustache.NewSet(mustache.NoEscape())
+//	err := set.ParseFS(templates, "templates/*.mustache")
+//	...
+//	err = set.Render("welcome", w, data)
+//
+// A TemplateSet is safe for concurrent rendering once parsing is done.
+type TemplateSet struct {
+	options   []Option
+	templates map[string]*Template
+	versions  map[string]map[int]*Template // other versions of templates by name, see ParseStoreVersions
+	selector  Selector
+	lazy      *lazyTemplates // templates parsed on first use, see Provide
+}
+
+// NewSet returns an empty template set. The options are applied to every
+// template parsed into the set.
+func NewSet(options ...Option) *TemplateSet {
+	return &TemplateSet{
+		options:   options,
+		templates: make(map[string]*Template),
+	}
+}
+
+// ParseFS parses the files of fsys matching patterns as defined by fs.Glob
+// into the set. Each template is named after the base name of its file
+// without extension, so templates/header.mustache is named header. It is an
+// error for two files to share a name.
+func (s *TemplateSet) ParseFS(fsys fs.FS, patterns ...string) error {
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("pattern matches no files: %q", pattern)
+		}
+		for _, filename := range matches {
+			b, err := fs.ReadFile(fsys, filename)
+			if err != nil {
+				return err
+			}
+			name := strings.TrimSuffix(path.Base(filename), path.Ext(filename))
+			if _, ok := s.templates[name]; ok {
+				return fmt.Errorf("%s: template %q already defined", filename, name)
+			}
+			t := New(s.options...)
+			t.name = name
+			if err := t.ParseBytes(b); err != nil {
+				return fmt.Errorf("%s: %w", filename, err)
+			}
+			s.templates[name] = t
+		}
+	}
+	return nil
+}
+
+// Lookup returns the template with the given name, or nil if there is none.
+// Partials of a template rendered on its own are not resolved against the set,
+// use Render for that.
+func (s *TemplateSet) Lookup(name string) *Template {
+	return s.templates[name]
+}
+
+// Names returns the sorted names of the templates in the set.
+func (s *TemplateSet) Names() []string {
+	names := make([]string, 0, len(s.templates))
+	for name := range s.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MissingPartials returns the names of the partials referenced by the
+// templates of the set which are neither templates of the set nor otherwise
+// registered, sorted.
+func (s *TemplateSet) MissingPartials() []string {
+	var missing []string
+	for _, name := range s.Names() {
+		v := newVarCollector(true)
+		v.shared = s.templates
+		v.template(s.templates[name])
+		for _, m := range v.missing {
+			if !contains(missing, m) {
+				missing = append(missing, m)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Render renders the named template to w, resolving partials against the
+// other templates of the set.
+func (s *TemplateSet) Render(name string, w io.Writer, data ...interface{}) error {
+	return s.RenderContext(context.Background(), name, w, data...)
+}
+
+// RenderContext is like Render, making ctx available to customizer functions
+// registered with CustomizeFunctionCtx.
+func (s *TemplateSet) RenderContext(ctx context.Context, name string, w io.Writer, data ...interface{}) error {
+	templates := s.selected(ctx)
+	t, ok := templates[name]
+	if !ok && s.lazy != nil {
+		var err error
+		if t, err = s.lazy.load(ctx, name); err != nil {
+			return err
+		}
+		ok = t != nil
+	}
+	if !ok {
+		return fmt.Errorf("template %q not defined", name)
+	}
+	return t.run(ctx, w, data, func(tw *writer) {
+		tw.state.partials = templates
+		tw.state.lazy = s.lazy
+	})
+}
@@ -0,0 +1,45 @@
+package mustache
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestTemplateSet(t *testing.T) {
+	fsys := fstest.MapFS{
+		"templates/page.mustache":            {Data: []byte("{{>header}}<p>{{body}}</p>")},
+		"templates/partials/header.mustache": {Data: []byte("<h1>{{~upper}}{{title}}{{/upper}}</h1>")},
+	}
+	set := NewSet(CustomizeFunction("upper", func(s string) (string, error) {
+		return strings.ToUpper(s), nil
+	}))
+	if err := set.ParseFS(fsys, "templates/*.mustache", "templates/partials/*.mustache"); err != nil {
+		t.Fatal(err)
+	}
+	if names := strings.Join(set.Names(), ","); names != "header,page" {
+		t.Errorf("expected names header,page got %q", names)
+	}
+	if set.Lookup("page") == nil || set.Lookup("missing") != nil {
+		t.Error("unexpected lookup result")
+	}
+
+	var b strings.Builder
+	if err := set.Render("page", &b, map[string]string{"title": "Hi", "body": "a & b"}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "<h1>HI</h1><p>a &amp; b</p>"; b.String() != expected {
+		t.Errorf("expected %q got %q", expected, b.String())
+	}
+
+	if missing := set.MissingPartials(); len(missing) != 0 {
+		t.Errorf("expected no missing partials got %q", missing)
+	}
+
+	if err := set.Render("missing", &b); err == nil {
+		t.Error("expected an error for an undefined template")
+	}
+	if err := set.ParseFS(fsys, "templates/page.mustache"); err == nil {
+		t.Error("expected an error for a duplicate template")
+	}
+}
@@ -0,0 +1,236 @@
+package mustache
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Source serializes the parse tree of the template back into mustache syntax
+// using the delimiters of the template. Combined with RenameVariable and
+// RenamePartial this allows rewriting stored templates.
+//
+// Variable tags and set delimiter tags are written as they appear in the
+// source, and the other tags are written using the delimiters in effect where
+// they appear. Whitespace inside of tags is not preserved and the options of
+// function sections are written in sorted order, so the result is equivalent
+// to, but not always identical to, the parsed source. The whitespace removed by
+// trim markers, as in {{- name -}}, is left out along with the markers of
+// tags other than variable tags.
+func (t *Template) Source() string {
+	var b strings.Builder
+	s := &sourceWriter{b: &b, open: t.startDelim, close: t.endDelim, consts: t.consts, escapes: t.escapeDelims}
+	s.nodes(t.elems)
+	s.flush(false)
+	return b.String()
+}
+
+// sourceWriter writes the source of nodes to b, using the delimiters open and
+// close in effect at the node being written.
+type sourceWriter struct {
+	b           *strings.Builder
+	open, close string
+	consts      map[string]string
+	escapes     bool // whether backslashes escape delimiters, see EscapeDelimiters
+	backslashes int  // the backslashes ending the text written, if escapes
+}
+
+// text writes the text s, escaping the delimiters it holds.
+func (s *sourceWriter) text(text string) {
+	if !s.escapes {
+		s.b.WriteString(strings.ReplaceAll(text, s.open, `\`+s.open))
+		return
+	}
+	// The backslashes before a delimiter are escaped along with it, and
+	// those ending the text are held until what follows them is known.
+	for {
+		i := strings.Index(text, s.open)
+		if i < 0 {
+			break
+		}
+		s.write(text[:i])
+		s.flush(true)
+		s.b.WriteString(`\` + s.open)
+		text = text[i+len(s.open):]
+	}
+	s.write(text)
+}
+
+// write writes text holding no delimiter, holding back the backslashes it ends
+// with.
+func (s *sourceWriter) write(text string) {
+	trimmed := strings.TrimRight(text, `\`)
+	if trimmed != "" {
+		s.flush(false)
+		s.b.WriteString(trimmed)
+	}
+	s.backslashes += len(text) - len(trimmed)
+}
+
+// flush writes the backslashes held back, doubled if a delimiter follows them.
+func (s *sourceWriter) flush(delim bool) {
+	n := s.backslashes
+	if delim {
+		n *= 2
+	}
+	s.b.WriteString(strings.Repeat(`\`, n))
+	s.backslashes = 0
+}
+
+// tag writes a tag holding the concatenation of parts.
+func (s *sourceWriter) tag(parts ...string) {
+	s.flush(true)
+	s.b.WriteString(s.open)
+	for _, part := range parts {
+		s.b.WriteString(part)
+	}
+	s.b.WriteString(s.close)
+}
+
+// section writes a section opened with sigil and args, closed with name.
+func (s *sourceWriter) section(sigil, args, name string, elems []node) {
+	s.tag(sigil, args)
+	s.nodes(elems)
+	s.tag("/", name)
+}
+
+func (s *sourceWriter) nodes(nodes []node) {
+	for _, n := range nodes {
+		s.node(n)
+	}
+}
+
+func (s *sourceWriter) node(n node) {
+	switch n.(type) {
+	case textNode, trimNode:
+	default:
+		// Other nodes start with a delimiter.
+		s.flush(true)
+	}
+	switch n := n.(type) {
+	case textNode:
+		// Text holds a delimiter only if it was escaped.
+		s.text(string(n))
+	case *varNode:
+		if n.tag != "" {
+			s.b.WriteString(n.tag)
+		} else if n.escape == noEscape {
+			s.tag("&", n.name)
+		} else {
+			s.tag(n.name)
+		}
+	case *coalesceNode:
+		args := make([]string, len(n.args))
+		for i, arg := range n.args {
+			args[i] = arg.ident
+			if arg.path == nil {
+				args[i] = strconv.Quote(arg.literal)
+			}
+		}
+		sigil := ""
+		if n.escape == noEscape {
+			sigil = "&"
+		}
+		s.tag(sigil, "coalesce ", strings.Join(args, " "))
+	case *translateNode:
+		sigil := ""
+		if n.escape == noEscape {
+			sigil = "&"
+		}
+		args := append([]string{strconv.Quote(n.key)}, bindingStrings(n.args)...)
+		s.tag(sigil, "_ ", strings.Join(args, " "))
+	case *sectionNode:
+		args := n.name
+		if n.offset > 0 {
+			args += ` offset="` + strconv.Itoa(n.offset) + `"`
+		}
+		if n.limit > 0 {
+			args += ` limit="` + strconv.Itoa(n.limit) + `"`
+		}
+		s.section(sectionSigil(n.inverted), args, n.name, n.elems)
+	case *functionSectionNode:
+		args := n.name
+		for _, arg := range n.args {
+			if bareArgRe.MatchString(arg) && !strings.Contains(arg, s.close) {
+				args += " " + arg
+			} else {
+				args += ` "` + optionEscaper.Replace(arg) + `"`
+			}
+		}
+		keys := make([]string, 0, len(n.opts)+len(n.optPaths)+len(n.optParts))
+		for k := range n.opts {
+			keys = append(keys, k)
+		}
+		for k := range n.optPaths {
+			keys = append(keys, k)
+		}
+		for k := range n.optParts {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if path, ok := n.optPaths[k]; ok {
+				args += " " + k + "=" + s.open + pathString(path) + s.close
+			} else if parts, ok := n.optParts[k]; ok {
+				args += " " + k + `="` + optionEscaper.Replace(optionSource(parts, s.open, s.close)) + `"`
+			} else {
+				args += " " + k + `="` + optionEscaper.Replace(n.opts[k]) + `"`
+			}
+		}
+		s.section("~", args, n.name, n.elems)
+	case *testNode:
+		s.section("#", "test_value "+s.open+pathString(n.testIdentPath)+s.close+` "`+n.testVal+`"`, "test_value", n.elems)
+	case *typeTestNode:
+		s.section(sectionSigil(n.inverted), n.kind+" "+n.name, n.kind, n.elems)
+	case *countNode:
+		s.section(sectionSigil(n.inverted), n.kind+" "+n.name+" "+strconv.Itoa(n.count), n.kind, n.elems)
+	case *chunkNode:
+		s.section("#", "chunk "+n.name+" "+strconv.Itoa(n.size), "chunk", n.elems)
+	case *zipNode:
+		args := "zip " + n.idents[0] + " " + n.idents[1]
+		if n.names != [2]string{"@a", "@b"} {
+			args += ` as="` + n.names[0][1:] + " " + n.names[1][1:] + `"`
+		}
+		s.section("#", args, "zip", n.elems)
+	case *switchNode:
+		s.tag("#switch ", n.name)
+		for _, value := range n.values {
+			s.section("#", "case "+strconv.Quote(value), "case", n.cases[value])
+		}
+		if n.hasDefault {
+			s.section("#", "default", "default", n.defaultElems)
+		}
+		s.tag("/switch")
+	case *letNode:
+		args := append([]string{"let"}, bindingStrings(n.bindings)...)
+		s.section("#", strings.Join(args, " "), "let", n.elems)
+	case *captureNode:
+		s.section("#", "capture "+strconv.Quote(n.name), "capture", n.elems)
+	case *partialNode:
+		s.tag(">", n.name)
+	case *verbatimNode:
+		open, close := verbatimTags(s.open, s.close)
+		s.b.WriteString(open + n.text + close)
+	case *commentNode:
+		s.tag("!", n.text)
+	case *constNode:
+		s.tag("=const ", n.name, " ", strconv.Quote(s.consts[n.name]))
+	case trimNode:
+		// Trimmed whitespace is left out, as are the markers of most tags,
+		// and escapes are written along with the text.
+	case delimNode:
+		s.b.WriteString(string(n))
+		inner := strings.TrimSuffix(strings.TrimPrefix(string(n), s.open+"="), "="+s.close)
+		if delims := strings.Fields(inner); len(delims) == 2 {
+			s.open, s.close = delims[0], delims[1]
+		}
+	}
+}
+
+// sectionSigil returns the character opening a section tag.
+func sectionSigil(inverted bool) string {
+	if inverted {
+		return "^"
+	}
+	return "#"
+}
@@ -0,0 +1,64 @@
+package mustache
+
+import "testing"
+
+func TestSource(t *testing.T) {
+	same := func(s string) (string, error) { return s, nil }
+	for _, test := range []struct {
+		template string
+		options  []Option
+	}{
+		{template: "Hello {{name}}, {{{raw}}} {{&amp}}!"},
+		{template: "{{#items}}- {{.}}\n{{/items}}{{^items}}none{{/items}}"},
+		{template: "{{! a comment }}{{>header}}"},
+		{template: "{{a}} {{=<% %>=}}<%b%> <%#c%><%d%><%/c%><%={{ }}=%>{{e}}"},
+		{template: "{{=| |=}}\n{{not a tag}} |name|\n"},
+		{template: `{{=const greeting "hi"}}{{greeting}}`},
+		{template: `{{~date layout="2006" tz={{user.tz}}}}{{when}}{{/date}}`},
+		{template: `{{~wrap suffix="\"}}\\"}}{{when}}{{/wrap}}`},
+		{template: `{{~split token="<{{sep}}>"}}{{when}}{{/split}}`},
+		{template: `{{~join ", " 2 "\"}}" sep="x"}}{{when}}{{/join}}`},
+		{
+			template: `{{#switch status}}{{#case "on"}}1{{/case}}{{#case "off"}}0{{/case}}{{#default}}?{{/default}}{{/switch}}`,
+			options:  []Option{SwitchSections()},
+		},
+		{
+			template: `{{#let a=b.c d="e"}}{{a}}{{d}}{{/let}}`,
+			options:  []Option{LetSections()},
+		},
+		{
+			template: `{{#let a=b.c | truncate 5 "..." d="e" | upper}}{{a}}{{d}}{{/let}}`,
+			options:  []Option{LetSections(), FilterPipes(), CustomizeFunction("truncate", same), CustomizeFunction("upper", same)},
+		},
+		{
+			template: `{{coalesce a b "c"}}{{&coalesce d "e"}}`,
+			options:  []Option{CoalesceTags()},
+		},
+		{
+			template: `{{name | trim | truncate 5 "..."}}{{{raw|upper}}}`,
+			options:  []Option{FilterPipes(), CustomizeFunction("trim", same), CustomizeFunction("truncate", same), CustomizeFunction("upper", same)},
+		},
+		{
+			template: `{{_ "cart.items" count=cart.size label="Cart"}}{{&_ "html"}}`,
+			options:  []Option{Translate(messages{})},
+		},
+	} {
+		template := New(test.options...)
+		if err := template.ParseString(test.template); err != nil {
+			t.Errorf("%q: %s", test.template, err)
+			continue
+		}
+		source := template.Source()
+		if source != test.template {
+			t.Errorf("expected %q got %q", test.template, source)
+		}
+		reparsed := New(test.options...)
+		if err := reparsed.ParseString(source); err != nil {
+			t.Errorf("%q: %s", source, err)
+			continue
+		}
+		if again := reparsed.Source(); again != source {
+			t.Errorf("expected %q got %q after reparsing", source, again)
+		}
+	}
+}
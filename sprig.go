@@ -0,0 +1,245 @@
+package mustache
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// SprigHelpers makes a curated subset of the helpers of the sprig library
+// available to the template as by Funcs, with the names, arguments and
+// results of their sprig counterparts, so that the helpers of text/template
+// templates need not be rewritten:
+//
+//	{{title | trunc 20 | upper}} {{count | add 1}} {{nick | default "anonymous"}}
+//
+// The subset holds the string, default, integer math and encoding helpers,
+// leaving out those reading the environment or producing random values:
+//
+//	upper lower title untitle trim trimAll trimPrefix trimSuffix nospace
+//	replace repeat substr trunc abbrev contains hasPrefix hasSuffix quote
+//	squote plural default empty ternary add add1 sub mul div mod max min
+//	floor ceil b64enc b64dec
+//
+// As templates may come from untrusted authors, repeat fails rather than
+// return more than a megabyte. The whole library may be installed with
+// Funcs(sprig.TxtFuncMap()) instead.
+func SprigHelpers() Option {
+	return Funcs(sprigFuncs)
+}
+
+var sprigFuncs = template.FuncMap{
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"title":      title,
+	"untitle":    untitle,
+	"trim":       strings.TrimSpace,
+	"trimAll":    func(cutset, s string) string { return strings.Trim(s, cutset) },
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"nospace": func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, s)
+	},
+	"replace":   func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"repeat":    repeat,
+	"substr":    substr,
+	"trunc":     trunc,
+	"abbrev":    abbrev,
+	"contains":  func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix": func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix": func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"quote":     func(s string) string { return strconv.Quote(s) },
+	"squote":    func(s string) string { return "'" + s + "'" },
+	"plural": func(one, many string, count int) string {
+		if count == 1 {
+			return one
+		}
+		return many
+	},
+	"default": func(d, v interface{}) interface{} {
+		if empty(v) {
+			return d
+		}
+		return v
+	},
+	"empty": empty,
+	"ternary": func(a, b interface{}, cond bool) interface{} {
+		if cond {
+			return a
+		}
+		return b
+	},
+	"add": func(values ...interface{}) int64 {
+		var sum int64
+		for _, v := range values {
+			sum += toInt64(v)
+		}
+		return sum
+	},
+	"add1": func(v interface{}) int64 { return toInt64(v) + 1 },
+	"sub":  func(a, b interface{}) int64 { return toInt64(a) - toInt64(b) },
+	"mul": func(a interface{}, values ...interface{}) int64 {
+		product := toInt64(a)
+		for _, v := range values {
+			product *= toInt64(v)
+		}
+		return product
+	},
+	"div": func(a, b interface{}) (int64, error) {
+		if toInt64(b) == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return toInt64(a) / toInt64(b), nil
+	},
+	"mod": func(a, b interface{}) (int64, error) {
+		if toInt64(b) == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return toInt64(a) % toInt64(b), nil
+	},
+	"max": func(a interface{}, values ...interface{}) int64 {
+		m := toInt64(a)
+		for _, v := range values {
+			if n := toInt64(v); n > m {
+				m = n
+			}
+		}
+		return m
+	},
+	"min": func(a interface{}, values ...interface{}) int64 {
+		m := toInt64(a)
+		for _, v := range values {
+			if n := toInt64(v); n < m {
+				m = n
+			}
+		}
+		return m
+	},
+	"floor":  func(v interface{}) float64 { return math.Floor(toFloat64(v)) },
+	"ceil":   func(v interface{}) float64 { return math.Ceil(toFloat64(v)) },
+	"b64enc": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"b64dec": func(s string) string {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return err.Error()
+		}
+		return string(b)
+	},
+}
+
+// title upper cases the first letter of each word of s.
+func title(s string) string {
+	return mapWordStarts(s, unicode.ToUpper)
+}
+
+// untitle lower cases the first letter of each word of s.
+func untitle(s string) string {
+	return mapWordStarts(s, unicode.ToLower)
+}
+
+// mapWordStarts maps the first letter of each word of s with f.
+func mapWordStarts(s string, f func(rune) rune) string {
+	start := true
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			start = true
+			return r
+		}
+		if start {
+			start = false
+			return f(r)
+		}
+		return r
+	}, s)
+}
+
+// maxRepeat is the maximum length in bytes of the result of repeat.
+const maxRepeat = 1 << 20
+
+// repeat returns count copies of s, failing if the result would be longer
+// than maxRepeat, as templates may come from untrusted authors.
+func repeat(count int, s string) (string, error) {
+	if count <= 0 || s == "" {
+		return "", nil
+	}
+	if count > maxRepeat/len(s) {
+		return "", fmt.Errorf("repeat: result longer than %d bytes", maxRepeat)
+	}
+	return strings.Repeat(s, count), nil
+}
+
+// substr returns the runes of s from start to end, as sprig does: a negative
+// start is the start of s and a negative end the end of s.
+func substr(start, end int, s string) string {
+	runes := []rune(s)
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 || end > len(runes) {
+		end = len(runes)
+	}
+	if start > end {
+		return ""
+	}
+	return string(runes[start:end])
+}
+
+// trunc returns the first n runes of s, or its last -n runes if n is
+// negative.
+func trunc(n int, s string) string {
+	runes := []rune(s)
+	if n < 0 && -n < len(runes) {
+		return string(runes[len(runes)+n:])
+	}
+	if n >= 0 && n < len(runes) {
+		return string(runes[:n])
+	}
+	return s
+}
+
+// abbrev truncates s to width runes, ending it with "..." if it is cut.
+func abbrev(width int, s string) string {
+	runes := []rune(s)
+	if width < 4 || len(runes) <= width {
+		return s
+	}
+	return string(runes[:width-3]) + "..."
+}
+
+// empty reports whether v is empty as sprig has it: nil, false, zero, or an
+// empty string, list or map.
+func empty(v interface{}) bool {
+	r := reflect.ValueOf(v)
+	switch r.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return r.Len() == 0
+	}
+	return r.IsZero()
+}
+
+// toFloat64 converts v, typically a string argument, to a float64, zero if it
+// is not a number as sprig does.
+func toFloat64(v interface{}) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(fmt.Sprint(v)), 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+// toInt64 converts v like toFloat64, truncated to an integer.
+func toInt64(v interface{}) int64 {
+	return int64(toFloat64(v))
+}
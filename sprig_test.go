@@ -0,0 +1,58 @@
+package mustache
+
+import (
+	"testing"
+)
+
+func TestSprigHelpers(t *testing.T) {
+	data := map[string]interface{}{
+		"title": "the quick brown fox",
+		"count": 4,
+		"price": 2.5,
+		"empty": "",
+		"admin": true,
+	}
+	for _, test := range []struct {
+		template string
+		expected string
+	}{
+		{`{{title | trunc 9 | upper}}`, "THE QUICK"},
+		{`{{title | title}} {{title | abbrev 10}} {{title | trunc -3}}`, "The Quick Brown Fox the qui... fox"},
+		{`{{title | replace " " "-"}} {{title | nospace | substr 3 8}}`, "the-quick-brown-fox quick"},
+		{`{{title | contains "quick"}} {{title | hasPrefix "a"}} {{{title | quote}}}`, `true false "the quick brown fox"`},
+		{`{{count | add 1 2}} {{count | sub 10}} {{count | mul 3}} {{count | div 9}} {{count | max 2 7}} {{count | add1}}`, "7 6 12 2 7 5"},
+		{`{{price | floor}} {{price | ceil}} {{count | plural "item" "items"}}`, "2 3 items"},
+		{`{{empty | default "none"}} {{title | default "none" | trimPrefix "the "}} {{admin | ternary "yes" "no"}}`, "none quick brown fox yes"},
+		{`{{empty | default "ab" | repeat 3}}{{title | repeat -1}}`, "ababab"},
+		{`{{title | b64enc | b64dec}} {{~trimSuffix " fox"}}{{title}}{{/trimSuffix}}`, "the quick brown fox the quick brown"},
+	} {
+		template := New(FilterPipes(), SprigHelpers(), SilentMiss(false))
+		if err := template.ParseString(test.template); err != nil {
+			t.Fatal(err)
+		}
+		output, err := template.RenderString(data)
+		if err != nil {
+			t.Errorf("%q: %s", test.template, err)
+		} else if output != test.expected {
+			t.Errorf("%q: expected %q got %q", test.template, test.expected, output)
+		}
+	}
+
+	template := New(FilterPipes(), SprigHelpers(), SilentMiss(false))
+	if err := template.ParseString(`{{empty | mod 1}}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := template.RenderString(data); err == nil {
+		t.Error("expected a division by zero error")
+	}
+
+	for _, count := range []string{"99999999999999999", "60000"} {
+		template := New(FilterPipes(), SprigHelpers(), SilentMiss(false))
+		if err := template.ParseString(`{{title | repeat ` + count + `}}`); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := template.RenderString(data); err == nil {
+			t.Errorf("repeat %s: expected an error for a result too long", count)
+		}
+	}
+}
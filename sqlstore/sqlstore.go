@@ -0,0 +1,154 @@
+// Package sqlstore implements mustache.Store with a SQL database, keeping
+// every version of the templates in a table so that they may be rolled back:
+//
+//	db, err := sql.Open("postgres", dsn)
+//	...
+//	store := sqlstore.New(db, "templates")
+//	err = store.CreateTable(ctx)
+//	...
+//	version, err := store.Put(ctx, "welcome", "Hello {{name}}!")
+//	...
+//	set := mustache.NewSet()
+//	err = set.ParseStore(ctx, store)
+//
+// The queries use the placeholders of PostgreSQL by default. Use
+// QuestionPlaceholders for databases such as MySQL or SQLite.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"time"
+
+	"github.com/observeinc/mustache"
+)
+
+// Store is a mustache.Store keeping templates in a table of a SQL database.
+// It may be used by multiple goroutines concurrently. Concurrent puts of the
+// same template may fail on the primary key of the table rather than store
+// the same version twice.
+type Store struct {
+	db          *sql.DB
+	table       string
+	placeholder func(n int) string
+}
+
+var _ mustache.Store = (*Store)(nil)
+
+// Option configures a Store.
+type Option func(*Store)
+
+// QuestionPlaceholders makes the queries use ? placeholders rather than $1,
+// $2 and so on.
+func QuestionPlaceholders() Option {
+	return func(s *Store) {
+		s.placeholder = func(int) string { return "?" }
+	}
+}
+
+// New returns a Store keeping templates in table of db. The name of the table
+// is used in queries as is, so it must not come from untrusted input.
+func New(db *sql.DB, table string, options ...Option) *Store {
+	s := &Store{
+		db:    db,
+		table: table,
+		placeholder: func(n int) string {
+			return "$" + strconv.Itoa(n)
+		},
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// CreateTable creates the table of the store if it does not exist.
+func (s *Store) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+s.table+
+		" (name VARCHAR(255) NOT NULL, version INTEGER NOT NULL, source TEXT NOT NULL,"+
+		" created TIMESTAMP NOT NULL, PRIMARY KEY (name, version))")
+	return err
+}
+
+// Get returns the given version of the template name, or its latest version
+// if version is 0.
+func (s *Store) Get(ctx context.Context, name string, version int) (mustache.StoredTemplate, error) {
+	t := mustache.StoredTemplate{Name: name}
+	query := "SELECT version, source, created FROM " + s.table + " WHERE name = " + s.placeholder(1)
+	args := []interface{}{name}
+	if version != 0 {
+		query += " AND version = " + s.placeholder(2)
+		args = append(args, version)
+	}
+	query += " ORDER BY version DESC LIMIT 1"
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&t.Version, &t.Source, &t.Created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, fmt.Errorf("template %q version %d: %w", name, version, fs.ErrNotExist)
+	}
+	return t, err
+}
+
+// List returns the sorted names of the templates of the store.
+func (s *Store) List(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT DISTINCT name FROM "+s.table+" ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// Put stores source as the new latest version of the template name, and
+// returns its version.
+func (s *Store) Put(ctx context.Context, name, source string) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var version int
+	err = tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM "+s.table+
+		" WHERE name = "+s.placeholder(1), name).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	version++
+	_, err = tx.ExecContext(ctx, "INSERT INTO "+s.table+" (name, version, source, created) VALUES ("+
+		s.placeholder(1)+", "+s.placeholder(2)+", "+s.placeholder(3)+", "+s.placeholder(4)+")",
+		name, version, source, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return version, tx.Commit()
+}
+
+// Versions returns the versions of the template name, oldest first.
+func (s *Store) Versions(ctx context.Context, name string) ([]mustache.StoredTemplate, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT version, source, created FROM "+s.table+
+		" WHERE name = "+s.placeholder(1)+" ORDER BY version", name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var versions []mustache.StoredTemplate
+	for rows.Next() {
+		t := mustache.StoredTemplate{Name: name}
+		if err := rows.Scan(&t.Version, &t.Source, &t.Created); err != nil {
+			return nil, err
+		}
+		versions = append(versions, t)
+	}
+	return versions, rows.Err()
+}
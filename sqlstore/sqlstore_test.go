@@ -0,0 +1,205 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/observeinc/mustache"
+)
+
+// fakeDriver is a database/sql driver answering the queries of a Store from
+// rows kept in memory, to test the Store without a database.
+type fakeDriver struct {
+	mu      sync.Mutex
+	rows    []row
+	queries []string
+}
+
+type row struct {
+	name    string
+	version int64
+	source  string
+	created time.Time
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{d}, nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c.d, query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return c, nil }
+func (c *fakeConn) Commit() error                             { return nil }
+func (c *fakeConn) Rollback() error                           { return nil }
+
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.queries = append(s.d.queries, s.query)
+	if strings.HasPrefix(s.query, "INSERT") {
+		s.d.rows = append(s.d.rows, row{args[0].(string), args[1].(int64), args[2].(string), args[3].(time.Time)})
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.queries = append(s.d.queries, s.query)
+	var matched []row
+	for _, r := range s.d.rows {
+		if (len(args) < 1 || r.name == args[0]) && (len(args) < 2 || r.version == args[1]) {
+			matched = append(matched, r)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].version < matched[j].version })
+	rows := &fakeRows{}
+	switch {
+	case strings.HasPrefix(s.query, "SELECT DISTINCT name"):
+		rows.columns = []string{"name"}
+		distinct := make(map[string]bool)
+		var names []string
+		for _, r := range matched {
+			if !distinct[r.name] {
+				distinct[r.name] = true
+				names = append(names, r.name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			rows.values = append(rows.values, []driver.Value{name})
+		}
+	case strings.HasPrefix(s.query, "SELECT COALESCE(MAX(version), 0)"):
+		rows.columns = []string{"max"}
+		var max int64
+		if len(matched) > 0 {
+			max = matched[len(matched)-1].version
+		}
+		rows.values = [][]driver.Value{{max}}
+	case strings.HasPrefix(s.query, "SELECT version, source, created"):
+		rows.columns = []string{"version", "source", "created"}
+		if strings.Contains(s.query, "DESC LIMIT 1") && len(matched) > 0 {
+			matched = matched[len(matched)-1:]
+		}
+		for _, r := range matched {
+			rows.values = append(rows.values, []driver.Value{r.version, r.source, r.created})
+		}
+	default:
+		return nil, errors.New("unexpected query " + s.query)
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestStore(t *testing.T) {
+	d := &fakeDriver{}
+	sql.Register("sqlstore-fake", d)
+	db, err := sql.Open("sqlstore-fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	store := New(db, "templates")
+	if err := store.CreateTable(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, put := range []struct{ name, source string }{
+		{"page", "{{>header}} v1"},
+		{"header", "<h1>{{title}}</h1>"},
+		{"page", "{{>header}} v2"},
+	} {
+		if _, err := store.Put(ctx, put.name, put.source); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if version, err := mustache.Rollback(ctx, store, "page", 1); err != nil || version != 3 {
+		t.Errorf("unexpected rollback to version %d, %v", version, err)
+	}
+
+	set := mustache.NewSet()
+	if err := set.ParseStore(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := set.Render("page", &b, map[string]string{"title": "Hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "<h1>Hi</h1> v1" {
+		t.Errorf("unexpected output %q", b.String())
+	}
+
+	versions, err := store.Versions(ctx, "page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sources []string
+	for _, v := range versions {
+		sources = append(sources, v.Source)
+	}
+	if expected := []string{"{{>header}} v1", "{{>header}} v2", "{{>header}} v1"}; !reflect.DeepEqual(sources, expected) {
+		t.Errorf("expected versions %q got %q", expected, sources)
+	}
+	if v, err := store.Get(ctx, "page", 2); err != nil || v.Source != "{{>header}} v2" {
+		t.Errorf("unexpected version %+v, %v", v, err)
+	}
+	if _, err := store.Get(ctx, "missing", 0); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+
+	expected := "INSERT INTO templates (name, version, source, created) VALUES ($1, $2, $3, $4)"
+	if !contains(d.queries, expected) {
+		t.Errorf("expected query %q in %q", expected, d.queries)
+	}
+	store = New(db, "templates", QuestionPlaceholders())
+	if _, err := store.Put(ctx, "page", "v4"); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "INSERT INTO templates (name, version, source, created) VALUES (?, ?, ?, ?)"; d.queries[len(d.queries)-1] != expected {
+		t.Errorf("expected query %q got %q", expected, d.queries[len(d.queries)-1])
+	}
+}
+
+func contains(queries []string, query string) bool {
+	for _, q := range queries {
+		if q == query {
+			return true
+		}
+	}
+	return false
+}
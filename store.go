@@ -0,0 +1,131 @@
+package mustache
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store persists the sources of templates by name, keeping every version of
+// them so that a template may be rolled back. Versions are numbered from 1 in
+// the order they were put. The sqlstore package implements Store with a SQL
+// database.
+type Store interface {
+	// Get returns the given version of the template name, or its latest
+	// version if version is 0. It returns an error wrapping fs.ErrNotExist if
+	// there is no such template or version.
+	Get(ctx context.Context, name string, version int) (StoredTemplate, error)
+	// List returns the sorted names of the templates of the store.
+	List(ctx context.Context) ([]string, error)
+	// Put stores source as the new latest version of the template name, and
+	// returns its version.
+	Put(ctx context.Context, name, source string) (int, error)
+	// Versions returns the versions of the template name, oldest first.
+	Versions(ctx context.Context, name string) ([]StoredTemplate, error)
+}
+
+// StoredTemplate is a version of a template of a Store.
+type StoredTemplate struct {
+	Name    string
+	Version int
+	Source  string
+	Created time.Time
+}
+
+// Rollback makes the given version of the template name its latest version
+// again, by putting its source as a new version, which it returns. The
+// history of the template is kept.
+func Rollback(ctx context.Context, store Store, name string, version int) (int, error) {
+	t, err := store.Get(ctx, name, version)
+	if err != nil {
+		return 0, err
+	}
+	return store.Put(ctx, name, t.Source)
+}
+
+// ParseStore parses the latest versions of the templates of store named by
+// names, or of all its templates if no names are given, into the set. It is
+// an error for a template to be defined already.
+func (s *TemplateSet) ParseStore(ctx context.Context, store Store, names ...string) error {
+	if len(names) == 0 {
+		var err error
+		if names, err = store.List(ctx); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		if _, ok := s.templates[name]; ok {
+			return fmt.Errorf("template %q already defined", name)
+		}
+		stored, err := store.Get(ctx, name, 0)
+		if err != nil {
+			return err
+		}
+		t := New(s.options...)
+		t.name = name
+		if err := t.ParseString(stored.Source); err != nil {
+			return fmt.Errorf("%s@%d: %w", name, stored.Version, err)
+		}
+		s.templates[name] = t
+	}
+	return nil
+}
+
+// MemoryStore is a Store keeping templates in memory, for tests and as a
+// reference for other implementations. It may be used by multiple goroutines
+// concurrently.
+type MemoryStore struct {
+	mu        sync.Mutex
+	templates map[string][]StoredTemplate
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{templates: make(map[string][]StoredTemplate)}
+}
+
+func (m *MemoryStore) Get(ctx context.Context, name string, version int) (StoredTemplate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	versions := m.templates[name]
+	if version == 0 {
+		version = len(versions)
+	}
+	if version < 1 || version > len(versions) {
+		return StoredTemplate{}, fmt.Errorf("template %q version %d: %w", name, version, fs.ErrNotExist)
+	}
+	return versions[version-1], nil
+}
+
+func (m *MemoryStore) List(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.templates))
+	for name := range m.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *MemoryStore) Put(ctx context.Context, name, source string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	version := len(m.templates[name]) + 1
+	m.templates[name] = append(m.templates[name], StoredTemplate{
+		Name:    name,
+		Version: version,
+		Source:  source,
+		Created: time.Now(),
+	})
+	return version, nil
+}
+
+func (m *MemoryStore) Versions(ctx context.Context, name string) ([]StoredTemplate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]StoredTemplate(nil), m.templates[name]...), nil
+}
@@ -0,0 +1,54 @@
+package mustache
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, source := range []string{"v1 {{name}}", "v2 {{name}}"} {
+		if _, err := store.Put(ctx, "greeting", source); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.Put(ctx, "other", "{{>greeting}}!"); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := store.List(ctx); strings.Join(names, ",") != "greeting,other" {
+		t.Errorf("unexpected names %q", names)
+	}
+	if version, err := Rollback(ctx, store, "greeting", 1); err != nil || version != 3 {
+		t.Errorf("unexpected rollback to version %d, %v", version, err)
+	}
+	if versions, _ := store.Versions(ctx, "greeting"); len(versions) != 3 || versions[2].Source != "v1 {{name}}" {
+		t.Errorf("unexpected versions %+v", versions)
+	}
+	for _, version := range []int{-1, 4} {
+		if _, err := store.Get(ctx, "greeting", version); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("version %d: expected fs.ErrNotExist, got %v", version, err)
+		}
+	}
+
+	set := NewSet()
+	if err := set.ParseStore(ctx, store, "other", "greeting"); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := set.Render("other", &b, map[string]string{"name": "Ann"}); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "v1 Ann!" {
+		t.Errorf("unexpected output %q", b.String())
+	}
+	if err := set.ParseStore(ctx, store, "other"); err == nil {
+		t.Error("expected an error for a template defined twice")
+	}
+	if err := NewSet().ParseStore(ctx, store, "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package mustache
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Validate checks that every variable referenced by the template can be found
+// in context, without rendering the template. It returns a *MissError for
+// each missing variable, in the order they appear in the template.
+//
+// Every section is entered once. Lists are represented by their first element,
+// and the contents of a section are checked whether or not it would be
+// rendered, e.g. for a false value or for every case of a switch. The contents
+// of sections whose value is missing or is an empty list are not checked, as
+// the context they would be rendered with is unknown. With MapSections, maps
+// are represented by their first entry, and empty maps are not checked.
+// Partials are checked with the context of the tag including them.
+// Errors report the position of the start of the tag.
+func (t *Template) Validate(context ...interface{}) []error {
+	v := validator{partials: make(map[string]bool)}
+	if t.captureSections {
+		v.captures = make(map[string]interface{})
+		context = append(context[:len(context):len(context)], v.captures)
+	}
+	v.template(t, context)
+	for i, err := range v.errs {
+		v.errs[i] = t.tag(err)
+	}
+	return v.errs
+}
+
+// validator looks up the variables of templates, recording the missing ones.
+type validator struct {
+	errs     []error
+	captures map[string]interface{}
+	partials map[string]bool // names of the partials being validated
+}
+
+func (v *validator) template(t *Template, c []interface{}) {
+	if t.consts != nil {
+		c = append(c[:len(c):len(c)], t.consts)
+	}
+	v.nodes(t, t.elems, c)
+}
+
+// position returns the position of the tag starting at the byte offset in the
+// source of t. It is zero if t was not parsed.
+func (t *Template) position(offset int) Position {
+	return t.starts[offset]
+}
+
+// lookup returns the value at path, recording a miss for the tag n if it is
+// missing.
+func (v *validator) lookup(t *Template, n spanned, name string, path []pathSegment, c []interface{}) interface{} {
+	value, _ := lookupPath(path, c...)
+	if value == nil {
+		pos := t.position(n.nodeSpans().outer.start)
+		v.errs = append(v.errs, &MissError{Name: name, Line: pos.Line, Col: pos.Col, Template: t.name})
+	}
+	return value
+}
+
+// first returns the representative of value used for the contents of a
+// section: the first element of a list, or value itself. It returns false for
+// an empty list.
+func first(value interface{}) (interface{}, bool) {
+	r := reflect.ValueOf(value)
+	switch r.Kind() {
+	case reflect.Slice, reflect.Array:
+		if r.Len() == 0 {
+			return nil, false
+		}
+		return r.Index(0).Interface(), true
+	}
+	return value, true
+}
+
+// sectionContext returns the context the contents of a section of t with the
+// value value are checked with: c with the representative of value pushed,
+// along with the variables the options of t bind for it. It returns false if
+// the contents are not checked.
+func sectionContext(t *Template, n *sectionNode, value interface{}, c []interface{}) ([]interface{}, bool) {
+	item, ok := first(value)
+	if value == nil || !ok {
+		return nil, false
+	}
+	r := reflect.ValueOf(value)
+	if r.Kind() == reflect.Map && t.mapSections {
+		// A map is represented by its first entry.
+		keys := sortedKeys(r)
+		if len(keys) == 0 {
+			return nil, false
+		}
+		item = r.MapIndex(keys[0]).Interface()
+		meta := map[string]interface{}{
+			"@key":   keys[0].Interface(),
+			"@value": item,
+		}
+		if t.loopVariables {
+			meta["@index"] = 0
+			meta["@first"] = true
+			meta["@last"] = len(keys) == 1
+			meta["@length"] = len(keys)
+		}
+		return push(item, push(meta, c)), true
+	}
+	paginated := n.offset > 0 || n.limit > 0
+	if (r.Kind() == reflect.Slice || r.Kind() == reflect.Array) && (t.loopVariables || paginated) {
+		meta := make(map[string]interface{}, 6)
+		if paginated {
+			meta["@total"] = r.Len()
+			meta["@more"] = 0
+		}
+		if t.loopVariables {
+			meta["@index"] = 0
+			meta["@first"] = true
+			meta["@last"] = r.Len() == 1
+			meta["@length"] = r.Len()
+		}
+		return push(item, push(meta, c)), true
+	}
+	return push(item, c), true
+}
+
+// push returns c with frame in front.
+func push(frame interface{}, c []interface{}) []interface{} {
+	return append([]interface{}{frame}, c...)
+}
+
+func (v *validator) nodes(t *Template, nodes []node, c []interface{}) {
+	for _, n := range nodes {
+		v.node(t, n, c)
+	}
+}
+
+func (v *validator) node(t *Template, n node, c []interface{}) {
+	switch n := n.(type) {
+	case *varNode:
+		if value, _ := lookupPath(n.path, c...); value == nil {
+			v.errs = append(v.errs, &MissError{Name: n.name, Line: n.line, Col: n.col, Template: t.name})
+		}
+	case *translateNode:
+		for _, b := range n.args {
+			if b.path != nil {
+				v.lookup(t, n, b.ident, b.path, c)
+			}
+		}
+	case *sectionNode:
+		value := v.lookup(t, n, n.name, n.path, c)
+		if n.inverted {
+			v.nodes(t, n.elems, c)
+		} else if inner, ok := sectionContext(t, n, value, c); ok {
+			v.nodes(t, n.elems, inner)
+		}
+	case *functionSectionNode:
+		names := make([]string, 0, len(n.optPaths)+len(n.optParts))
+		for name := range n.optPaths {
+			names = append(names, name)
+		}
+		for name := range n.optParts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if path, ok := n.optPaths[name]; ok {
+				v.lookup(t, n, pathString(path), path, c)
+			}
+			for _, part := range n.optParts[name] {
+				if part.path != nil {
+					v.lookup(t, n, pathString(part.path), part.path, c)
+				}
+			}
+		}
+		v.nodes(t, n.elems, c)
+	case *testNode:
+		v.lookup(t, n, pathString(n.testIdentPath), n.testIdentPath, c)
+		v.nodes(t, n.elems, c)
+	case *typeTestNode:
+		v.lookup(t, n, n.name, n.path, c)
+		v.nodes(t, n.elems, c)
+	case *countNode:
+		v.lookup(t, n, n.name, n.path, c)
+		v.nodes(t, n.elems, c)
+	case *chunkNode:
+		value := v.lookup(t, n, n.name, n.path, c)
+		if value == nil {
+			return
+		}
+		r := reflect.ValueOf(value)
+		row := []interface{}{value}
+		if r.Kind() == reflect.Slice || r.Kind() == reflect.Array {
+			row = nil
+			for i := 0; i < r.Len() && i < n.size; i++ {
+				row = append(row, r.Index(i).Interface())
+			}
+		}
+		if len(row) > 0 {
+			v.nodes(t, n.elems, push(row, c))
+		}
+	case *zipNode:
+		pair := make(map[string]interface{}, 2)
+		for i, path := range n.paths {
+			value := v.lookup(t, n, n.idents[i], path, c)
+			if r := reflect.ValueOf(value); (r.Kind() == reflect.Slice || r.Kind() == reflect.Array) && r.Len() > 0 {
+				pair[n.names[i]] = r.Index(0).Interface()
+			}
+		}
+		if len(pair) == 2 {
+			v.nodes(t, n.elems, push(pair, c))
+		}
+	case *switchNode:
+		v.lookup(t, n, n.name, n.path, c)
+		for _, value := range n.values {
+			v.nodes(t, n.cases[value], c)
+		}
+		v.nodes(t, n.defaultElems, c)
+	case *letNode:
+		frame := make(map[string]interface{}, len(n.bindings))
+		for _, b := range n.bindings {
+			if b.path == nil {
+				frame[b.name] = b.literal
+				continue
+			}
+			frame[b.name] = v.lookup(t, n, b.ident, b.path, push(frame, c))
+			if frame[b.name] == nil || len(b.filters) > 0 {
+				// The miss is reported once, for the binding, and filters
+				// return text.
+				frame[b.name] = ""
+			}
+		}
+		v.nodes(t, n.elems, push(frame, c))
+	case *captureNode:
+		v.nodes(t, n.elems, c)
+		if v.captures != nil {
+			v.captures[n.name] = capturedText("")
+		}
+	case *partialNode:
+		if v.partials[n.name] {
+			return
+		}
+		partial, ok := t.partials[n.name]
+		if !ok && t.partialDir != nil {
+			partial, _ = t.partialDir.load(t, n.name)
+		}
+		if partial != nil {
+			v.partials[n.name] = true
+			v.template(partial, c)
+			delete(v.partials, n.name)
+		}
+	}
+}
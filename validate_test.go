@@ -0,0 +1,81 @@
+package mustache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	item := New(Name("item"))
+	if err := item.ParseString("{{label}}{{price}}"); err != nil {
+		t.Fatal(err)
+	}
+	template := New(Name("config"), Partial(item), LetSections(), SwitchSections())
+	err := template.ParseString("{{=const region \"eu\"}}{{region}} {{host}}\n" +
+		"{{#items}}{{>item}}{{/items}}{{#empty}}{{ignored}}{{/empty}}{{#absent}}{{ignored}}{{/absent}}\n" +
+		"{{#enabled}}{{url}}{{/enabled}}{{^enabled}}{{fallback}}{{/enabled}}\n" +
+		"{{#let p=port}}{{p}}{{/let}}{{#switch mode}}{{#case \"a\"}}{{a}}{{/case}}{{#default}}{{d}}{{/default}}{{/switch}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := template.Validate(map[string]interface{}{
+		"host":    "example.com",
+		"items":   []map[string]interface{}{{"label": "a"}, {"label": "b", "price": 1}},
+		"empty":   []int{},
+		"enabled": false,
+		"url":     "https://example.com",
+		"mode":    "a",
+		"a":       1,
+	})
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+	expected := []string{
+		"item:1:9 failed to lookup price",
+		"config:2:60 failed to lookup absent",
+		"config:3:43 failed to lookup fallback",
+		"config:4:0 failed to lookup port",
+		"config:4:83 failed to lookup d",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q got %q", expected, got)
+	}
+
+	if errs := template.Validate(map[string]interface{}{
+		"host": "h", "items": []interface{}{}, "empty": []int{}, "absent": true, "ignored": 1, "enabled": true,
+		"url": "u", "fallback": "f", "port": 1, "mode": "m", "a": 1, "d": 1,
+	}); len(errs) != 0 {
+		t.Errorf("expected no errors got %v", errs)
+	}
+
+	template = New(LoopVariables())
+	if err := template.ParseString("{{#items}}{{@index}}/{{@length}}{{^@last}},{{/@last}}{{#@first}}{{/@first}}{{/items}}{{@index}}"); err != nil {
+		t.Fatal(err)
+	}
+	errs = template.Validate(map[string]interface{}{"items": []int{1, 2}})
+	if len(errs) != 1 || errs[0].Error() != "1:85 failed to lookup @index" {
+		t.Errorf("expected only the loop variable outside the section to be missing, got %v", errs)
+	}
+
+	template = New(MapSections(), LoopVariables())
+	if err := template.ParseString("{{#headers}}{{@key}}: {{@value}}{{^@last}},{{/@last}}{{/headers}}{{#empty}}{{x}}{{/empty}}{{@key}}"); err != nil {
+		t.Fatal(err)
+	}
+	errs = template.Validate(map[string]interface{}{
+		"headers": map[string]string{"b": "2", "a": "1"},
+		"empty":   map[string]int{},
+	})
+	if len(errs) != 1 || errs[0].Error() != "1:90 failed to lookup @key" {
+		t.Errorf("expected only the key outside the section to be missing, got %v", errs)
+	}
+
+	template = New(PaginateSections())
+	if err := template.ParseString(`{{#items offset="1"}}{{.}}{{#@more}}+{{@more}}/{{@total}}{{/@more}}{{/items}}{{#items}}{{@more}}{{/items}}`); err != nil {
+		t.Fatal(err)
+	}
+	errs = template.Validate(map[string]interface{}{"items": []int{1, 2}})
+	if len(errs) != 1 || errs[0].Error() != "1:87 failed to lookup @more" {
+		t.Errorf("expected only the count outside a paginated section to be missing, got %v", errs)
+	}
+}
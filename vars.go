@@ -0,0 +1,251 @@
+package mustache
+
+import (
+	"sort"
+	"strings"
+)
+
+// Vars returns the identifiers referenced by the variable, section and test
+// tags of the template, in order of first appearance. Identifiers inside
+// sections are returned as written, relative to the section. The implicit
+// iterator "." and names defined by the template itself, such as constants,
+// let bindings or the variables of LoopVariables, MapSections and paginated
+// sections within sections, are left out.
+func (t *Template) Vars() []string {
+	v := newVarCollector(false)
+	v.template(t)
+	return v.names
+}
+
+// VarsRecursive is like Vars, including the identifiers referenced by the
+// partials of the template and their partials in turn.
+func (t *Template) VarsRecursive() []string {
+	v := newVarCollector(true)
+	v.template(t)
+	return v.names
+}
+
+// Partials returns the names of the partials referenced by the template, in
+// order of first appearance.
+func (t *Template) Partials() []string {
+	v := newVarCollector(false)
+	v.template(t)
+	return v.partials
+}
+
+// MissingPartials returns the names of the partials referenced by the
+// template, or by its partials in turn, which are not registered with it and
+// can not be loaded. Rendering such a template renders nothing in place of the
+// missing partials, so this allows validating templates before using them.
+func (t *Template) MissingPartials() []string {
+	v := newVarCollector(true)
+	v.template(t)
+	return v.missing
+}
+
+// varCollector walks parse trees collecting referenced identifiers and
+// partials.
+type varCollector struct {
+	recursive bool
+	seen      map[string]bool
+	names     []string
+	defined   map[string]bool // names defined for the rest of the template
+	visited   map[*Template]bool
+	root      *Template            // the template the walk started at
+	shared    map[string]*Template // partials shared by a template set
+	partials  []string
+	missing   []string
+}
+
+func newVarCollector(recursive bool) *varCollector {
+	return &varCollector{
+		recursive: recursive,
+		seen:      make(map[string]bool),
+		defined:   make(map[string]bool),
+		visited:   make(map[*Template]bool),
+	}
+}
+
+func (v *varCollector) template(t *Template) {
+	if v.visited[t] {
+		return
+	}
+	v.visited[t] = true
+	if v.root == nil {
+		v.root = t
+	}
+	for name := range t.consts {
+		v.defined[name] = true
+	}
+	v.nodes(t, t.elems, nil)
+}
+
+// add records ident unless it refers to a name bound in scope.
+func (v *varCollector) add(ident string, path []pathSegment, bound map[string]bool) {
+	if ident == "." || ident == "*" || v.seen[ident] {
+		return
+	}
+	if len(path) > 0 && !path[0].quoted && (bound[path[0].key] || v.defined[path[0].key]) {
+		return
+	}
+	v.seen[ident] = true
+	v.names = append(v.names, ident)
+}
+
+// loopVariableNames are the names bound in sections by LoopVariables.
+var loopVariableNames = []string{"@index", "@first", "@last", "@length"}
+
+// bind returns a copy of bound extended with names.
+func bind(bound map[string]bool, names ...string) map[string]bool {
+	b := make(map[string]bool, len(bound)+len(names))
+	for name := range bound {
+		b[name] = true
+	}
+	for _, name := range names {
+		b[name] = true
+	}
+	return b
+}
+
+func (v *varCollector) nodes(t *Template, nodes []node, bound map[string]bool) {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *varNode:
+			v.add(n.name, n.path, bound)
+		case *coalesceNode:
+			for _, arg := range n.args {
+				if arg.path != nil {
+					v.add(arg.ident, arg.path, bound)
+				}
+			}
+		case *translateNode:
+			for _, b := range n.args {
+				if b.path != nil {
+					v.add(b.ident, b.path, bound)
+				}
+			}
+		case *sectionNode:
+			v.add(n.name, n.path, bound)
+			inner := bound
+			if !n.inverted && t.loopVariables {
+				inner = bind(inner, loopVariableNames...)
+			}
+			if !n.inverted && t.mapSections {
+				inner = bind(inner, "@key", "@value")
+			}
+			if !n.inverted && (n.offset > 0 || n.limit > 0) {
+				inner = bind(inner, "@total", "@more")
+			}
+			v.nodes(t, n.elems, inner)
+		case *functionSectionNode:
+			keys := make([]string, 0, len(n.optPaths)+len(n.optParts))
+			for k := range n.optPaths {
+				keys = append(keys, k)
+			}
+			for k := range n.optParts {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if path, ok := n.optPaths[k]; ok {
+					v.add(pathString(path), path, bound)
+				}
+				for _, part := range n.optParts[k] {
+					if part.path != nil {
+						v.add(pathString(part.path), part.path, bound)
+					}
+				}
+			}
+			v.nodes(t, n.elems, bound)
+		case *testNode:
+			v.add(pathString(n.testIdentPath), n.testIdentPath, bound)
+			v.nodes(t, n.elems, bound)
+		case *typeTestNode:
+			v.add(n.name, n.path, bound)
+			v.nodes(t, n.elems, bound)
+		case *countNode:
+			v.add(n.name, n.path, bound)
+			v.nodes(t, n.elems, bound)
+		case *chunkNode:
+			v.add(n.name, n.path, bound)
+			v.nodes(t, n.elems, bound)
+		case *zipNode:
+			v.add(n.idents[0], n.paths[0], bound)
+			v.add(n.idents[1], n.paths[1], bound)
+			v.nodes(t, n.elems, bind(bound, n.names[0], n.names[1]))
+		case *switchNode:
+			v.add(n.name, n.path, bound)
+			for _, value := range n.values {
+				v.nodes(t, n.cases[value], bound)
+			}
+			v.nodes(t, n.defaultElems, bound)
+		case *letNode:
+			inner := bound
+			for _, b := range n.bindings {
+				if b.path != nil {
+					v.add(b.ident, b.path, inner)
+				}
+				inner = bind(inner, b.name)
+			}
+			v.nodes(t, n.elems, inner)
+		case *captureNode:
+			v.nodes(t, n.elems, bound)
+			v.defined[n.name] = true
+		case *partialNode:
+			if !v.recursive {
+				if !contains(v.partials, n.name) {
+					v.partials = append(v.partials, n.name)
+				}
+				continue
+			}
+			if p := v.resolve(t, n.name); p != nil {
+				v.template(p)
+			} else if !contains(v.missing, n.name) {
+				v.missing = append(v.missing, n.name)
+			}
+		}
+	}
+}
+
+// resolve returns the partial name as it would be found when rendering t as
+// part of the root template, or nil.
+func (v *varCollector) resolve(t *Template, name string) *Template {
+	if p, ok := t.partials[name]; ok {
+		return p
+	}
+	if p, ok := v.root.partials[name]; ok {
+		return p
+	}
+	if p, ok := v.shared[name]; ok {
+		return p
+	}
+	if t.partialDir != nil {
+		if p, err := t.partialDir.load(t, name); err == nil {
+			return p
+		}
+	}
+	return nil
+}
+
+// contains reports whether s is in list.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// pathString formats path as it would be written in a tag.
+func pathString(path []pathSegment) string {
+	segments := make([]string, len(path))
+	for i, seg := range path {
+		if seg.quoted {
+			segments[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(seg.key) + `"`
+		} else {
+			segments[i] = seg.key
+		}
+	}
+	return strings.Join(segments, ".")
+}
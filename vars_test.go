@@ -0,0 +1,106 @@
+package mustache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVars(t *testing.T) {
+	for _, test := range []struct {
+		template string
+		options  []Option
+		expected []string
+	}{
+		{
+			"Hello {{name}}, {{#items}}{{.}} {{label}}{{/items}}{{^items}}{{name}}{{/items}}",
+			nil,
+			[]string{"name", "items", "label"},
+		},
+		{
+			`{{#test_value {{status}} "ok"}}{{a."b.c"}}{{/test_value}}{{~date tz={{user.tz}} layout="{{user.layout}} Z"}}{{at}}{{/date}}`,
+			[]Option{TestValueSection()},
+			[]string{"status", `a."b.c"`, "user.layout", "user.tz", "at"},
+		},
+		{
+			`{{=const url "x"}}{{url}}{{#let total=order.total}}{{total}} {{other}}{{/let}}{{total}}`,
+			[]Option{LetSections()},
+			[]string{"order.total", "other", "total"},
+		},
+		{
+			`{{#zip labels values}}{{@a}}{{@b}}{{/zip}}{{#capture c}}{{x}}{{/capture}}{{c}}{{coalesce nick name "there"}}`,
+			[]Option{ZipSections(), CaptureSections(), CoalesceTags()},
+			[]string{"labels", "values", "x", "nick", "name"},
+		},
+		{
+			`{{#items}}{{@index}}{{^@last}},{{/@last}}{{/items}}{{@length}}`,
+			[]Option{LoopVariables()},
+			[]string{"items", "@length"},
+		},
+		{
+			`{{#headers}}{{@key}}: {{@value}} {{name}}{{/headers}}{{@key}}`,
+			[]Option{MapSections()},
+			[]string{"headers", "name", "@key"},
+		},
+		{
+			`{{#items limit="2"}}{{.}}{{#@more}}+{{@more}}{{/@more}}{{/items}}{{@total}}`,
+			[]Option{PaginateSections()},
+			[]string{"items", "@total"},
+		},
+	} {
+		template := New(test.options...)
+		if err := template.ParseString(test.template); err != nil {
+			t.Fatal(err)
+		}
+		if vars := template.Vars(); !reflect.DeepEqual(vars, test.expected) {
+			t.Errorf("%s: expected %q got %q", test.template, test.expected, vars)
+		}
+	}
+}
+
+func TestVarsRecursive(t *testing.T) {
+	header := New(Name("header"))
+	if err := header.ParseString("{{title}}{{>body}}"); err != nil {
+		t.Fatal(err)
+	}
+	body := New(Name("body"))
+	if err := body.ParseString("{{content}}{{>header}}"); err != nil {
+		t.Fatal(err)
+	}
+	header.Option(Partial(body))
+	body.Option(Partial(header))
+	template := New(Partial(header))
+	if err := template.ParseString("{{>header}}{{footer}}"); err != nil {
+		t.Fatal(err)
+	}
+	if vars := template.Vars(); !reflect.DeepEqual(vars, []string{"footer"}) {
+		t.Errorf("expected [footer] got %q", vars)
+	}
+	expected := []string{"title", "content", "footer"}
+	if vars := template.VarsRecursive(); !reflect.DeepEqual(vars, expected) {
+		t.Errorf("expected %q got %q", expected, vars)
+	}
+}
+
+func TestPartials(t *testing.T) {
+	header := New(Name("header"))
+	if err := header.ParseString("{{title}}{{>logo}}{{>nav}}"); err != nil {
+		t.Fatal(err)
+	}
+	template := New(Partial(header))
+	if err := template.ParseString("{{>header}}{{#items}}{{>item}}{{/items}}{{>header}}"); err != nil {
+		t.Fatal(err)
+	}
+	if partials := template.Partials(); !reflect.DeepEqual(partials, []string{"header", "item"}) {
+		t.Errorf("expected [header item] got %q", partials)
+	}
+	expected := []string{"logo", "nav", "item"}
+	if missing := template.MissingPartials(); !reflect.DeepEqual(missing, expected) {
+		t.Errorf("expected %q got %q", expected, missing)
+	}
+
+	// Partials of the root template are found when rendering partials too.
+	template.Option(Partial(New(Name("logo"))), Partial(New(Name("nav"))), Partial(New(Name("item"))))
+	if missing := template.MissingPartials(); len(missing) != 0 {
+		t.Errorf("expected no missing partials got %q", missing)
+	}
+}
@@ -2,8 +2,9 @@ package mustache
 
 import (
 	"bufio"
-	"bytes"
+	"context"
 	"io"
+	"strings"
 )
 
 type writer struct {
@@ -11,6 +12,29 @@ type writer struct {
 	hasTag  bool
 	w       io.Writer
 	b       *bufio.Writer
+	state   *renderState
+}
+
+// renderState holds the state shared by all writers taking part in a single
+// render.
+type renderState struct {
+	ctx           context.Context
+	limit         *limitWriter
+	partials      map[string]*Template   // partials of the template being rendered
+	lazy          *lazyTemplates         // partials parsed on first use, see Provide
+	partialChain  map[string]bool        // names of the partials being rendered
+	captures      map[string]interface{} // output of capture sections by name
+	lineReport    *LineReport            // changes made in single line mode
+	warnings      *[]Warning             // soft issues, recorded by RenderResult
+	memo          map[memoKey]memoValue  // lookups made so far, with MemoizeLookups
+	maxIterations int
+	maxDepth      int
+	flushDepth    int          // the depth of the sections flushing the destination
+	flusher       func() error // flushes the destination, if it can be flushed
+	iterations    int
+	depth         int
+	writeErr      *WriteError // the first error of the underlying writer
+	err           error
 }
 
 func newWriter(w io.Writer) *writer {
@@ -19,7 +43,183 @@ func newWriter(w io.Writer) *writer {
 		hasTag:  false,
 		w:       w,
 		b:       bufio.NewWriter(w),
+		state:   &renderState{ctx: context.Background(), partialChain: make(map[string]bool)},
+	}
+}
+
+// sub returns a new writer to w which shares the render state of the writer.
+func (w *writer) sub(to io.Writer) *writer {
+	s := newWriter(to)
+	s.state = w.state
+	return s
+}
+
+// setLimit restricts the number of bytes written to the underlying writer to
+// n. Writes beyond the limit fail with an *OutputLimitError.
+func (w *writer) setLimit(n int64) {
+	w.state.limit = &limitWriter{w: w.w, n: n, max: n}
+	w.w = w.state.limit
+	w.b.Reset(w.w)
+}
+
+// checkWrites makes the writer keep the first error of the underlying writer
+// in the render state, from where it aborts the render. Later writes fail
+// with the same error without reaching the underlying writer.
+func (w *writer) checkWrites() {
+	w.w = &errWriter{w: w.w, state: w.state}
+	w.b.Reset(w.w)
+}
+
+// abort returns a non-nil error if rendering should stop, either because the
+// render context is done, the underlying writer failed or a limit has been
+// exceeded.
+func (w *writer) abort() error {
+	if err := w.state.ctx.Err(); err != nil {
+		return err
+	}
+	if w.state.writeErr != nil {
+		return w.state.writeErr
+	}
+	if w.state.limit != nil && w.state.limit.err != nil {
+		return w.state.limit.err
+	}
+	return w.state.err
+}
+
+// enter records that rendering descends into a section or partial. It returns
+// a *DepthLimitError if this exceeds the maximum depth. Every call to enter
+// must be matched by a call to leave.
+func (w *writer) enter() error {
+	w.state.depth++
+	if w.state.maxDepth > 0 && w.state.depth > w.state.maxDepth {
+		w.state.err = &DepthLimitError{Limit: w.state.maxDepth}
+		return w.state.err
+	}
+	return nil
+}
+
+// leave records that rendering returns from a section or partial.
+func (w *writer) leave() {
+	w.state.depth--
+}
+
+// flushSection flushes the destination of the render at the end of a section,
+// if the section is nested at most the flush depth deep. A failure to flush
+// is kept like an error of the underlying writer.
+func (w *writer) flushSection() error {
+	if w.state.flusher == nil || w.state.depth > w.state.flushDepth || w.state.writeErr != nil {
+		return nil
+	}
+	if err := w.state.flusher(); err != nil {
+		w.state.writeErr = &WriteError{Err: err}
+		return w.state.writeErr
+	}
+	return nil
+}
+
+// iterate records a single iteration of a section. It returns an
+// *IterationLimitError if this exceeds the maximum number of iterations.
+func (w *writer) iterate() error {
+	w.state.iterations++
+	if w.state.maxIterations > 0 && w.state.iterations > w.state.maxIterations {
+		w.state.err = &IterationLimitError{Limit: w.state.maxIterations}
+		return w.state.err
 	}
+	return nil
+}
+
+// memoKey identifies a lookup of a name in a context chain. The chain is
+// identified by the address of its first frame and its length, as the chains
+// built while rendering are never modified. The key keeps the chain alive, so
+// its address is not reused by another chain during the render.
+type memoKey struct {
+	name  string
+	frame *interface{}
+	n     int
+}
+
+type memoValue struct {
+	v  interface{}
+	ok bool
+}
+
+// lookup returns the value at path, the path of name, in the context chain c.
+// The lookups of a render are memoized if its template has MemoizeLookups.
+func (w *writer) lookup(name string, path []pathSegment, c []interface{}) (interface{}, bool) {
+	if w.state.memo == nil {
+		return lookupPath(path, c...)
+	}
+	key := memoKey{name: name, n: len(c)}
+	if len(c) > 0 {
+		key.frame = &c[0]
+	}
+	if m, ok := w.state.memo[key]; ok {
+		return m.v, m.ok
+	}
+	v, ok := lookupPath(path, c...)
+	w.state.memo[key] = memoValue{v, ok}
+	return v, ok
+}
+
+// errWriter records the first error returned by w, or io.ErrShortWrite if w
+// writes fewer bytes than given, as a *WriteError in the render state.
+type errWriter struct {
+	w     io.Writer
+	state *renderState
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	if e.state.writeErr != nil {
+		return 0, e.state.writeErr
+	}
+	n, err := e.w.Write(p)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		e.state.writeErr = &WriteError{Err: err}
+		return n, e.state.writeErr
+	}
+	return n, nil
+}
+
+// writeAll writes p to w with a single call to its Write method, returning a
+// *WriteError if it fails or writes fewer bytes than p.
+func writeAll(w io.Writer, p []byte) error {
+	n, err := w.Write(p)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		return &WriteError{Err: err}
+	}
+	return nil
+}
+
+// limitWriter writes at most n bytes to w and fails after that.
+type limitWriter struct {
+	w   io.Writer
+	n   int64
+	max int64
+	err error
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	if int64(len(p)) > l.n {
+		n, err := l.w.Write(p[:l.n])
+		l.n -= int64(n)
+		if err == nil {
+			err = &OutputLimitError{Limit: l.max}
+		}
+		l.err = err
+		return n, err
+	}
+	n, err := l.w.Write(p)
+	l.n -= int64(n)
+	return n, err
 }
 
 func (w *writer) text() {
@@ -44,23 +244,31 @@ func (w *writer) flush() error {
 	return w.b.Flush()
 }
 
-func (w *writer) write(r rune) error {
-	_, err := w.b.WriteRune(r)
-	if err != nil {
-		return err
-	}
-	if r == '\n' {
-		return w.flush()
+// WriteString writes s, flushing the line written so far after each line
+// break. The text between line breaks is written at once.
+func (w *writer) WriteString(s string) (int, error) {
+	n := 0
+	for s != "" {
+		line := s
+		i := strings.IndexByte(s, '\n')
+		if i >= 0 {
+			line = s[:i+1]
+		}
+		m, err := w.b.WriteString(line)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		s = s[len(line):]
+		if i >= 0 {
+			if err := w.flush(); err != nil {
+				return n, err
+			}
+		}
 	}
-	return nil
+	return n, nil
 }
 
 func (w *writer) Write(b []byte) (int, error) {
-	for i, r := range bytes.Runes(b) {
-		err := w.write(r)
-		if err != nil {
-			return i, err
-		}
-	}
-	return len(b), nil
+	return w.WriteString(string(b))
 }
@@ -2,6 +2,8 @@ package mustache
 
 import (
 	"bytes"
+	"io"
+	"strings"
 	"testing"
 )
 
@@ -14,17 +16,15 @@ func TestWriter(t *testing.T) {
 	}{
 		{true, true, "some text\n", "some text\n"},
 		{false, true, "  {{#standalone}}\n here.", " here."},
+		{false, true, "  {{#standalone}}\r\n here.", " here."},
 		{false, false, "print this\n and this", "print this\n and this"},
 	} {
 		b := bytes.NewBuffer(nil)
 		w := newWriter(b)
 		w.hasText = test.text
 		w.hasTag = test.tag
-		for _, r := range test.input {
-			err := w.write(r)
-			if err != nil {
-				t.Errorf("write error %q", err)
-			}
+		if _, err := w.WriteString(test.input); err != nil {
+			t.Errorf("write error %q", err)
 		}
 		w.flush()
 		if b.String() != test.expected {
@@ -32,3 +32,18 @@ func TestWriter(t *testing.T) {
 		}
 	}
 }
+
+func BenchmarkRenderText(b *testing.B) {
+	template := New()
+	err := template.ParseString(strings.Repeat("Lorem ipsum dolor sit amet, consectetur adipiscing elit.\n  {{name}} sed do eiusmod tempor.\n", 100))
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := map[string]string{"name": "Ann"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := template.Render(io.Discard, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}